@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+const adminCommand = "admin"
+
+// the commands an operator can submit, they are applied in order with the orders of the product
+var adminActions = map[string]match.CommandType{
+	"halt":       match.CommandTypeHalt,
+	"resume":     match.CommandTypeResume,
+	"expire":     match.CommandTypeExpire,
+	"cancel-all": match.CommandTypeCancelAll,
+}
+
+// gbe admin: submits an admin command to the order topic of a product
+func runAdmin(args []string) error {
+	flags := flag.NewFlagSet(adminCommand, flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %v %v [flags] %v\n", os.Args[0], adminCommand,
+			strings.Join(adminActionNames(), "|"))
+		flags.PrintDefaults()
+	}
+	configPath := flags.String("config", conf.DefaultConfigPath, "path of the config file")
+	productId := flags.String("product", "", "id of the product (required)")
+	maker := flags.String("maker", "", "address of the maker whose orders are cancelled, for cancel-all")
+	reason := flags.String("reason", "", "done reason of the orders cancelled by cancel-all, cancelled when empty")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New(fmt.Sprintf("expected one of %v", strings.Join(adminActionNames(), ", ")))
+	}
+	commandType, found := adminActions[flags.Arg(0)]
+	if !found {
+		return errors.New(fmt.Sprintf("unknown action %q, expected one of %v", flags.Arg(0),
+			strings.Join(adminActionNames(), ", ")))
+	}
+
+	if len(*productId) == 0 {
+		return errors.New("-product is required")
+	}
+	product, err := service.GetProductById(*productId)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return errors.New(fmt.Sprintf("product not found: %v", *productId))
+	}
+
+	command := match.NewCommand(commandType, "")
+	if commandType == match.CommandTypeCancelAll {
+		if !common.IsHexAddress(*maker) {
+			return errors.New(fmt.Sprintf("-maker %q is not an address", *maker))
+		}
+		command = match.NewCancelAllCommand(*maker, models.DoneReason(*reason), "")
+	}
+
+	conf.SetConfigPath(*configPath)
+	gbeConfig, err := conf.LoadConfig()
+	if err != nil {
+		return err
+	}
+	err = gbeConfig.Validate(conf.SectionKafka)
+	if err != nil {
+		return err
+	}
+
+	err = match.SubmitCommand(product.Id, command)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%v submitted to product %v\n", flags.Arg(0), product.Id)
+	return nil
+}
+
+func adminActionNames() []string {
+	var names []string
+	for name := range adminActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
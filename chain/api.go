@@ -0,0 +1,52 @@
+package chain
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// 用于读取链上状态，判断maker是否有足够的资金完成订单
+type ChainStateProvider interface {
+	// 获取owner持有的ERC20 token余额
+	GetBalance(token common.Address, owner common.Address) (*big.Int, error)
+
+	// 获取owner授权给0x ERC20 proxy的token额度
+	GetAllowance(token common.Address, owner common.Address) (*big.Int, error)
+
+	// 获取订单在exchange合约中已经成交的takerAssetAmount
+	GetFilledAmount(orderHash common.Hash) (*big.Int, error)
+
+	// 获取订单是否已经在exchange合约中取消
+	IsCancelled(orderHash common.Hash) (bool, error)
+
+	// 获取最新的区块高度，区块高度不变时链上状态也不会变化
+	GetBlockNumber() (uint64, error)
+
+	// 一次读取多个订单的成交数量和取消状态，以及多个账户的余额和授权额度。
+	// Ethereum节点使用JSON-RPC batch请求读取，检查大量订单时不需要为每个值发送一个请求
+	GetStates(orderHashes []common.Hash, accounts []TokenAccount) (*States, error)
+}
+
+// 持有ERC20 token的账户
+type TokenAccount struct {
+	Token common.Address
+	Owner common.Address
+}
+
+// GetStates读取的链上状态，包含请求的每个订单和账户
+type States struct {
+	Filled     map[common.Hash]*big.Int
+	Cancelled  map[common.Hash]bool
+	Balances   map[TokenAccount]*big.Int
+	Allowances map[TokenAccount]*big.Int
+}
+
+func newStates() *States {
+	return &States{
+		Filled:     map[common.Hash]*big.Int{},
+		Cancelled:  map[common.Hash]bool{},
+		Balances:   map[TokenAccount]*big.Int{},
+		Allowances: map[TokenAccount]*big.Int{},
+	}
+}
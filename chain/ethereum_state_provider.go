@@ -0,0 +1,180 @@
+package chain
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	callTimeout = 10 * time.Second
+
+	// eth_calls sent in one JSON-RPC batch, nodes limit the size of a batch
+	maxBatchCalls = 500
+)
+
+// EthereumStateProvider reads the chain state from an Ethereum node through JSON-RPC eth_call
+type EthereumStateProvider struct {
+	rpcClient         *rpc.Client
+	client            *ethclient.Client
+	exchangeAddress   common.Address
+	erc20ProxyAddress common.Address
+}
+
+func NewEthereumStateProvider(rpcUrl string, exchangeAddress, erc20ProxyAddress string) (*EthereumStateProvider, error) {
+	rpcClient, err := rpc.Dial(rpcUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EthereumStateProvider{
+		rpcClient:         rpcClient,
+		client:            ethclient.NewClient(rpcClient),
+		exchangeAddress:   common.HexToAddress(exchangeAddress),
+		erc20ProxyAddress: common.HexToAddress(erc20ProxyAddress),
+	}, nil
+}
+
+func (p *EthereumStateProvider) GetBalance(token common.Address, owner common.Address) (*big.Int, error) {
+	var balance *big.Int
+	err := p.call(token, zeroex.ERC20ABI, &balance, "balanceOf", owner)
+	return balance, err
+}
+
+func (p *EthereumStateProvider) GetAllowance(token common.Address, owner common.Address) (*big.Int, error) {
+	var allowance *big.Int
+	err := p.call(token, zeroex.ERC20ABI, &allowance, "allowance", owner, p.erc20ProxyAddress)
+	return allowance, err
+}
+
+func (p *EthereumStateProvider) GetFilledAmount(orderHash common.Hash) (*big.Int, error) {
+	var filled *big.Int
+	err := p.call(p.exchangeAddress, zeroex.ExchangeABI, &filled, "filled", orderHash)
+	return filled, err
+}
+
+func (p *EthereumStateProvider) IsCancelled(orderHash common.Hash) (bool, error) {
+	var cancelled bool
+	err := p.call(p.exchangeAddress, zeroex.ExchangeABI, &cancelled, "cancelled", orderHash)
+	return cancelled, err
+}
+
+func (p *EthereumStateProvider) GetBlockNumber() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+	return p.client.BlockNumber(ctx)
+}
+
+func (p *EthereumStateProvider) GetStates(orderHashes []common.Hash, accounts []TokenAccount) (*States, error) {
+	filled := make([]*big.Int, len(orderHashes))
+	cancelled := make([]bool, len(orderHashes))
+	balances := make([]*big.Int, len(accounts))
+	allowances := make([]*big.Int, len(accounts))
+
+	var calls []*contractCall
+	for i, orderHash := range orderHashes {
+		calls = append(calls,
+			&contractCall{p.exchangeAddress, zeroex.ExchangeABI, &filled[i], "filled", []interface{}{orderHash}},
+			&contractCall{p.exchangeAddress, zeroex.ExchangeABI, &cancelled[i], "cancelled", []interface{}{orderHash}})
+	}
+	for i, account := range accounts {
+		calls = append(calls,
+			&contractCall{account.Token, zeroex.ERC20ABI, &balances[i], "balanceOf", []interface{}{account.Owner}},
+			&contractCall{account.Token, zeroex.ERC20ABI, &allowances[i], "allowance",
+				[]interface{}{account.Owner, p.erc20ProxyAddress}})
+	}
+	for start := 0; start < len(calls); start += maxBatchCalls {
+		end := start + maxBatchCalls
+		if end > len(calls) {
+			end = len(calls)
+		}
+		err := p.batchCall(calls[start:end])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	states := newStates()
+	for i, orderHash := range orderHashes {
+		states.Filled[orderHash] = filled[i]
+		states.Cancelled[orderHash] = cancelled[i]
+	}
+	for i, account := range accounts {
+		states.Balances[account] = balances[i]
+		states.Allowances[account] = allowances[i]
+	}
+	return states, nil
+}
+
+// contractCall is an eth_call of a constant method whose single output is unpacked into result
+type contractCall struct {
+	contract    common.Address
+	contractABI abi.ABI
+	result      interface{}
+	method      string
+	args        []interface{}
+}
+
+// eth_call the contract calls at the latest block in one JSON-RPC batch
+func (p *EthereumStateProvider) batchCall(calls []*contractCall) error {
+	outputs := make([]hexutil.Bytes, len(calls))
+	elems := make([]rpc.BatchElem, len(calls))
+	for i, call := range calls {
+		input, err := call.contractABI.Pack(call.method, call.args...)
+		if err != nil {
+			return err
+		}
+		elems[i] = rpc.BatchElem{
+			Method: "eth_call",
+			Args: []interface{}{
+				map[string]interface{}{"to": call.contract, "data": hexutil.Bytes(input)},
+				"latest",
+			},
+			Result: &outputs[i],
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	err := p.rpcClient.BatchCallContext(ctx, elems)
+	if err != nil {
+		return err
+	}
+	for i, call := range calls {
+		if elems[i].Error != nil {
+			return elems[i].Error
+		}
+		err = call.contractABI.UnpackIntoInterface(call.result, call.method, outputs[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// eth_call a constant method of the contract at the latest block, and unpack its single output into result
+func (p *EthereumStateProvider) call(contract common.Address, contractABI abi.ABI, result interface{},
+	method string, args ...interface{}) error {
+	input, err := contractABI.Pack(method, args...)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), callTimeout)
+	defer cancel()
+
+	output, err := p.client.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: input}, nil)
+	if err != nil {
+		return err
+	}
+	return contractABI.UnpackIntoInterface(result, method, output)
+}
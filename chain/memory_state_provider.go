@@ -0,0 +1,110 @@
+package chain
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// MemoryStateProvider keeps the chain state in memory, it is used as a fixture in tests and local
+// environments without an Ethereum node. Everything not set is zero, and every change of the state
+// is mined in a new block.
+type MemoryStateProvider struct {
+	mu          sync.RWMutex
+	blockNumber uint64
+	balances    map[TokenAccount]*big.Int
+	allowances  map[TokenAccount]*big.Int
+	filled      map[common.Hash]*big.Int
+	cancelled   map[common.Hash]bool
+}
+
+func NewMemoryStateProvider() *MemoryStateProvider {
+	return &MemoryStateProvider{
+		balances:   map[TokenAccount]*big.Int{},
+		allowances: map[TokenAccount]*big.Int{},
+		filled:     map[common.Hash]*big.Int{},
+		cancelled:  map[common.Hash]bool{},
+	}
+}
+
+func (p *MemoryStateProvider) GetBalance(token common.Address, owner common.Address) (*big.Int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return valueOrZero(p.balances[TokenAccount{token, owner}]), nil
+}
+
+func (p *MemoryStateProvider) GetAllowance(token common.Address, owner common.Address) (*big.Int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return valueOrZero(p.allowances[TokenAccount{token, owner}]), nil
+}
+
+func (p *MemoryStateProvider) GetFilledAmount(orderHash common.Hash) (*big.Int, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return valueOrZero(p.filled[orderHash]), nil
+}
+
+func (p *MemoryStateProvider) IsCancelled(orderHash common.Hash) (bool, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cancelled[orderHash], nil
+}
+
+func (p *MemoryStateProvider) GetBlockNumber() (uint64, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.blockNumber, nil
+}
+
+func (p *MemoryStateProvider) GetStates(orderHashes []common.Hash, accounts []TokenAccount) (*States, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	states := newStates()
+	for _, orderHash := range orderHashes {
+		states.Filled[orderHash] = valueOrZero(p.filled[orderHash])
+		states.Cancelled[orderHash] = p.cancelled[orderHash]
+	}
+	for _, account := range accounts {
+		states.Balances[account] = valueOrZero(p.balances[account])
+		states.Allowances[account] = valueOrZero(p.allowances[account])
+	}
+	return states, nil
+}
+
+func (p *MemoryStateProvider) SetBalance(token common.Address, owner common.Address, balance *big.Int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.balances[TokenAccount{token, owner}] = new(big.Int).Set(balance)
+	p.blockNumber++
+}
+
+func (p *MemoryStateProvider) SetAllowance(token common.Address, owner common.Address, allowance *big.Int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.allowances[TokenAccount{token, owner}] = new(big.Int).Set(allowance)
+	p.blockNumber++
+}
+
+func (p *MemoryStateProvider) SetFilledAmount(orderHash common.Hash, filled *big.Int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.filled[orderHash] = new(big.Int).Set(filled)
+	p.blockNumber++
+}
+
+func (p *MemoryStateProvider) SetCancelled(orderHash common.Hash, cancelled bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.cancelled[orderHash] = cancelled
+	p.blockNumber++
+}
+
+func valueOrZero(value *big.Int) *big.Int {
+	if value == nil {
+		return new(big.Int)
+	}
+	return new(big.Int).Set(value)
+}
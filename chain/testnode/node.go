@@ -0,0 +1,337 @@
+package testnode
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/zimengpan/go-boomflow/chain"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+// Node is an in-process stand-in of an Ethereum node for tests. It serves the JSON-RPC methods used by the
+// relayer against an in-memory state: ERC20 balanceOf/allowance and 0x filled/cancelled through eth_call,
+// and transactions that are mined immediately, each in its own block. Exchange transactions only update the
+// filled amounts of their orders, token balances are only moved by ERC20 transfer.
+type Node struct {
+	// the state read by eth_call, set by the tests
+	State *chain.MemoryStateProvider
+
+	chainId           int64
+	exchangeAddress   common.Address
+	erc20ProxyAddress common.Address
+	signer            types.Signer
+
+	mu           sync.Mutex
+	nonces       map[common.Address]uint64
+	transactions []*types.Transaction
+	receipts     map[common.Hash]*types.Receipt
+
+	server   *rpc.Server
+	listener net.Listener
+}
+
+func NewNode(chainId int64, exchangeAddress, erc20ProxyAddress string) *Node {
+	n := &Node{
+		State:             chain.NewMemoryStateProvider(),
+		chainId:           chainId,
+		exchangeAddress:   common.HexToAddress(exchangeAddress),
+		erc20ProxyAddress: common.HexToAddress(erc20ProxyAddress),
+		signer:            types.NewEIP155Signer(big.NewInt(chainId)),
+		nonces:            map[common.Address]uint64{},
+		receipts:          map[common.Hash]*types.Receipt{},
+		server:            rpc.NewServer(),
+	}
+
+	err := n.server.RegisterName("eth", &ethService{n})
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Start serves JSON-RPC over HTTP on a random local port and returns its url
+func (n *Node) Start() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	n.listener = listener
+
+	go func() {
+		_ = http.Serve(listener, n.server)
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+func (n *Node) Stop() {
+	if n.listener != nil {
+		_ = n.listener.Close()
+	}
+	n.server.Stop()
+}
+
+// DialInProc returns a client connected to the node without going through the network
+func (n *Node) DialInProc() *rpc.Client {
+	return rpc.DialInProc(n.server)
+}
+
+// GetTransactions returns all the transactions mined so far
+func (n *Node) GetTransactions() []*types.Transaction {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]*types.Transaction{}, n.transactions...)
+}
+
+// every state change and every transaction is mined in a new block
+func (n *Node) blockNumber() uint64 {
+	stateBlockNumber, _ := n.State.GetBlockNumber()
+	return stateBlockNumber + uint64(len(n.transactions))
+}
+
+func (n *Node) call(to common.Address, data []byte) ([]byte, error) {
+	contractABI := zeroex.ERC20ABI
+	if to == n.exchangeAddress {
+		contractABI = zeroex.ExchangeABI
+	}
+
+	method, args, err := unpackCall(contractABI, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var result interface{}
+	switch method.Name {
+	case "balanceOf":
+		result, err = n.State.GetBalance(to, args[0].(common.Address))
+	case "allowance":
+		result = new(big.Int)
+		if args[1].(common.Address) == n.erc20ProxyAddress {
+			result, err = n.State.GetAllowance(to, args[0].(common.Address))
+		}
+	case "filled":
+		result, err = n.State.GetFilledAmount(common.Hash(args[0].([32]byte)))
+	case "cancelled":
+		result, err = n.State.IsCancelled(common.Hash(args[0].([32]byte)))
+	default:
+		return nil, errors.New(fmt.Sprintf("method %v is not callable", method.Name))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return method.Outputs.Pack(result)
+}
+
+func (n *Node) sendTransaction(tx *types.Transaction) (common.Hash, error) {
+	from, err := types.Sender(n.signer, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if tx.Nonce() != n.nonces[from] {
+		return common.Hash{}, errors.New(fmt.Sprintf("invalid nonce %v of %v, expected %v",
+			tx.Nonce(), from.Hex(), n.nonces[from]))
+	}
+	n.nonces[from]++
+
+	status := types.ReceiptStatusSuccessful
+	if tx.To() != nil && *tx.To() == n.exchangeAddress {
+		err = n.executeExchange(tx.Data())
+	} else if tx.To() != nil && len(tx.Data()) > 0 {
+		err = n.executeTransfer(from, *tx.To(), tx.Data())
+	}
+	if err != nil {
+		status = types.ReceiptStatusFailed
+	}
+
+	n.transactions = append(n.transactions, tx)
+	n.receipts[tx.Hash()] = &types.Receipt{
+		Status:            status,
+		CumulativeGasUsed: tx.Gas(),
+		Logs:              []*types.Log{},
+		TxHash:            tx.Hash(),
+		GasUsed:           tx.Gas(),
+		BlockNumber:       new(big.Int).SetUint64(n.blockNumber()),
+	}
+	return tx.Hash(), nil
+}
+
+// update the filled amounts of the orders filled by batchFillOrders, a transaction fails without filling any
+// order when one of the orders has less than its fill amount left
+func (n *Node) executeExchange(data []byte) error {
+	method, args, err := unpackCall(zeroex.ExchangeABI, data)
+	if err != nil {
+		return err
+	}
+	if method.Name != "batchFillOrders" {
+		return errors.New(fmt.Sprintf("method %v is not supported", method.Name))
+	}
+
+	var call struct {
+		Orders                []zeroex.Order
+		TakerAssetFillAmounts []*big.Int
+		Signatures            [][]byte
+	}
+	err = method.Inputs.Copy(&call, args)
+	if err != nil {
+		return err
+	}
+	if len(call.Orders) != len(call.TakerAssetFillAmounts) {
+		return errors.New("fill amounts do not match the orders")
+	}
+
+	for i := range call.Orders {
+		remaining, err := n.remainingTakerAssetAmount(&call.Orders[i])
+		if err != nil {
+			return err
+		}
+		if call.TakerAssetFillAmounts[i].Sign() <= 0 || remaining.Cmp(call.TakerAssetFillAmounts[i]) < 0 {
+			return errors.New(fmt.Sprintf("order %v is not fillable", i))
+		}
+	}
+	for i := range call.Orders {
+		err = n.fill(&call.Orders[i], call.TakerAssetFillAmounts[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// move the balance of an ERC20 transfer, any other call to a token fails
+func (n *Node) executeTransfer(from common.Address, token common.Address, data []byte) error {
+	method, args, err := unpackCall(zeroex.ERC20ABI, data)
+	if err != nil {
+		return err
+	}
+	if method.Name != "transfer" {
+		return errors.New(fmt.Sprintf("method %v is not supported", method.Name))
+	}
+
+	to, amount := args[0].(common.Address), args[1].(*big.Int)
+	fromBalance, err := n.State.GetBalance(token, from)
+	if err != nil {
+		return err
+	}
+	if fromBalance.Cmp(amount) < 0 {
+		return errors.New(fmt.Sprintf("transfer amount %v exceeds balance %v", amount, fromBalance))
+	}
+	toBalance, err := n.State.GetBalance(token, to)
+	if err != nil {
+		return err
+	}
+	n.State.SetBalance(token, from, new(big.Int).Sub(fromBalance, amount))
+	n.State.SetBalance(token, to, new(big.Int).Add(toBalance, amount))
+	return nil
+}
+
+func (n *Node) remainingTakerAssetAmount(order *zeroex.Order) (*big.Int, error) {
+	orderHash := order.Hash(n.chainId, n.exchangeAddress)
+	cancelled, err := n.State.IsCancelled(orderHash)
+	if err != nil {
+		return nil, err
+	}
+	if cancelled {
+		return new(big.Int), nil
+	}
+
+	filled, err := n.State.GetFilledAmount(orderHash)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).Sub(order.TakerAssetAmount, filled), nil
+}
+
+func (n *Node) fill(order *zeroex.Order, takerAssetFilled *big.Int) error {
+	if takerAssetFilled.Sign() <= 0 {
+		return errors.New("order is not fillable")
+	}
+
+	orderHash := order.Hash(n.chainId, n.exchangeAddress)
+	filled, err := n.State.GetFilledAmount(orderHash)
+	if err != nil {
+		return err
+	}
+	n.State.SetFilledAmount(orderHash, new(big.Int).Add(filled, takerAssetFilled))
+	return nil
+}
+
+func unpackCall(contractABI abi.ABI, data []byte) (*abi.Method, []interface{}, error) {
+	if len(data) < 4 {
+		return nil, nil, errors.New("invalid call data")
+	}
+	method, err := contractABI.MethodById(data[:4])
+	if err != nil {
+		return nil, nil, err
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		return nil, nil, err
+	}
+	return method, args, nil
+}
+
+// ethService implements the eth namespace of the JSON-RPC api
+type ethService struct {
+	node *Node
+}
+
+type callArgs struct {
+	From *common.Address `json:"from"`
+	To   *common.Address `json:"to"`
+	Data hexutil.Bytes   `json:"data"`
+}
+
+func (s *ethService) ChainId() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(s.node.chainId))
+}
+
+func (s *ethService) BlockNumber() hexutil.Uint64 {
+	s.node.mu.Lock()
+	defer s.node.mu.Unlock()
+	return hexutil.Uint64(s.node.blockNumber())
+}
+
+func (s *ethService) GasPrice() *hexutil.Big {
+	return (*hexutil.Big)(big.NewInt(1))
+}
+
+func (s *ethService) GetTransactionCount(address common.Address, blockNumber string) hexutil.Uint64 {
+	s.node.mu.Lock()
+	defer s.node.mu.Unlock()
+	return hexutil.Uint64(s.node.nonces[address])
+}
+
+func (s *ethService) Call(args callArgs, blockNumber string) (hexutil.Bytes, error) {
+	if args.To == nil {
+		return nil, errors.New("missing call target")
+	}
+	return s.node.call(*args.To, args.Data)
+}
+
+func (s *ethService) SendRawTransaction(encodedTx hexutil.Bytes) (common.Hash, error) {
+	tx := new(types.Transaction)
+	err := rlp.DecodeBytes(encodedTx, tx)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return s.node.sendTransaction(tx)
+}
+
+func (s *ethService) GetTransactionReceipt(txHash common.Hash) *types.Receipt {
+	s.node.mu.Lock()
+	defer s.node.mu.Unlock()
+	return s.node.receipts[txHash]
+}
@@ -0,0 +1,175 @@
+package testnode
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/zimengpan/go-boomflow/chain"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	testChainId           = 1337
+	testExchangeAddress   = "0x48bacb9266a570d521063ef5dd96e61686dbe788"
+	testErc20ProxyAddress = "0x1dc4c1cefef38a777b15aa20260a54e584b16c48"
+)
+
+var (
+	testToken = common.HexToAddress("0xe41d2489571d322189246dafa5ebde1f4699f498")
+	testOwner = common.HexToAddress("0x1D297954F3a6C293DDDe068BD462c1d5761de089")
+)
+
+func startTestNode(t *testing.T) (*Node, string) {
+	t.Helper()
+
+	node := NewNode(testChainId, testExchangeAddress, testErc20ProxyAddress)
+	url, err := node.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(node.Stop)
+	return node, url
+}
+
+func newTestOrder(salt int64) *zeroex.Order {
+	return &zeroex.Order{
+		MakerAddress:          testOwner,
+		MakerAssetAmount:      big.NewInt(100),
+		TakerAssetAmount:      big.NewInt(200),
+		MakerFee:              new(big.Int),
+		TakerFee:              new(big.Int),
+		ExpirationTimeSeconds: big.NewInt(1792499797),
+		Salt:                  big.NewInt(salt),
+		MakerAssetData:        []byte{1},
+		TakerAssetData:        []byte{2},
+		MakerFeeAssetData:     []byte{},
+		TakerFeeAssetData:     []byte{},
+	}
+}
+
+func assertBigInt(t *testing.T, name string, actual *big.Int, expected int64) {
+	t.Helper()
+	if actual.Cmp(big.NewInt(expected)) != 0 {
+		t.Fatalf("%v %v, expected %v", name, actual, expected)
+	}
+}
+
+// the EthereumStateProvider reads the state of the node through JSON-RPC
+func TestEthereumStateProvider(t *testing.T) {
+	node, url := startTestNode(t)
+	provider, err := chain.NewEthereumStateProvider(url, testExchangeAddress, testErc20ProxyAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := newTestOrder(1)
+	orderHash := order.Hash(testChainId, common.HexToAddress(testExchangeAddress))
+	node.State.SetBalance(testToken, testOwner, big.NewInt(500))
+	node.State.SetAllowance(testToken, testOwner, big.NewInt(300))
+	node.State.SetFilledAmount(orderHash, big.NewInt(40))
+	node.State.SetCancelled(orderHash, true)
+
+	balance, err := provider.GetBalance(testToken, testOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBigInt(t, "balance", balance, 500)
+
+	allowance, err := provider.GetAllowance(testToken, testOwner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBigInt(t, "allowance", allowance, 300)
+
+	filled, err := provider.GetFilledAmount(orderHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBigInt(t, "filled amount", filled, 40)
+
+	cancelled, err := provider.IsCancelled(orderHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cancelled {
+		t.Fatal("order is not cancelled")
+	}
+
+	filled, err = provider.GetFilledAmount(newTestOrder(2).Hash(testChainId, common.HexToAddress(testExchangeAddress)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertBigInt(t, "filled amount of another order", filled, 0)
+}
+
+// a batchFillOrders transaction fails without filling any order when one of the orders has less than its fill amount left
+func TestBatchFillOrders(t *testing.T) {
+	node, url := startTestNode(t)
+	client, err := ethclient.Dial(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := types.NewEIP155Signer(big.NewInt(testChainId))
+
+	left, right := newTestOrder(1), newTestOrder(2)
+	exchangeAddress := common.HexToAddress(testExchangeAddress)
+	leftHash, rightHash := left.Hash(testChainId, exchangeAddress), right.Hash(testChainId, exchangeAddress)
+
+	sendFill := func(nonce uint64, leftAmount, rightAmount int64) *types.Receipt {
+		t.Helper()
+
+		data, err := zeroex.BatchFillOrdersCalldata([]*zeroex.Order{left, right},
+			[]*big.Int{big.NewInt(leftAmount), big.NewInt(rightAmount)}, []string{"0x01", "0x02"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := types.SignTx(types.NewTransaction(nonce, exchangeAddress, new(big.Int), 1000000, big.NewInt(1), data),
+			signer, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.SendTransaction(context.Background(), tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt, err := client.TransactionReceipt(context.Background(), tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return receipt
+	}
+
+	receipt := sendFill(0, 150, 30)
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("fill failed")
+	}
+	filled, _ := node.State.GetFilledAmount(leftHash)
+	assertBigInt(t, "left filled", filled, 150)
+	filled, _ = node.State.GetFilledAmount(rightHash)
+	assertBigInt(t, "right filled", filled, 30)
+
+	// the left order has 50 left
+	receipt = sendFill(1, 60, 30)
+	if receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("overfill succeeded")
+	}
+	filled, _ = node.State.GetFilledAmount(leftHash)
+	assertBigInt(t, "left filled", filled, 150)
+	filled, _ = node.State.GetFilledAmount(rightHash)
+	assertBigInt(t, "right filled", filled, 30)
+
+	if len(node.GetTransactions()) != 2 {
+		t.Fatalf("%v transactions mined, expected 2", len(node.GetTransactions()))
+	}
+}
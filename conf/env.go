@@ -0,0 +1,130 @@
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const envPrefix = "GBE"
+
+// applyEnv overrides the fields of the config with the environment variables named after their json path,
+// e.g. kafka.brokers -> GBE_KAFKA_BROKERS, restServer.rateLimits.read.perIpRate -> GBE_REST_SERVER_RATE_LIMITS_READ_PER_IP_RATE.
+// Lists of strings are comma separated, maps and lists of objects are JSON.
+func applyEnv(config *GbeConfig) error {
+	return applyEnvToStruct(reflect.ValueOf(config).Elem(), envPrefix)
+}
+
+func applyEnvToStruct(v reflect.Value, prefix string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if len(name) == 0 || name == "-" {
+			continue
+		}
+
+		key := prefix + "_" + envName(name)
+		if field.Type.Kind() == reflect.Struct {
+			err := applyEnvToStruct(v.Field(i), key)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, found := os.LookupEnv(key)
+		if !found {
+			continue
+		}
+		err := setEnvValue(v.Field(i), value)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid environment variable %v: %v", key, err))
+		}
+	}
+	return nil
+}
+
+// envName converts a json field name to the environment variable form: rpcUrl -> RPC_URL
+func envName(name string) string {
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
+
+func setEnvValue(v reflect.Value, value string) error {
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+
+	case reflect.Int, reflect.Int64:
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+
+	case reflect.Uint64:
+		u, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.String {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				item = strings.TrimSpace(item)
+				if len(item) > 0 {
+					items = append(items, item)
+				}
+			}
+			v.Set(reflect.ValueOf(items))
+			return nil
+		}
+		return setEnvJSON(v, value)
+
+	case reflect.Map:
+		return setEnvJSON(v, value)
+
+	default:
+		return errors.New(fmt.Sprintf("unsupported type %v", v.Type()))
+	}
+	return nil
+}
+
+// the environment replaces the value of the file instead of being merged into it
+func setEnvJSON(v reflect.Value, value string) error {
+	decoded := reflect.New(v.Type())
+	err := json.Unmarshal([]byte(value), decoded.Interface())
+	if err != nil {
+		return err
+	}
+	v.Set(decoded.Elem())
+	return nil
+}
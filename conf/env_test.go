@@ -0,0 +1,117 @@
+package conf
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// setEnv sets the variables until the returned function is called
+func setEnv(t *testing.T, env map[string]string) func() {
+	for key, value := range env {
+		err := os.Setenv(key, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return func() {
+		for key := range env {
+			_ = os.Unsetenv(key)
+		}
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	tests := map[string]string{
+		"addr":              "ADDR",
+		"rpcUrl":            "RPC_URL",
+		"erc20ProxyAddress": "ERC20_PROXY_ADDRESS",
+		"perIpRate":         "PER_IP_RATE",
+	}
+	for name, expected := range tests {
+		if envName(name) != expected {
+			t.Fatalf("env name of %v is %v, expected %v", name, envName(name), expected)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	defer setEnv(t, map[string]string{
+		"GBE_DATA_SOURCE_ENABLE_AUTO_MIGRATE":           "true",
+		"GBE_KAFKA_BROKERS":                             "kafka1:9092, kafka2:9092,",
+		"GBE_REST_SERVER_RATE_LIMITS_READ_PER_IP_RATE":  "2.5",
+		"GBE_REST_SERVER_RATE_LIMITS_READ_PER_IP_BURST": "10",
+		"GBE_ETHEREUM_CHAIN_ID":                         "1",
+		"GBE_ETHEREUM_RPC_URL":                          "wss://mainnet.example.com/ws",
+		"GBE_SETTLEMENT_GAS_LIMIT":                      "500000",
+		"GBE_LOGGING_LEVELS":                            `{"rest": "warn"}`,
+		"GBE_FEE_DEFAULT_SCHEDULE":                      `[{"minVolume": 0, "makerFeeRate": 0.002}]`,
+		"GBE_JWT_SECRET":                                "fedcba9876543210",
+	})()
+
+	c := newValidConfig()
+	err := applyEnv(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := newValidConfig()
+	expected.DataSource.EnableAutoMigrate = true
+	expected.Kafka.Brokers = []string{"kafka1:9092", "kafka2:9092"}
+	expected.RestServer.RateLimits.Read = RateLimit{PerIpRate: 2.5, PerIpBurst: 10}
+	expected.Ethereum.ChainId = 1
+	expected.Ethereum.RpcUrl = "wss://mainnet.example.com/ws"
+	expected.Settlement.GasLimit = 500000
+	// maps and lists of objects replace the values of the file instead of being merged into them
+	expected.Logging.Levels = map[string]string{"rest": "warn"}
+	expected.Fee.DefaultSchedule = []FeeTier{{MinVolume: 0, MakerFeeRate: 0.002}}
+	expected.JwtSecret = "fedcba9876543210"
+	if !reflect.DeepEqual(c, expected) {
+		t.Fatalf("config with env\n%+v\nexpected\n%+v", c, expected)
+	}
+}
+
+func TestApplyEnvInvalidValue(t *testing.T) {
+	tests := map[string]string{
+		"GBE_ETHEREUM_CHAIN_ID":               "one",
+		"GBE_DATA_SOURCE_ENABLE_AUTO_MIGRATE": "maybe",
+		"GBE_SETTLEMENT_GAS_LIMIT":            "-1",
+		"GBE_LOGGING_LEVELS":                  "rest=warn",
+	}
+	for key, value := range tests {
+		t.Run(key, func(t *testing.T) {
+			defer setEnv(t, map[string]string{key: value})()
+
+			err := applyEnv(newValidConfig())
+			if err == nil || !strings.Contains(err.Error(), key) {
+				t.Fatalf("expected an error naming %v, got %v", key, err)
+			}
+		})
+	}
+}
+
+// the environment is applied over the config file
+func TestLoadConfigWithEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "conf.json")
+	err = ioutil.WriteFile(path, []byte(`{"redis": {"addr": "localhost:6379"}, "ethereum": {"chainId": 1337}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer setEnv(t, map[string]string{"GBE_REDIS_ADDR": "redis:6379"})()
+
+	c, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Redis.Addr != "redis:6379" || c.Ethereum.ChainId != 1337 {
+		t.Fatalf("redis addr %v and chain id %v, expected redis:6379 and 1337", c.Redis.Addr, c.Ethereum.ChainId)
+	}
+}
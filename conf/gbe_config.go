@@ -1,61 +1,194 @@
-package conf
-
-import (
-	"encoding/json"
-	"io/ioutil"
-	"sync"
-)
-
-type GbeConfig struct {
-	DataSource DataSourceConfig `json:"dataSource"`
-	Redis      RedisConfig      `json:"redis"`
-	Kafka      KafkaConfig      `json:"kafka"`
-	PushServer PushServerConfig `json:"pushServer"`
-	RestServer RestServerConfig `json:"restServer"`
-	JwtSecret  string           `json:"jwtSecret"`
-}
-
-type DataSourceConfig struct {
-	DriverName        string `json:"driverName"`
-	Addr              string `json:"addr"`
-	Database          string `json:"database"`
-	User              string `json:"user"`
-	Password          string `json:"password"`
-	EnableAutoMigrate bool   `json:"enableAutoMigrate"`
-}
-
-type RedisConfig struct {
-	Addr     string `json:"addr"`
-	Password string `json:"password"`
-}
-
-type KafkaConfig struct {
-	Brokers []string `json:"brokers"`
-}
-
-type PushServerConfig struct {
-	Addr string `json:"addr"`
-	Path string `json:"path"`
-}
-
-type RestServerConfig struct {
-	Addr string `json:"addr"`
-}
-
-var config GbeConfig
-var configOnce sync.Once
-
-func GetConfig() *GbeConfig {
-	configOnce.Do(func() {
-		bytes, err := ioutil.ReadFile("conf.json")
-		if err != nil {
-			panic(err)
-		}
-
-		err = json.Unmarshal(bytes, &config)
-		if err != nil {
-			panic(err)
-		}
-	})
-	return &config
-}
+package conf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+)
+
+type GbeConfig struct {
+	DataSource   DataSourceConfig   `json:"dataSource"`
+	Redis        RedisConfig        `json:"redis"`
+	Kafka        KafkaConfig        `json:"kafka"`
+	PushServer   PushServerConfig   `json:"pushServer"`
+	RestServer   RestServerConfig   `json:"restServer"`
+	Match        MatchConfig        `json:"match"`
+	Ethereum     EthereumConfig     `json:"ethereum"`
+	Fee          FeeConfig          `json:"fee"`
+	OrderWatcher OrderWatcherConfig `json:"orderWatcher"`
+	Settlement   SettlementConfig   `json:"settlement"`
+	Metrics      MetricsConfig      `json:"metrics"`
+	Logging      LoggingConfig      `json:"logging"`
+	JwtSecret    string             `json:"jwtSecret"`
+}
+
+type DataSourceConfig struct {
+	DriverName        string `json:"driverName"`
+	Addr              string `json:"addr"`
+	Database          string `json:"database"`
+	User              string `json:"user"`
+	Password          string `json:"password"`
+	EnableAutoMigrate bool   `json:"enableAutoMigrate"`
+}
+
+type RedisConfig struct {
+	Addr     string `json:"addr"`
+	Password string `json:"password"`
+}
+
+type KafkaConfig struct {
+	Brokers []string `json:"brokers"`
+}
+
+type PushServerConfig struct {
+	Addr string `json:"addr"`
+	Path string `json:"path"`
+}
+
+type RestServerConfig struct {
+	Addr       string          `json:"addr"`
+	RateLimits RateLimitConfig `json:"rateLimits"`
+	// 反向代理的ip或者CIDR，只有来自这些地址的请求才按照X-Forwarded-For获取客户端ip，为空时使用连接的地址
+	TrustedProxies []string `json:"trustedProxies"`
+}
+
+// 每类请求分别限流，同时按照客户端ip和maker地址计数
+type RateLimitConfig struct {
+	Placement    RateLimit `json:"placement"`
+	Cancellation RateLimit `json:"cancellation"`
+	Read         RateLimit `json:"read"`
+}
+
+type RateLimit struct {
+	// 每秒补充的请求数，0表示不限流
+	PerIpRate  float64 `json:"perIpRate"`
+	PerIpBurst int     `json:"perIpBurst"`
+	// 只对登录后的请求生效
+	PerMakerRate  float64 `json:"perMakerRate"`
+	PerMakerBurst int     `json:"perMakerBurst"`
+}
+
+type LoggingConfig struct {
+	// default level of all components: debug, info, warn, error
+	Level string `json:"level"`
+	// component -> level, overrides the default level
+	Levels map[string]string `json:"levels"`
+}
+
+type MetricsConfig struct {
+	// address of the listener serving /metrics, empty disables it
+	Addr string `json:"addr"`
+}
+
+type MatchConfig struct {
+	// default slippage protection of market orders relative to the best price, 0 means unbounded
+	MaxSlippage float64 `json:"maxSlippage"`
+	// leader election of the engines, an empty backend runs every engine as the leader
+	Election ElectionConfig `json:"election"`
+	// encoding of the order and log messages written by this process, json (default) or protobuf.
+	// Messages are read in the encoding of their header whatever the config
+	Encoding string `json:"encoding"`
+}
+
+type ElectionConfig struct {
+	// file: flock on a lock file, only for the processes of one host. Other backends are registered by match.RegisterElector
+	Backend string `json:"backend"`
+	// directory of the lock and token files of the file backend
+	Dir string `json:"dir"`
+	// seconds between two attempts of a standby to become the leader
+	RetryInterval int `json:"retryInterval"`
+}
+
+type EthereumConfig struct {
+	ChainId           int64  `json:"chainId"`
+	ExchangeAddress   string `json:"exchangeAddress"`
+	Erc20ProxyAddress string `json:"erc20ProxyAddress"`
+	// JSON-RPC endpoint of an Ethereum node, empty disables the on-chain checks of makers
+	RpcUrl string `json:"rpcUrl"`
+}
+
+type FeeConfig struct {
+	// 订单的feeRecipientAddress必须是其中之一，order_config返回第一个
+	RecipientAddresses []string `json:"recipientAddresses"`
+	// productId -> 费率表，按MinVolume升序排列
+	Schedules map[string][]FeeTier `json:"schedules"`
+	// 没有单独配置费率表的product使用
+	DefaultSchedule []FeeTier `json:"defaultSchedule"`
+}
+
+type OrderWatcherConfig struct {
+	// seconds between two checks of the open orders, the check is skipped when no new block is mined
+	Interval int `json:"interval"`
+	// seconds between two expire commands sent to the order topic of every product, 0 disables them.
+	// Expired GTT orders on the top of the book are removed anyway when they would trade
+	ExpireInterval int `json:"expireInterval"`
+}
+
+type SettlementConfig struct {
+	// hex private key of the relayer account that sends the settlement transactions, empty disables settlement
+	PrivateKey string `json:"privateKey"`
+	GasLimit   uint64 `json:"gasLimit"`
+	// seconds between two checks of the pending transactions
+	ConfirmInterval int `json:"confirmInterval"`
+}
+
+type FeeTier struct {
+	// maker在该product的成交量(quote)达到MinVolume时适用
+	MinVolume float64 `json:"minVolume"`
+	// post-only订单的makerFee至少为makerAssetAmount * MakerFeeRate
+	MakerFeeRate float64 `json:"makerFeeRate"`
+	// 其他订单可能作为taker成交，makerFee至少为makerAssetAmount * TakerFeeRate。
+	// 订单的takerFee由发送结算交易的relayer支付，必须为0
+	TakerFeeRate float64 `json:"takerFeeRate"`
+}
+
+const DefaultConfigPath = "conf.json"
+
+var configPath = DefaultConfigPath
+var config *GbeConfig
+var configErr error
+var configOnce sync.Once
+
+// SetConfigPath sets the file read by the first LoadConfig or GetConfig, it has no effect afterwards
+func SetConfigPath(path string) {
+	configPath = path
+}
+
+// LoadConfig reads the config file and applies the GBE_* environment overrides, the sections used by a process
+// are checked by Validate. The config is loaded once, later calls return the same config or error.
+func LoadConfig() (*GbeConfig, error) {
+	configOnce.Do(func() {
+		config, configErr = loadConfig(configPath)
+	})
+	return config, configErr
+}
+
+// GetConfig is LoadConfig for the components started after the config has been loaded, it panics on error
+func GetConfig() *GbeConfig {
+	c, err := LoadConfig()
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+func loadConfig(path string) (*GbeConfig, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("read config file %v error: %v", path, err))
+	}
+
+	var c GbeConfig
+	err = json.Unmarshal(bytes, &c)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("parse config file %v error: %v", path, err))
+	}
+
+	err = applyEnv(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
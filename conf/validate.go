@@ -0,0 +1,289 @@
+package conf
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	redacted = "******"
+
+	minJwtSecretLength = 16
+)
+
+var logLevels = []string{"trace", "debug", "info", "warn", "warning", "error", "fatal", "panic"}
+
+var rpcUrlSchemes = []string{"http", "https", "ws", "wss"}
+
+const (
+	// names of the config sections, as in the json file
+	SectionDataSource   = "dataSource"
+	SectionRedis        = "redis"
+	SectionKafka        = "kafka"
+	SectionRestServer   = "restServer"
+	SectionMatch        = "match"
+	SectionEthereum     = "ethereum"
+	SectionFee          = "fee"
+	SectionOrderWatcher = "orderWatcher"
+	SectionSettlement   = "settlement"
+	SectionMetrics      = "metrics"
+	SectionLogging      = "logging"
+	SectionJwtSecret    = "jwtSecret"
+)
+
+type checkFunc func(field string, err error)
+
+var sectionValidators = map[string]func(c *GbeConfig, check checkFunc){
+	SectionDataSource: func(c *GbeConfig, check checkFunc) {
+		if len(c.DataSource.Addr) > 0 {
+			check("dataSource.addr", validateAddr(c.DataSource.Addr, false))
+		}
+	},
+	SectionRedis: func(c *GbeConfig, check checkFunc) {
+		if len(c.Redis.Addr) > 0 {
+			check("redis.addr", validateAddr(c.Redis.Addr, false))
+		}
+	},
+	SectionKafka: func(c *GbeConfig, check checkFunc) {
+		if len(c.Kafka.Brokers) == 0 {
+			check("kafka.brokers", errors.New("at least one broker is required"))
+		}
+		for i, broker := range c.Kafka.Brokers {
+			check(fmt.Sprintf("kafka.brokers[%v]", i), validateAddr(broker, true))
+		}
+	},
+	SectionRestServer: func(c *GbeConfig, check checkFunc) {
+		check("restServer.addr", validateAddr(c.RestServer.Addr, false))
+		check("restServer.rateLimits.placement", validateRateLimit(c.RestServer.RateLimits.Placement))
+		check("restServer.rateLimits.cancellation", validateRateLimit(c.RestServer.RateLimits.Cancellation))
+		check("restServer.rateLimits.read", validateRateLimit(c.RestServer.RateLimits.Read))
+		for i, proxy := range c.RestServer.TrustedProxies {
+			check(fmt.Sprintf("restServer.trustedProxies[%v]", i), validateIpOrCidr(proxy))
+		}
+	},
+	SectionMatch: func(c *GbeConfig, check checkFunc) {
+		if c.Match.MaxSlippage < 0 {
+			check("match.maxSlippage", errors.New("must not be negative"))
+		}
+		if c.Match.Election.Backend == "file" && len(c.Match.Election.Dir) == 0 {
+			check("match.election.dir", errors.New("is required by the file backend"))
+		}
+		if c.Match.Election.RetryInterval < 0 {
+			check("match.election.retryInterval", errors.New("must not be negative"))
+		}
+		if c.Match.Encoding != "" && c.Match.Encoding != "json" && c.Match.Encoding != "protobuf" {
+			check("match.encoding", errors.New("must be json or protobuf"))
+		}
+	},
+	SectionEthereum: func(c *GbeConfig, check checkFunc) {
+		if c.Ethereum.ChainId <= 0 {
+			check("ethereum.chainId", errors.New("must be positive"))
+		}
+		check("ethereum.exchangeAddress", validateEthereumAddress(c.Ethereum.ExchangeAddress))
+		check("ethereum.erc20ProxyAddress", validateEthereumAddress(c.Ethereum.Erc20ProxyAddress))
+		if len(c.Ethereum.RpcUrl) > 0 {
+			check("ethereum.rpcUrl", validateRpcUrl(c.Ethereum.RpcUrl))
+		}
+	},
+	SectionFee: func(c *GbeConfig, check checkFunc) {
+		if len(c.Fee.RecipientAddresses) == 0 {
+			check("fee.recipientAddresses", errors.New("at least one address is required"))
+		}
+		for i, address := range c.Fee.RecipientAddresses {
+			check(fmt.Sprintf("fee.recipientAddresses[%v]", i), validateEthereumAddress(address))
+		}
+		check("fee.defaultSchedule", validateFeeSchedule(c.Fee.DefaultSchedule))
+		for productId, schedule := range c.Fee.Schedules {
+			check(fmt.Sprintf("fee.schedules.%v", productId), validateFeeSchedule(schedule))
+		}
+	},
+	SectionOrderWatcher: func(c *GbeConfig, check checkFunc) {
+		if c.OrderWatcher.Interval < 0 {
+			check("orderWatcher.interval", errors.New("must not be negative"))
+		}
+		if c.OrderWatcher.ExpireInterval < 0 {
+			check("orderWatcher.expireInterval", errors.New("must not be negative"))
+		}
+	},
+	SectionSettlement: func(c *GbeConfig, check checkFunc) {
+		if len(c.Settlement.PrivateKey) > 0 {
+			check("settlement.privateKey", validatePrivateKey(c.Settlement.PrivateKey))
+			if c.Settlement.GasLimit == 0 {
+				check("settlement.gasLimit", errors.New("must be positive when settlement is enabled"))
+			}
+		}
+		if c.Settlement.ConfirmInterval < 0 {
+			check("settlement.confirmInterval", errors.New("must not be negative"))
+		}
+	},
+	SectionMetrics: func(c *GbeConfig, check checkFunc) {
+		if len(c.Metrics.Addr) > 0 {
+			check("metrics.addr", validateAddr(c.Metrics.Addr, false))
+		}
+	},
+	SectionLogging: func(c *GbeConfig, check checkFunc) {
+		if len(c.Logging.Level) > 0 {
+			check("logging.level", validateLogLevel(c.Logging.Level))
+		}
+		for component, level := range c.Logging.Levels {
+			check(fmt.Sprintf("logging.levels.%v", component), validateLogLevel(level))
+		}
+	},
+	SectionJwtSecret: func(c *GbeConfig, check checkFunc) {
+		if len(c.JwtSecret) == 0 {
+			check("jwtSecret", errors.New("must not be empty"))
+		} else if len(c.JwtSecret) < minJwtSecretLength {
+			check("jwtSecret", errors.New(fmt.Sprintf("must be at least %v characters", minJwtSecretLength)))
+		}
+	},
+}
+
+// Validate checks the given sections of the config, or all of them when none is given,
+// and reports every invalid field at once, named by its json path
+func (c *GbeConfig) Validate(sections ...string) error {
+	if len(sections) == 0 {
+		for section := range sectionValidators {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+
+	var problems []string
+	check := func(field string, err error) {
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%v: %v", field, err))
+		}
+	}
+	for _, section := range sections {
+		validator, found := sectionValidators[section]
+		if !found {
+			return errors.New(fmt.Sprintf("unknown config section: %v", section))
+		}
+		validator(c, check)
+	}
+
+	if len(problems) > 0 {
+		return errors.New(fmt.Sprintf("invalid config:\n  %v", strings.Join(problems, "\n  ")))
+	}
+	return nil
+}
+
+// Redacted returns a copy of the config with the secrets masked, safe to be printed or logged
+func (c *GbeConfig) Redacted() GbeConfig {
+	r := *c
+	r.DataSource.Password = redact(r.DataSource.Password)
+	r.Redis.Password = redact(r.Redis.Password)
+	r.Settlement.PrivateKey = redact(r.Settlement.PrivateKey)
+	r.JwtSecret = redact(r.JwtSecret)
+	return r
+}
+
+// empty secrets are kept to show they are not configured
+func redact(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	return redacted
+}
+
+// validateAddr checks a host:port address, the host can be omitted by listeners
+func validateAddr(addr string, requireHost bool) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.New(fmt.Sprintf("malformed address %q, expected host:port", addr))
+	}
+	if requireHost && len(host) == 0 {
+		return errors.New(fmt.Sprintf("malformed address %q, host is required", addr))
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil || p <= 0 || p > 65535 {
+		return errors.New(fmt.Sprintf("malformed address %q, invalid port %q", addr, port))
+	}
+	return nil
+}
+
+// validateRpcUrl checks the JSON-RPC endpoint of a node, the url itself is not included in the errors
+// as it often carries the API key of a node provider
+func validateRpcUrl(rpcUrl string) error {
+	u, err := url.Parse(rpcUrl)
+	if err != nil {
+		return errors.New("malformed url")
+	}
+	found := false
+	for _, scheme := range rpcUrlSchemes {
+		if strings.EqualFold(u.Scheme, scheme) {
+			found = true
+		}
+	}
+	if !found {
+		return errors.New(fmt.Sprintf("unsupported scheme %q, expected one of %v", u.Scheme, strings.Join(rpcUrlSchemes, ", ")))
+	}
+	if len(u.Hostname()) == 0 {
+		return errors.New("host is required")
+	}
+	return nil
+}
+
+func validateIpOrCidr(s string) error {
+	if net.ParseIP(s) != nil {
+		return nil
+	}
+	_, _, err := net.ParseCIDR(s)
+	if err != nil {
+		return errors.New(fmt.Sprintf("invalid ip or CIDR %q", s))
+	}
+	return nil
+}
+
+func validateEthereumAddress(address string) error {
+	if !common.IsHexAddress(address) {
+		return errors.New(fmt.Sprintf("invalid ethereum address %q", address))
+	}
+	return nil
+}
+
+// the key itself is never included in the error
+func validatePrivateKey(key string) error {
+	key = strings.TrimPrefix(key, "0x")
+	bytes, err := hex.DecodeString(key)
+	if err != nil || len(bytes) != 32 {
+		return errors.New("must be a 32 bytes hex private key")
+	}
+	return nil
+}
+
+func validateRateLimit(limit RateLimit) error {
+	if limit.PerIpRate < 0 || limit.PerIpBurst < 0 || limit.PerMakerRate < 0 || limit.PerMakerBurst < 0 {
+		return errors.New("rates and bursts must not be negative")
+	}
+	return nil
+}
+
+func validateFeeSchedule(schedule []FeeTier) error {
+	for i, tier := range schedule {
+		if tier.MinVolume < 0 || tier.MakerFeeRate < 0 || tier.TakerFeeRate < 0 {
+			return errors.New(fmt.Sprintf("tier %v: volume and rates must not be negative", i))
+		}
+		if i > 0 && tier.MinVolume < schedule[i-1].MinVolume {
+			return errors.New(fmt.Sprintf("tier %v: tiers must be sorted by minVolume", i))
+		}
+	}
+	return nil
+}
+
+func validateLogLevel(level string) error {
+	for _, l := range logLevels {
+		if strings.EqualFold(level, l) {
+			return nil
+		}
+	}
+	return errors.New(fmt.Sprintf("unknown level %q, expected one of %v", level, strings.Join(logLevels, ", ")))
+}
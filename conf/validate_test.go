@@ -0,0 +1,117 @@
+package conf
+
+import (
+	"strings"
+	"testing"
+)
+
+func newValidConfig() *GbeConfig {
+	return &GbeConfig{
+		Redis:      RedisConfig{Addr: "localhost:6379"},
+		Kafka:      KafkaConfig{Brokers: []string{"localhost:9092"}},
+		RestServer: RestServerConfig{Addr: ":8080", TrustedProxies: []string{"10.0.0.1", "192.168.0.0/16"}},
+		Ethereum: EthereumConfig{
+			ChainId:           1337,
+			ExchangeAddress:   "0x48bacb9266a570d521063ef5dd96e61686dbe788",
+			Erc20ProxyAddress: "0x1dc4c1cefef38a777b15aa20260a54e584b16c48",
+			RpcUrl:            "http://localhost:8545",
+		},
+		Fee: FeeConfig{
+			RecipientAddresses: []string{"0x1d297954f3a6c293ddde068bd462c1d5761de089"},
+			DefaultSchedule:    []FeeTier{{MinVolume: 0, MakerFeeRate: 0.001}, {MinVolume: 1000, MakerFeeRate: 0.0005}},
+		},
+		Settlement: SettlementConfig{
+			PrivateKey: "0x" + strings.Repeat("ab", 32),
+			GasLimit:   400000,
+		},
+		Logging:   LoggingConfig{Level: "info", Levels: map[string]string{"match": "DEBUG"}},
+		JwtSecret: "0123456789abcdef",
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *GbeConfig)
+		// the field reported as invalid, empty when the config is valid
+		field string
+	}{
+		{"valid", func(c *GbeConfig) {}, ""},
+		{"https rpc url", func(c *GbeConfig) { c.Ethereum.RpcUrl = "https://mainnet.example.com/v3/key" }, ""},
+		{"wss rpc url", func(c *GbeConfig) { c.Ethereum.RpcUrl = "wss://mainnet.example.com/ws" }, ""},
+		{"rpc url not configured", func(c *GbeConfig) { c.Ethereum.RpcUrl = "" }, ""},
+		{"rpc url without scheme", func(c *GbeConfig) { c.Ethereum.RpcUrl = "localhost:8545" }, "ethereum.rpcUrl"},
+		{"ipc path as rpc url", func(c *GbeConfig) { c.Ethereum.RpcUrl = "/var/run/geth.ipc" }, "ethereum.rpcUrl"},
+		{"unsupported rpc url scheme", func(c *GbeConfig) { c.Ethereum.RpcUrl = "ftp://localhost:8545" }, "ethereum.rpcUrl"},
+		{"rpc url without host", func(c *GbeConfig) { c.Ethereum.RpcUrl = "http://:8545" }, "ethereum.rpcUrl"},
+		{"malformed rpc url", func(c *GbeConfig) { c.Ethereum.RpcUrl = "http://local host" }, "ethereum.rpcUrl"},
+		{"chain id", func(c *GbeConfig) { c.Ethereum.ChainId = 0 }, "ethereum.chainId"},
+		{"exchange address", func(c *GbeConfig) { c.Ethereum.ExchangeAddress = "0x48bacb" }, "ethereum.exchangeAddress"},
+		{"redis addr without port", func(c *GbeConfig) { c.Redis.Addr = "localhost" }, "redis.addr"},
+		{"no kafka broker", func(c *GbeConfig) { c.Kafka.Brokers = nil }, "kafka.brokers"},
+		{"kafka broker without host", func(c *GbeConfig) { c.Kafka.Brokers = []string{":9092"} }, "kafka.brokers[0]"},
+		{"trusted proxy", func(c *GbeConfig) { c.RestServer.TrustedProxies = []string{"10.0.0.0/33"} }, "restServer.trustedProxies[0]"},
+		{"negative rate limit", func(c *GbeConfig) { c.RestServer.RateLimits.Read.PerIpRate = -1 }, "restServer.rateLimits.read"},
+		{"match encoding", func(c *GbeConfig) { c.Match.Encoding = "xml" }, "match.encoding"},
+		{"unsorted fee schedule", func(c *GbeConfig) { c.Fee.DefaultSchedule[0].MinVolume = 2000 }, "fee.defaultSchedule"},
+		{"settlement gas limit", func(c *GbeConfig) { c.Settlement.GasLimit = 0 }, "settlement.gasLimit"},
+		{"log level", func(c *GbeConfig) { c.Logging.Levels["match"] = "verbose" }, "logging.levels.match"},
+		{"short jwt secret", func(c *GbeConfig) { c.JwtSecret = "secret" }, "jwtSecret"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newValidConfig()
+			test.change(c)
+			err := c.Validate()
+			if len(test.field) == 0 {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), "\n  "+test.field+": ") {
+				t.Fatalf("expected %v to be invalid, got %v", test.field, err)
+			}
+		})
+	}
+}
+
+// every invalid field of the validated sections is reported at once, the other sections are not checked
+func TestValidateSections(t *testing.T) {
+	c := newValidConfig()
+	c.Ethereum.RpcUrl = "localhost:8545"
+	c.Ethereum.ChainId = 0
+	c.Kafka.Brokers = nil
+
+	err := c.Validate(SectionEthereum)
+	if err == nil {
+		t.Fatal("expected the ethereum section to be invalid")
+	}
+	for _, field := range []string{"ethereum.chainId", "ethereum.rpcUrl"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatalf("%v not reported: %v", field, err)
+		}
+	}
+	if strings.Contains(err.Error(), "kafka") {
+		t.Fatalf("kafka reported when only ethereum is validated: %v", err)
+	}
+
+	if err := c.Validate("unknown"); err == nil {
+		t.Fatal("expected an error for an unknown section")
+	}
+}
+
+// the secrets are never included in the errors
+func TestValidateHidesSecrets(t *testing.T) {
+	c := newValidConfig()
+	c.Settlement.PrivateKey = "0x" + strings.Repeat("ab", 31)
+	c.Ethereum.RpcUrl = "ftp://mainnet.example.com/v3/secretkey"
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatal("expected the config to be invalid")
+	}
+	if strings.Contains(err.Error(), strings.Repeat("ab", 31)) || strings.Contains(err.Error(), "secretkey") {
+		t.Fatalf("secret included in the error: %v", err)
+	}
+}
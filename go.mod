@@ -3,11 +3,18 @@ module github.com/zimengpan/go-boomflow
 go 1.12
 
 require (
+	github.com/alicebob/miniredis/v2 v2.14.1
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/emirpasic/gods v1.12.0
+	github.com/ethereum/go-ethereum v1.9.25
 	github.com/gin-gonic/gin v1.4.0
 	github.com/gitbitex/gitbitex-spot v0.0.0-20191101075759-8f83a76d4423
+	github.com/go-redis/redis v6.15.2+incompatible
 	github.com/gorilla/mux v1.7.3
+	github.com/prometheus/client_golang v1.7.1
 	github.com/segmentio/kafka-go v0.3.4
 	github.com/shopspring/decimal v0.0.0-20191009025716-f1972eb1d1f5
 	github.com/siddontang/go-log v0.0.0-20190221022429-1e957dd83bed
+	github.com/sirupsen/logrus v1.4.2
+	google.golang.org/protobuf v1.23.0
 )
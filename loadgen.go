@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/loadgen"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+const loadgenCommand = "loadgen"
+
+// flags of the generated orders
+type generatorFlags struct {
+	configPath  *string
+	productId   *string
+	seed        *int64
+	makers      *int
+	mid         *float64
+	volatility  *float64
+	spread      *float64
+	crossRatio  *float64
+	marketRatio *float64
+	cancelRatio *float64
+}
+
+func newGeneratorFlags(flags *flag.FlagSet) *generatorFlags {
+	return &generatorFlags{
+		configPath:  flags.String("config", conf.DefaultConfigPath, "path of the config file, the orders are signed for its exchange and pay its fees"),
+		productId:   flags.String("product", "1", "id of the product of the orders"),
+		seed:        flags.Int64("seed", 1, "seed of the random orders, the same seed generates the same orders"),
+		makers:      flags.Int("makers", 10, "number of makers of each worker"),
+		mid:         flags.Float64("mid", 100, "starting mid price"),
+		volatility:  flags.Float64("volatility", 0.0005, "relative move of the mid price per order"),
+		spread:      flags.Float64("spread", 0.01, "max relative distance of limit prices from the mid"),
+		crossRatio:  flags.Float64("cross-ratio", 0.2, "probability of a limit order to cross the mid"),
+		marketRatio: flags.Float64("market-ratio", 0.05, "probability of a market order"),
+		cancelRatio: flags.Float64("cancel-ratio", 0.3, "probability of cancelling an open order instead of placing one"),
+	}
+}
+
+func (f *generatorFlags) config() (*loadgen.Config, error) {
+	conf.SetConfigPath(*f.configPath)
+	gbeConfig, err := conf.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+	err = gbeConfig.Validate(conf.SectionEthereum, conf.SectionFee)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := service.GetProductById(*f.productId)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, errors.New(fmt.Sprintf("product not found: %v", *f.productId))
+	}
+	baseAsset, err := service.GetAssetByCurrency(product.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	quoteAsset, err := service.GetAssetByCurrency(product.QuoteCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if baseAsset == nil || quoteAsset == nil {
+		return nil, errors.New(fmt.Sprintf("asset not found: %v - %v", product.BaseCurrency, product.QuoteCurrency))
+	}
+	if len(gbeConfig.Fee.RecipientAddresses) == 0 {
+		return nil, errors.New("no fee recipient address configured")
+	}
+
+	// new makers have no volume and pay the fees of the first tier
+	tier, err := service.GetFeeTier(product.Id, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &loadgen.Config{
+		Seed:            *f.seed,
+		Product:         product,
+		BaseAsset:       baseAsset,
+		QuoteAsset:      quoteAsset,
+		Makers:          *f.makers,
+		Mid:             *f.mid,
+		Volatility:      *f.volatility,
+		Spread:          *f.spread,
+		CrossRatio:      *f.crossRatio,
+		MarketRatio:     *f.marketRatio,
+		CancelRatio:     *f.cancelRatio,
+		ChainId:         gbeConfig.Ethereum.ChainId,
+		ExchangeAddress: common.HexToAddress(gbeConfig.Ethereum.ExchangeAddress),
+		FeeRecipient:    gbeConfig.Fee.RecipientAddresses[0],
+		FeeRate:         tier.TakerFeeRate,
+	}, nil
+}
+
+// gbe loadgen: sends random orders to the REST API, to the order topic or to an order file
+func runLoadgen(args []string) error {
+	flags := flag.NewFlagSet(loadgenCommand, flag.ExitOnError)
+	generator := newGeneratorFlags(flags)
+	target := flags.String("target", "rest", "where the orders are sent: rest, kafka (the order topic) or file")
+	url := flags.String("url", "http://localhost:8001", "base url of the REST API, for -target rest")
+	output := flags.String("output", "orders.jsonl", "file the orders are written to, for -target file; it can be replayed with the replay command")
+	firstId := flags.Int64("first-id", time.Now().Unix()*1000, "id of the first order, for -target kafka and file")
+	concurrency := flags.Int("concurrency", 4, "number of workers sending orders")
+	rate := flags.Float64("rate", 100, "requests per second of all the workers together, 0 for no limit")
+	duration := flags.Duration("duration", 10*time.Second, "duration of the load, 0 for no limit")
+	count := flags.Int64("count", 0, "number of requests, 0 for no limit")
+	_ = flags.Parse(args)
+
+	config, err := generator.config()
+	if err != nil {
+		return err
+	}
+
+	var newTarget func(g *loadgen.Generator) (loadgen.Target, error)
+	var fileTarget *loadgen.OrderTarget
+	switch *target {
+	case "rest":
+		newTarget = func(g *loadgen.Generator) (loadgen.Target, error) {
+			return loadgen.NewRestTarget(*url, g.Makers()), nil
+		}
+	case "kafka":
+		err = conf.GetConfig().Validate(conf.SectionKafka)
+		if err != nil {
+			return err
+		}
+		kafkaTarget := loadgen.NewKafkaTarget(*firstId)
+		newTarget = func(g *loadgen.Generator) (loadgen.Target, error) {
+			return kafkaTarget, nil
+		}
+	case "file":
+		fileTarget, err = loadgen.NewFileTarget(*output, *firstId)
+		if err != nil {
+			return err
+		}
+		newTarget = func(g *loadgen.Generator) (loadgen.Target, error) {
+			return fileTarget, nil
+		}
+	default:
+		return errors.New(fmt.Sprintf("unknown target: %v", *target))
+	}
+
+	report, err := loadgen.Run(loadgen.RunConfig{
+		Generator:   *config,
+		Concurrency: *concurrency,
+		Rate:        *rate,
+		Duration:    *duration,
+		Count:       *count,
+	}, newTarget)
+	if fileTarget != nil {
+		closeErr := fileTarget.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	report.Print(os.Stdout)
+	return nil
+}
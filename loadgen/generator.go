@@ -0,0 +1,238 @@
+package loadgen
+
+import (
+	"crypto/ecdsa"
+	"math"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	nullAddress = "0x0000000000000000000000000000000000000000"
+
+	// price precision of the order book
+	priceScale = 16
+)
+
+// sizes are multiples of 0.25 base with only 2 and 5 as factors, so that an integer amount of quote
+// divided by the size is a price with a few decimals, even for a quote asset without decimals
+var sizeMultiples = []int64{1, 2, 4, 5, 8, 10, 16, 20, 25, 32, 40}
+
+type Config struct {
+	Seed int64
+
+	Product    *models.Product
+	BaseAsset  *models.Asset
+	QuoteAsset *models.Asset
+
+	// number of makers, their keys are derived from the seed
+	Makers int
+
+	// starting mid price, it moves by a random walk of Volatility (relative) per order
+	Mid        float64
+	Volatility float64
+
+	// limit prices are spread around the mid up to Spread (relative) on both sides,
+	// a limit order crosses the mid with probability CrossRatio
+	Spread     float64
+	CrossRatio float64
+
+	// probability of a market order and of a cancellation of an open order
+	MarketRatio float64
+	CancelRatio float64
+
+	// fields of the 0x orders, the fees are the minimum required by the fee rate. The orders may take, so
+	// the rate is the taker rate of the fee tier, paid as maker fee like every order of the relayer
+	ChainId         int64
+	ExchangeAddress common.Address
+	FeeRecipient    string
+	FeeRate         float64
+}
+
+// Action is the next request of the load: an order to place, or a placed order to cancel
+type Action struct {
+	Order  *models.Order
+	Cancel bool
+}
+
+// Generator produces a realistic random flow of signed 0x orders: limit orders on both sides around a
+// moving mid, market orders and cancellations of the orders placed before. It is not safe for concurrent use.
+type Generator struct {
+	config Config
+	rand   *rand.Rand
+	makers []*ecdsa.PrivateKey
+	mid    float64
+	salt   int64
+
+	// placed orders that may still be open, candidates for cancellation
+	open []*models.Order
+}
+
+func NewGenerator(config Config) *Generator {
+	g := &Generator{
+		config: config,
+		rand:   rand.New(rand.NewSource(config.Seed)),
+		mid:    config.Mid,
+	}
+	for i := 0; i < config.Makers || i == 0; i++ {
+		g.makers = append(g.makers, makerKey(config.Seed, i))
+	}
+	return g
+}
+
+// the keys of the makers only depend on the seed, so that a load can be replayed
+func makerKey(seed int64, i int) *ecdsa.PrivateKey {
+	hash := crypto.Keccak256([]byte("gbe-loadgen"), big.NewInt(seed).Bytes(), big.NewInt(int64(i)).Bytes())
+	key, err := crypto.ToECDSA(hash)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+// Makers returns the keys of the makers, the REST target signs them in with these keys
+func (g *Generator) Makers() []*ecdsa.PrivateKey {
+	return g.makers
+}
+
+// Placed records an order accepted by the target, with the id the target assigned to it
+func (g *Generator) Placed(order *models.Order) {
+	if order.Type == models.OrderTypeLimit {
+		g.open = append(g.open, order)
+	}
+}
+
+func (g *Generator) Next() *Action {
+	g.mid *= math.Exp(g.config.Volatility * g.rand.NormFloat64())
+
+	if len(g.open) > 0 && g.rand.Float64() < g.config.CancelRatio {
+		i := g.rand.Intn(len(g.open))
+		order := g.open[i]
+		g.open[i] = g.open[len(g.open)-1]
+		g.open = g.open[:len(g.open)-1]
+		return &Action{Order: order, Cancel: true}
+	}
+
+	side := models.SideBuy
+	if g.rand.Intn(2) == 0 {
+		side = models.SideSell
+	}
+
+	orderType := models.OrderTypeLimit
+	if g.rand.Float64() < g.config.MarketRatio {
+		orderType = models.OrderTypeMarket
+	}
+
+	// buy orders rest below the mid and sell orders above it, unless they cross
+	distance := g.rand.Float64() * g.config.Spread
+	if orderType == models.OrderTypeMarket || g.rand.Float64() < g.config.CrossRatio {
+		distance = -distance
+	}
+	price := g.mid * (1 + distance)
+	if side == models.SideBuy {
+		price = g.mid * (1 - distance)
+	}
+
+	size := decimal.New(sizeMultiples[g.rand.Intn(len(sizeMultiples))], 0).Mul(decimal.New(25, -2))
+	return &Action{Order: g.newOrder(side, orderType, size, price)}
+}
+
+// build the 0x order of the maker, and the book fields the REST server derives from its amounts
+func (g *Generator) newOrder(side models.Side, orderType models.OrderType, size decimal.Decimal, price float64) *models.Order {
+	key := g.makers[g.rand.Intn(len(g.makers))]
+	g.salt++
+
+	limitPrice := decimal.NewFromFloat(price)
+	if increment := g.config.Product.PriceIncrement; increment.GreaterThan(decimal.Zero) {
+		limitPrice = limitPrice.Div(increment).Round(0).Mul(increment)
+	}
+
+	// quote amount in the smallest unit of the quote asset, at least one unit
+	quoteAmount := size.Mul(limitPrice).Shift(g.config.QuoteAsset.Decimals).Round(0)
+	if quoteAmount.LessThan(decimal.New(1, 0)) {
+		quoteAmount = decimal.New(1, 0)
+	}
+	baseAmount := size.Shift(g.config.BaseAsset.Decimals)
+
+	order := &models.Order{
+		CreatedAt:             time.Now(),
+		MakerAddress:          crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		TakerAddress:          nullAddress,
+		FeeRecipientAddress:   g.config.FeeRecipient,
+		SenderAddress:         nullAddress,
+		ExpirationTimeSeconds: decimal.New(time.Now().Add(24*time.Hour).Unix(), 0),
+		Salt:                  decimal.New(g.config.Seed, 0).Shift(9).Add(decimal.New(g.salt, 0)),
+		Side:                  side,
+		Type:                  orderType,
+		ProductId:             g.config.Product.Id,
+		Status:                models.OrderStatusNew,
+		TimeInForce:           models.TimeInForceGTC,
+		Size:                  size,
+		Funds:                 quoteAmount.Shift(-g.config.QuoteAsset.Decimals),
+	}
+	order.Price = order.Funds.DivRound(order.Size, priceScale)
+	if orderType == models.OrderTypeMarket {
+		order.TimeInForce = models.TimeInForceIOC
+	}
+
+	order.MakerAssetData, order.TakerAssetData = g.config.BaseAsset.AssetData, g.config.QuoteAsset.AssetData
+	order.MakerAssetAmount, order.TakerAssetAmount = baseAmount, quoteAmount
+	if side == models.SideBuy {
+		order.MakerAssetData, order.TakerAssetData = order.TakerAssetData, order.MakerAssetData
+		order.MakerAssetAmount, order.TakerAssetAmount = order.TakerAssetAmount, order.MakerAssetAmount
+	}
+	order.MakerFeeAssetData, order.TakerFeeAssetData = order.MakerAssetData, order.TakerAssetData
+	order.MakerFee = order.MakerAssetAmount.Mul(decimal.NewFromFloat(g.config.FeeRate)).Ceil()
+	order.TakerFee = decimal.Zero
+
+	g.sign(order, key)
+	return order
+}
+
+func (g *Generator) sign(order *models.Order, key *ecdsa.PrivateKey) {
+	zeroExOrder, err := zeroex.NewOrder(order)
+	if err != nil {
+		panic(err)
+	}
+	hash := zeroExOrder.Hash(g.config.ChainId, g.config.ExchangeAddress)
+
+	sig, err := crypto.Sign(hash.Bytes(), key)
+	if err != nil {
+		panic(err)
+	}
+
+	// v, r, s followed by the signature type
+	signature := append([]byte{sig[64] + 27}, sig[:64]...)
+	order.Hash = hash.Hex()
+	order.Signature = hexutil.Encode(append(signature, zeroex.SignatureTypeEIP712))
+}
+
+// GenerateCommands returns n messages of the order topic as the engine would read them: placed orders with
+// increasing ids, and cancel requests of orders placed before
+func GenerateCommands(config Config, n int) []*match.Command {
+	generator := NewGenerator(config)
+	commands := make([]*match.Command, 0, n)
+	for len(commands) < n {
+		action := generator.Next()
+		if action.Cancel {
+			cancel := match.NewCancelCommand(action.Order, "", "")
+			cancel.SubmittedAt = action.Order.CreatedAt.Add(time.Millisecond)
+			commands = append(commands, cancel)
+			continue
+		}
+		action.Order.Id = int64(len(commands) + 1)
+		action.Order.UpdatedAt = action.Order.CreatedAt
+		commands = append(commands, match.NewPlaceCommand(action.Order))
+		generator.Placed(action.Order)
+	}
+	return commands
+}
@@ -0,0 +1,194 @@
+package loadgen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+type RunConfig struct {
+	Generator Config
+
+	// number of workers, each one with its own generator seeded from Generator.Seed
+	Concurrency int
+	// requests per second of all the workers together, 0 for no limit
+	Rate float64
+	// the run stops after Duration or after Count requests, whichever comes first; 0 for no limit
+	Duration time.Duration
+	Count    int64
+}
+
+// Report is the result of a run
+type Report struct {
+	Elapsed  time.Duration
+	Places   int64
+	Cancels  int64
+	Errors   map[string]int64
+	Latency  Percentiles
+	firstErr map[string]string
+}
+
+// Run sends the generated load to the target of every worker and reports the throughput, latency and
+// errors. newTarget is called once per worker with the makers of its generator.
+func Run(config RunConfig, newTarget func(g *Generator) (Target, error)) (*Report, error) {
+	if config.Concurrency <= 0 {
+		config.Concurrency = 1
+	}
+	if config.Duration <= 0 && config.Count <= 0 {
+		return nil, errors.New("either a duration or a count is required")
+	}
+
+	var interval time.Duration
+	if config.Rate > 0 {
+		interval = time.Duration(float64(time.Second) * float64(config.Concurrency) / config.Rate)
+	}
+
+	var deadline time.Time
+	if config.Duration > 0 {
+		deadline = time.Now().Add(config.Duration)
+	}
+
+	type result struct {
+		report    *Report
+		latencies []time.Duration
+	}
+	results := make([]result, config.Concurrency)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < config.Concurrency; i++ {
+		generatorConfig := config.Generator
+		generatorConfig.Seed = config.Generator.Seed + int64(i)
+		generator := NewGenerator(generatorConfig)
+
+		target, err := newTarget(generator)
+		if err != nil {
+			return nil, err
+		}
+
+		// the count is shared evenly by the workers
+		count := int64(-1)
+		if config.Count > 0 {
+			count = config.Count / int64(config.Concurrency)
+			if int64(i) < config.Count%int64(config.Concurrency) {
+				count++
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, generator *Generator, target Target) {
+			defer wg.Done()
+			r := &results[i]
+			r.report, r.latencies = runWorker(generator, target, interval, deadline, count)
+		}(i, generator, target)
+	}
+	wg.Wait()
+
+	report := &Report{Elapsed: time.Since(start), Errors: map[string]int64{}, firstErr: map[string]string{}}
+	var latencies []time.Duration
+	for _, r := range results {
+		report.Places += r.report.Places
+		report.Cancels += r.report.Cancels
+		for kind, n := range r.report.Errors {
+			report.Errors[kind] += n
+			if _, found := report.firstErr[kind]; !found {
+				report.firstErr[kind] = r.report.firstErr[kind]
+			}
+		}
+		latencies = append(latencies, r.latencies...)
+	}
+	report.Latency = NewPercentiles(latencies)
+	return report, nil
+}
+
+func runWorker(generator *Generator, target Target, interval time.Duration, deadline time.Time,
+	count int64) (*Report, []time.Duration) {
+	report := &Report{Errors: map[string]int64{}, firstErr: map[string]string{}}
+	var latencies []time.Duration
+
+	next := time.Now()
+	for n := int64(0); count < 0 || n < count; n++ {
+		if interval > 0 {
+			time.Sleep(time.Until(next))
+			next = next.Add(interval)
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+
+		action := generator.Next()
+		start := time.Now()
+		var err error
+		if action.Cancel {
+			err = target.Cancel(action.Order)
+			report.Cancels++
+		} else {
+			err = target.Place(action.Order)
+			report.Places++
+		}
+		latencies = append(latencies, time.Since(start))
+
+		if err != nil {
+			kind := "error"
+			if statusErr, ok := err.(*StatusError); ok {
+				kind = fmt.Sprintf("http %v", statusErr.StatusCode)
+			}
+			if action.Cancel {
+				kind = "cancel: " + kind
+			} else {
+				kind = "place: " + kind
+			}
+			report.Errors[kind]++
+			if _, found := report.firstErr[kind]; !found {
+				report.firstErr[kind] = err.Error()
+			}
+			continue
+		}
+		if !action.Cancel {
+			generator.Placed(action.Order)
+		}
+	}
+	return report, latencies
+}
+
+func (r *Report) Print(w io.Writer) {
+	requests := r.Places + r.Cancels
+	_, _ = fmt.Fprintf(w, "requests:   %v (%v places, %v cancels) in %v\n", requests, r.Places, r.Cancels,
+		r.Elapsed.Round(time.Millisecond))
+	_, _ = fmt.Fprintf(w, "throughput: %.1f requests/s\n", float64(requests)/r.Elapsed.Seconds())
+	_, _ = fmt.Fprintf(w, "latency:    %v\n", r.Latency)
+
+	kinds := make([]string, 0, len(r.Errors))
+	for kind := range r.Errors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	for _, kind := range kinds {
+		_, _ = fmt.Fprintf(w, "errors:     %v %v, e.g. %v\n", r.Errors[kind], kind, r.firstErr[kind])
+	}
+}
+
+// Percentiles summarizes a distribution of latencies
+type Percentiles struct {
+	P50, P90, P99, P999, Max time.Duration
+}
+
+func NewPercentiles(latencies []time.Duration) Percentiles {
+	if len(latencies) == 0 {
+		return Percentiles{}
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	at := func(p float64) time.Duration {
+		return sorted[int(p*float64(len(sorted)-1))]
+	}
+	return Percentiles{P50: at(0.5), P90: at(0.9), P99: at(0.99), P999: at(0.999), Max: sorted[len(sorted)-1]}
+}
+
+func (p Percentiles) String() string {
+	return fmt.Sprintf("p50 %v, p90 %v, p99 %v, p99.9 %v, max %v", p.P50, p.P90, p.P99, p.P999, p.Max)
+}
@@ -0,0 +1,248 @@
+package loadgen
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// Target receives the load. Place sets the id of the order on success.
+// Implementations are safe for concurrent use.
+type Target interface {
+	Place(order *models.Order) error
+	Cancel(order *models.Order) error
+}
+
+// StatusError is returned by the REST target for a response other than 200
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("http %v: %v", e.StatusCode, e.Message)
+}
+
+// RestTarget places and cancels orders through the REST API, signing in every maker on its first request
+type RestTarget struct {
+	url    string
+	client *http.Client
+	makers map[string]*ecdsa.PrivateKey
+
+	mutex  sync.Mutex
+	tokens map[string]string
+}
+
+func NewRestTarget(url string, makers []*ecdsa.PrivateKey) *RestTarget {
+	t := &RestTarget{
+		url:    strings.TrimSuffix(url, "/"),
+		client: &http.Client{Timeout: 10 * time.Second},
+		makers: map[string]*ecdsa.PrivateKey{},
+		tokens: map[string]string{},
+	}
+	for _, key := range makers {
+		t.makers[strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())] = key
+	}
+	return t
+}
+
+func (t *RestTarget) Place(order *models.Order) error {
+	token, err := t.token(order.MakerAddress)
+	if err != nil {
+		return err
+	}
+
+	// the order JSON carries the 0x fields under the names of the place order request
+	req := map[string]interface{}{
+		"hash":                  order.Hash,
+		"makerAddress":          order.MakerAddress,
+		"takerAddress":          order.TakerAddress,
+		"feeRecipientAddress":   order.FeeRecipientAddress,
+		"senderAddress":         order.SenderAddress,
+		"makerAssetAmount":      order.MakerAssetAmount,
+		"takerAssetAmount":      order.TakerAssetAmount,
+		"makerFee":              order.MakerFee,
+		"takerFee":              order.TakerFee,
+		"expirationTimeSeconds": order.ExpirationTimeSeconds,
+		"salt":                  order.Salt,
+		"makerAssetData":        order.MakerAssetData,
+		"takerAssetData":        order.TakerAssetData,
+		"makerFeeAssetData":     order.MakerFeeAssetData,
+		"takerFeeAssetData":     order.TakerFeeAssetData,
+		"signature":             order.Signature,
+		"type":                  order.Type,
+		"timeInForce":           order.TimeInForce,
+	}
+	var placed models.Order
+	err = t.do(http.MethodPost, "/api/orders", token, req, &placed)
+	if err != nil {
+		return err
+	}
+	order.Id = placed.Id
+	return nil
+}
+
+func (t *RestTarget) Cancel(order *models.Order) error {
+	token, err := t.token(order.MakerAddress)
+	if err != nil {
+		return err
+	}
+	return t.do(http.MethodDelete, fmt.Sprintf("/api/orders/%v", order.Id), token, nil, nil)
+}
+
+// sign in with personal_sign of the login message, the token is kept for the following requests
+func (t *RestTarget) token(makerAddress string) (string, error) {
+	makerAddress = strings.ToLower(makerAddress)
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if token, found := t.tokens[makerAddress]; found {
+		return token, nil
+	}
+
+	key, found := t.makers[makerAddress]
+	if !found {
+		return "", errors.New(fmt.Sprintf("unknown maker: %v", makerAddress))
+	}
+
+	var nonce struct{ Message string }
+	err := t.do(http.MethodPost, "/api/auth/nonce", "", map[string]string{"makerAddress": makerAddress}, &nonce)
+	if err != nil {
+		return "", err
+	}
+
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(nonce.Message), nonce.Message)))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		return "", err
+	}
+	sig[64] += 27
+
+	var token struct{ Token string }
+	err = t.do(http.MethodPost, "/api/auth/token", "",
+		map[string]string{"makerAddress": makerAddress, "signature": hexutil.Encode(sig)}, &token)
+	if err != nil {
+		return "", err
+	}
+	t.tokens[makerAddress] = token.Token
+	return token.Token, nil
+}
+
+func (t *RestTarget) do(method, path, token string, req interface{}, resp interface{}) error {
+	var body []byte
+	if req != nil {
+		var err error
+		body, err = json.Marshal(req)
+		if err != nil {
+			return err
+		}
+	}
+
+	httpReq, err := http.NewRequest(method, t.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if len(token) > 0 {
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer httpResp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return err
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return &StatusError{StatusCode: httpResp.StatusCode, Message: strings.TrimSpace(string(respBody))}
+	}
+	if resp == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, resp)
+}
+
+// OrderTarget bypasses the REST API and writes the orders as commands of the order topic, either to kafka
+// for a running engine or to a JSON lines file for a match.FileOrderReader. Ids are assigned locally.
+type OrderTarget struct {
+	submit func(productId string, command *match.Command) error
+	close  func() error
+	lastId int64
+}
+
+// NewKafkaTarget submits the orders to the order topic of their product
+func NewKafkaTarget(firstId int64) *OrderTarget {
+	return &OrderTarget{
+		submit: match.SubmitCommand,
+		close:  func() error { return nil },
+		lastId: firstId - 1,
+	}
+}
+
+// NewFileTarget writes the orders to a file that can be replayed with the replay command
+func NewFileTarget(path string, firstId int64) (*OrderTarget, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	writer := bufio.NewWriter(file)
+
+	var mutex sync.Mutex
+	return &OrderTarget{
+		submit: func(productId string, command *match.Command) error {
+			buf, err := json.Marshal(command)
+			if err != nil {
+				return err
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			_, err = writer.Write(append(buf, '\n'))
+			return err
+		},
+		close: func() error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			err := writer.Flush()
+			if err != nil {
+				_ = file.Close()
+				return err
+			}
+			return file.Close()
+		},
+		lastId: firstId - 1,
+	}, nil
+}
+
+func (t *OrderTarget) Place(order *models.Order) error {
+	order.Id = atomic.AddInt64(&t.lastId, 1)
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = order.CreatedAt
+	return t.submit(order.ProductId, match.NewPlaceCommand(order))
+}
+
+func (t *OrderTarget) Cancel(order *models.Order) error {
+	return t.submit(order.ProductId, match.NewCancelCommand(order, "", ""))
+}
+
+func (t *OrderTarget) Close() error {
+	return t.close()
+}
@@ -0,0 +1,74 @@
+package logging
+
+import (
+	"os"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+const (
+	// fields shared by the components to correlate the logs of one order
+	FieldComponent = "component"
+	FieldRequestId = "requestId"
+	FieldOrderId   = "orderId"
+	FieldOrderHash = "orderHash"
+	FieldProductId = "productId"
+	FieldMaker     = "maker"
+)
+
+var (
+	mu      sync.Mutex
+	loggers = map[string]*logrus.Entry{}
+	config  conf.LoggingConfig
+)
+
+// New returns the logger of a component. Logs are written to stdout as JSON with the component field,
+// the level is logging.levels[component] in the config, or logging.level when it is not set.
+// Loggers are usually created during package initialization, their levels are applied by Configure.
+func New(component string) *logrus.Entry {
+	mu.Lock()
+	defer mu.Unlock()
+
+	logger, found := loggers[component]
+	if found {
+		return logger
+	}
+
+	l := logrus.New()
+	l.Out = os.Stdout
+	l.Formatter = &logrus.JSONFormatter{}
+	l.Level = componentLevel(component)
+
+	logger = l.WithField(FieldComponent, component)
+	loggers[component] = logger
+	return logger
+}
+
+// Configure sets the levels of the existing and future loggers, it is called once the config is loaded
+func Configure(loggingConfig conf.LoggingConfig) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	config = loggingConfig
+	for component, logger := range loggers {
+		logger.Logger.SetLevel(componentLevel(component))
+	}
+}
+
+func componentLevel(component string) logrus.Level {
+	level, found := config.Levels[component]
+	if !found {
+		level = config.Level
+	}
+	if len(level) == 0 {
+		return logrus.InfoLevel
+	}
+
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
@@ -1,28 +1,123 @@
-package main
-
-import (
-	"net/http"
-
-	"github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/match"
-	"github.com/zimengpan/go-boomflow/rest"
-)
-
-func main() {
-	//gbeConfig := conf.GetConfig()
-
-	go func() {
-		log.Info(http.ListenAndServe("localhost:6060", nil))
-	}()
-
-	match.StartEngine()
-
-	/*products, err := service.GetProducts()
-	if err != nil {
-		panic(err)
-	}*/
-
-	rest.StartServer()
-
-	select {}
-}
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+)
+
+func main() {
+	flag.Usage = usage
+	configPath := flag.String("config", conf.DefaultConfigPath, "path of the config file, GBE_* environment variables override its fields")
+	printConfig := flag.Bool("print-config", false, "print the effective config with the secrets redacted and exit")
+	flag.Parse()
+
+	// flags are accepted before and after the role: gbe -config x.json engine, gbe engine -config x.json
+	if c, found := commands[flag.Arg(0)]; found {
+		err := c.run(flag.Args()[1:])
+		if err != nil {
+			exit(err)
+		}
+		return
+	}
+
+	roleName := defaultRole
+	if flag.NArg() > 0 {
+		roleName = flag.Arg(0)
+		err := flag.CommandLine.Parse(flag.Args()[1:])
+		if err != nil {
+			os.Exit(2)
+		}
+		if flag.NArg() > 0 {
+			exit(errors.New(fmt.Sprintf("unexpected arguments: %v", strings.Join(flag.Args(), " "))))
+		}
+	}
+	r, err := getRole(roleName)
+	if err != nil {
+		exit(err)
+	}
+
+	conf.SetConfigPath(*configPath)
+	gbeConfig, err := conf.LoadConfig()
+	if err != nil {
+		exit(err)
+	}
+	err = r.validate(gbeConfig)
+	if err != nil {
+		exit(err)
+	}
+	logging.Configure(gbeConfig.Logging)
+
+	if *printConfig {
+		bytes, err := json.MarshalIndent(gbeConfig.Redacted(), "", "    ")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(string(bytes))
+		return
+	}
+
+	if len(gbeConfig.Metrics.Addr) > 0 {
+		http.Handle("/metrics", promhttp.Handler())
+		go func() {
+			logging.New("main").Error(http.ListenAndServe(gbeConfig.Metrics.Addr, nil))
+		}()
+	}
+
+	err = r.start()
+	if err != nil {
+		exit(err)
+	}
+	logging.New("main").WithField("role", roleName).Info("started")
+
+	select {}
+}
+
+// one-off commands, they run instead of a role
+type command struct {
+	description string
+	run         func(args []string) error
+}
+
+var commands = map[string]*command{
+	replayCommand:  {description: "replay the orders of a product", run: runReplay},
+	loadgenCommand: {description: "send random orders to the REST API or the order topic", run: runLoadgen},
+	adminCommand:   {description: "halt or resume trading, expire or cancel orders of a product", run: runAdmin},
+}
+
+func commandNames() []string {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %v [flags] [role] [flags]\n\nRoles (default %v):\n", os.Args[0], defaultRole)
+	for _, name := range roleNames() {
+		fmt.Fprintf(out, "  %-8v %v\n", name, roles[name].description)
+	}
+	fmt.Fprintln(out, "\nCommands:")
+	for _, name := range commandNames() {
+		fmt.Fprintf(out, "  %-8v %v, see %v -h\n", name, commands[name].description, name)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+func exit(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
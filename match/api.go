@@ -1,44 +1,67 @@
-package match
-
-import (
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-// 用于撮合引擎读取order，需要支持设置offset，从指定的offset开始读取
-type OrderReader interface {
-	// 设置读取的起始offset
-	SetOffset(offset int64) error
-
-	// 拉取order
-	FetchOrder() (offset int64, order *models.Order, err error)
-}
-
-// 用于保存撮合日志
-type LogStore interface {
-	// 保存日志
-	Store(logs []interface{}) error
-}
-
-// 以观察者模式读取撮合日志
-type LogReader interface {
-	// 获取当前的productId
-	GetProductId() string
-
-	// 注册一个日志观察者
-	RegisterObserver(observer LogObserver)
-
-	// 开始执行读取log，读取到的log将会回调给观察者
-	Run(seq, offset int64)
-}
-
-// 撮合日志reader观察者
-type LogObserver interface {
-	// 当读到OpenLog时回调
-	OnOpenLog(log *OpenLog, offset int64)
-
-	// 当读到MatchLog时回调
-	OnMatchLog(log *MatchLog, offset int64)
-
-	// 当读到DoneLog是回调
-	OnDoneLog(log *DoneLog, offset int64)
-}
+package match
+
+import "fmt"
+
+// 用于撮合引擎读取order topic中的command，需要支持设置offset，从指定的offset开始读取
+type OrderReader interface {
+	// 设置读取的起始offset
+	SetOffset(offset int64) error
+
+	// 拉取command，消息无法解码时返回*OrderDecodeError，reader已经越过这条消息，可以继续拉取
+	FetchOrder() (offset int64, command *Command, err error)
+}
+
+// order topic中无法解码为command的消息
+type OrderDecodeError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *OrderDecodeError) Error() string {
+	return fmt.Sprintf("decode order at offset %v error: %v", e.Offset, e.Err)
+}
+
+// 用于保存撮合日志
+type LogStore interface {
+	// 保存日志，token为写入日志的leader的fencing token，随每条日志保存，没有选举时为0
+	Store(token int64, logs []interface{}) error
+
+	// 获取已经保存的最后一条日志的seq，没有日志时返回0，standby当选leader时用于接续旧leader的日志
+	LastSeq() (int64, error)
+}
+
+// 用于保存orderBook的快照，engine启动时从最新的快照恢复，只需要执行快照之后的order
+type SnapshotStore interface {
+	// 保存快照，快照包含的log必须都已经持久化
+	Store(snapshot *Snapshot) error
+
+	// 获取最新的快照，没有快照时返回nil
+	GetLatest() (*Snapshot, error)
+}
+
+// 以观察者模式读取撮合日志
+type LogReader interface {
+	// 获取当前的productId
+	GetProductId() string
+
+	// 注册一个日志观察者
+	RegisterObserver(observer LogObserver)
+
+	// 开始执行读取log，读取到的log将会回调给观察者
+	Run(seq, offset int64)
+}
+
+// 撮合日志reader观察者
+type LogObserver interface {
+	// 当读到OpenLog时回调
+	OnOpenLog(log *OpenLog, offset int64)
+
+	// 当读到MatchLog时回调
+	OnMatchLog(log *MatchLog, offset int64)
+
+	// 当读到DoneLog是回调
+	OnDoneLog(log *DoneLog, offset int64)
+
+	// 当读到ActivatedLog时回调
+	OnActivatedLog(log *ActivatedLog, offset int64)
+}
@@ -1,27 +1,51 @@
-package match
-
-import (
-	"github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/conf"
-	"github.com/zimengpan/go-boomflow/service"
-)
-
-func StartEngine() {
-	gbeConfig := conf.GetConfig()
-
-	products, err := service.GetProducts()
-	if err != nil {
-		panic(err)
-	}
-	for _, product := range products {
-		orderReader := NewKafkaOrderReader(product.Id, gbeConfig.Kafka.Brokers)
-		//snapshotStore := NewRedisSnapshotStore(product.Id)
-		//logStore := NewKafkaLogStore(product.Id, gbeConfig.Kafka.Brokers)
-		//matchEngine := NewEngine(product, orderReader, logStore, snapshotStore)
-		matchEngine := NewEngine(product, orderReader)
-
-		matchEngine.Start()
-	}
-
-	log.Info("match engine ok")
-}
+package match
+
+import (
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+var logger = logging.New("match")
+
+func StartEngine() {
+	gbeConfig := conf.GetConfig()
+
+	elector, err := NewElector(gbeConfig.Match.Election)
+	if err != nil {
+		panic(err)
+	}
+
+	codec, err := GetCodec(gbeConfig.Match.Encoding)
+	if err != nil {
+		panic(err)
+	}
+
+	products, err := service.GetProducts()
+	if err != nil {
+		panic(err)
+	}
+	// 快照保存在redis中，standby和重启的engine从leader最新的快照恢复；没有配置redis时不做快照
+	var redisClient *redis.Client
+	if len(gbeConfig.Redis.Addr) > 0 {
+		redisClient = redis.NewClient(&redis.Options{
+			Addr:     gbeConfig.Redis.Addr,
+			Password: gbeConfig.Redis.Password,
+		})
+	}
+
+	for _, product := range products {
+		orderReader := NewKafkaOrderReader(product.Id, gbeConfig.Kafka.Brokers)
+		var snapshotStore SnapshotStore
+		if redisClient != nil {
+			snapshotStore = NewRedisSnapshotStore(product.Id, redisClient)
+		}
+		logStore := NewKafkaLogStore(product.Id, gbeConfig.Kafka.Brokers, codec)
+		matchEngine := NewEngine(product, orderReader, logStore, snapshotStore, elector)
+
+		matchEngine.Start()
+	}
+
+	logger.Info("match engine ok")
+}
@@ -0,0 +1,221 @@
+package match
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// 消息的编码，写在消息头中
+type Encoding byte
+
+const (
+	EncodingJSON     = Encoding(1)
+	EncodingProtobuf = Encoding(2)
+)
+
+// 消息头为headerMagic加上一个字节的Encoding。JSON消息总是以'{'开始，不需要消息头，
+// 没有消息头的消息都按JSON解析，引入消息头之前写入的消息也可以读取
+const (
+	headerMagic = 0x00
+	headerSize  = 2
+)
+
+// 编码order topic中的command和log topic中的log，不包括消息头
+type Codec interface {
+	// 编码的名称，用于配置
+	Name() string
+
+	Encoding() Encoding
+
+	EncodeCommand(command *Command) ([]byte, error)
+
+	DecodeCommand(data []byte) (*Command, error)
+
+	EncodeLog(log Log) ([]byte, error)
+
+	DecodeLog(data []byte) (Log, error)
+}
+
+var codecs = map[Encoding]Codec{
+	EncodingJSON:     jsonCodec{},
+	EncodingProtobuf: protobufCodec{},
+}
+
+// 按照名称获取codec，名称为空时使用JSON
+func GetCodec(name string) (Codec, error) {
+	if len(name) == 0 {
+		return codecs[EncodingJSON], nil
+	}
+	for _, codec := range codecs {
+		if codec.Name() == name {
+			return codec, nil
+		}
+	}
+	return nil, errors.New(fmt.Sprintf("unknown encoding %q, expected one of %v", name, strings.Join(codecNames(), ", ")))
+}
+
+func codecNames() []string {
+	var names []string
+	for _, codec := range codecs {
+		names = append(names, codec.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 编码command，加上消息头
+func EncodeCommand(codec Codec, command *Command) ([]byte, error) {
+	body, err := codec.EncodeCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	return withHeader(codec.Encoding(), body), nil
+}
+
+// 解析order topic中的一条消息，按照消息头选择codec
+func DecodeCommand(data []byte) (*Command, error) {
+	codec, body, err := splitHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	command, err := codec.DecodeCommand(body)
+	if err != nil {
+		return nil, err
+	}
+	err = command.validate()
+	if err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+// 编码log，加上消息头
+func EncodeLog(codec Codec, log Log) ([]byte, error) {
+	body, err := codec.EncodeLog(log)
+	if err != nil {
+		return nil, err
+	}
+	return withHeader(codec.Encoding(), body), nil
+}
+
+// 解析log topic中的一条消息，按照消息头选择codec
+func DecodeLog(data []byte) (Log, error) {
+	codec, body, err := splitHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	return codec.DecodeLog(body)
+}
+
+func withHeader(encoding Encoding, body []byte) []byte {
+	if encoding == EncodingJSON {
+		return body
+	}
+	return append([]byte{headerMagic, byte(encoding)}, body...)
+}
+
+func splitHeader(data []byte) (Codec, []byte, error) {
+	if len(data) == 0 || data[0] != headerMagic {
+		return codecs[EncodingJSON], data, nil
+	}
+	if len(data) < headerSize {
+		return nil, nil, errors.New("message header is truncated")
+	}
+	codec, found := codecs[Encoding(data[1])]
+	if !found {
+		return nil, nil, errors.New(fmt.Sprintf("unknown encoding %v in message header", data[1]))
+	}
+	return codec, data[headerSize:], nil
+}
+
+func checkCommandVersion(version int) error {
+	if version > CommandVersion {
+		return errors.New(fmt.Sprintf("unsupported command version %v, expected at most %v", version, CommandVersion))
+	}
+	if version <= 0 {
+		return errors.New(fmt.Sprintf("invalid command version %v", version))
+	}
+	return nil
+}
+
+// JSON编码，decimal为字符串
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Encoding() Encoding {
+	return EncodingJSON
+}
+
+func (jsonCodec) EncodeCommand(command *Command) ([]byte, error) {
+	return json.Marshal(command)
+}
+
+// 没有版本的消息是引入command之前直接写入的order，转换为place或者cancel command
+func (jsonCodec) DecodeCommand(data []byte) (*Command, error) {
+	var header struct {
+		Version int
+	}
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.Version == 0 {
+		var order models.Order
+		err = json.Unmarshal(data, &order)
+		if err != nil {
+			return nil, err
+		}
+		return commandOfOrder(&order), nil
+	}
+	err = checkCommandVersion(header.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	var command Command
+	err = json.Unmarshal(data, &command)
+	if err != nil {
+		return nil, err
+	}
+	return &command, nil
+}
+
+func (jsonCodec) EncodeLog(log Log) ([]byte, error) {
+	return json.Marshal(log)
+}
+
+func (jsonCodec) DecodeLog(data []byte) (Log, error) {
+	var base Base
+	err := json.Unmarshal(data, &base)
+	if err != nil {
+		return nil, err
+	}
+
+	var log Log
+	switch base.Type {
+	case LogTypeOpen:
+		log = &OpenLog{}
+	case LogTypeMatch:
+		log = &MatchLog{}
+	case LogTypeDone:
+		log = &DoneLog{}
+	case LogTypeActivated:
+		log = &ActivatedLog{}
+	default:
+		return nil, errors.New(fmt.Sprintf("unknown log type %q", base.Type))
+	}
+	err = json.Unmarshal(data, log)
+	if err != nil {
+		return nil, err
+	}
+	return log, nil
+}
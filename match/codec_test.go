@@ -0,0 +1,274 @@
+package match
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+var testTime = time.Date(2020, 3, 1, 8, 30, 15, 123456789, time.UTC)
+
+// 所有字段都有值的order，检查每个字段都被编码
+func newTestOrder() *models.Order {
+	return &models.Order{
+		Id:                    42,
+		CreatedAt:             testTime,
+		UpdatedAt:             testTime.Add(time.Second),
+		Hash:                  "0xb01650a8ac36c665b6bee363e83db10787003c89dc2278e05d16de462ba46cd2",
+		MakerAddress:          "0x1D297954F3a6C293DDDe068BD462c1d5761de089",
+		TakerAddress:          "0x0000000000000000000000000000000000000000",
+		FeeRecipientAddress:   "0x0000000000000000000000000000000000000001",
+		SenderAddress:         "0x0000000000000000000000000000000000000002",
+		MakerAssetAmount:      decimal.RequireFromString("199"),
+		TakerAssetAmount:      decimal.RequireFromString("2000000000000000000"),
+		MakerFee:              decimal.RequireFromString("1"),
+		TakerFee:              decimal.RequireFromString("4000000000000000"),
+		ExpirationTimeSeconds: decimal.RequireFromString("1792499797"),
+		Salt:                  decimal.RequireFromString("1000000001"),
+		Side:                  models.SideSell,
+		Type:                  models.OrderTypeStopLimit,
+		ProductId:             "1",
+		MakerAssetData:        "0xf47261b0000000000000000000000000e41d2489571d322189246dafa5ebde1f4699f498",
+		TakerAssetData:        "0xf47261b0000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2",
+		MakerFeeAssetData:     "0xf47261b0000000000000000000000000e41d2489571d322189246dafa5ebde1f4699f498",
+		TakerFeeAssetData:     "0xf47261b0000000000000000000000000c02aaa39b223fe8d0a0e5c4f27ead9083c756cc2",
+		Signature:             "0x1caf4bc0fd4c130eff0fbc3cb474ea23276783ce87efacdb5fe3c33229086654d3",
+		Status:                models.OrderStatusNew,
+		Settled:               true,
+		TimeInForce:           models.TimeInForceGTT,
+		PostOnly:              true,
+		PostOnlyReprice:       true,
+		MaxSlippage:           decimal.RequireFromString("0.05"),
+		StopPrice:             decimal.RequireFromString("0.0015"),
+		DisplaySize:           decimal.RequireFromString("0.5"),
+		Size:                  decimal.RequireFromString("1.25"),
+		Funds:                 decimal.RequireFromString("0.001875"),
+		Price:                 decimal.RequireFromString("0.0014"),
+		CancelReason:          models.DoneReasonExpired,
+		RequestId:             "6b1d2f0c-8a41-4b5e-9d3a-0f6c2e7d9a11",
+	}
+}
+
+func newTestCommands() []*Command {
+	cancel := NewCancelCommand(newTestOrder(), models.DoneReasonUnfunded, "req-cancel")
+	cancel.SubmittedAt = testTime
+	cancelAll := NewCancelAllCommand("0x1D297954F3a6C293DDDe068BD462c1d5761de089", models.DoneReasonCancelled, "req-cancel-all")
+	cancelAll.SubmittedAt = testTime
+
+	commands := []*Command{NewPlaceCommand(newTestOrder()), cancel, cancelAll}
+	for _, commandType := range []CommandType{CommandTypeExpire, CommandTypeHalt, CommandTypeResume} {
+		command := NewCommand(commandType, "req-"+string(commandType))
+		command.SubmittedAt = testTime
+		commands = append(commands, command)
+	}
+	return commands
+}
+
+func newTestLogs() []Log {
+	return []Log{
+		&OpenLog{
+			Base:          Base{LogTypeOpen, 1, "1", testTime},
+			OrderId:       42,
+			RemainingSize: decimal.RequireFromString("1.25"),
+			Price:         decimal.RequireFromString("0.0014"),
+			Side:          models.SideSell,
+		},
+		&MatchLog{
+			Base:         Base{LogTypeMatch, 2, "1", testTime},
+			TradeId:      7,
+			TakerOrderId: 43,
+			MakerOrderId: 42,
+			Side:         models.SideSell,
+			Price:        decimal.RequireFromString("0.0014"),
+			Size:         decimal.RequireFromString("0.75"),
+		},
+		&DoneLog{
+			Base:          Base{LogTypeDone, 3, "1", testTime},
+			OrderId:       42,
+			OrderHash:     "0xb01650a8ac36c665b6bee363e83db10787003c89dc2278e05d16de462ba46cd2",
+			Price:         decimal.RequireFromString("0.0014"),
+			RemainingSize: decimal.RequireFromString("0.5"),
+			Reason:        models.DoneReasonCancelled,
+			Side:          models.SideSell,
+		},
+		&ActivatedLog{
+			Base:      Base{LogTypeActivated, 4, "1", testTime},
+			OrderId:   44,
+			StopPrice: decimal.RequireFromString("0.0015"),
+			LastPrice: decimal.RequireFromString("0.0016"),
+			Side:      models.SideBuy,
+		},
+	}
+}
+
+// 用JSON比较解码前后的值，decimal和time的内部表示可能不同
+func assertSameJSON(t *testing.T, expected, actual interface{}) {
+	t.Helper()
+
+	expectedJSON, err := json.Marshal(expected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actualJSON, err := json.Marshal(actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(expectedJSON, actualJSON) {
+		t.Fatalf("decoded\n%s\nexpected\n%s", actualJSON, expectedJSON)
+	}
+}
+
+func testCodecs(t *testing.T) []Codec {
+	var testCodecs []Codec
+	for _, name := range []string{"json", "protobuf"} {
+		codec, err := GetCodec(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testCodecs = append(testCodecs, codec)
+	}
+	return testCodecs
+}
+
+func TestCodecCommandRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs(t) {
+		for _, command := range newTestCommands() {
+			data, err := EncodeCommand(codec, command)
+			if err != nil {
+				t.Fatalf("%v: encode %v command: %v", codec.Name(), command.Type, err)
+			}
+			decoded, err := DecodeCommand(data)
+			if err != nil {
+				t.Fatalf("%v: decode %v command: %v", codec.Name(), command.Type, err)
+			}
+			assertSameJSON(t, command, decoded)
+		}
+	}
+}
+
+func TestCodecLogRoundTrip(t *testing.T) {
+	for _, codec := range testCodecs(t) {
+		for _, log := range newTestLogs() {
+			data, err := EncodeLog(codec, log)
+			if err != nil {
+				t.Fatalf("%v: encode log %v: %v", codec.Name(), log.GetSeq(), err)
+			}
+			decoded, err := DecodeLog(data)
+			if err != nil {
+				t.Fatalf("%v: decode log %v: %v", codec.Name(), log.GetSeq(), err)
+			}
+			assertSameJSON(t, log, decoded)
+		}
+	}
+}
+
+// 只有protobuf消息有消息头，JSON消息和引入消息头之前一样
+func TestCodecHeader(t *testing.T) {
+	command := NewCommand(CommandTypeHalt, "")
+
+	data, err := EncodeCommand(codecs[EncodingJSON], command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != '{' {
+		t.Fatalf("JSON command starts with %#x", data[0])
+	}
+
+	data, err = EncodeCommand(codecs[EncodingProtobuf], command)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[0] != headerMagic || Encoding(data[1]) != EncodingProtobuf {
+		t.Fatalf("protobuf command starts with %#x %#x", data[0], data[1])
+	}
+
+	_, err = DecodeCommand([]byte{headerMagic})
+	if err == nil {
+		t.Fatal("decoded a truncated header")
+	}
+	_, err = DecodeCommand([]byte{headerMagic, 0x7f})
+	if err == nil {
+		t.Fatal("decoded an unknown encoding")
+	}
+}
+
+func TestCodecCommandVersion(t *testing.T) {
+	_, err := DecodeCommand([]byte(`{"Version":2,"Type":"halt"}`))
+	if err == nil {
+		t.Fatal("decoded a command of a newer version")
+	}
+	_, err = DecodeCommand([]byte(`{"Version":1,"Type":"unknown"}`))
+	if err == nil {
+		t.Fatal("decoded an unknown command type")
+	}
+}
+
+// 引入command之前，order topic中是直接写入的order，撤单请求是状态为cancelling的order
+func TestDecodeLegacyOrder(t *testing.T) {
+	order := newTestOrder()
+	data, err := json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command, err := DecodeCommand(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != CommandTypePlace || command.Version != CommandVersion || command.RequestId != order.RequestId ||
+		!command.SubmittedAt.Equal(order.CreatedAt) {
+		t.Fatalf("legacy order decoded as %+v", command)
+	}
+	assertSameJSON(t, order, command.Order)
+
+	order.Status = models.OrderStatusCancelling
+	data, err = json.Marshal(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	command, err = DecodeCommand(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Command{
+		Version:     CommandVersion,
+		Type:        CommandTypeCancel,
+		RequestId:   order.RequestId,
+		SubmittedAt: order.UpdatedAt,
+		OrderId:     order.Id,
+		Side:        order.Side,
+		Reason:      order.CancelReason,
+	}
+	assertSameJSON(t, expected, command)
+}
+
+// 旧版本写入的消息，字段不全，decimal为字符串
+func TestDecodeLegacyOrderMessage(t *testing.T) {
+	place := `{"Id":1792413397000,"CreatedAt":"2026-10-19T12:36:37.39554802Z","UpdatedAt":"2026-10-19T12:36:37.39554802Z",` +
+		`"Hash":"0xb016","MakerAddress":"0x1D297954F3a6C293DDDe068BD462c1d5761de089","Side":"buy","Type":"limit",` +
+		`"ProductId":"1","Status":"new","TimeInForce":"GTC","Size":"2","Price":"0.0001","StopPrice":"0"}`
+	command, err := DecodeCommand([]byte(place))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != CommandTypePlace || command.Order.Id != 1792413397000 ||
+		!command.Order.Price.Equal(decimal.RequireFromString("0.0001")) {
+		t.Fatalf("legacy order decoded as %+v", command)
+	}
+
+	cancel := `{"Id":1792413397000,"CreatedAt":"2026-10-19T12:36:37.39554802Z","UpdatedAt":"2026-10-19T12:40:00Z",` +
+		`"Side":"buy","ProductId":"1","Status":"cancelling","CancelReason":"unfunded"}`
+	command, err = DecodeCommand([]byte(cancel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if command.Type != CommandTypeCancel || command.OrderId != 1792413397000 || command.Side != models.SideBuy ||
+		command.Reason != models.DoneReasonUnfunded || !command.SubmittedAt.Equal(time.Date(2026, 10, 19, 12, 40, 0, 0, time.UTC)) {
+		t.Fatalf("legacy cancel decoded as %+v", command)
+	}
+}
@@ -0,0 +1,137 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// order topic中消息格式的当前版本，消息格式发生不兼容的变化时增加
+const CommandVersion = 1
+
+type CommandType string
+
+const (
+	// 下单
+	CommandTypePlace = CommandType("place")
+	// 撤销一个订单
+	CommandTypeCancel = CommandType("cancel")
+	// 撤销一个maker在该product上的所有订单，包括止损单
+	CommandTypeCancelAll = CommandType("cancel_all")
+	// 以command的提交时间为当前时间，移除orderBook中所有已经过期的GTT订单
+	CommandTypeExpire = CommandType("expire")
+	// 暂停交易，暂停期间下单会被拒绝，撤单照常执行
+	CommandTypeHalt = CommandType("halt")
+	// 恢复交易
+	CommandTypeResume = CommandType("resume")
+)
+
+// Command是order topic中的一条消息，engine按顺序执行
+type Command struct {
+	// 消息格式的版本，为0的消息是旧版本直接写入的order
+	Version int
+	Type    CommandType
+	// 提交command的REST请求的id，用于追踪
+	RequestId string `json:",omitempty"`
+	// 提交的时间，command产生的log使用该时间，也是orderBook判断GTT订单是否过期的时钟
+	SubmittedAt time.Time
+
+	// place: 下单的order
+	Order *models.Order `json:",omitempty"`
+
+	// cancel: 撤销的order
+	OrderId int64       `json:",omitempty"`
+	Side    models.Side `json:",omitempty"`
+
+	// cancel_all: 撤销该maker的所有订单
+	MakerAddress string `json:",omitempty"`
+
+	// cancel, cancel_all: 订单DoneLog的reason，为空时为cancelled
+	Reason models.DoneReason `json:",omitempty"`
+}
+
+func NewPlaceCommand(order *models.Order) *Command {
+	return &Command{
+		Version:     CommandVersion,
+		Type:        CommandTypePlace,
+		RequestId:   order.RequestId,
+		SubmittedAt: order.CreatedAt,
+		Order:       order,
+	}
+}
+
+func NewCancelCommand(order *models.Order, reason models.DoneReason, requestId string) *Command {
+	return &Command{
+		Version:     CommandVersion,
+		Type:        CommandTypeCancel,
+		RequestId:   requestId,
+		SubmittedAt: time.Now(),
+		OrderId:     order.Id,
+		Side:        order.Side,
+		Reason:      reason,
+	}
+}
+
+func NewCancelAllCommand(makerAddress string, reason models.DoneReason, requestId string) *Command {
+	return &Command{
+		Version:      CommandVersion,
+		Type:         CommandTypeCancelAll,
+		RequestId:    requestId,
+		SubmittedAt:  time.Now(),
+		MakerAddress: makerAddress,
+		Reason:       reason,
+	}
+}
+
+// 用于expire，halt和resume等没有参数的command
+func NewCommand(commandType CommandType, requestId string) *Command {
+	return &Command{
+		Version:     CommandVersion,
+		Type:        commandType,
+		RequestId:   requestId,
+		SubmittedAt: time.Now(),
+	}
+}
+
+// 旧版本中撤单请求是状态为cancelling的order，log的时间是状态更新的时间
+func commandOfOrder(order *models.Order) *Command {
+	if order.Status == models.OrderStatusCancelling {
+		command := &Command{
+			Version:     CommandVersion,
+			Type:        CommandTypeCancel,
+			RequestId:   order.RequestId,
+			SubmittedAt: order.CreatedAt,
+			OrderId:     order.Id,
+			Side:        order.Side,
+			Reason:      order.CancelReason,
+		}
+		if order.UpdatedAt.After(order.CreatedAt) {
+			command.SubmittedAt = order.UpdatedAt
+		}
+		return command
+	}
+	return NewPlaceCommand(order)
+}
+
+func (c *Command) validate() error {
+	switch c.Type {
+	case CommandTypePlace:
+		if c.Order == nil {
+			return errors.New("place command without order")
+		}
+	case CommandTypeCancel:
+		if c.OrderId == 0 {
+			return errors.New("cancel command without order id")
+		}
+	case CommandTypeCancelAll:
+		if len(c.MakerAddress) == 0 {
+			return errors.New("cancel_all command without maker address")
+		}
+	case CommandTypeExpire, CommandTypeHalt, CommandTypeResume:
+	default:
+		return errors.New(fmt.Sprintf("unknown command type %q", c.Type))
+	}
+	return nil
+}
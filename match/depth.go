@@ -0,0 +1,395 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// depth is one side of the order book: price levels in an AVL tree keyed by the price in ticks, the best
+// level at the minimum, and the orders of each level in a FIFO list. Cancelling an order unlinks it from
+// its level in O(1), the visible size of every level is kept up to date for the level 2 book.
+type depth struct {
+	side models.Side
+
+	// all orders
+	orders map[int64]*BookOrder
+
+	// price levels, ordered from the best to the worst price
+	levels levelTree
+
+	// time priority of the last queued order
+	seq int64
+}
+
+// priceLevel is the queue of the orders at one price, and a node of the level tree
+type priceLevel struct {
+	// in ticks
+	price int64
+	// ticks for asks, negative ticks for bids, so that the best level has the smallest key
+	key int64
+
+	// sum of the visible size of the orders in lots
+	size  int64
+	count int
+
+	// orders in time priority
+	head, tail *BookOrder
+
+	left, right *priceLevel
+	height      int
+}
+
+// L2Level is the aggregated visible size at a price of the level 2 book
+type L2Level struct {
+	Price  decimal.Decimal
+	Size   decimal.Decimal
+	Orders int
+}
+
+func newDepth(side models.Side) *depth {
+	return &depth{
+		side:   side,
+		orders: map[int64]*BookOrder{},
+	}
+}
+
+func (d *depth) levelKey(price int64) int64 {
+	if d.side == models.SideBuy {
+		return -price
+	}
+	return price
+}
+
+// queue a new order behind all the orders at the same price, only its visible slice is shown for an iceberg order
+func (d *depth) add(order BookOrder) error {
+	if order.DisplaySize > 0 && order.Size > order.DisplaySize {
+		order.HiddenSize = order.Size - order.DisplaySize
+		order.Size = order.DisplaySize
+	}
+	d.seq++
+	order.Seq = d.seq
+	return d.put(order)
+}
+
+// put an order behind the orders at the same price with its time priority unchanged, used to restore from
+// snapshot, where the orders come in time priority
+func (d *depth) put(order BookOrder) error {
+	if order.Price <= 0 {
+		return errors.New(fmt.Sprintf("order %v has no price", order.OrderId))
+	}
+	if _, found := d.orders[order.OrderId]; found {
+		return errors.New(fmt.Sprintf("order %v is already on book", order.OrderId))
+	}
+
+	key := d.levelKey(order.Price)
+	level := d.levels.get(key)
+	if level != nil && level.size > math.MaxInt64-order.Size {
+		return errors.New(fmt.Sprintf("size of the level %v overflows with order %v", order.Price, order.OrderId))
+	}
+
+	if order.Seq > d.seq {
+		d.seq = order.Seq
+	}
+	if level == nil {
+		level = &priceLevel{price: order.Price, key: key}
+		d.levels.insert(level)
+	}
+
+	bookOrder := &order
+	bookOrder.level, bookOrder.prev, bookOrder.next = nil, nil, nil
+	level.push(bookOrder)
+	d.orders[order.OrderId] = bookOrder
+	return nil
+}
+
+// remove an order including its hidden size from the depth
+func (d *depth) remove(orderId int64) (*BookOrder, error) {
+	order, found := d.orders[orderId]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("order %v not found on book", orderId))
+	}
+
+	delete(d.orders, orderId)
+	d.unlink(order)
+	return order, nil
+}
+
+func (d *depth) decrSize(orderId int64, size int64) error {
+	order, found := d.orders[orderId]
+	if !found {
+		return errors.New(fmt.Sprintf("order %v not found on book", orderId))
+	}
+
+	if order.Size < size {
+		return errors.New(fmt.Sprintf("order %v Size %v less than %v", orderId, order.Size, size))
+	}
+
+	order.Size -= size
+	order.level.size -= size
+	if order.Size == 0 {
+		// the visible slice of an iceberg order is filled, replenish it with a fresh time priority
+		if order.HiddenSize > 0 {
+			level := order.level
+			level.unlink(order)
+			order.Size = order.DisplaySize
+			if order.HiddenSize < order.Size {
+				order.Size = order.HiddenSize
+			}
+			order.HiddenSize -= order.Size
+			d.seq++
+			order.Seq = d.seq
+			level.push(order)
+			return nil
+		}
+
+		delete(d.orders, orderId)
+		d.unlink(order)
+	}
+
+	return nil
+}
+
+// unlink an order from its level, the level is removed from the tree once it is empty
+func (d *depth) unlink(order *BookOrder) {
+	level := order.level
+	level.unlink(order)
+	if level.count == 0 {
+		d.levels.delete(level.key)
+	}
+}
+
+// the best order of the depth, nil if the depth is empty
+func (d *depth) best() *BookOrder {
+	if d.levels.min == nil {
+		return nil
+	}
+	return d.levels.min.head
+}
+
+// the size of the depth that the taker can fill immediately, skipping the expired orders
+func (d *depth) fillableSize(taker *BookOrder, now int64) int64 {
+	var fillable int64
+	d.levels.each(func(level *priceLevel) bool {
+		if !taker.crosses(level.price) {
+			return false
+		}
+		for order := level.head; order != nil && fillable < taker.Size; order = order.next {
+			if !order.expired(now) {
+				fillable = addInt64Saturated(fillable, addInt64Saturated(order.Size, order.HiddenSize))
+			}
+		}
+		return fillable < taker.Size
+	})
+	return fillable
+}
+
+// all orders of the depth in price-time priority
+func (d *depth) each(fn func(order *BookOrder)) {
+	d.levels.each(func(level *priceLevel) bool {
+		for order := level.head; order != nil; order = order.next {
+			fn(order)
+		}
+		return true
+	})
+}
+
+// the visible size of the best n price levels, all levels if n <= 0
+func (d *depth) level2(n int, units *bookUnits) []L2Level {
+	var levels []L2Level
+	d.levels.each(func(level *priceLevel) bool {
+		levels = append(levels, L2Level{
+			Price:  units.price.toDecimal(level.price),
+			Size:   units.size.toDecimal(level.size),
+			Orders: level.count,
+		})
+		return n <= 0 || len(levels) < n
+	})
+	return levels
+}
+
+// append an order to the tail of the level
+func (l *priceLevel) push(order *BookOrder) {
+	order.level = l
+	order.prev = l.tail
+	if l.tail == nil {
+		l.head = order
+	} else {
+		l.tail.next = order
+	}
+	l.tail = order
+	l.size += order.Size
+	l.count++
+}
+
+func (l *priceLevel) unlink(order *BookOrder) {
+	if order.prev == nil {
+		l.head = order.next
+	} else {
+		order.prev.next = order.next
+	}
+	if order.next == nil {
+		l.tail = order.prev
+	} else {
+		order.next.prev = order.prev
+	}
+	l.size -= order.Size
+	l.count--
+	order.level, order.prev, order.next = nil, nil, nil
+}
+
+// levelTree is an AVL tree of the price levels ordered by key, with the minimum cached
+type levelTree struct {
+	root *priceLevel
+	min  *priceLevel
+}
+
+func (t *levelTree) get(key int64) *priceLevel {
+	n := t.root
+	for n != nil {
+		if key < n.key {
+			n = n.left
+		} else if key > n.key {
+			n = n.right
+		} else {
+			return n
+		}
+	}
+	return nil
+}
+
+func (t *levelTree) insert(level *priceLevel) {
+	level.left, level.right, level.height = nil, nil, 1
+	t.root = insertLevel(t.root, level)
+	if t.min == nil || level.key < t.min.key {
+		t.min = level
+	}
+}
+
+func (t *levelTree) delete(key int64) {
+	t.root = deleteLevel(t.root, key)
+	if t.min != nil && t.min.key == key {
+		t.min = leftmostLevel(t.root)
+	}
+}
+
+// visit the levels in key order until fn returns false
+func (t *levelTree) each(fn func(level *priceLevel) bool) {
+	var stack []*priceLevel
+	n := t.root
+	for n != nil || len(stack) > 0 {
+		for n != nil {
+			stack = append(stack, n)
+			n = n.left
+		}
+		n = stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if !fn(n) {
+			return
+		}
+		n = n.right
+	}
+}
+
+func insertLevel(n, level *priceLevel) *priceLevel {
+	if n == nil {
+		return level
+	}
+	if level.key < n.key {
+		n.left = insertLevel(n.left, level)
+	} else {
+		n.right = insertLevel(n.right, level)
+	}
+	return balanceLevel(n)
+}
+
+func deleteLevel(n *priceLevel, key int64) *priceLevel {
+	if n == nil {
+		return nil
+	}
+	if key < n.key {
+		n.left = deleteLevel(n.left, key)
+	} else if key > n.key {
+		n.right = deleteLevel(n.right, key)
+	} else {
+		if n.left == nil {
+			return n.right
+		}
+		if n.right == nil {
+			return n.left
+		}
+		// replace the node by its successor
+		successor := leftmostLevel(n.right)
+		successor.right = deleteMinLevel(n.right)
+		successor.left = n.left
+		n = successor
+	}
+	return balanceLevel(n)
+}
+
+func deleteMinLevel(n *priceLevel) *priceLevel {
+	if n.left == nil {
+		return n.right
+	}
+	n.left = deleteMinLevel(n.left)
+	return balanceLevel(n)
+}
+
+func leftmostLevel(n *priceLevel) *priceLevel {
+	for n != nil && n.left != nil {
+		n = n.left
+	}
+	return n
+}
+
+func levelHeight(n *priceLevel) int {
+	if n == nil {
+		return 0
+	}
+	return n.height
+}
+
+func updateLevelHeight(n *priceLevel) {
+	n.height = 1 + levelHeight(n.left)
+	if h := 1 + levelHeight(n.right); h > n.height {
+		n.height = h
+	}
+}
+
+func rotateLevelLeft(n *priceLevel) *priceLevel {
+	r := n.right
+	n.right = r.left
+	r.left = n
+	updateLevelHeight(n)
+	updateLevelHeight(r)
+	return r
+}
+
+func rotateLevelRight(n *priceLevel) *priceLevel {
+	l := n.left
+	n.left = l.right
+	l.right = n
+	updateLevelHeight(n)
+	updateLevelHeight(l)
+	return l
+}
+
+func balanceLevel(n *priceLevel) *priceLevel {
+	updateLevelHeight(n)
+	switch balance := levelHeight(n.left) - levelHeight(n.right); {
+	case balance > 1:
+		if levelHeight(n.left.left) < levelHeight(n.left.right) {
+			n.left = rotateLevelLeft(n.left)
+		}
+		return rotateLevelRight(n)
+	case balance < -1:
+		if levelHeight(n.right.right) < levelHeight(n.right.left) {
+			n.right = rotateLevelRight(n.right)
+		}
+		return rotateLevelLeft(n)
+	}
+	return n
+}
@@ -0,0 +1,350 @@
+package match
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// checkLevelTree verifies the AVL invariants of the tree, the cached minimum and the sizes of the levels,
+// and returns the keys in order
+func checkLevelTree(t *testing.T, tree *levelTree) []int64 {
+	t.Helper()
+
+	var keys []int64
+	var check func(n *priceLevel, lower, upper *int64) int
+	check = func(n *priceLevel, lower, upper *int64) int {
+		if n == nil {
+			return 0
+		}
+		if lower != nil && n.key <= *lower || upper != nil && n.key >= *upper {
+			t.Fatalf("level %v is out of order", n.key)
+		}
+		left := check(n.left, lower, &n.key)
+		keys = append(keys, n.key)
+		right := check(n.right, &n.key, upper)
+
+		if left-right > 1 || right-left > 1 {
+			t.Fatalf("level %v is unbalanced: left height %v, right height %v", n.key, left, right)
+		}
+		height := 1 + left
+		if right >= left {
+			height = 1 + right
+		}
+		if n.height != height {
+			t.Fatalf("level %v has height %v, expected %v", n.key, n.height, height)
+		}
+
+		var size int64
+		var count int
+		for order := n.head; order != nil; order = order.next {
+			if order.level != n {
+				t.Fatalf("order %v does not point to its level %v", order.OrderId, n.key)
+			}
+			size += order.Size
+			count++
+		}
+		if n.size != size || n.count != count {
+			t.Fatalf("level %v has size %v and %v orders, expected %v and %v", n.key, n.size, n.count, size, count)
+		}
+		return height
+	}
+	check(tree.root, nil, nil)
+
+	if len(keys) == 0 {
+		if tree.min != nil {
+			t.Fatalf("empty tree caches the minimum %v", tree.min.key)
+		}
+	} else if tree.min == nil || tree.min.key != keys[0] {
+		t.Fatalf("cached minimum is %v, expected %v", tree.min, keys[0])
+	}
+	return keys
+}
+
+func assertKeys(t *testing.T, tree *levelTree, expected []int64) {
+	t.Helper()
+
+	keys := checkLevelTree(t, tree)
+	if len(keys) != len(expected) {
+		t.Fatalf("keys are %v, expected %v", keys, expected)
+	}
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("keys are %v, expected %v", keys, expected)
+		}
+	}
+}
+
+func newTestLevelTree(keys ...int64) *levelTree {
+	tree := &levelTree{}
+	for _, key := range keys {
+		tree.insert(&priceLevel{price: key, key: key})
+	}
+	return tree
+}
+
+func TestLevelTreeInsertRebalances(t *testing.T) {
+	// ascending, descending and zig-zag insertions need the four kinds of rotation
+	for _, keys := range [][]int64{
+		{1, 2, 3, 4, 5, 6, 7},
+		{7, 6, 5, 4, 3, 2, 1},
+		{5, 1, 3},
+		{1, 5, 3},
+	} {
+		tree := newTestLevelTree(keys...)
+		sorted := append([]int64(nil), keys...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		assertKeys(t, tree, sorted)
+	}
+
+	tree := newTestLevelTree(1, 2, 3, 4, 5, 6, 7)
+	if tree.root.key != 4 || tree.root.height != 3 {
+		t.Fatalf("root is %v with height %v, expected 4 with height 3", tree.root.key, tree.root.height)
+	}
+}
+
+func TestLevelTreeDeleteSuccessor(t *testing.T) {
+	//         4
+	//     2       6
+	//   1   3   5   7
+	tree := newTestLevelTree(4, 2, 6, 1, 3, 5, 7)
+
+	// the root has two children, it is replaced by its successor 5
+	tree.delete(4)
+	assertKeys(t, tree, []int64{1, 2, 3, 5, 6, 7})
+	if tree.root.key != 5 {
+		t.Fatalf("root is %v, expected the successor 5", tree.root.key)
+	}
+
+	// the successor 6 is the right child itself
+	tree.delete(5)
+	assertKeys(t, tree, []int64{1, 2, 3, 6, 7})
+
+	// removing the successor from a deeper right subtree rebalances it
+	tree = newTestLevelTree(4, 2, 8, 1, 3, 6, 10, 5, 7, 9, 11)
+	tree.delete(8)
+	assertKeys(t, tree, []int64{1, 2, 3, 4, 5, 6, 7, 9, 10, 11})
+	tree.delete(4)
+	assertKeys(t, tree, []int64{1, 2, 3, 5, 6, 7, 9, 10, 11})
+
+	// deleting a missing key changes nothing
+	tree.delete(100)
+	assertKeys(t, tree, []int64{1, 2, 3, 5, 6, 7, 9, 10, 11})
+}
+
+func TestLevelTreeMinAfterDelete(t *testing.T) {
+	tree := newTestLevelTree(5, 3, 8, 1, 4)
+	if tree.min.key != 1 {
+		t.Fatalf("minimum is %v, expected 1", tree.min.key)
+	}
+
+	for _, expected := range []int64{3, 4, 5, 8} {
+		tree.delete(tree.min.key)
+		checkLevelTree(t, tree)
+		if tree.min.key != expected {
+			t.Fatalf("minimum is %v, expected %v", tree.min.key, expected)
+		}
+	}
+
+	// deleting a level that is not the minimum keeps the cache
+	tree = newTestLevelTree(5, 3, 8)
+	tree.delete(8)
+	if tree.min.key != 3 {
+		t.Fatalf("minimum is %v, expected 3", tree.min.key)
+	}
+
+	tree.delete(3)
+	tree.delete(5)
+	assertKeys(t, tree, nil)
+	if tree.min != nil {
+		t.Fatalf("minimum of an empty tree is %v", tree.min.key)
+	}
+
+	// a smaller key inserted after deletes becomes the minimum
+	tree.insert(&priceLevel{price: 2, key: 2})
+	tree.insert(&priceLevel{price: 1, key: 1})
+	assertKeys(t, tree, []int64{1, 2})
+}
+
+func TestLevelTreeRandom(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tree := &levelTree{}
+	present := map[int64]bool{}
+
+	for i := 0; i < 5000; i++ {
+		key := rnd.Int63n(200)
+		if present[key] {
+			tree.delete(key)
+			delete(present, key)
+		} else {
+			tree.insert(&priceLevel{price: key, key: key})
+			present[key] = true
+		}
+
+		if i%50 == 0 {
+			var expected []int64
+			for key := range present {
+				expected = append(expected, key)
+			}
+			sort.Slice(expected, func(i, j int) bool { return expected[i] < expected[j] })
+			assertKeys(t, tree, expected)
+		}
+	}
+}
+
+func newTestBookOrder(orderId int64, side models.Side, price, size int64) BookOrder {
+	return BookOrder{
+		OrderId:     orderId,
+		Side:        side,
+		Type:        models.OrderTypeLimit,
+		TimeInForce: models.TimeInForceGTC,
+		Price:       price,
+		Size:        size,
+	}
+}
+
+func TestDepthPriceTimePriority(t *testing.T) {
+	for _, side := range []models.Side{models.SideBuy, models.SideSell} {
+		d := newDepth(side)
+		for i, price := range []int64{10, 12, 10, 11, 12} {
+			err := d.add(newTestBookOrder(int64(i+1), side, price, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkLevelTree(t, &d.levels)
+
+		var orderIds []int64
+		d.each(func(order *BookOrder) { orderIds = append(orderIds, order.OrderId) })
+		expected := []int64{1, 3, 4, 2, 5}
+		if side == models.SideBuy {
+			expected = []int64{2, 5, 4, 1, 3}
+		}
+		for i := range expected {
+			if orderIds[i] != expected[i] {
+				t.Fatalf("%v orders are %v, expected %v", side, orderIds, expected)
+			}
+		}
+		if d.best().OrderId != expected[0] {
+			t.Fatalf("%v best order is %v, expected %v", side, d.best().OrderId, expected[0])
+		}
+	}
+}
+
+func TestDepthRemoveLevels(t *testing.T) {
+	d := newDepth(models.SideSell)
+	for i, price := range []int64{10, 10, 11, 12} {
+		err := d.add(newTestBookOrder(int64(i+1), models.SideSell, price, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the level stays until its last order is removed
+	_, err := d.remove(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKeys(t, &d.levels, []int64{10, 11, 12})
+	if d.best().OrderId != 2 {
+		t.Fatalf("best order is %v, expected 2", d.best().OrderId)
+	}
+
+	// a filled order removes the best level, the next level becomes the best
+	err = d.decrSize(2, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertKeys(t, &d.levels, []int64{11, 12})
+	if d.best().OrderId != 3 {
+		t.Fatalf("best order is %v, expected 3", d.best().OrderId)
+	}
+
+	_, err = d.remove(2)
+	if err == nil {
+		t.Fatal("removed an order that is not on the book")
+	}
+	err = d.decrSize(3, 3)
+	if err == nil {
+		t.Fatal("decreased an order by more than its size")
+	}
+}
+
+func TestDepthIcebergReplenish(t *testing.T) {
+	d := newDepth(models.SideSell)
+	iceberg := newTestBookOrder(1, models.SideSell, 10, 5)
+	iceberg.DisplaySize = 2
+	for _, order := range []BookOrder{iceberg, newTestBookOrder(2, models.SideSell, 10, 1)} {
+		err := d.add(order)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if level := d.levels.min; level.size != 3 {
+		t.Fatalf("visible size is %v, expected 3", level.size)
+	}
+
+	// the replenished slice queues behind the other order
+	err := d.decrSize(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkLevelTree(t, &d.levels)
+	if d.best().OrderId != 2 {
+		t.Fatalf("best order is %v, expected 2", d.best().OrderId)
+	}
+	if order := d.orders[1]; order.Size != 2 || order.HiddenSize != 1 {
+		t.Fatalf("iceberg has size %v and hidden size %v, expected 2 and 1", order.Size, order.HiddenSize)
+	}
+}
+
+func BenchmarkDepthAddRemove(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	d := newDepth(models.SideSell)
+
+	// a book of 10000 orders over 1000 levels, each iteration cancels a random order and queues a new one
+	const orders = 10000
+	orderIds := make([]int64, 0, orders)
+	for i := int64(1); i <= orders; i++ {
+		err := d.add(newTestBookOrder(i, models.SideSell, 1+rnd.Int63n(1000), 1))
+		if err != nil {
+			b.Fatal(err)
+		}
+		orderIds = append(orderIds, i)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		j := rnd.Intn(len(orderIds))
+		_, err := d.remove(orderIds[j])
+		if err != nil {
+			b.Fatal(err)
+		}
+		orderIds[j] = int64(orders + 1 + i)
+		err = d.add(newTestBookOrder(orderIds[j], models.SideSell, 1+rnd.Int63n(1000), 1))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDepthDuplicateOrderId(t *testing.T) {
+	d := newDepth(models.SideSell)
+	err := d.add(newTestBookOrder(1, models.SideSell, 10, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the order on the book is kept
+	err = d.add(newTestBookOrder(1, models.SideSell, 11, 3))
+	if err == nil {
+		t.Fatal("added an order id that is already on the book")
+	}
+	assertKeys(t, &d.levels, []int64{10})
+	if order := d.orders[1]; order.Price != 10 || order.Size != 2 {
+		t.Fatalf("order on the book is replaced by %+v", order)
+	}
+}
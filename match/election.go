@@ -0,0 +1,58 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+// leader已经被新的leader取代，不能再写入撮合日志
+var ErrFenced = errors.New("leader is fenced by a newer leader")
+
+// 用于engine的主备选举，同一个product同一时间只有一个leader可以写入撮合日志
+type Elector interface {
+	// 阻塞直到成为product的leader
+	Campaign(productId string) (Lease, error)
+}
+
+// leader的任期
+type Lease interface {
+	// fencing token，每次有新的leader当选都会递增，新leader的token一定大于旧leader的token
+	Token() int64
+
+	// 检查任期是否仍然有效，已经被新的leader取代时返回ErrFenced，写入日志前必须检查
+	CheckFence() error
+
+	// 主动放弃leader
+	Resign() error
+}
+
+// 根据配置创建Elector的工厂方法，分布式的实现通过RegisterElector注册
+type ElectorFactory func(config conf.ElectionConfig) (Elector, error)
+
+var electorFactories = map[string]ElectorFactory{}
+var electorFactoriesMu sync.Mutex
+
+// 注册一种选举的实现，config中的match.election.backend为backend时使用
+func RegisterElector(backend string, factory ElectorFactory) {
+	electorFactoriesMu.Lock()
+	defer electorFactoriesMu.Unlock()
+	electorFactories[backend] = factory
+}
+
+// 根据配置创建Elector，没有配置backend时返回nil，engine直接作为leader运行
+func NewElector(config conf.ElectionConfig) (Elector, error) {
+	if len(config.Backend) == 0 {
+		return nil, nil
+	}
+
+	electorFactoriesMu.Lock()
+	factory, found := electorFactories[config.Backend]
+	electorFactoriesMu.Unlock()
+	if !found {
+		return nil, errors.New(fmt.Sprintf("unknown election backend: %v", config.Backend))
+	}
+	return factory(config)
+}
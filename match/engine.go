@@ -1,200 +1,404 @@
-package match
-
-import (
-	logger "github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-type Engine struct {
-	// productId是一个engine的唯一标识，每个product都会对应一个engine
-	productId string
-
-	// engine持有的orderBook，和product对应，需要快照，并从快照中恢复
-	OrderBook *orderBook
-
-	// 用于读取order
-	orderReader OrderReader
-
-	// 读取order的起始offset，该值第一次启动时候会从快照中恢复
-	orderOffset int64
-
-	// 读取的order会写入chan，写入order的同时需要携带该order的offset
-	orderCh chan *offsetOrder
-}
-
-type offsetOrder struct {
-	Offset int64
-	Order  *models.Order
-}
-
-func NewEngine(product *models.Product, orderReader OrderReader) *Engine {
-	e := &Engine{
-		productId: product.Id,
-		OrderBook: NewOrderBook(product),
-		orderCh:   make(chan *offsetOrder, 10000),
-		//snapshotReqCh:        make(chan *Snapshot, 32),
-		//snapshotApproveReqCh: make(chan *Snapshot, 32),
-		//snapshotCh:           make(chan *Snapshot, 32),
-		//snapshotStore:        snapshotStore,
-		orderReader: orderReader,
-		//logStore:             logStore,
-	}
-
-	// 获取最新的snapshot，并使用snapshot进行恢复
-	/*snapshot, err := snapshotStore.GetLatest()
-	if err != nil {
-		logger.Fatalf("get latest snapshot error: %v", err)
-	}
-	if snapshot != nil {
-		e.restore(snapshot)
-	}*/
-	return e
-}
-
-func (e *Engine) Start() {
-	go e.runFetcher()
-	go e.runApplier()
-	//go e.runCommitter()
-	//go e.runSnapshots()
-}
-
-// 负责不断的拉取order，写入chan
-func (e *Engine) runFetcher() {
-	var offset = e.orderOffset
-	if offset > 0 {
-		offset = offset + 1
-	}
-	err := e.orderReader.SetOffset(offset)
-	if err != nil {
-		logger.Fatalf("set order reader offset error: %v", err)
-	}
-
-	for {
-		offset, order, err := e.orderReader.FetchOrder()
-		if err != nil {
-			logger.Error(err)
-			continue
-		}
-		e.orderCh <- &offsetOrder{offset, order}
-	}
-}
-
-// 从本地队列获取order，执行orderBook操作，同时要响应snapshot请求
-func (e *Engine) runApplier() {
-	for {
-		select {
-		case offsetOrder := <-e.orderCh:
-			// put or cancel order
-
-			e.OrderBook.ApplyOrder(offsetOrder.Order)
-
-			// 将orderBook产生的log写入chan进行持久化
-			/*for _, log := range logs {
-					e.logCh <- log
-				}
-
-				// 记录订单的offset用于判断是否需要进行快照
-				orderOffset = offsetOrder.Offset
-
-			case snapshot := <-e.snapshotReqCh:
-				// 接收到快照请求，判断是否真的需要执行快照
-				delta := orderOffset - snapshot.OrderOffset
-				if delta <= 1000 {
-					continue
-				}
-
-				logger.Infof("should take snapshot: %v %v-[%v]-%v->",
-					e.productId, snapshot.OrderOffset, delta, orderOffset)
-
-				// 执行快照，并将快照数据写入批准chan
-				snapshot.OrderBookSnapshot = e.OrderBook.Snapshot()
-				snapshot.OrderOffset = orderOffset
-				e.snapshotApproveReqCh <- snapshot*/
-		}
-	}
-}
-
-//TODO: Implementation
-// 将orderBook产生的log进行持久化，同时需要响应snapshot审批
-/*func (e *Engine) runCommitter() {
-	var seq = e.OrderBook.logSeq
-	var pending *Snapshot = nil
-	var logs []interface{}
-
-	for {
-		select {
-		case log := <-e.logCh:
-			// discard duplicate log
-			if log.GetSeq() <= seq {
-				logger.Infof("discard log seq=%v", seq)
-				continue
-			}
-
-			seq = log.GetSeq()
-			logs = append(logs, log)
-
-			// chan is not empty and buffer is not full, continue read.
-			if len(e.logCh) > 0 && len(logs) < 100 {
-				continue
-			}
-
-			// store log, clean buffer
-			err := e.logStore.Store(logs)
-			if err != nil {
-				panic(err)
-			}
-			logs = nil
-
-			// approve pending snapshot
-			if pending != nil && seq >= pending.OrderBookSnapshot.LogSeq {
-				e.snapshotCh <- pending
-				pending = nil
-			}
-
-		case snapshot := <-e.snapshotApproveReqCh:
-			// 写入的seq已经达到或者超过snapshot的seq，批准snapshot请求
-			if seq >= snapshot.OrderBookSnapshot.LogSeq {
-				e.snapshotCh <- snapshot
-				pending = nil
-				continue
-			}
-
-			// 当前还有未批准的snapshot，但是又有新的snapshot请求，丢弃旧的请求
-			if pending != nil {
-				logger.Infof("discard snapshot request (seq=%v), new one (seq=%v) received",
-					pending.OrderBookSnapshot.LogSeq, snapshot.OrderBookSnapshot.LogSeq)
-			}
-			pending = snapshot
-		}
-	}
-}*/
-
-//TODO: Implementation
-// 定时发起快照请求，同时负责持久化通过审批的快照
-/*func (e *Engine) runSnapshots() {
-	// 最后一次快照时的order orderOffset
-	orderOffset := e.orderOffset
-
-	for {
-		select {
-		case <-time.After(30 * time.Second):
-			// make a new snapshot request
-			e.snapshotReqCh <- &Snapshot{
-				OrderOffset: orderOffset,
-			}
-
-		case snapshot := <-e.snapshotCh:
-			// store snapshot
-			err := e.snapshotStore.Store(snapshot)
-			if err != nil {
-				logger.Warnf("store snapshot failed: %v", err)
-				continue
-			}
-			logger.Infof("new snapshot stored :product=%v OrderOffset=%v LogSeq=%v",
-				e.productId, snapshot.OrderOffset, snapshot.OrderBookSnapshot.LogSeq)
-
-			// update offset for next snapshot request
-			orderOffset = snapshot.OrderOffset
-		}
-	}
-}*/
+package match
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/metrics"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+type Engine struct {
+	// productId是一个engine的唯一标识，每个product都会对应一个engine
+	productId string
+
+	// engine持有的orderBook，和product对应，需要快照，并从快照中恢复
+	OrderBook *orderBook
+
+	// 用于读取order
+	orderReader OrderReader
+
+	// 最后执行的order的offset，从快照中恢复，没有快照时为-1
+	orderOffset int64
+
+	// 读取的command会写入chan，写入command的同时需要携带该command的offset
+	commandCh chan *offsetCommand
+
+	// 用于保存orderBook产生的log
+	logStore LogStore
+
+	// orderBook产生的log会写入chan，由committer批量持久化
+	logCh chan Log
+
+	// 用于主备选举，为nil时engine直接作为leader运行
+	elector Elector
+
+	// 当选leader后写入，committer开始持久化log
+	leaseCh chan Lease
+
+	// 用于保存快照，为nil时不做快照，每次启动都从第一个order开始执行
+	snapshotStore SnapshotStore
+
+	// 发起快照的间隔，以及两次快照之间至少执行的order数量
+	snapshotInterval  time.Duration
+	minSnapshotOrders int64
+
+	// 快照请求，applier在两个command之间生成快照
+	snapshotReqCh chan *Snapshot
+
+	// 等待committer批准的快照，快照包含的log都持久化后才能保存
+	snapshotApproveReqCh chan *Snapshot
+
+	// 已经批准的快照，由runSnapshots保存
+	snapshotCh chan *Snapshot
+}
+
+const (
+	// standby最多保留的未持久化log数量，当选时旧leader最后没有写入的log需要由新leader补写
+	maxStandbyLogs = 100000
+
+	defaultSnapshotInterval  = 30 * time.Second
+	defaultMinSnapshotOrders = 1000
+)
+
+type offsetCommand struct {
+	Offset  int64
+	Command *Command
+}
+
+func NewEngine(product *models.Product, orderReader OrderReader, logStore LogStore, snapshotStore SnapshotStore,
+	elector Elector) *Engine {
+	e := &Engine{
+		productId:            product.Id,
+		OrderBook:            NewOrderBook(product),
+		orderOffset:          -1,
+		commandCh:            make(chan *offsetCommand, 10000),
+		logCh:                make(chan Log, 10000),
+		leaseCh:              make(chan Lease, 1),
+		snapshotStore:        snapshotStore,
+		snapshotInterval:     defaultSnapshotInterval,
+		minSnapshotOrders:    defaultMinSnapshotOrders,
+		snapshotReqCh:        make(chan *Snapshot, 32),
+		snapshotApproveReqCh: make(chan *Snapshot, 32),
+		snapshotCh:           make(chan *Snapshot, 32),
+		orderReader:          orderReader,
+		logStore:             logStore,
+		elector:              elector,
+	}
+
+	// 获取最新的snapshot，并使用snapshot进行恢复。standby冷启动时同样从leader保存的快照开始跟随order
+	if snapshotStore != nil {
+		snapshot, err := snapshotStore.GetLatest()
+		if err != nil {
+			logger.Fatalf("get latest snapshot error: %v", err)
+		}
+		if snapshot != nil {
+			e.restore(snapshot)
+		}
+	}
+	return e
+}
+
+func (e *Engine) restore(snapshot *Snapshot) {
+	logger.WithFields(logrus.Fields{
+		logging.FieldProductId: e.productId,
+		"orderOffset":          snapshot.OrderOffset,
+		"logSeq":               snapshot.OrderBook.LogSeq,
+	}).Info("restoring snapshot")
+
+	e.OrderBook.Restore(&snapshot.OrderBook)
+	e.orderOffset = snapshot.OrderOffset
+	metrics.SnapshotOrderOffset.WithLabelValues(e.productId).Set(float64(snapshot.OrderOffset))
+}
+
+func (e *Engine) Start() {
+	// committer的起始seq必须在applier开始执行order之前获取
+	seq := e.OrderBook.logSeq
+
+	go e.runFetcher()
+	go e.runApplier()
+	go e.runCommitter(seq)
+	go e.runElection()
+	if e.snapshotStore != nil {
+		go e.runSnapshots()
+	}
+}
+
+// standby和leader一样读取并执行order，保持orderBook和leader一致，当选后由committer接管log的写入
+func (e *Engine) runElection() {
+	if e.elector == nil {
+		e.leaseCh <- nil
+		return
+	}
+
+	logger.WithField(logging.FieldProductId, e.productId).Info("standby, campaigning for leader")
+	lease, err := e.elector.Campaign(e.productId)
+	if err != nil {
+		logger.Fatalf("campaign for leader of %v error: %v", e.productId, err)
+	}
+
+	logger.WithFields(logrus.Fields{
+		logging.FieldProductId: e.productId,
+		"token":                lease.Token(),
+	}).Info("became leader")
+	metrics.LeaderToken.WithLabelValues(e.productId).Set(float64(lease.Token()))
+	e.leaseCh <- lease
+}
+
+// 负责不断的拉取command，写入chan
+func (e *Engine) runFetcher() {
+	err := e.orderReader.SetOffset(e.orderOffset + 1)
+	if err != nil {
+		logger.Fatalf("set order reader offset error: %v", err)
+	}
+
+	for {
+		offset, command, err := e.orderReader.FetchOrder()
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		metrics.OrdersReceived.WithLabelValues(e.productId).Inc()
+		e.commandCh <- &offsetCommand{offset, command}
+	}
+}
+
+// 从本地队列获取command，按照类型执行orderBook操作，同时要响应snapshot请求
+func (e *Engine) runApplier() {
+	// 最后执行的order的offset
+	orderOffset := e.orderOffset
+
+	for {
+		select {
+		case offsetCommand := <-e.commandCh:
+			command := offsetCommand.Command
+			switch command.Type {
+			case CommandTypeHalt:
+				logger.WithFields(logrus.Fields{
+					logging.FieldProductId: e.productId,
+					logging.FieldRequestId: command.RequestId,
+				}).Warn("trading halted")
+			case CommandTypeResume:
+				logger.WithFields(logrus.Fields{
+					logging.FieldProductId: e.productId,
+					logging.FieldRequestId: command.RequestId,
+				}).Warn("trading resumed")
+			}
+
+			// place, cancel, cancel all, expire, halt or resume
+			start := time.Now()
+			logs := e.OrderBook.ApplyCommand(command)
+			e.observeApply(offsetCommand, start)
+			e.logApply(offsetCommand, logs)
+
+			// 将orderBook产生的log写入chan进行持久化
+			for _, log := range logs {
+				e.logCh <- log
+			}
+
+			// 记录订单的offset用于判断是否需要进行快照
+			orderOffset = offsetCommand.Offset
+
+		case snapshot := <-e.snapshotReqCh:
+			// 接收到快照请求，距离上次快照执行的order太少时不做快照
+			delta := orderOffset - snapshot.OrderOffset
+			if delta < e.minSnapshotOrders {
+				continue
+			}
+
+			logger.Infof("should take snapshot: %v %v-[%v]-%v->",
+				e.productId, snapshot.OrderOffset, delta, orderOffset)
+
+			// 执行快照，并将快照数据写入批准chan
+			snapshot.OrderBook = e.OrderBook.Snapshot()
+			snapshot.OrderOffset = orderOffset
+			e.snapshotApproveReqCh <- snapshot
+		}
+	}
+}
+
+// 将orderBook产生的log进行持久化，同时需要响应snapshot审批
+// 当选leader之前只保留最近的log，当选后从旧leader最后写入的log之后开始持久化
+func (e *Engine) runCommitter(seq int64) {
+	var pending *Snapshot
+	var logs []interface{}
+	var leader bool
+	var lease Lease
+
+	for {
+		select {
+		case lease = <-e.leaseCh:
+			leader = true
+			logs, seq = e.takeOver(logs, seq)
+
+		case log := <-e.logCh:
+			// discard duplicate log
+			if log.GetSeq() <= seq {
+				logger.Infof("discard log seq=%v", seq)
+				continue
+			}
+
+			seq = log.GetSeq()
+			logs = append(logs, log)
+
+			if !leader && len(logs) > maxStandbyLogs {
+				logs = logs[len(logs)-maxStandbyLogs:]
+			}
+
+			// chan is not empty and buffer is not full, continue read.
+			if len(e.logCh) > 0 && len(logs) < 100 {
+				continue
+			}
+
+		case snapshot := <-e.snapshotApproveReqCh:
+			// 当前还有未批准的snapshot，但是又有新的snapshot请求，丢弃旧的请求
+			if pending != nil {
+				logger.Infof("discard snapshot request (seq=%v), new one (seq=%v) received",
+					pending.OrderBook.LogSeq, snapshot.OrderBook.LogSeq)
+			}
+			pending = snapshot
+		}
+
+		if !leader {
+			continue
+		}
+		if len(logs) == 0 {
+			pending = e.approveSnapshot(pending, seq)
+			continue
+		}
+
+		// 被新leader取代后不能再写入log。检查之后写入之前仍然可能有新的leader当选，
+		// 每条log都带有fencing token，reader会丢弃token小于已读到的最大token的log
+		var token int64
+		if lease != nil {
+			token = lease.Token()
+			err := lease.CheckFence()
+			if err != nil {
+				logger.Fatalf("%v reject logs of leader (token=%v): %v", e.productId, token, err)
+			}
+		}
+
+		// store log, clean buffer
+		err := e.logStore.Store(token, logs)
+		if err != nil {
+			panic(err)
+		}
+		logs = nil
+		metrics.CommittedLogSeq.WithLabelValues(e.productId).Set(float64(seq))
+
+		pending = e.approveSnapshot(pending, seq)
+	}
+}
+
+// 只有leader保存快照，并且快照包含的log都已经持久化：缓存中没有未写入的log，seq之前的log都已经由本leader或者旧leader写入。
+// 否则从快照恢复的engine不会再产生这些log，它们永远不会被写入。返回仍然等待批准的快照
+func (e *Engine) approveSnapshot(pending *Snapshot, seq int64) *Snapshot {
+	if pending == nil || seq < pending.OrderBook.LogSeq {
+		return pending
+	}
+	e.snapshotCh <- pending
+	return nil
+}
+
+// 丢弃旧leader已经写入的log，返回需要由新leader补写的log和新的去重seq。
+// 冷启动的standby从leader保存的快照恢复，快照之前的log都已经写入，它保留的log从快照之后开始
+func (e *Engine) takeOver(logs []interface{}, seq int64) ([]interface{}, int64) {
+	lastSeq, err := e.logStore.LastSeq()
+	if err != nil {
+		panic(err)
+	}
+
+	var pending []interface{}
+	for _, log := range logs {
+		if log.(Log).GetSeq() > lastSeq {
+			pending = append(pending, log)
+		}
+	}
+
+	// standby落后于旧leader，之后执行产生的重复log会被丢弃
+	if seq <= lastSeq {
+		return pending, lastSeq
+	}
+
+	// standby保留的log不足以接续旧leader的log
+	if len(pending) == 0 || pending[0].(Log).GetSeq() != lastSeq+1 {
+		logger.Fatalf("%v standby can not continue the logs of the previous leader: lastSeq=%v", e.productId, lastSeq)
+	}
+	return pending, seq
+}
+
+// 记录command执行后engine的状态
+func (e *Engine) observeApply(offsetCommand *offsetCommand, start time.Time) {
+	metrics.ApplyDuration.WithLabelValues(e.productId).Observe(time.Since(start).Seconds())
+	metrics.OrdersApplied.WithLabelValues(e.productId).Inc()
+	metrics.OrderQueueDepth.WithLabelValues(e.productId).Set(float64(len(e.commandCh)))
+	metrics.OrderOffset.WithLabelValues(e.productId).Set(float64(offsetCommand.Offset))
+	metrics.LogSeq.WithLabelValues(e.productId).Set(float64(e.OrderBook.logSeq))
+	for side, depth := range e.OrderBook.depths {
+		metrics.BookOrders.WithLabelValues(e.productId, side.String()).Set(float64(len(depth.orders)))
+	}
+}
+
+// debug级别下输出每个command的执行结果，requestId来自提交command的REST请求
+func (e *Engine) logApply(offsetCommand *offsetCommand, logs []Log) {
+	if !logger.Logger.IsLevelEnabled(logrus.DebugLevel) {
+		return
+	}
+
+	command := offsetCommand.Command
+	fields := logrus.Fields{
+		logging.FieldProductId: e.productId,
+		logging.FieldRequestId: command.RequestId,
+		"offset":               offsetCommand.Offset,
+		"command":              command.Type,
+	}
+	switch command.Type {
+	case CommandTypePlace:
+		fields[logging.FieldOrderId] = command.Order.Id
+		fields[logging.FieldOrderHash] = command.Order.Hash
+	case CommandTypeCancel:
+		fields[logging.FieldOrderId] = command.OrderId
+	case CommandTypeCancelAll:
+		fields[logging.FieldMaker] = command.MakerAddress
+	}
+	entry := logger.WithFields(fields)
+	entry.Debug("command applied")
+	for _, log := range logs {
+		entry.WithFields(logrus.Fields{
+			"logSeq": log.GetSeq(),
+			"log":    log,
+		}).Debug("log produced")
+	}
+}
+
+// 定时发起快照请求，同时负责持久化通过审批的快照
+func (e *Engine) runSnapshots() {
+	// 最后一次快照时的order orderOffset
+	orderOffset := e.orderOffset
+
+	for {
+		select {
+		case <-time.After(e.snapshotInterval):
+			// make a new snapshot request
+			e.snapshotReqCh <- &Snapshot{
+				OrderOffset: orderOffset,
+			}
+
+		case snapshot := <-e.snapshotCh:
+			// store snapshot
+			err := e.snapshotStore.Store(snapshot)
+			if err != nil {
+				logger.Warnf("store snapshot failed: %v", err)
+				continue
+			}
+			logger.Infof("new snapshot stored :product=%v OrderOffset=%v LogSeq=%v",
+				e.productId, snapshot.OrderOffset, snapshot.OrderBook.LogSeq)
+			metrics.LastSnapshotTime.WithLabelValues(e.productId).SetToCurrentTime()
+			metrics.SnapshotOrderOffset.WithLabelValues(e.productId).Set(float64(snapshot.OrderOffset))
+
+			// update offset for next snapshot request
+			orderOffset = snapshot.OrderOffset
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package match
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// 内存中的order topic，读到末尾后等待新的command
+type testOrderReader struct {
+	sync.Mutex
+	commands []*Command
+	offset   int64
+}
+
+func (r *testOrderReader) SetOffset(offset int64) error {
+	r.Lock()
+	defer r.Unlock()
+	r.offset = offset
+	return nil
+}
+
+func (r *testOrderReader) FetchOrder() (int64, *Command, error) {
+	for {
+		r.Lock()
+		if r.offset < int64(len(r.commands)) {
+			offset := r.offset
+			r.offset++
+			r.Unlock()
+			return offset, r.commands[offset], nil
+		}
+		r.Unlock()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type testLogStore struct {
+	sync.Mutex
+	logs []Log
+}
+
+func (s *testLogStore) Store(token int64, logs []interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+	for _, log := range logs {
+		s.logs = append(s.logs, log.(Log))
+	}
+	return nil
+}
+
+func (s *testLogStore) LastSeq() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	if len(s.logs) == 0 {
+		return 0, nil
+	}
+	return s.logs[len(s.logs)-1].GetSeq(), nil
+}
+
+func (s *testLogStore) describeLogs() []string {
+	s.Lock()
+	defer s.Unlock()
+	var logs []string
+	for _, log := range s.logs {
+		logs = append(logs, describeLog(log))
+	}
+	return logs
+}
+
+// 和redis一样保存快照的JSON，恢复的orderBook不会与engine共享数据
+type testSnapshotStore struct {
+	sync.Mutex
+	latest []byte
+}
+
+func (s *testSnapshotStore) Store(snapshot *Snapshot) error {
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.latest = bytes
+	return nil
+}
+
+func (s *testSnapshotStore) GetLatest() (*Snapshot, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.latest == nil {
+		return nil, nil
+	}
+	var snapshot Snapshot
+	err := json.Unmarshal(s.latest, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// Campaign一直阻塞，直到测试授予leader
+type testElector struct {
+	leaseCh chan Lease
+}
+
+func (e *testElector) Campaign(productId string) (Lease, error) {
+	return <-e.leaseCh, nil
+}
+
+type testLease struct{}
+
+func (testLease) Token() int64      { return 1 }
+func (testLease) CheckFence() error { return nil }
+func (testLease) Resign() error     { return nil }
+
+// 前四个order之后做快照，之后的command从快照恢复的engine继续执行
+func newEngineTestCommands() []*Command {
+	return []*Command{
+		place(newTestLimitOrder(1, models.SideSell, "100", "1")),
+		place(newTestLimitOrder(2, models.SideSell, "101", "1")),
+		place(newTestLimitOrder(3, models.SideBuy, "99", "1")),
+		place(newTestLimitOrder(4, models.SideBuy, "100", "0.5")),
+		place(newTestLimitOrder(5, models.SideBuy, "101", "1")),
+		at(NewCancelCommand(newTestLimitOrder(3, models.SideBuy, "99", "1"), models.DoneReasonCancelled, ""), 0),
+	}
+}
+
+func expectedEngineLogs(commands []*Command) []string {
+	book := NewOrderBook(testBookProduct)
+	var logs []string
+	for _, command := range commands {
+		for _, log := range book.ApplyCommand(command) {
+			logs = append(logs, describeLog(log))
+		}
+	}
+	return logs
+}
+
+func newTestEngine(commands []*Command, logStore LogStore, snapshotStore SnapshotStore, elector Elector) *Engine {
+	engine := NewEngine(testBookProduct, &testOrderReader{commands: commands}, logStore, snapshotStore, elector)
+	engine.snapshotInterval = time.Millisecond
+	engine.minSnapshotOrders = 1
+	return engine
+}
+
+func waitFor(t *testing.T, what string, done func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %v", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func assertStoredLogs(t *testing.T, logStore *testLogStore, expected []string) {
+	t.Helper()
+
+	waitFor(t, "logs", func() bool { return len(logStore.describeLogs()) >= len(expected) })
+	if logs := logStore.describeLogs(); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("logs:\n%v\nexpected:\n%v", strings.Join(logs, "\n"), strings.Join(expected, "\n"))
+	}
+}
+
+func TestEngineRestoresSnapshot(t *testing.T) {
+	expected := expectedEngineLogs(newEngineTestCommands())
+	snapshotStore := &testSnapshotStore{}
+
+	// 快照只有在包含的log都写入之后才保存
+	logStore := &testLogStore{}
+	newTestEngine(newEngineTestCommands()[:4], logStore, snapshotStore, nil).Start()
+	var snapshot *Snapshot
+	waitFor(t, "snapshot", func() bool {
+		snapshot, _ = snapshotStore.GetLatest()
+		return snapshot != nil && snapshot.OrderOffset == 3
+	})
+	if lastSeq, _ := logStore.LastSeq(); lastSeq < snapshot.OrderBook.LogSeq {
+		t.Fatalf("snapshot of log seq %v stored before the log is, last seq %v", snapshot.OrderBook.LogSeq, lastSeq)
+	}
+	logSeq := snapshot.OrderBook.LogSeq
+	assertStoredLogs(t, logStore, expected[:logSeq])
+
+	// 重启后从快照之后的order开始执行，log的seq接续快照
+	engine := newTestEngine(newEngineTestCommands(), logStore, snapshotStore, nil)
+	if engine.orderOffset != 3 || engine.OrderBook.logSeq != logSeq {
+		t.Fatalf("restored order offset %v and log seq %v, expected 3 and %v",
+			engine.orderOffset, engine.OrderBook.logSeq, logSeq)
+	}
+	engine.Start()
+	assertStoredLogs(t, logStore, expected)
+}
+
+// standby不写入log也不保存快照，当选后写入旧leader没有写入的log，之后才保存快照
+func TestEngineStandbySnapshot(t *testing.T) {
+	commands := newEngineTestCommands()
+	expected := expectedEngineLogs(commands)
+	snapshotStore := &testSnapshotStore{}
+	logStore := &testLogStore{}
+	elector := &testElector{leaseCh: make(chan Lease)}
+
+	engine := newTestEngine(commands, logStore, snapshotStore, elector)
+	reader := engine.orderReader.(*testOrderReader)
+	engine.Start()
+	waitFor(t, "commands", func() bool {
+		reader.Lock()
+		defer reader.Unlock()
+		return reader.offset == int64(len(commands))
+	})
+	time.Sleep(50 * time.Millisecond)
+	if snapshot, _ := snapshotStore.GetLatest(); snapshot != nil {
+		t.Fatalf("standby stored a snapshot at offset %v", snapshot.OrderOffset)
+	}
+	if logs := logStore.describeLogs(); len(logs) > 0 {
+		t.Fatalf("standby stored logs %v", logs)
+	}
+
+	// 旧leader已经写入了前两条log
+	_ = logStore.Store(0, []interface{}{&OpenLog{Base: Base{Sequence: 1}}, &OpenLog{Base: Base{Sequence: 2}}})
+	elector.leaseCh <- testLease{}
+	assertStoredLogs(t, logStore, append([]string{"open 0 0@0", "open 0 0@0"}, expected[2:]...))
+	waitFor(t, "snapshot", func() bool {
+		snapshot, _ := snapshotStore.GetLatest()
+		return snapshot != nil && snapshot.OrderOffset == int64(len(commands)-1)
+	})
+}
+
+func TestRedisSnapshotStore(t *testing.T) {
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	store := NewRedisSnapshotStore(testBookProduct.Id, redis.NewClient(&redis.Options{Addr: server.Addr()}))
+
+	snapshot, err := store.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshot != nil {
+		t.Fatalf("snapshot %+v found in an empty store", snapshot)
+	}
+
+	book := NewOrderBook(testBookProduct)
+	for _, command := range newEngineTestCommands() {
+		book.ApplyCommand(command)
+	}
+	err = store.Store(&Snapshot{OrderOffset: 5, OrderBook: book.Snapshot()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot, err = store.GetLatest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewOrderBook(testBookProduct)
+	restored.Restore(&snapshot.OrderBook)
+	if snapshot.OrderOffset != 5 || restored.logSeq != book.logSeq {
+		t.Fatalf("restored offset %v and log seq %v, expected 5 and %v", snapshot.OrderOffset, restored.logSeq, book.logSeq)
+	}
+	assertBookOrders(t, restored, models.SideSell, 2)
+	assertBookOrders(t, restored, models.SideBuy)
+}
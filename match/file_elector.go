@@ -0,0 +1,135 @@
+//go:build !windows
+// +build !windows
+
+package match
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+const fileElectorBackend = "file"
+
+func init() {
+	RegisterElector(fileElectorBackend, func(config conf.ElectionConfig) (Elector, error) {
+		return NewFileElector(config.Dir, time.Duration(config.RetryInterval)*time.Second)
+	})
+}
+
+// FileElector elects the leader of a product with an exclusive flock on <dir>/<productId>.lock. It only works
+// for the processes of one host, it is meant for tests and single host deployments.
+// The fencing token is kept in <dir>/<productId>.token and incremented by every new leader.
+type FileElector struct {
+	dir           string
+	retryInterval time.Duration
+}
+
+func NewFileElector(dir string, retryInterval time.Duration) (*FileElector, error) {
+	if retryInterval <= 0 {
+		retryInterval = time.Second
+	}
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &FileElector{dir: dir, retryInterval: retryInterval}, nil
+}
+
+func (e *FileElector) Campaign(productId string) (Lease, error) {
+	file, err := os.OpenFile(filepath.Join(e.dir, productId+".lock"), os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			break
+		}
+		if err != syscall.EWOULDBLOCK {
+			_ = file.Close()
+			return nil, err
+		}
+		time.Sleep(e.retryInterval)
+	}
+
+	tokenPath := filepath.Join(e.dir, productId+".token")
+	token, err := readFenceToken(tokenPath)
+	if err == nil {
+		token++
+		err = writeFenceToken(tokenPath, token)
+	}
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return &fileLease{file: file, tokenPath: tokenPath, token: token}, nil
+}
+
+type fileLease struct {
+	file      *os.File
+	tokenPath string
+	token     int64
+}
+
+func (l *fileLease) Token() int64 {
+	return l.token
+}
+
+// the lock is held as long as the process lives, the token also fences a leader whose lock file was removed
+// and acquired again by another process
+func (l *fileLease) CheckFence() error {
+	token, err := readFenceToken(l.tokenPath)
+	if err != nil {
+		return err
+	}
+	if token != l.token {
+		return ErrFenced
+	}
+	return nil
+}
+
+func (l *fileLease) Resign() error {
+	err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	if err != nil {
+		return err
+	}
+	return l.file.Close()
+}
+
+func readFenceToken(path string) (int64, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	token, err := strconv.ParseInt(strings.TrimSpace(string(bytes)), 10, 64)
+	if err != nil {
+		return 0, errors.New(fmt.Sprintf("invalid fencing token in %v: %v", path, err))
+	}
+	return token, nil
+}
+
+// the token is replaced atomically so that a reader never sees a partial write
+func writeFenceToken(path string, token int64) error {
+	tmpPath := path + ".tmp"
+	err := ioutil.WriteFile(tmpPath, []byte(strconv.FormatInt(token, 10)), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,80 @@
+package match
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// max length of a line of the order file
+const maxOrderLineSize = 10e6
+
+// FileOrderReader reads the order topic exported as JSON lines, each line is a command or an order written
+// before commands were introduced. The offset of a message is its line number starting from 0, blank lines
+// are skipped but counted. FetchOrder returns io.EOF after the last message.
+type FileOrderReader struct {
+	path    string
+	file    *os.File
+	scanner *bufio.Scanner
+	offset  int64
+}
+
+func NewFileOrderReader(path string) (*FileOrderReader, error) {
+	r := &FileOrderReader{path: path}
+	err := r.SetOffset(0)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *FileOrderReader) SetOffset(offset int64) error {
+	if r.file != nil {
+		_ = r.file.Close()
+	}
+
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	r.file = file
+	r.scanner = bufio.NewScanner(file)
+	r.scanner.Buffer(make([]byte, 64*1024), maxOrderLineSize)
+	r.offset = 0
+
+	for r.offset < offset && r.scanner.Scan() {
+		r.offset++
+	}
+	return r.scanner.Err()
+}
+
+func (r *FileOrderReader) FetchOrder() (offset int64, command *Command, err error) {
+	for r.scanner.Scan() {
+		offset = r.offset
+		r.offset++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		command, err = DecodeCommand([]byte(line))
+		if err != nil {
+			return offset, nil, &OrderDecodeError{Offset: offset, Err: errors.New(fmt.Sprintf("%v:%v: %v", r.path, offset+1, err))}
+		}
+		return offset, command, nil
+	}
+
+	err = r.scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+	return 0, nil, err
+}
+
+func (r *FileOrderReader) Close() error {
+	return r.file.Close()
+}
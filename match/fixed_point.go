@@ -0,0 +1,290 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+var (
+	maxUnits = decimal.New(math.MaxInt64, 0)
+
+	// the increments of a product that has none
+	defaultPriceIncrement = decimal.New(1, -8)
+	defaultSizeIncrement  = decimal.New(1, -8)
+)
+
+type rounding int
+
+const (
+	roundExact = rounding(iota)
+	roundDown
+	roundUp
+)
+
+// fixedUnit converts between non-negative decimal amounts and int64 multiples of a unit
+type fixedUnit struct {
+	unit decimal.Decimal
+	// coefficient and exponent of the unit, the coefficient is 0 if it does not fit in int64
+	coefficient int64
+	exp         int32
+}
+
+func newFixedUnit(unit decimal.Decimal) fixedUnit {
+	u := fixedUnit{unit: unit, exp: unit.Exponent()}
+	if coefficient := unit.Coefficient(); coefficient.IsInt64() {
+		u.coefficient = coefficient.Int64()
+	}
+	return u
+}
+
+// the number of units of an amount, an error if it is negative, overflows int64, or is not a multiple of
+// the unit and must be exact
+func (u fixedUnit) toUnits(amount decimal.Decimal, r rounding) (int64, error) {
+	if amount.Sign() < 0 {
+		return 0, errors.New(fmt.Sprintf("negative amount %v", amount))
+	}
+
+	// fast path: amount / unit = (amount coefficient * 10^exp) / unit coefficient, exp may be negative
+	if coefficient := amount.Coefficient(); coefficient.IsInt64() && u.coefficient > 0 {
+		numerator, denominator := coefficient.Int64(), u.coefficient
+		var ok bool
+		if exp := amount.Exponent() - u.exp; exp >= 0 {
+			numerator, ok = mulPow10(numerator, exp)
+		} else {
+			denominator, ok = mulPow10(denominator, -exp)
+		}
+		if ok {
+			return roundQuotient(numerator/denominator, numerator%denominator != 0, amount, u.unit, r)
+		}
+	}
+
+	quotient, remainder := amount.QuoRem(u.unit, 0)
+	if quotient.GreaterThan(maxUnits) {
+		return 0, errors.New(fmt.Sprintf("amount %v overflows %v units of %v", amount, int64(math.MaxInt64), u.unit))
+	}
+	return roundQuotient(quotient.IntPart(), !remainder.IsZero(), amount, u.unit, r)
+}
+
+func roundQuotient(quotient int64, inexact bool, amount, unit decimal.Decimal, r rounding) (int64, error) {
+	if !inexact || r == roundDown {
+		return quotient, nil
+	}
+	if r == roundExact {
+		return 0, errors.New(fmt.Sprintf("amount %v is not a multiple of %v", amount, unit))
+	}
+	if quotient == math.MaxInt64 {
+		return 0, errors.New(fmt.Sprintf("amount %v overflows %v units of %v", amount, int64(math.MaxInt64), unit))
+	}
+	return quotient + 1, nil
+}
+
+// the decimal amount of a number of units
+func (u fixedUnit) toDecimal(units int64) decimal.Decimal {
+	if u.coefficient == 1 {
+		return decimal.New(units, u.exp)
+	}
+	return decimal.New(units, 0).Mul(u.unit)
+}
+
+// bookUnits are the fixed-point units of the matching core: sizes are in lots of the size increment, prices
+// in ticks of the price increment and funds in units of lot * tick, the smallest notional of a trade.
+// Amounts are converted when an order enters the book and when logs and snapshots are written.
+type bookUnits struct {
+	size     fixedUnit
+	price    fixedUnit
+	notional fixedUnit
+}
+
+func newBookUnits(product *models.Product) *bookUnits {
+	sizeIncrement := product.SizeIncrement
+	if sizeIncrement.IsZero() {
+		sizeIncrement = defaultSizeIncrement
+	}
+	priceIncrement := product.PriceIncrement
+	if priceIncrement.IsZero() {
+		priceIncrement = defaultPriceIncrement
+	}
+
+	return &bookUnits{
+		size:     newFixedUnit(sizeIncrement),
+		price:    newFixedUnit(priceIncrement),
+		notional: newFixedUnit(sizeIncrement.Mul(priceIncrement)),
+	}
+}
+
+// the error of an order whose amounts can not be represented on the book, it is done with the reason
+type amountError struct {
+	reason models.DoneReason
+	err    error
+}
+
+func (e *amountError) Error() string {
+	return e.err.Error()
+}
+
+// convert an order to the book. The price of a limit order is snapped to the price increment and never
+// moves against the order. Only a market buy order has funds, rounded down to what can pay for a lot.
+func (u *bookUnits) newBookOrder(order *models.Order) (*BookOrder, error) {
+	bookOrder := &BookOrder{
+		OrderId:         order.Id,
+		OrderHash:       order.Hash,
+		MakerAddress:    order.MakerAddress,
+		Side:            order.Side,
+		Type:            order.Type,
+		MaxSlippage:     order.MaxSlippage,
+		TimeInForce:     order.TimeInForce,
+		PostOnly:        order.PostOnly,
+		PostOnlyReprice: order.PostOnlyReprice,
+	}
+	if bookOrder.Type == "" {
+		bookOrder.Type = models.OrderTypeLimit
+	}
+	if bookOrder.TimeInForce == "" {
+		bookOrder.TimeInForce = models.TimeInForceGTC
+	}
+	if bookOrder.TimeInForce == models.TimeInForceGTT {
+		bookOrder.ExpiresAt = order.ExpirationTimeSeconds.IntPart()
+	}
+
+	var err error
+	// a market order has no price until it is matched
+	if bookOrder.Type != models.OrderTypeMarket {
+		priceRounding := roundUp
+		if bookOrder.Side == models.SideBuy {
+			priceRounding = roundDown
+		}
+		bookOrder.Price, err = u.price.toUnits(order.Price, priceRounding)
+		if err == nil && bookOrder.Price == 0 {
+			err = errors.New(fmt.Sprintf("price %v is less than %v", order.Price, u.price.unit))
+		}
+		if err != nil {
+			return nil, &amountError{models.DoneReasonInvalidPrice, err}
+		}
+	}
+
+	// a market buy order is sized by its funds, its size is only informative
+	sizeRounding := roundExact
+	if bookOrder.isMarketBuy() {
+		sizeRounding = roundDown
+	}
+	bookOrder.Size, err = u.size.toUnits(order.Size, sizeRounding)
+	if err == nil {
+		bookOrder.DisplaySize, err = u.size.toUnits(order.DisplaySize, roundExact)
+	}
+	if err == nil && bookOrder.isMarketBuy() {
+		bookOrder.Funds, err = u.notional.toUnits(order.Funds, roundDown)
+	}
+	if err != nil {
+		return nil, &amountError{models.DoneReasonInvalidSize, err}
+	}
+	return bookOrder, nil
+}
+
+// bookOrderSnapshot is a BookOrder in a snapshot, with decimal amounts so that the snapshot does not depend
+// on the units of the book
+type bookOrderSnapshot struct {
+	OrderId         int64
+	Size            decimal.Decimal
+	Funds           decimal.Decimal
+	Price           decimal.Decimal
+	Side            models.Side
+	Type            models.OrderType
+	MaxSlippage     decimal.Decimal
+	TimeInForce     models.TimeInForce
+	PostOnly        bool
+	PostOnlyReprice bool
+	ExpiresAt       int64
+	DisplaySize     decimal.Decimal
+	HiddenSize      decimal.Decimal
+	Seq             int64
+	OrderHash       string
+	MakerAddress    string
+}
+
+func (u *bookUnits) snapshotOrder(order *BookOrder) bookOrderSnapshot {
+	return bookOrderSnapshot{
+		OrderId:         order.OrderId,
+		Size:            u.size.toDecimal(order.Size),
+		Funds:           u.notional.toDecimal(order.Funds),
+		Price:           u.price.toDecimal(order.Price),
+		Side:            order.Side,
+		Type:            order.Type,
+		MaxSlippage:     order.MaxSlippage,
+		TimeInForce:     order.TimeInForce,
+		PostOnly:        order.PostOnly,
+		PostOnlyReprice: order.PostOnlyReprice,
+		ExpiresAt:       order.ExpiresAt,
+		DisplaySize:     u.size.toDecimal(order.DisplaySize),
+		HiddenSize:      u.size.toDecimal(order.HiddenSize),
+		Seq:             order.Seq,
+		OrderHash:       order.OrderHash,
+		MakerAddress:    order.MakerAddress,
+	}
+}
+
+// restore an order of a snapshot, its amounts must be exact multiples of the units. Only limit orders rest
+// on the book, their funds are not used.
+func (u *bookUnits) restoreOrder(snapshot *bookOrderSnapshot) (*BookOrder, error) {
+	order := &BookOrder{
+		OrderId:         snapshot.OrderId,
+		Side:            snapshot.Side,
+		Type:            snapshot.Type,
+		MaxSlippage:     snapshot.MaxSlippage,
+		TimeInForce:     snapshot.TimeInForce,
+		PostOnly:        snapshot.PostOnly,
+		PostOnlyReprice: snapshot.PostOnlyReprice,
+		ExpiresAt:       snapshot.ExpiresAt,
+		Seq:             snapshot.Seq,
+		OrderHash:       snapshot.OrderHash,
+		MakerAddress:    snapshot.MakerAddress,
+	}
+
+	var err error
+	for _, amount := range []struct {
+		units *int64
+		unit  fixedUnit
+		value decimal.Decimal
+	}{
+		{&order.Size, u.size, snapshot.Size},
+		{&order.Price, u.price, snapshot.Price},
+		{&order.DisplaySize, u.size, snapshot.DisplaySize},
+		{&order.HiddenSize, u.size, snapshot.HiddenSize},
+	} {
+		*amount.units, err = amount.unit.toUnits(amount.value, roundExact)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("order %v of snapshot: %v", snapshot.OrderId, err))
+		}
+	}
+	return order, nil
+}
+
+// a * b, false on overflow, both are non-negative
+func mulInt64(a, b int64) (int64, bool) {
+	if a != 0 && b > math.MaxInt64/a {
+		return 0, false
+	}
+	return a * b, true
+}
+
+// a + b capped at math.MaxInt64, both are non-negative
+func addInt64Saturated(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+// x * 10^exp, false on overflow
+func mulPow10(x int64, exp int32) (int64, bool) {
+	for ; exp > 0; exp-- {
+		if x > math.MaxInt64/10 {
+			return 0, false
+		}
+		x *= 10
+	}
+	return x, true
+}
@@ -0,0 +1,132 @@
+package match
+
+import (
+	"math"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+func TestToUnits(t *testing.T) {
+	cent := decimal.New(1, -2)
+	tests := []struct {
+		name     string
+		unit     decimal.Decimal
+		amount   string
+		rounding rounding
+		units    int64
+		// whether the amount can not be converted
+		fails bool
+	}{
+		{"exact", cent, "1.23", roundExact, 123, false},
+		{"zero", cent, "0", roundExact, 0, false},
+		{"integer amount", cent, "12", roundExact, 1200, false},
+		{"not a multiple", cent, "1.234", roundExact, 0, true},
+		{"rounded down", cent, "1.239", roundDown, 123, false},
+		{"rounded up", cent, "1.231", roundUp, 124, false},
+		{"multiple rounded up", cent, "1.230", roundUp, 123, false},
+		{"negative", cent, "-0.01", roundDown, 0, true},
+		{"max units", cent, "92233720368547758.07", roundExact, math.MaxInt64, false},
+
+		// the coefficient of the amount is beyond int64, the units are computed by QuoRem
+		{"slow path rounded down", cent, "92233720.36854775808", roundDown, 9223372036, false},
+		{"slow path rounded up", cent, "92233720.36854775808", roundUp, 9223372037, false},
+		{"slow path not a multiple", cent, "92233720.36854775808", roundExact, 0, true},
+		{"slow path overflow", cent, "92233720368547758.08", roundExact, 0, true},
+		// the coefficient of 1e18 fits in int64 but its 1e20 cents do not
+		{"scaled amount overflow", cent, "1e18", roundDown, 0, true},
+		{"rounded up overflow", decimal.New(1, 0), "9223372036854775807.5", roundUp, 0, true},
+		{"rounded down at max units", decimal.New(1, 0), "9223372036854775807.5", roundDown, math.MaxInt64, false},
+		{"unit beyond int64", decimal.RequireFromString("10000000000000000000"), "30000000000000000000", roundExact, 3, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			units, err := newFixedUnit(test.unit).toUnits(decimal.RequireFromString(test.amount), test.rounding)
+			if test.fails {
+				if err == nil {
+					t.Fatalf("%v converted to %v units of %v, expected an error", test.amount, units, test.unit)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if units != test.units {
+				t.Fatalf("%v is %v units of %v, expected %v", test.amount, units, test.unit, test.units)
+			}
+		})
+	}
+}
+
+func TestNewBookOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		order *models.Order
+		// book amounts in ticks of 0.01, lots of 0.001 and funds units of 0.00001
+		price, size, funds int64
+		// reason of the amountError, empty when the order enters the book
+		reason models.DoneReason
+	}{
+		{"limit buy", newTestLimitOrder(1, models.SideBuy, "100.01", "1.5"), 10001, 1500, 0, ""},
+
+		// the price of a passive order is rounded so that it never gets worse for the order
+		{"buy price rounded down", newTestLimitOrder(1, models.SideBuy, "100.019", "1"), 10001, 1000, 0, ""},
+		{"sell price rounded up", newTestLimitOrder(1, models.SideSell, "100.011", "1"), 10002, 1000, 0, ""},
+		{"sell price rounded up from below a tick", newTestLimitOrder(1, models.SideSell, "0.001", "1"), 1, 1000, 0, ""},
+		{"buy price rounded down to zero", newTestLimitOrder(1, models.SideBuy, "0.009", "1"), 0, 0, 0,
+			models.DoneReasonInvalidPrice},
+		{"zero price", newTestLimitOrder(1, models.SideSell, "0", "1"), 0, 0, 0, models.DoneReasonInvalidPrice},
+		{"negative price", newTestLimitOrder(1, models.SideSell, "-1", "1"), 0, 0, 0, models.DoneReasonInvalidPrice},
+		{"price overflow", newTestLimitOrder(1, models.SideBuy, "1e17", "1"), 0, 0, 0, models.DoneReasonInvalidPrice},
+
+		{"size not a multiple", newTestLimitOrder(1, models.SideBuy, "100", "1.0005"), 0, 0, 0,
+			models.DoneReasonInvalidSize},
+		{"size overflow", newTestLimitOrder(1, models.SideSell, "100", "1e17"), 0, 0, 0, models.DoneReasonInvalidSize},
+
+		// funds of a market buy are rounded down to what can pay for a lot, its size is only informative
+		{"market buy funds rounded down", newTestMarketOrder(1, models.SideBuy, "0.0015", "1.234567", "0"), 0, 1, 123456, ""},
+		{"market buy funds overflow", newTestMarketOrder(1, models.SideBuy, "1", "1e15", "0"), 0, 0, 0,
+			models.DoneReasonInvalidSize},
+		{"market sell", newTestMarketOrder(1, models.SideSell, "0.5", "1.234567", "0"), 0, 500, 0, ""},
+		{"market sell size not a multiple", newTestMarketOrder(1, models.SideSell, "0.0015", "0", "0"), 0, 0, 0,
+			models.DoneReasonInvalidSize},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bookOrder, err := newBookUnits(testBookProduct).newBookOrder(test.order)
+			if len(test.reason) > 0 {
+				amountErr, ok := err.(*amountError)
+				if !ok {
+					t.Fatalf("expected an amount error, got %v", err)
+				}
+				if amountErr.reason != test.reason {
+					t.Fatalf("amount error reason %v, expected %v", amountErr.reason, test.reason)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bookOrder.Price != test.price || bookOrder.Size != test.size || bookOrder.Funds != test.funds {
+				t.Fatalf("price %v, size %v and funds %v, expected %v, %v and %v", bookOrder.Price, bookOrder.Size,
+					bookOrder.Funds, test.price, test.size, test.funds)
+			}
+		})
+	}
+}
+
+// an order without type and time in force is a GTC limit order
+func TestNewBookOrderDefaults(t *testing.T) {
+	order := newTestLimitOrder(1, models.SideBuy, "100", "1")
+	order.Type = ""
+	order.TimeInForce = ""
+
+	bookOrder, err := newBookUnits(testBookProduct).newBookOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bookOrder.Type != models.OrderTypeLimit || bookOrder.TimeInForce != models.TimeInForceGTC {
+		t.Fatalf("type %v and time in force %v, expected limit and GTC", bookOrder.Type, bookOrder.TimeInForce)
+	}
+}
@@ -0,0 +1,112 @@
+package match
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/zimengpan/go-boomflow/metrics"
+)
+
+type KafkaLogReader struct {
+	readerId  string
+	productId string
+	reader    *kafka.Reader
+	observer  LogObserver
+}
+
+func NewKafkaLogReader(readerId, productId string, brokers []string) LogReader {
+	s := &KafkaLogReader{
+		readerId:  readerId,
+		productId: productId,
+	}
+
+	s.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     TopicLogPrefix + productId,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	return s
+}
+
+func (r *KafkaLogReader) GetProductId() string {
+	return r.productId
+}
+
+func (r *KafkaLogReader) RegisterObserver(observer LogObserver) {
+	r.observer = observer
+}
+
+func (r *KafkaLogReader) Run(seq, offset int64) {
+	logger.Infof("%v:%v read from %v", r.productId, r.readerId, offset)
+
+	var lastSeq = seq
+	var fence logFence
+
+	err := r.reader.SetOffset(offset)
+	if err != nil {
+		panic(err)
+	}
+
+	for {
+		message, err := r.reader.FetchMessage(context.Background())
+		if err != nil {
+			metrics.KafkaErrors.WithLabelValues(TopicLogPrefix+r.productId, "read").Inc()
+			logger.Error(err)
+			continue
+		}
+
+		// 丢弃已经被取代的旧leader写入的log，旧leader在检查fence之后、写入之前可能已经有新的leader当选
+		token, err := messageFencingToken(message)
+		if err != nil {
+			panic(err)
+		}
+		if !fence.accept(token) {
+			logger.Warnf("%v:%v discard log of fenced leader: token=%v maxToken=%v offset=%v",
+				r.productId, r.readerId, token, fence.maxToken, message.Offset)
+			continue
+		}
+
+		log, err := DecodeLog(message.Value)
+		if err != nil {
+			panic(err)
+		}
+
+		// 丢弃重复的log，seq必须连续
+		if log.GetSeq() <= lastSeq {
+			logger.Infof("%v:%v discard log :%+v", r.productId, r.readerId, log)
+			continue
+		} else if lastSeq > 0 && log.GetSeq() != lastSeq+1 {
+			logger.Fatalf("non-seq detected, lastSeq=%v seq=%v", lastSeq, log.GetSeq())
+		}
+		lastSeq = log.GetSeq()
+
+		switch log := log.(type) {
+		case *OpenLog:
+			r.observer.OnOpenLog(log, message.Offset)
+
+		case *MatchLog:
+			r.observer.OnMatchLog(log, message.Offset)
+
+		case *DoneLog:
+			r.observer.OnDoneLog(log, message.Offset)
+
+		case *ActivatedLog:
+			r.observer.OnActivatedLog(log, message.Offset)
+		}
+	}
+}
+
+// 记录读到的最大fencing token，token小于最大token的log来自已经被取代的leader
+type logFence struct {
+	maxToken int64
+}
+
+func (f *logFence) accept(token int64) bool {
+	if token < f.maxToken {
+		return false
+	}
+	f.maxToken = token
+	return true
+}
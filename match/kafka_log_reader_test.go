@@ -0,0 +1,60 @@
+package match
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// 旧leader在新leader当选后写入的log被丢弃，同一个leader和更新的leader写入的log都保留
+func TestLogFence(t *testing.T) {
+	var fence logFence
+	for i, c := range []struct {
+		token    int64
+		accepted bool
+	}{
+		{0, true},
+		{1, true},
+		{1, true},
+		{3, true},
+		{2, false},
+		{1, false},
+		{3, true},
+		{4, true},
+	} {
+		if fence.accept(c.token) != c.accepted {
+			t.Fatalf("log %v with token %v accepted=%v, expected %v", i, c.token, !c.accepted, c.accepted)
+		}
+	}
+	if fence.maxToken != 4 {
+		t.Fatalf("max token %v, expected 4", fence.maxToken)
+	}
+}
+
+func TestMessageFencingToken(t *testing.T) {
+	token, err := messageFencingToken(kafka.Message{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != 0 {
+		t.Fatalf("token %v of a message without header, expected 0", token)
+	}
+
+	message := kafka.Message{Headers: []kafka.Header{
+		{Key: "other", Value: []byte("x")},
+		{Key: headerFencingToken, Value: []byte(strconv.FormatInt(42, 10))},
+	}}
+	token, err = messageFencingToken(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != 42 {
+		t.Fatalf("token %v, expected 42", token)
+	}
+
+	_, err = messageFencingToken(kafka.Message{Headers: []kafka.Header{{Key: headerFencingToken, Value: []byte("x")}}})
+	if err == nil {
+		t.Fatal("parsed an invalid token")
+	}
+}
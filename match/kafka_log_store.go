@@ -0,0 +1,94 @@
+package match
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/zimengpan/go-boomflow/metrics"
+)
+
+const (
+	TopicLogPrefix = "matching_log_"
+
+	// 日志消息头，值为写入日志的leader的fencing token
+	headerFencingToken = "fencingToken"
+)
+
+type KafkaLogStore struct {
+	productId string
+	brokers   []string
+	logWriter *kafka.Writer
+	codec     Codec
+}
+
+func NewKafkaLogStore(productId string, brokers []string, codec Codec) *KafkaLogStore {
+	s := &KafkaLogStore{productId: productId, brokers: brokers, codec: codec}
+
+	s.logWriter = kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      brokers,
+		Topic:        TopicLogPrefix + productId,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: 5 * time.Millisecond,
+	})
+	return s
+}
+
+func (s *KafkaLogStore) Store(token int64, logs []interface{}) error {
+	headers := []kafka.Header{{Key: headerFencingToken, Value: []byte(strconv.FormatInt(token, 10))}}
+
+	var messages []kafka.Message
+	for _, log := range logs {
+		val, err := EncodeLog(s.codec, log.(Log))
+		if err != nil {
+			return err
+		}
+		messages = append(messages, kafka.Message{Value: val, Headers: headers})
+	}
+
+	err := s.logWriter.WriteMessages(context.Background(), messages...)
+	if err != nil {
+		metrics.KafkaErrors.WithLabelValues(TopicLogPrefix+s.productId, "write").Inc()
+	}
+	return err
+}
+
+func (s *KafkaLogStore) LastSeq() (int64, error) {
+	topic := TopicLogPrefix + s.productId
+	conn, err := kafka.DialLeader(context.Background(), "tcp", s.brokers[0], topic, 0)
+	if err != nil {
+		metrics.KafkaErrors.WithLabelValues(topic, "read").Inc()
+		return 0, err
+	}
+	defer conn.Close()
+
+	lastOffset, err := conn.ReadLastOffset()
+	if err != nil || lastOffset == 0 {
+		return 0, err
+	}
+	_, err = conn.Seek(lastOffset-1, kafka.SeekAbsolute)
+	if err != nil {
+		return 0, err
+	}
+	message, err := conn.ReadMessage(10e6)
+	if err != nil {
+		return 0, err
+	}
+
+	log, err := DecodeLog(message.Value)
+	if err != nil {
+		return 0, err
+	}
+	return log.GetSeq(), nil
+}
+
+// 读取消息中的fencing token，引入fencing token之前写入的消息和没有选举时写入的消息为0
+func messageFencingToken(message kafka.Message) (int64, error) {
+	for _, header := range message.Headers {
+		if header.Key == headerFencingToken {
+			return strconv.ParseInt(string(header.Value), 10, 64)
+		}
+	}
+	return 0, nil
+}
@@ -1,48 +1,69 @@
-package match
-
-import (
-	"context"
-	"encoding/json"
-
-	"github.com/segmentio/kafka-go"
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-const (
-	TopicOrderPrefix = "matching_order_"
-)
-
-type KafkaOrderReader struct {
-	orderReader *kafka.Reader
-}
-
-func NewKafkaOrderReader(productId string, brokers []string) *KafkaOrderReader {
-	s := &KafkaOrderReader{}
-
-	s.orderReader = kafka.NewReader(kafka.ReaderConfig{
-		Brokers:   brokers,
-		Topic:     TopicOrderPrefix + productId,
-		Partition: 0,
-		MinBytes:  1,
-		MaxBytes:  10e6,
-	})
-	return s
-}
-
-func (s *KafkaOrderReader) SetOffset(offset int64) error {
-	return s.orderReader.SetOffset(offset)
-}
-
-func (s *KafkaOrderReader) FetchOrder() (offset int64, order *models.Order, err error) {
-	message, err := s.orderReader.FetchMessage(context.Background())
-	if err != nil {
-		return 0, nil, err
-	}
-
-	err = json.Unmarshal(message.Value, &order)
-	if err != nil {
-		return 0, nil, err
-	}
-
-	return message.Offset, order, nil
-}
+package match
+
+import (
+	"context"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/zimengpan/go-boomflow/metrics"
+)
+
+const (
+	TopicOrderPrefix = "matching_order_"
+)
+
+type KafkaOrderReader struct {
+	productId   string
+	brokers     []string
+	orderReader *kafka.Reader
+}
+
+func NewKafkaOrderReader(productId string, brokers []string) *KafkaOrderReader {
+	s := &KafkaOrderReader{productId: productId, brokers: brokers}
+
+	s.orderReader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Topic:     TopicOrderPrefix + productId,
+		Partition: 0,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	return s
+}
+
+func (s *KafkaOrderReader) SetOffset(offset int64) error {
+	return s.orderReader.SetOffset(offset)
+}
+
+func (s *KafkaOrderReader) FetchOrder() (offset int64, command *Command, err error) {
+	message, err := s.orderReader.FetchMessage(context.Background())
+	if err != nil {
+		metrics.KafkaErrors.WithLabelValues(TopicOrderPrefix+s.productId, "read").Inc()
+		return 0, nil, err
+	}
+	metrics.OrderOffsetLag.WithLabelValues(s.productId).Set(float64(s.orderReader.Lag()))
+
+	command, err = DecodeCommand(message.Value)
+	if err != nil {
+		return message.Offset, nil, &OrderDecodeError{Offset: message.Offset, Err: err}
+	}
+
+	return message.Offset, command, nil
+}
+
+// LastOffset returns the offset of the last order of the topic, -1 when the topic is empty.
+// The orders up to it can be fetched without waiting for new orders.
+func (s *KafkaOrderReader) LastOffset() (int64, error) {
+	topic := TopicOrderPrefix + s.productId
+	conn, err := kafka.DialLeader(context.Background(), "tcp", s.brokers[0], topic, 0)
+	if err != nil {
+		metrics.KafkaErrors.WithLabelValues(topic, "read").Inc()
+		return 0, err
+	}
+	defer conn.Close()
+
+	lastOffset, err := conn.ReadLastOffset()
+	if err != nil {
+		return 0, err
+	}
+	return lastOffset - 1, nil
+}
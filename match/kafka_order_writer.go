@@ -0,0 +1,60 @@
+package match
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/metrics"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+var productId2Writer sync.Map
+
+func getWriter(productId string) *kafka.Writer {
+	writer, found := productId2Writer.Load(productId)
+	if found {
+		return writer.(*kafka.Writer)
+	}
+
+	gbeConfig := conf.GetConfig()
+
+	newWriter := kafka.NewWriter(kafka.WriterConfig{
+		Brokers:      gbeConfig.Kafka.Brokers,
+		Topic:        TopicOrderPrefix + productId,
+		Balancer:     &kafka.LeastBytes{},
+		BatchTimeout: 5 * time.Millisecond,
+	})
+	writer, _ = productId2Writer.LoadOrStore(productId, newWriter)
+	return writer.(*kafka.Writer)
+}
+
+// 将command按照配置的编码写入product对应的order topic，由engine读取并执行
+func SubmitCommand(productId string, command *Command) error {
+	codec, err := GetCodec(conf.GetConfig().Match.Encoding)
+	if err != nil {
+		return err
+	}
+	buf, err := EncodeCommand(codec, command)
+	if err != nil {
+		return err
+	}
+
+	err = getWriter(productId).WriteMessages(context.Background(), kafka.Message{Value: buf})
+	if err != nil {
+		metrics.KafkaErrors.WithLabelValues(TopicOrderPrefix+productId, "write").Inc()
+	}
+	return err
+}
+
+// 提交下单的command
+func SubmitOrder(order *models.Order) error {
+	return SubmitCommand(order.ProductId, NewPlaceCommand(order))
+}
+
+// 提交撤单的command，reason为空时订单以cancelled完成
+func SubmitCancel(order *models.Order, reason models.DoneReason, requestId string) error {
+	return SubmitCommand(order.ProductId, NewCancelCommand(order, reason, requestId))
+}
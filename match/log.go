@@ -1,111 +1,156 @@
-package match
-
-import (
-	"time"
-
-	"github.com/shopspring/decimal"
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-type LogType string
-
-const (
-	LogTypeMatch = LogType("match")
-	LogTypeOpen  = LogType("open")
-	LogTypeDone  = LogType("done")
-)
-
-type Log interface {
-	GetSeq() int64
-}
-
-type Base struct {
-	Type      LogType
-	Sequence  int64
-	ProductId string
-	Time      time.Time
-}
-
-type ReceivedLog struct {
-	Base
-	OrderId int64
-	Size    decimal.Decimal
-	Price   decimal.Decimal
-	Side    models.Side
-}
-
-func (l *ReceivedLog) GetSeq() int64 {
-	return l.Sequence
-}
-
-type OpenLog struct {
-	Base
-	OrderId       int64
-	RemainingSize decimal.Decimal
-	Price         decimal.Decimal
-	Side          models.Side
-}
-
-func newOpenLog(logSeq int64, productId string, takerOrder *BookOrder) *OpenLog {
-	return &OpenLog{
-		Base:          Base{LogTypeOpen, logSeq, productId, time.Now()},
-		OrderId:       takerOrder.OrderId,
-		RemainingSize: takerOrder.Size,
-		Price:         takerOrder.Price,
-		Side:          takerOrder.Side,
-	}
-}
-
-func (l *OpenLog) GetSeq() int64 {
-	return l.Sequence
-}
-
-type DoneLog struct {
-	Base
-	OrderId       int64
-	Price         decimal.Decimal
-	RemainingSize decimal.Decimal
-	Reason        models.DoneReason
-	Side          models.Side
-}
-
-func newDoneLog(logSeq int64, productId string, order *BookOrder, remainingSize decimal.Decimal, reason models.DoneReason) *DoneLog {
-	return &DoneLog{
-		Base:          Base{LogTypeDone, logSeq, productId, time.Now()},
-		OrderId:       order.OrderId,
-		Price:         order.Price,
-		RemainingSize: remainingSize,
-		Reason:        reason,
-		Side:          order.Side,
-	}
-}
-
-func (l *DoneLog) GetSeq() int64 {
-	return l.Sequence
-}
-
-type MatchLog struct {
-	Base
-	TradeId      int64
-	TakerOrderId int64
-	MakerOrderId int64
-	Side         models.Side
-	Price        decimal.Decimal
-	Size         decimal.Decimal
-}
-
-func newMatchLog(logSeq int64, productId string, tradeSeq int64, takerOrder, makerOrder *BookOrder, price, size decimal.Decimal) *MatchLog {
-	return &MatchLog{
-		Base:         Base{LogTypeMatch, logSeq, productId, time.Now()},
-		TradeId:      tradeSeq,
-		TakerOrderId: takerOrder.OrderId,
-		MakerOrderId: makerOrder.OrderId,
-		Side:         makerOrder.Side,
-		Price:        price,
-		Size:         size,
-	}
-}
-
-func (l *MatchLog) GetSeq() int64 {
-	return l.Sequence
-}
+package match
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+type LogType string
+
+const (
+	LogTypeMatch = LogType("match")
+	LogTypeOpen  = LogType("open")
+	LogTypeDone  = LogType("done")
+	// a stop order is triggered and submitted to the order book
+	LogTypeActivated = LogType("activated")
+)
+
+type Log interface {
+	GetSeq() int64
+}
+
+type Base struct {
+	Type      LogType
+	Sequence  int64
+	ProductId string
+	Time      time.Time
+}
+
+type ReceivedLog struct {
+	Base
+	OrderId int64
+	Size    decimal.Decimal
+	Price   decimal.Decimal
+	Side    models.Side
+}
+
+func (l *ReceivedLog) GetSeq() int64 {
+	return l.Sequence
+}
+
+type OpenLog struct {
+	Base
+	OrderId       int64
+	RemainingSize decimal.Decimal
+	Price         decimal.Decimal
+	Side          models.Side
+}
+
+func newOpenLog(logSeq int64, productId string, logTime time.Time, units *bookUnits, takerOrder *BookOrder) *OpenLog {
+	return &OpenLog{
+		Base:          Base{LogTypeOpen, logSeq, productId, logTime},
+		OrderId:       takerOrder.OrderId,
+		RemainingSize: units.size.toDecimal(takerOrder.Size),
+		Price:         units.price.toDecimal(takerOrder.Price),
+		Side:          takerOrder.Side,
+	}
+}
+
+func (l *OpenLog) GetSeq() int64 {
+	return l.Sequence
+}
+
+type DoneLog struct {
+	Base
+	OrderId       int64
+	OrderHash     string
+	Price         decimal.Decimal
+	RemainingSize decimal.Decimal
+	Reason        models.DoneReason
+	Side          models.Side
+}
+
+func newDoneLog(logSeq int64, productId string, logTime time.Time, units *bookUnits, order *BookOrder, remainingSize int64, reason models.DoneReason) *DoneLog {
+	// the price of a market order is only its slippage limit while matching
+	price := decimal.Zero
+	if order.Type != models.OrderTypeMarket {
+		price = units.price.toDecimal(order.Price)
+	}
+
+	return &DoneLog{
+		Base:          Base{LogTypeDone, logSeq, productId, logTime},
+		OrderId:       order.OrderId,
+		OrderHash:     order.OrderHash,
+		Price:         price,
+		RemainingSize: units.size.toDecimal(remainingSize),
+		Reason:        reason,
+		Side:          order.Side,
+	}
+}
+
+// the done log of an order that never entered the book, with its amounts as submitted
+func newOrderDoneLog(logSeq int64, productId string, logTime time.Time, order *models.Order, reason models.DoneReason) *DoneLog {
+	return &DoneLog{
+		Base:          Base{LogTypeDone, logSeq, productId, logTime},
+		OrderId:       order.Id,
+		OrderHash:     order.Hash,
+		Price:         order.Price,
+		RemainingSize: order.Size,
+		Reason:        reason,
+		Side:          order.Side,
+	}
+}
+
+func (l *DoneLog) GetSeq() int64 {
+	return l.Sequence
+}
+
+type MatchLog struct {
+	Base
+	TradeId      int64
+	TakerOrderId int64
+	MakerOrderId int64
+	Side         models.Side
+	Price        decimal.Decimal
+	Size         decimal.Decimal
+}
+
+func newMatchLog(logSeq int64, productId string, logTime time.Time, units *bookUnits, tradeSeq int64, takerOrder, makerOrder *BookOrder, price, size int64) *MatchLog {
+	return &MatchLog{
+		Base:         Base{LogTypeMatch, logSeq, productId, logTime},
+		TradeId:      tradeSeq,
+		TakerOrderId: takerOrder.OrderId,
+		MakerOrderId: makerOrder.OrderId,
+		Side:         makerOrder.Side,
+		Price:        units.price.toDecimal(price),
+		Size:         units.size.toDecimal(size),
+	}
+}
+
+func (l *MatchLog) GetSeq() int64 {
+	return l.Sequence
+}
+
+type ActivatedLog struct {
+	Base
+	OrderId   int64
+	StopPrice decimal.Decimal
+	LastPrice decimal.Decimal
+	Side      models.Side
+}
+
+func newActivatedLog(logSeq int64, productId string, logTime time.Time, order *models.Order, lastPrice decimal.Decimal) *ActivatedLog {
+	return &ActivatedLog{
+		Base:      Base{LogTypeActivated, logSeq, productId, logTime},
+		OrderId:   order.Id,
+		StopPrice: order.StopPrice,
+		LastPrice: lastPrice,
+		Side:      order.Side,
+	}
+}
+
+func (l *ActivatedLog) GetSeq() int64 {
+	return l.Sequence
+}
@@ -1,235 +1,602 @@
-package match
-
-import (
-	"errors"
-	"fmt"
-
-	"github.com/emirpasic/gods/maps/treemap"
-	"github.com/shopspring/decimal"
-	"github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-const (
-	orderIdWindowCap = 10000
-)
-
-type orderBook struct {
-	// one product corresponds to one order book
-	product *models.Product
-
-	// depths: asks & bids
-	depths map[models.Side]*depth
-
-	// strictly continuously increasing transaction ID, used for the primary key ID of trade
-	tradeSeq int64
-
-	// strictly continuously increasing log SEQ, used to write matching log
-	logSeq int64
-
-	// to prevent the order from being submitted to the order book repeatedly,
-	// a sliding window de duplication strategy is adopted.
-	orderIdWindow Window
-}
-
-type priceOrderIdKey struct {
-	price   decimal.Decimal
-	orderId int64
-}
-
-func NewOrderBook(product *models.Product) *orderBook {
-	asks := &depth{
-		queue:  treemap.NewWith(priceOrderIdKeyAscComparator),
-		orders: map[int64]*BookOrder{},
-	}
-	bids := &depth{
-		queue:  treemap.NewWith(priceOrderIdKeyDescComparator),
-		orders: map[int64]*BookOrder{},
-	}
-
-	orderBook := &orderBook{
-		product:       product,
-		depths:        map[models.Side]*depth{models.SideBuy: bids, models.SideSell: asks},
-		orderIdWindow: newWindow(0, orderIdWindowCap),
-	}
-	return orderBook
-}
-
-func (o *orderBook) ApplyOrder(order *models.Order) (logs []Log) {
-	// prevent orders from being submitted repeatedly to the matching engine
-	log.Info("Order: ", order.Signature)
-	err := o.orderIdWindow.put(order.Salt)
-	if err != nil {
-		log.Error(err)
-		return logs
-	}
-
-	takerOrder := newBookOrder(order)
-	log.Info("Order Price", takerOrder.Price)
-	if takerOrder.Size.GreaterThan(decimal.Zero) {
-		// If taker has an uncompleted size, put taker in orderBook
-		o.depths[takerOrder.Side].add(*takerOrder)
-
-		openLog := newOpenLog(o.nextLogSeq(), o.product.Id, takerOrder)
-		logs = append(logs, openLog)
-	} else {
-		var remainingSize = takerOrder.Size
-		var reason = models.DoneReasonFilled
-
-		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, takerOrder, remainingSize, reason)
-		logs = append(logs, doneLog)
-	}
-	return logs
-}
-
-/*func (o *orderBook) CancelOrder(order *models.Order) (logs []Log) {
-	_ = o.orderIdWindow.put(order.Id)
-
-	bookOrder, found := o.depths[order.Side].orders[order.Id]
-	if !found {
-		return logs
-	}
-
-	// 将order的size全部decr，等于remove操作
-	remainingSize := bookOrder.Size
-	err := o.depths[order.Side].decrSize(order.Id, bookOrder.Size)
-	if err != nil {
-		panic(err)
-	}
-
-	doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, bookOrder, remainingSize, models.DoneReasonCancelled)
-	return append(logs, doneLog)
-}*/
-
-/*func (o *orderBook) Snapshot() orderBookSnapshot {
-	snapshot := orderBookSnapshot{
-		Orders:        make([]BookOrder, len(o.depths[models.SideSell].orders)+len(o.depths[models.SideBuy].orders)),
-		LogSeq:        o.logSeq,
-		TradeSeq:      o.tradeSeq,
-		OrderIdWindow: o.orderIdWindow,
-	}
-
-	i := 0
-	for _, order := range o.depths[models.SideSell].orders {
-		snapshot.Orders[i] = *order
-		i++
-	}
-	for _, order := range o.depths[models.SideBuy].orders {
-		snapshot.Orders[i] = *order
-		i++
-	}
-
-	return snapshot
-}
-
-func (o *orderBook) Restore(snapshot *orderBookSnapshot) {
-	o.logSeq = snapshot.LogSeq
-	o.tradeSeq = snapshot.TradeSeq
-	o.orderIdWindow = snapshot.OrderIdWindow
-	if o.orderIdWindow.Cap == 0 {
-		o.orderIdWindow = newWindow(0, orderIdWindowCap)
-	}
-
-	for _, order := range snapshot.Orders {
-		o.depths[order.Side].add(order)
-	}
-}*/
-
-func (o *orderBook) nextLogSeq() int64 {
-	o.logSeq++
-	return o.logSeq
-}
-
-func (o *orderBook) nextTradeSeq() int64 {
-	o.tradeSeq++
-	return o.tradeSeq
-}
-
-type depth struct {
-	// all orders
-	orders map[int64]*BookOrder
-
-	// price first, time first order queue for order match
-	// priceOrderIdKey -> orderId
-	queue *treemap.Map
-}
-
-func (d *depth) add(order BookOrder) {
-	d.orders[order.OrderId] = &order
-	d.queue.Put(&priceOrderIdKey{order.Price, order.OrderId}, order.OrderId)
-}
-
-func (d *depth) decrSize(orderId int64, size decimal.Decimal) error {
-	order, found := d.orders[orderId]
-	if !found {
-		return errors.New(fmt.Sprintf("order %v not found on book", orderId))
-	}
-
-	if order.Size.LessThan(size) {
-		return errors.New(fmt.Sprintf("order %v Size %v less than %v", orderId, order.Size, size))
-	}
-
-	order.Size = order.Size.Sub(size)
-	if order.Size.IsZero() {
-		delete(d.orders, orderId)
-		d.queue.Remove(&priceOrderIdKey{order.Price, order.OrderId})
-	}
-
-	return nil
-}
-
-type BookOrder struct {
-	OrderId int64
-	Size    decimal.Decimal
-	Funds   decimal.Decimal
-	Price   decimal.Decimal
-	Side    models.Side
-}
-
-func newBookOrder(order *models.Order) *BookOrder {
-	return &BookOrder{
-		OrderId: order.Id,
-		Size:    order.TakerAssetAmount,
-		Funds:   order.MakerAssetAmount,
-		Price:   (order.TakerAssetAmount).Div(order.MakerAssetAmount),
-		Side:    order.Side,
-	}
-}
-
-func priceOrderIdKeyAscComparator(a, b interface{}) int {
-	aAsserted := a.(*priceOrderIdKey)
-	bAsserted := b.(*priceOrderIdKey)
-
-	x := aAsserted.price.Cmp(bAsserted.price)
-	if x != 0 {
-		return x
-	}
-
-	y := aAsserted.orderId - bAsserted.orderId
-	if y == 0 {
-		return 0
-	} else if y > 0 {
-		return 1
-	} else {
-		return -1
-	}
-}
-
-func priceOrderIdKeyDescComparator(a, b interface{}) int {
-	aAsserted := a.(*priceOrderIdKey)
-	bAsserted := b.(*priceOrderIdKey)
-
-	x := aAsserted.price.Cmp(bAsserted.price)
-	if x != 0 {
-		return -x
-	}
-
-	y := aAsserted.orderId - bAsserted.orderId
-	if y == 0 {
-		return 0
-	} else if y > 0 {
-		return 1
-	} else {
-		return -1
-	}
-}
+package match
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const (
+	orderWindowCap = 100000
+
+	// the price in ticks of a market buy order without slippage protection, crosses every ask
+	marketBuyPrice = math.MaxInt64
+)
+
+type orderBook struct {
+	// one product corresponds to one order book
+	product *models.Product
+
+	// the book works on integer sizes, prices and funds in these units
+	units *bookUnits
+
+	// depths: asks & bids
+	depths map[models.Side]*depth
+
+	// strictly continuously increasing transaction ID, used for the primary key ID of trade
+	tradeSeq int64
+
+	// strictly continuously increasing log SEQ, used to write matching log
+	logSeq int64
+
+	// to prevent the order from being submitted to the order book repeatedly,
+	// a sliding window de duplication strategy is adopted.
+	orderWindow Window
+
+	// stop orders waiting for the last trade price to reach their stop price
+	stops *stopBook
+
+	// price of the last trade in ticks, used to trigger stop orders
+	lastPrice int64
+
+	// submission time of the command being applied, the time of its logs, so that the same commands
+	// always produce the same logs
+	logTime time.Time
+
+	// no order is placed while trading is halted
+	halted bool
+}
+
+type orderBookSnapshot struct {
+	ProductId   string
+	Orders      []bookOrderSnapshot
+	StopOrders  []models.Order
+	LastPrice   decimal.Decimal
+	TradeSeq    int64
+	LogSeq      int64
+	OrderWindow Window
+	Halted      bool
+}
+
+func NewOrderBook(product *models.Product) *orderBook {
+	orderBook := &orderBook{
+		product: product,
+		units:   newBookUnits(product),
+		depths: map[models.Side]*depth{
+			models.SideBuy:  newDepth(models.SideBuy),
+			models.SideSell: newDepth(models.SideSell),
+		},
+		orderWindow: newWindow(orderWindowCap),
+		stops:       newStopBook(),
+	}
+	return orderBook
+}
+
+// apply a command of the order topic, the logs are stamped with the time the command was submitted
+func (o *orderBook) ApplyCommand(command *Command) (logs []Log) {
+	o.logTime = command.SubmittedAt
+
+	switch command.Type {
+	case CommandTypePlace:
+		return o.placeOrder(command.Order)
+	case CommandTypeCancel:
+		return o.cancelOrder(command.OrderId, command.Side, command.Reason)
+	case CommandTypeCancelAll:
+		return o.cancelMakerOrders(command.MakerAddress, command.Reason)
+	case CommandTypeExpire:
+		return o.expireOrders()
+	case CommandTypeHalt:
+		o.halted = true
+	case CommandTypeResume:
+		o.halted = false
+	}
+	return logs
+}
+
+func (o *orderBook) placeOrder(order *models.Order) (logs []Log) {
+	// no order enters the book while trading is halted
+	if o.halted {
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, models.DoneReasonHalted)
+		return append(logs, doneLog)
+	}
+
+	// an order id is never reused, the order that comes later must not replace the one on the book
+	if o.hasOrder(order.Id) {
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, models.DoneReasonDuplicated)
+		return append(logs, doneLog)
+	}
+
+	// prevent orders from being submitted repeatedly to the matching engine
+	if !o.orderWindow.put(orderDedupeKey(order)) {
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, models.DoneReasonDuplicated)
+		return append(logs, doneLog)
+	}
+
+	// a stop order waits in the stop book unless the last trade price has already reached it
+	if order.Type == models.OrderTypeStop || order.Type == models.OrderTypeStopLimit {
+		if stopOrderExpired(order, o.logTime.Unix()) {
+			doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, models.DoneReasonExpired)
+			return append(logs, doneLog)
+		}
+		if !stopTriggered(order.Side, order.StopPrice, o.lastTradePrice()) {
+			o.stops.add(order)
+			return logs
+		}
+		logs = o.activateStopOrder(order)
+		return append(logs, o.activateStopOrders()...)
+	}
+
+	logs = o.matchOrder(order)
+	return append(logs, o.activateStopOrders()...)
+}
+
+// whether an order is on the book or in the stop book
+func (o *orderBook) hasOrder(orderId int64) bool {
+	if _, found := o.stops.orders[orderId]; found {
+		return true
+	}
+	for _, depth := range o.depths {
+		if _, found := depth.orders[orderId]; found {
+			return true
+		}
+	}
+	return false
+}
+
+// activate the stop orders triggered by the trades, one by one, until no more stop order is triggered
+func (o *orderBook) activateStopOrders() (logs []Log) {
+	for len(o.stops.orders) > 0 {
+		order := o.stops.popTriggered(o.lastTradePrice())
+		if order == nil {
+			return logs
+		}
+		logs = append(logs, o.activateStopOrder(order)...)
+	}
+	return logs
+}
+
+// the price of the last trade, zero before the first trade
+func (o *orderBook) lastTradePrice() decimal.Decimal {
+	if o.lastPrice == 0 {
+		return decimal.Zero
+	}
+	return o.units.price.toDecimal(o.lastPrice)
+}
+
+// turn a triggered stop order into a market order and a stop-limit order into a limit order, then match it.
+// A GTT stop order that expired before it was triggered is done without being activated.
+func (o *orderBook) activateStopOrder(order *models.Order) (logs []Log) {
+	if stopOrderExpired(order, o.logTime.Unix()) {
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, models.DoneReasonExpired)
+		return append(logs, doneLog)
+	}
+
+	activatedLog := newActivatedLog(o.nextLogSeq(), o.product.Id, o.logTime, order, o.lastTradePrice())
+	logs = append(logs, activatedLog)
+
+	activated := *order
+	if order.Type == models.OrderTypeStop {
+		activated.Type = models.OrderTypeMarket
+		activated.TimeInForce = models.TimeInForceIOC
+	} else {
+		activated.Type = models.OrderTypeLimit
+	}
+
+	return append(logs, o.matchOrder(&activated)...)
+}
+
+func (o *orderBook) matchOrder(order *models.Order) (logs []Log) {
+	takerOrder, err := o.units.newBookOrder(order)
+	if err != nil {
+		// newBookOrder only fails on amounts, any other error still rejects the order instead of crashing the engine
+		reason := models.DoneReasonCancelled
+		if ae, ok := err.(*amountError); ok {
+			reason = ae.reason
+		}
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, order, reason)
+		return append(logs, doneLog)
+	}
+
+	// the time of the command is the clock of the order book, expiration of GTT orders is judged by it
+	now := o.logTime.Unix()
+	if takerOrder.expired(now) {
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonExpired)
+		return append(logs, doneLog)
+	}
+
+	makerDepth := o.depths[takerOrder.Side.Opposite()]
+
+	// a market order has no price, it crosses the opposite depth up to its slippage limit
+	if takerOrder.Type == models.OrderTypeMarket {
+		logs = append(logs, o.pruneExpired(makerDepth, now)...)
+		takerOrder.Price = o.marketLimitPrice(takerOrder, makerDepth.best())
+	}
+
+	// a post-only order must never take liquidity, reject it or move its price to the passive side
+	if takerOrder.PostOnly {
+		logs = append(logs, o.pruneExpired(makerDepth, now)...)
+		makerOrder := makerDepth.best()
+		if makerOrder != nil && takerOrder.crosses(makerOrder.Price) {
+			if !takerOrder.PostOnlyReprice || !takerOrder.reprice(makerOrder.Price) {
+				doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonPostOnly)
+				return append(logs, doneLog)
+			}
+		}
+	}
+
+	// a FOK order is rejected as a whole unless the opposite depth can fill it completely
+	if takerOrder.TimeInForce == models.TimeInForceFOK && makerDepth.fillableSize(takerOrder, now) < takerOrder.Size {
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonFillOrKill)
+		return append(logs, doneLog)
+	}
+
+	// whether the taker stopped because the best maker is beyond its price
+	var priceReached bool
+	// whether the funds left of a market buy order are too small to buy anything
+	var fundsExhausted bool
+	for {
+		if takerOrder.isMarketBuy() {
+			if takerOrder.Funds == 0 {
+				break
+			}
+		} else if takerOrder.Size == 0 {
+			break
+		}
+
+		logs = append(logs, o.pruneExpired(makerDepth, now)...)
+
+		// check whether there is price crossing between the taker and the best maker
+		makerOrder := makerDepth.best()
+		if makerOrder == nil {
+			break
+		}
+		if !takerOrder.crosses(makerOrder.Price) {
+			priceReached = true
+			break
+		}
+
+		// trade price in ticks
+		var price = makerOrder.Price
+		// trade size in lots
+		var size int64
+
+		if takerOrder.isMarketBuy() {
+			// the lots the funds can pay for at current price, funds are in units of lot * tick
+			takerSize := takerOrder.Funds / price
+			if takerSize == 0 {
+				fundsExhausted = true
+				break
+			}
+
+			// Take the minimum size of taker and maker as trade size, adjust the funds of taker order
+			size = minInt64(takerSize, makerOrder.Size)
+			notional, ok := mulInt64(size, price)
+			if !ok || notional > takerOrder.Funds {
+				logger.Fatalf("order %v funds %v can not pay %v lots at %v ticks", takerOrder.OrderId, takerOrder.Funds, size, price)
+			}
+			takerOrder.Funds -= notional
+		} else {
+			// Take the minimum size of taker and maker as trade size, adjust the size of taker order
+			size = minInt64(takerOrder.Size, makerOrder.Size)
+			takerOrder.Size -= size
+		}
+		o.lastPrice = price
+
+		sliceFilled := size == makerOrder.Size
+		err := makerDepth.decrSize(makerOrder.OrderId, size)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		matchLog := newMatchLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, o.nextTradeSeq(), takerOrder, makerOrder, price, size)
+		logs = append(logs, matchLog)
+
+		if makerOrder.Size == 0 {
+			// maker is filled
+			doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, makerOrder, makerOrder.Size, models.DoneReasonFilled)
+			logs = append(logs, doneLog)
+		} else if sliceFilled {
+			// the next slice of an iceberg maker is shown on the book
+			openLog := newOpenLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, makerOrder)
+			logs = append(logs, openLog)
+		}
+	}
+
+	if takerOrder.Type == models.OrderTypeMarket {
+		// market orders never rest on the book, whatever is left is cancelled
+		var reason = models.DoneReasonFilled
+		if (takerOrder.isMarketBuy() && takerOrder.Funds > 0 && !fundsExhausted) ||
+			(!takerOrder.isMarketBuy() && takerOrder.Size > 0) {
+			reason = models.DoneReasonCancelled
+			if priceReached {
+				reason = models.DoneReasonSlippage
+			}
+		}
+
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, 0, reason)
+		logs = append(logs, doneLog)
+	} else if takerOrder.Size == 0 {
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonFilled)
+		logs = append(logs, doneLog)
+	} else if takerOrder.TimeInForce == models.TimeInForceIOC || takerOrder.TimeInForce == models.TimeInForceFOK {
+		// the remaining size of an IOC order is cancelled immediately
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonImmediateOrCancel)
+		logs = append(logs, doneLog)
+	} else {
+		// If taker has an uncompleted size, put taker in orderBook
+		takerDepth := o.depths[takerOrder.Side]
+		err := takerDepth.add(*takerOrder)
+		if err != nil {
+			doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerOrder, takerOrder.Size, models.DoneReasonInvalidSize)
+			return append(logs, doneLog)
+		}
+
+		openLog := newOpenLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, takerDepth.orders[takerOrder.OrderId])
+		logs = append(logs, openLog)
+	}
+	return logs
+}
+
+// the worst price in ticks a market order may trade at, relative to the best opposite price when the
+// order has slippage protection, otherwise unbounded. Maker prices are whole ticks, so the limit is rounded
+// towards the best price without changing which makers it crosses.
+func (o *orderBook) marketLimitPrice(order *BookOrder, best *BookOrder) int64 {
+	if best == nil || order.MaxSlippage.IsZero() {
+		if order.Side == models.SideBuy {
+			return marketBuyPrice
+		}
+		return 0
+	}
+
+	bestPrice := decimal.New(best.Price, 0)
+	if order.Side == models.SideBuy {
+		limit := bestPrice.Mul(decimal.New(1, 0).Add(order.MaxSlippage)).Floor()
+		if limit.GreaterThan(maxUnits) {
+			return marketBuyPrice
+		}
+		return limit.IntPart()
+	}
+	return bestPrice.Mul(decimal.New(1, 0).Sub(order.MaxSlippage)).Ceil().IntPart()
+}
+
+// remove the expired GTT orders on the top of the depth, so that the best order is always alive
+func (o *orderBook) pruneExpired(d *depth, now int64) (logs []Log) {
+	for {
+		order := d.best()
+		if order == nil || !order.expired(now) {
+			return logs
+		}
+
+		_, err := d.remove(order.OrderId)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, order, order.Size+order.HiddenSize, models.DoneReasonExpired)
+		logs = append(logs, doneLog)
+	}
+}
+
+// remove an order from the book or the stop book, the order is done with the reason, cancelled by default
+func (o *orderBook) cancelOrder(orderId int64, side models.Side, reason models.DoneReason) (logs []Log) {
+	if len(reason) == 0 {
+		reason = models.DoneReasonCancelled
+	}
+
+	if stopOrder := o.stops.remove(orderId); stopOrder != nil {
+		doneLog := newOrderDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, stopOrder, reason)
+		return append(logs, doneLog)
+	}
+
+	depth, found := o.depths[side]
+	if !found {
+		return logs
+	}
+	bookOrder, found := depth.orders[orderId]
+	if !found {
+		return logs
+	}
+
+	_, err := depth.remove(orderId)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	doneLog := newDoneLog(o.nextLogSeq(), o.product.Id, o.logTime, o.units, bookOrder, bookOrder.Size+bookOrder.HiddenSize, reason)
+	return append(logs, doneLog)
+}
+
+// cancel all orders of a maker, the stop orders first, then the orders on the book in price-time priority
+func (o *orderBook) cancelMakerOrders(makerAddress string, reason models.DoneReason) (logs []Log) {
+	for _, stopOrder := range o.stops.snapshot() {
+		if strings.EqualFold(stopOrder.MakerAddress, makerAddress) {
+			logs = append(logs, o.cancelOrder(stopOrder.Id, stopOrder.Side, reason)...)
+		}
+	}
+
+	for _, side := range []models.Side{models.SideSell, models.SideBuy} {
+		var orders []*BookOrder
+		o.depths[side].each(func(order *BookOrder) {
+			if strings.EqualFold(order.MakerAddress, makerAddress) {
+				orders = append(orders, order)
+			}
+		})
+		for _, order := range orders {
+			logs = append(logs, o.cancelOrder(order.OrderId, side, reason)...)
+		}
+	}
+	return logs
+}
+
+// remove all expired GTT orders from the book, not only those on the top of the depths, and the expired
+// GTT orders of the stop book
+func (o *orderBook) expireOrders() (logs []Log) {
+	now := o.logTime.Unix()
+	for _, stopOrder := range o.stops.snapshot() {
+		if stopOrderExpired(&stopOrder, now) {
+			logs = append(logs, o.cancelOrder(stopOrder.Id, stopOrder.Side, models.DoneReasonExpired)...)
+		}
+	}
+
+	for _, side := range []models.Side{models.SideSell, models.SideBuy} {
+		var orders []*BookOrder
+		o.depths[side].each(func(order *BookOrder) {
+			if order.expired(now) {
+				orders = append(orders, order)
+			}
+		})
+		for _, order := range orders {
+			logs = append(logs, o.cancelOrder(order.OrderId, side, models.DoneReasonExpired)...)
+		}
+	}
+	return logs
+}
+
+func (o *orderBook) Snapshot() orderBookSnapshot {
+	snapshot := orderBookSnapshot{
+		ProductId:   o.product.Id,
+		Orders:      make([]bookOrderSnapshot, 0, len(o.depths[models.SideSell].orders)+len(o.depths[models.SideBuy].orders)),
+		StopOrders:  o.stops.snapshot(),
+		LastPrice:   o.lastTradePrice(),
+		LogSeq:      o.logSeq,
+		TradeSeq:    o.tradeSeq,
+		OrderWindow: o.orderWindow.clone(),
+		Halted:      o.halted,
+	}
+
+	// orders in price-time priority, the snapshot of a book is always the same
+	for _, side := range []models.Side{models.SideSell, models.SideBuy} {
+		o.depths[side].each(func(order *BookOrder) {
+			snapshot.Orders = append(snapshot.Orders, o.units.snapshotOrder(order))
+		})
+	}
+
+	return snapshot
+}
+
+// the visible size of the best n price levels of each side, all levels if n <= 0
+func (o *orderBook) Level2(n int) (asks, bids []L2Level) {
+	return o.depths[models.SideSell].level2(n, o.units), o.depths[models.SideBuy].level2(n, o.units)
+}
+
+func (o *orderBook) Restore(snapshot *orderBookSnapshot) {
+	o.logSeq = snapshot.LogSeq
+	o.tradeSeq = snapshot.TradeSeq
+	lastPrice, err := o.units.price.toUnits(snapshot.LastPrice, roundExact)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	o.lastPrice = lastPrice
+	o.halted = snapshot.Halted
+	o.orderWindow = snapshot.OrderWindow.clone()
+	if o.orderWindow.Cap == 0 {
+		o.orderWindow = newWindow(orderWindowCap)
+	}
+	o.orderWindow.rebuild()
+
+	for i := range snapshot.Orders {
+		order, err := o.units.restoreOrder(&snapshot.Orders[i])
+		if err != nil {
+			logger.Fatal(err)
+		}
+		err = o.depths[order.Side].put(*order)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+	for i := range snapshot.StopOrders {
+		stopOrder := snapshot.StopOrders[i]
+		o.stops.add(&stopOrder)
+	}
+}
+
+// orders are identified by their 0x order hash, or by maker and salt when the hash is absent
+func orderDedupeKey(order *models.Order) string {
+	if len(order.Hash) > 0 {
+		return strings.ToLower(order.Hash)
+	}
+	return strings.ToLower(order.MakerAddress) + ":" + order.Salt.String()
+}
+
+func (o *orderBook) nextLogSeq() int64 {
+	o.logSeq++
+	return o.logSeq
+}
+
+func (o *orderBook) nextTradeSeq() int64 {
+	o.tradeSeq++
+	return o.tradeSeq
+}
+
+// BookOrder is an order on the book, its amounts are integers in the units of the book
+type BookOrder struct {
+	OrderId int64
+	// in lots
+	Size int64
+	// in units of lot * tick, only for a market buy order
+	Funds int64
+	// in ticks
+	Price           int64
+	Side            models.Side
+	Type            models.OrderType
+	MaxSlippage     decimal.Decimal
+	TimeInForce     models.TimeInForce
+	PostOnly        bool
+	PostOnlyReprice bool
+	// unix seconds after which a GTT order is removed from the book
+	ExpiresAt int64
+	// the size shown on the book of an iceberg order, zero for a normal order
+	DisplaySize int64
+	// the size of an iceberg order not shown on the book yet
+	HiddenSize int64
+	// time priority on the book
+	Seq int64
+	// the 0x order hash
+	OrderHash string
+	// used to cancel all orders of a maker
+	MakerAddress string
+
+	// position in the FIFO queue of its price level while on the book
+	level      *priceLevel
+	prev, next *BookOrder
+}
+
+// whether the order would trade against a maker at the given price
+func (b *BookOrder) crosses(price int64) bool {
+	if b.Side == models.SideBuy {
+		return b.Price >= price
+	}
+	return b.Price <= price
+}
+
+// a market buy order is sized by its funds rather than its size
+func (b *BookOrder) isMarketBuy() bool {
+	return b.Type == models.OrderTypeMarket && b.Side == models.SideBuy
+}
+
+func (b *BookOrder) expired(now int64) bool {
+	return b.TimeInForce == models.TimeInForceGTT && b.ExpiresAt <= now
+}
+
+// move the price one tick away from the best opposite price, false if there is no valid passive price
+func (b *BookOrder) reprice(bestPrice int64) bool {
+	if b.Side == models.SideBuy {
+		b.Price = bestPrice - 1
+		return b.Price > 0
+	}
+	if bestPrice == math.MaxInt64 {
+		return false
+	}
+	b.Price = bestPrice + 1
+	return true
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
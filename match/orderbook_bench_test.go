@@ -0,0 +1,95 @@
+package match_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/zimengpan/go-boomflow/loadgen"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+// number of generated commands applied to a fresh book, the benchmark starts over when they run out
+const benchCommands = 100000
+
+// signing the orders is slow, the commands are generated once for each benchmark and reused as b.N grows
+var generatedCommands = map[string][]*match.Command{}
+
+func benchConfig(b *testing.B) loadgen.Config {
+	product, err := service.GetProductById("1")
+	if err != nil {
+		b.Fatal(err)
+	}
+	baseAsset, err := service.GetAssetByCurrency(product.BaseCurrency)
+	if err != nil {
+		b.Fatal(err)
+	}
+	quoteAsset, err := service.GetAssetByCurrency(product.QuoteCurrency)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	// the defaults of gbe loadgen
+	return loadgen.Config{
+		Seed:            1,
+		Product:         product,
+		BaseAsset:       baseAsset,
+		QuoteAsset:      quoteAsset,
+		Makers:          10,
+		Mid:             100,
+		Volatility:      0.0005,
+		Spread:          0.01,
+		CrossRatio:      0.2,
+		MarketRatio:     0.05,
+		CancelRatio:     0.3,
+		ChainId:         1337,
+		ExchangeAddress: common.HexToAddress("0x48bacb9266a570d521063ef5dd96e61686dbe788"),
+		FeeRecipient:    "0x0000000000000000000000000000000000000001",
+	}
+}
+
+func benchApplyCommand(b *testing.B, config loadgen.Config) {
+	commands, found := generatedCommands[b.Name()]
+	if !found {
+		commands = loadgen.GenerateCommands(config, benchCommands)
+		generatedCommands[b.Name()] = commands
+	}
+
+	// ns/op is the mean, a sweep of a deep price level or a burst of stop activations only shows in the tail
+	durations := make([]time.Duration, b.N)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	book := match.NewOrderBook(config.Product)
+	for i := 0; i < b.N; i++ {
+		if i > 0 && i%len(commands) == 0 {
+			b.StopTimer()
+			book = match.NewOrderBook(config.Product)
+			b.StartTimer()
+		}
+		start := time.Now()
+		book.ApplyCommand(commands[i%len(commands)])
+		durations[i] = time.Since(start)
+	}
+	b.StopTimer()
+
+	percentiles := loadgen.NewPercentiles(durations)
+	b.ReportMetric(float64(percentiles.P50.Nanoseconds()), "p50-ns/op")
+	b.ReportMetric(float64(percentiles.P99.Nanoseconds()), "p99-ns/op")
+}
+
+// the default mix of gbe loadgen: limit orders around a moving mid, some crossing, market orders and cancels
+func BenchmarkOrderBookApplyCommand(b *testing.B) {
+	benchApplyCommand(b, benchConfig(b))
+}
+
+// few crossing orders and cancels, the book grows deep and most orders rest on it
+func BenchmarkOrderBookDeepBook(b *testing.B) {
+	config := benchConfig(b)
+	config.Spread = 0.05
+	config.CrossRatio = 0.02
+	config.MarketRatio = 0.01
+	config.CancelRatio = 0.05
+	benchApplyCommand(b, config)
+}
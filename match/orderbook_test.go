@@ -0,0 +1,585 @@
+package match
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// prices in ticks of 0.01 and sizes in lots of 0.001
+var testBookProduct = &models.Product{
+	Id:             "1",
+	PriceIncrement: decimal.New(1, -2),
+	SizeIncrement:  decimal.New(1, -3),
+}
+
+func newTestLimitOrder(orderId int64, side models.Side, price, size string) *models.Order {
+	return &models.Order{
+		Id:           orderId,
+		Hash:         fmt.Sprintf("0x%x", orderId),
+		MakerAddress: "0x1d297954f3a6c293ddde068bd462c1d5761de089",
+		Side:         side,
+		Type:         models.OrderTypeLimit,
+		TimeInForce:  models.TimeInForceGTC,
+		Price:        decimal.RequireFromString(price),
+		Size:         decimal.RequireFromString(size),
+	}
+}
+
+func placeTestOrder(book *orderBook, order *models.Order) []Log {
+	command := NewPlaceCommand(order)
+	command.SubmittedAt = testTime
+	return book.ApplyCommand(command)
+}
+
+func assertBookOrders(t *testing.T, book *orderBook, side models.Side, expected ...int64) {
+	t.Helper()
+
+	var orderIds []int64
+	book.depths[side].each(func(order *BookOrder) { orderIds = append(orderIds, order.OrderId) })
+	if fmt.Sprint(orderIds) != fmt.Sprint(expected) {
+		t.Fatalf("%v orders on the book are %v, expected %v", side, orderIds, expected)
+	}
+}
+
+func newTestMarketOrder(orderId int64, side models.Side, size, funds, maxSlippage string) *models.Order {
+	order := newTestLimitOrder(orderId, side, "0", size)
+	order.Type = models.OrderTypeMarket
+	order.TimeInForce = models.TimeInForceIOC
+	order.Funds = decimal.RequireFromString(funds)
+	order.MaxSlippage = decimal.RequireFromString(maxSlippage)
+	return order
+}
+
+// a stop order becomes the market order, a stop-limit order the limit order, when the price reaches stopPrice
+func withStopPrice(order *models.Order, stopPrice string) *models.Order {
+	order.StopPrice = decimal.RequireFromString(stopPrice)
+	if order.Type == models.OrderTypeMarket {
+		order.Type = models.OrderTypeStop
+	} else {
+		order.Type = models.OrderTypeStopLimit
+	}
+	return order
+}
+
+func iceberg(order *models.Order, displaySize string) *models.Order {
+	order.DisplaySize = decimal.RequireFromString(displaySize)
+	return order
+}
+
+func withMaker(order *models.Order, makerAddress string) *models.Order {
+	order.MakerAddress = makerAddress
+	return order
+}
+
+func withHash(order *models.Order, hash string) *models.Order {
+	order.Hash = hash
+	return order
+}
+
+func gtt(order *models.Order, expiresIn int64) *models.Order {
+	order.TimeInForce = models.TimeInForceGTT
+	order.ExpirationTimeSeconds = decimal.New(testTime.Unix()+expiresIn, 0)
+	return order
+}
+
+func withTimeInForce(order *models.Order, timeInForce models.TimeInForce) *models.Order {
+	order.TimeInForce = timeInForce
+	return order
+}
+
+func postOnly(order *models.Order, reprice bool) *models.Order {
+	order.PostOnly = true
+	order.PostOnlyReprice = reprice
+	return order
+}
+
+// the command submitted the given seconds after testTime
+func at(command *Command, seconds int64) *Command {
+	command.SubmittedAt = testTime.Add(time.Duration(seconds) * time.Second)
+	return command
+}
+
+func place(order *models.Order) *Command {
+	return at(NewPlaceCommand(order), 0)
+}
+
+// a log in a short form that tables of expected logs can spell out
+func describeLog(log Log) string {
+	switch l := log.(type) {
+	case *MatchLog:
+		return fmt.Sprintf("match %v<-%v %v@%v", l.TakerOrderId, l.MakerOrderId, l.Size, l.Price)
+	case *OpenLog:
+		return fmt.Sprintf("open %v %v@%v", l.OrderId, l.RemainingSize, l.Price)
+	case *DoneLog:
+		return fmt.Sprintf("done %v %v %v", l.OrderId, l.RemainingSize, l.Reason)
+	case *ActivatedLog:
+		return fmt.Sprintf("activated %v", l.OrderId)
+	}
+	return fmt.Sprintf("unknown %T", log)
+}
+
+// bookTest places the orders of book on a fresh book at testTime, then applies the commands and compares
+// the logs they produce
+type bookTest struct {
+	name     string
+	book     []*models.Order
+	commands []*Command
+	logs     []string
+}
+
+func runBookTests(t *testing.T, tests []bookTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			book := NewOrderBook(testBookProduct)
+			for _, order := range test.book {
+				placeTestOrder(book, order)
+			}
+
+			var logs []string
+			seq := book.logSeq
+			for _, command := range test.commands {
+				for _, log := range book.ApplyCommand(command) {
+					seq++
+					if log.GetSeq() != seq {
+						t.Fatalf("log %v has seq %v, expected %v", describeLog(log), log.GetSeq(), seq)
+					}
+					logs = append(logs, describeLog(log))
+				}
+			}
+			if strings.Join(logs, "\n") != strings.Join(test.logs, "\n") {
+				t.Fatalf("logs:\n%v\nexpected:\n%v", strings.Join(logs, "\n"), strings.Join(test.logs, "\n"))
+			}
+		})
+	}
+}
+
+func TestOrderBookTimeInForce(t *testing.T) {
+	runBookTests(t, []bookTest{
+		{
+			name:     "limit order rests",
+			commands: []*Command{place(newTestLimitOrder(1, models.SideSell, "10", "1"))},
+			logs:     []string{"open 1 1@10"},
+		},
+		{
+			name: "limit order sweeps the levels in price-time priority",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideSell, "11", "1"),
+				newTestLimitOrder(3, models.SideSell, "10", "1"),
+			},
+			commands: []*Command{place(newTestLimitOrder(4, models.SideBuy, "11", "2.5"))},
+			logs: []string{
+				"match 4<-1 1@10", "done 1 0 filled",
+				"match 4<-3 1@10", "done 3 0 filled",
+				"match 4<-2 0.5@11", "done 4 0 filled",
+			},
+		},
+		{
+			name:     "remaining size of a limit order rests at its price",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{place(newTestLimitOrder(2, models.SideBuy, "10.5", "3"))},
+			logs:     []string{"match 2<-1 1@10", "done 1 0 filled", "open 2 2@10.5"},
+		},
+		{
+			name: "IOC cancels the remaining size",
+			book: []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{
+				place(withTimeInForce(newTestLimitOrder(2, models.SideBuy, "10", "3"), models.TimeInForceIOC)),
+			},
+			logs: []string{"match 2<-1 1@10", "done 1 0 filled", "done 2 2 ioc"},
+		},
+		{
+			name: "IOC on an empty book",
+			commands: []*Command{
+				place(withTimeInForce(newTestLimitOrder(1, models.SideBuy, "10", "1"), models.TimeInForceIOC)),
+			},
+			logs: []string{"done 1 1 ioc"},
+		},
+		{
+			name: "FOK is rejected unless it fills completely, the book is untouched",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideSell, "11", "1"),
+			},
+			commands: []*Command{
+				place(withTimeInForce(newTestLimitOrder(3, models.SideBuy, "10", "2"), models.TimeInForceFOK)),
+				place(newTestLimitOrder(4, models.SideBuy, "11", "2")),
+			},
+			logs: []string{
+				"done 3 2 fok",
+				"match 4<-1 1@10", "done 1 0 filled", "match 4<-2 1@11", "done 2 0 filled", "done 4 0 filled",
+			},
+		},
+		{
+			name: "FOK fills completely",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideSell, "11", "1"),
+			},
+			commands: []*Command{
+				place(withTimeInForce(newTestLimitOrder(3, models.SideBuy, "11", "2"), models.TimeInForceFOK)),
+			},
+			logs: []string{"match 3<-1 1@10", "done 1 0 filled", "match 3<-2 1@11", "done 2 0 filled", "done 3 0 filled"},
+		},
+		{
+			name:     "GTT expired on arrival",
+			commands: []*Command{place(gtt(newTestLimitOrder(1, models.SideBuy, "10", "1"), 0))},
+			logs:     []string{"done 1 1 expired"},
+		},
+		{
+			name:     "GTT maker trades before it expires",
+			book:     []*models.Order{gtt(newTestLimitOrder(1, models.SideSell, "10", "1"), 10)},
+			commands: []*Command{at(NewPlaceCommand(newTestLimitOrder(2, models.SideBuy, "10", "1")), 9)},
+			logs:     []string{"match 2<-1 1@10", "done 1 0 filled", "done 2 0 filled"},
+		},
+		{
+			name:     "expired GTT maker is removed when the taker reaches it",
+			book:     []*models.Order{gtt(newTestLimitOrder(1, models.SideSell, "10", "1"), 10)},
+			commands: []*Command{at(NewPlaceCommand(newTestLimitOrder(2, models.SideBuy, "10", "1")), 10)},
+			logs:     []string{"done 1 1 expired", "open 2 1@10"},
+		},
+	})
+}
+
+func TestOrderBookPostOnly(t *testing.T) {
+	runBookTests(t, []bookTest{
+		{
+			name:     "crossing post-only order is rejected",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{place(postOnly(newTestLimitOrder(2, models.SideBuy, "10", "1"), false))},
+			logs:     []string{"done 2 1 post_only"},
+		},
+		{
+			name:     "crossing post-only buy is repriced one tick below the best ask",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{place(postOnly(newTestLimitOrder(2, models.SideBuy, "10.5", "1"), true))},
+			logs:     []string{"open 2 1@9.99"},
+		},
+		{
+			name:     "crossing post-only sell is repriced one tick above the best bid",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideBuy, "10", "1")},
+			commands: []*Command{place(postOnly(newTestLimitOrder(2, models.SideSell, "9", "1"), true))},
+			logs:     []string{"open 2 1@10.01"},
+		},
+		{
+			name:     "post-only buy is rejected when there is no price below the best ask",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "0.01", "1")},
+			commands: []*Command{place(postOnly(newTestLimitOrder(2, models.SideBuy, "0.01", "1"), true))},
+			logs:     []string{"done 2 1 post_only"},
+		},
+		{
+			name:     "post-only order that does not cross rests at its price",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{place(postOnly(newTestLimitOrder(2, models.SideBuy, "9.5", "1"), true))},
+			logs:     []string{"open 2 1@9.5"},
+		},
+	})
+}
+
+// market buy orders spend their funds, market sell orders their size, neither rests on the book
+func TestOrderBookMarketOrders(t *testing.T) {
+	asks := func() []*models.Order {
+		return []*models.Order{
+			newTestLimitOrder(1, models.SideSell, "10", "1"),
+			newTestLimitOrder(2, models.SideSell, "11", "1"),
+		}
+	}
+	runBookTests(t, []bookTest{
+		{
+			name:     "buy by funds sweeps the asks until the funds are spent",
+			book:     asks(),
+			commands: []*Command{place(newTestMarketOrder(3, models.SideBuy, "0", "15.5", "0"))},
+			logs:     []string{"match 3<-1 1@10", "done 1 0 filled", "match 3<-2 0.5@11", "done 3 0 filled"},
+		},
+		{
+			name:     "funds that can not pay for a lot are not spent",
+			book:     asks(),
+			commands: []*Command{place(newTestMarketOrder(3, models.SideBuy, "0", "0.005", "0"))},
+			logs:     []string{"done 3 0 filled"},
+		},
+		{
+			name:     "buy stops at its slippage limit",
+			book:     asks(),
+			commands: []*Command{place(newTestMarketOrder(3, models.SideBuy, "0", "100", "0.05"))},
+			logs:     []string{"match 3<-1 1@10", "done 1 0 filled", "done 3 0 slippage"},
+		},
+		{
+			name:     "buy within its slippage limit empties the book, the funds left are cancelled",
+			book:     asks(),
+			commands: []*Command{place(newTestMarketOrder(3, models.SideBuy, "0", "100", "0.1"))},
+			logs: []string{
+				"match 3<-1 1@10", "done 1 0 filled", "match 3<-2 1@11", "done 2 0 filled", "done 3 0 cancelled",
+			},
+		},
+		{
+			name: "sell by size stops at its slippage limit",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideBuy, "10", "1"),
+				newTestLimitOrder(2, models.SideBuy, "9", "1"),
+			},
+			commands: []*Command{place(newTestMarketOrder(3, models.SideSell, "2", "0", "0.05"))},
+			logs:     []string{"match 3<-1 1@10", "done 1 0 filled", "done 3 0 slippage"},
+		},
+		{
+			name:     "sell fills against part of a bid",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideBuy, "10", "2")},
+			commands: []*Command{place(newTestMarketOrder(2, models.SideSell, "1.5", "0", "0"))},
+			logs:     []string{"match 2<-1 1.5@10", "done 2 0 filled"},
+		},
+		{
+			name:     "sell on an empty book is cancelled",
+			commands: []*Command{place(newTestMarketOrder(1, models.SideSell, "1", "0", "0"))},
+			logs:     []string{"done 1 0 cancelled"},
+		},
+		{
+			name: "expired makers are removed before the slippage limit is set",
+			book: []*models.Order{
+				gtt(newTestLimitOrder(1, models.SideSell, "10", "1"), 10),
+				newTestLimitOrder(2, models.SideSell, "11", "1"),
+			},
+			commands: []*Command{at(NewPlaceCommand(newTestMarketOrder(3, models.SideBuy, "0", "100", "0.05")), 10)},
+			logs:     []string{"done 1 1 expired", "match 3<-2 1@11", "done 2 0 filled", "done 3 0 cancelled"},
+		},
+	})
+}
+
+func TestOrderBookStopOrders(t *testing.T) {
+	runBookTests(t, []bookTest{
+		{
+			name: "triggered stops activate one by one in trigger order",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideSell, "11", "1"),
+				newTestLimitOrder(5, models.SideSell, "12", "1"),
+				withStopPrice(newTestLimitOrder(3, models.SideBuy, "12", "1"), "11"),
+				withStopPrice(newTestLimitOrder(4, models.SideBuy, "11", "1"), "10"),
+			},
+			commands: []*Command{place(newTestLimitOrder(6, models.SideBuy, "10", "1"))},
+			logs: []string{
+				"match 6<-1 1@10", "done 1 0 filled", "done 6 0 filled",
+				"activated 4", "match 4<-2 1@11", "done 2 0 filled", "done 4 0 filled",
+				"activated 3", "match 3<-5 1@12", "done 5 0 filled", "done 3 0 filled",
+			},
+		},
+		{
+			name: "the earlier of two triggered stops goes first, its trade may untrigger the other",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideBuy, "9", "1"),
+				withStopPrice(newTestMarketOrder(3, models.SideSell, "1", "0", "0"), "10"),
+				withStopPrice(newTestLimitOrder(4, models.SideBuy, "12", "1"), "10"),
+			},
+			commands: []*Command{place(newTestLimitOrder(6, models.SideBuy, "10", "1"))},
+			logs: []string{
+				"match 6<-1 1@10", "done 1 0 filled", "done 6 0 filled",
+				"activated 3", "match 3<-2 1@9", "done 2 0 filled", "done 3 0 filled",
+			},
+		},
+		{
+			name: "stop order activates on arrival when the last price has reached it",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				newTestLimitOrder(2, models.SideBuy, "10", "1"),
+				newTestLimitOrder(3, models.SideSell, "11", "1"),
+			},
+			commands: []*Command{place(withStopPrice(newTestLimitOrder(4, models.SideBuy, "11", "1"), "10"))},
+			logs:     []string{"activated 4", "match 4<-3 1@11", "done 3 0 filled", "done 4 0 filled"},
+		},
+		{
+			name: "stop order is cancelled in the stop book",
+			book: []*models.Order{withStopPrice(newTestLimitOrder(1, models.SideBuy, "11", "1"), "10")},
+			commands: []*Command{
+				at(NewCancelCommand(newTestLimitOrder(1, models.SideBuy, "11", "1"), "", ""), 0),
+			},
+			logs: []string{"done 1 1 cancelled"},
+		},
+		{
+			name: "GTT stop order that expired before it was triggered is not activated",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				gtt(withStopPrice(newTestLimitOrder(2, models.SideBuy, "11", "1"), "10"), 10),
+			},
+			commands: []*Command{at(NewPlaceCommand(newTestLimitOrder(3, models.SideBuy, "10", "1")), 20)},
+			logs:     []string{"match 3<-1 1@10", "done 1 0 filled", "done 3 0 filled", "done 2 1 expired"},
+		},
+	})
+}
+
+func TestOrderBookIcebergOrders(t *testing.T) {
+	runBookTests(t, []bookTest{
+		{
+			name:     "iceberg order shows its display size",
+			commands: []*Command{place(iceberg(newTestLimitOrder(1, models.SideSell, "10", "3"), "1"))},
+			logs:     []string{"open 1 1@10"},
+		},
+		{
+			name: "replenished slice goes behind the orders at its price",
+			book: []*models.Order{
+				iceberg(newTestLimitOrder(1, models.SideSell, "10", "3"), "1"),
+				newTestLimitOrder(2, models.SideSell, "10", "1"),
+			},
+			commands: []*Command{place(newTestLimitOrder(3, models.SideBuy, "10", "2.5"))},
+			logs: []string{
+				"match 3<-1 1@10", "open 1 1@10",
+				"match 3<-2 1@10", "done 2 0 filled",
+				"match 3<-1 0.5@10", "done 3 0 filled",
+			},
+		},
+		{
+			name:     "last slice is the hidden size left",
+			book:     []*models.Order{iceberg(newTestLimitOrder(1, models.SideSell, "10", "2.5"), "1")},
+			commands: []*Command{place(newTestLimitOrder(2, models.SideBuy, "10", "3"))},
+			logs: []string{
+				"match 2<-1 1@10", "open 1 1@10",
+				"match 2<-1 1@10", "open 1 0.5@10",
+				"match 2<-1 0.5@10", "done 1 0 filled",
+				"open 2 0.5@10",
+			},
+		},
+		{
+			name: "cancelled iceberg order reports its hidden size",
+			book: []*models.Order{iceberg(newTestLimitOrder(1, models.SideSell, "10", "3"), "1")},
+			commands: []*Command{
+				at(NewCancelCommand(newTestLimitOrder(1, models.SideSell, "10", "3"), "", ""), 0),
+			},
+			logs: []string{"done 1 3 cancelled"},
+		},
+	})
+}
+
+// the book works in lots of 0.001 and ticks of 0.01, the logs carry the exact decimal amounts
+func TestOrderBookFixedPointLogs(t *testing.T) {
+	runBookTests(t, []bookTest{
+		{
+			name:     "amounts of one lot and odd ticks",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10.01", "0.001")},
+			commands: []*Command{place(newTestLimitOrder(2, models.SideBuy, "10.01", "0.003"))},
+			logs:     []string{"match 2<-1 0.001@10.01", "done 1 0 filled", "open 2 0.002@10.01"},
+		},
+		{
+			name: "prices between ticks move away from the other side",
+			commands: []*Command{
+				place(newTestLimitOrder(1, models.SideBuy, "10.005", "1")),
+				place(newTestLimitOrder(2, models.SideSell, "10.005", "1")),
+			},
+			logs: []string{"open 1 1@10", "open 2 1@10.01"},
+		},
+		{
+			name:     "size that is not a multiple of the lot is rejected",
+			commands: []*Command{place(newTestLimitOrder(1, models.SideSell, "10", "0.0015"))},
+			logs:     []string{"done 1 0.0015 invalid_size"},
+		},
+		{
+			name:     "price that overflows the ticks is rejected",
+			commands: []*Command{place(newTestLimitOrder(1, models.SideSell, "100000000000000000", "1"))},
+			logs:     []string{"done 1 1 invalid_price"},
+		},
+		{
+			name:     "buy price below one tick is rejected",
+			commands: []*Command{place(newTestLimitOrder(1, models.SideBuy, "0.001", "1"))},
+			logs:     []string{"done 1 1 invalid_price"},
+		},
+	})
+}
+
+func TestOrderBookCommands(t *testing.T) {
+	const (
+		makerA = "0x1d297954f3a6c293ddde068bd462c1d5761de089"
+		makerB = "0x6ecbe1db9ef729cbe972c83fb886247691fb6beb"
+	)
+	runBookTests(t, []bookTest{
+		{
+			name: "cancel_all cancels the stop orders of the maker, then its orders in price-time priority",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "10", "1"),
+				withMaker(newTestLimitOrder(2, models.SideSell, "11", "1"), makerB),
+				newTestLimitOrder(3, models.SideBuy, "9", "1"),
+				withStopPrice(newTestLimitOrder(4, models.SideSell, "8", "1"), "8"),
+			},
+			commands: []*Command{
+				at(NewCancelAllCommand(strings.ToUpper(makerA), models.DoneReasonUnfunded, ""), 0),
+				place(newTestLimitOrder(5, models.SideBuy, "11", "1")),
+			},
+			logs: []string{
+				"done 4 1 unfunded", "done 1 1 unfunded", "done 3 1 unfunded",
+				"match 5<-2 1@11", "done 2 0 filled", "done 5 0 filled",
+			},
+		},
+		{
+			name: "expire removes the expired GTT orders below the top of the book and in the stop book",
+			book: []*models.Order{
+				newTestLimitOrder(1, models.SideSell, "9", "1"),
+				gtt(newTestLimitOrder(2, models.SideSell, "10", "1"), 10),
+				gtt(newTestLimitOrder(3, models.SideSell, "11", "1"), 100),
+				gtt(withStopPrice(newTestLimitOrder(4, models.SideSell, "8", "1"), "8"), 10),
+			},
+			commands: []*Command{at(NewCommand(CommandTypeExpire, ""), 50)},
+			logs:     []string{"done 4 1 expired", "done 2 1 expired"},
+		},
+		{
+			name: "orders are rejected while halted, cancels still apply",
+			book: []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{
+				at(NewCommand(CommandTypeHalt, ""), 0),
+				place(newTestLimitOrder(2, models.SideBuy, "10", "1")),
+				at(NewCancelCommand(newTestLimitOrder(1, models.SideSell, "10", "1"), "", ""), 0),
+				at(NewCommand(CommandTypeResume, ""), 0),
+				place(newTestLimitOrder(3, models.SideBuy, "10", "1")),
+			},
+			logs: []string{"done 2 1 halted", "done 1 1 cancelled", "open 3 1@10"},
+		},
+		{
+			name: "order with the hash of an order in the window is duplicated, even after it is filled",
+			book: []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{
+				place(withHash(newTestLimitOrder(2, models.SideBuy, "9", "1"), "0x1")),
+				place(newTestLimitOrder(3, models.SideBuy, "10", "1")),
+				place(withHash(newTestLimitOrder(4, models.SideSell, "10", "1"), "0x1")),
+			},
+			logs: []string{"done 2 1 duplicated", "match 3<-1 1@10", "done 1 0 filled", "done 3 0 filled", "done 4 1 duplicated"},
+		},
+		{
+			name:     "order with the id of an order on the book is duplicated",
+			book:     []*models.Order{newTestLimitOrder(1, models.SideSell, "10", "1")},
+			commands: []*Command{place(withHash(newTestLimitOrder(1, models.SideBuy, "9", "1"), "0xabc"))},
+			logs:     []string{"done 1 1 duplicated"},
+		},
+	})
+}
+
+// a snapshot shares no memory with the book: the orders placed after it was taken, or on a book restored
+// from it, do not change the snapshot
+func TestSnapshotIsolatedFromBook(t *testing.T) {
+	book := NewOrderBook(testBookProduct)
+	// a full window overwrites its oldest key in place
+	book.orderWindow = newWindow(2)
+	placeTestOrder(book, newTestLimitOrder(1, models.SideSell, "10", "1"))
+	placeTestOrder(book, newTestLimitOrder(2, models.SideSell, "11", "1"))
+
+	snapshot := book.Snapshot()
+	placeTestOrder(book, newTestLimitOrder(3, models.SideSell, "12", "1"))
+	if fmt.Sprint(snapshot.OrderWindow.Keys) != "[0x1 0x2]" || len(snapshot.Orders) != 2 {
+		t.Fatalf("snapshot changed by the book: window %v, %v orders", snapshot.OrderWindow.Keys, len(snapshot.Orders))
+	}
+
+	// the book forgot order 1, a book restored from the snapshot still remembers it
+	for i := 0; i < 2; i++ {
+		restored := NewOrderBook(testBookProduct)
+		restored.Restore(&snapshot)
+		assertBookOrders(t, restored, models.SideSell, 1, 2)
+
+		logs := placeTestOrder(restored, newTestLimitOrder(1, models.SideSell, "10", "1"))
+		if done, ok := logs[0].(*DoneLog); !ok || done.Reason != models.DoneReasonDuplicated {
+			t.Fatalf("restored book accepted a duplicated order: %+v", logs[0])
+		}
+		placeTestOrder(restored, newTestLimitOrder(4, models.SideSell, "13", "1"))
+		if fmt.Sprint(snapshot.OrderWindow.Keys) != "[0x1 0x2]" {
+			t.Fatalf("snapshot changed by the restored book: window %v", snapshot.OrderWindow.Keys)
+		}
+	}
+}
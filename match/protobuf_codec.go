@@ -0,0 +1,546 @@
+package match
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// protobufCodec encodes the messages of messages.proto. The wire format is written and read field by
+// field with protowire, fields with the default value are omitted and unknown fields are skipped, so
+// that messages stay compatible with code generated from the schema.
+type protobufCodec struct{}
+
+// field numbers of the Log message
+const (
+	logFieldOpen      = 1
+	logFieldMatch     = 2
+	logFieldDone      = 3
+	logFieldActivated = 4
+)
+
+func (protobufCodec) Name() string {
+	return "protobuf"
+}
+
+func (protobufCodec) Encoding() Encoding {
+	return EncodingProtobuf
+}
+
+func (protobufCodec) EncodeCommand(command *Command) ([]byte, error) {
+	var b []byte
+	b = appendInt64(b, 1, int64(command.Version))
+	b = appendString(b, 2, string(command.Type))
+	b = appendString(b, 3, command.RequestId)
+	b = appendTime(b, 4, command.SubmittedAt)
+	if command.Order != nil {
+		b = appendMessage(b, 5, encodeOrder(command.Order))
+	}
+	b = appendInt64(b, 6, command.OrderId)
+	b = appendString(b, 7, string(command.Side))
+	b = appendString(b, 8, command.MakerAddress)
+	b = appendString(b, 9, string(command.Reason))
+	return b, nil
+}
+
+func (protobufCodec) DecodeCommand(data []byte) (*Command, error) {
+	var d protoDecoder
+	command := &Command{}
+	err := eachField(data, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			command.Version = int(d.int64(f))
+		case 2:
+			command.Type = CommandType(d.string(f))
+		case 3:
+			command.RequestId = d.string(f)
+		case 4:
+			command.SubmittedAt = d.time(f)
+		case 5:
+			command.Order = d.order(f)
+		case 6:
+			command.OrderId = d.int64(f)
+		case 7:
+			command.Side = models.Side(d.string(f))
+		case 8:
+			command.MakerAddress = d.string(f)
+		case 9:
+			command.Reason = models.DoneReason(d.string(f))
+		}
+	})
+	if err == nil {
+		err = d.err
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid protobuf command: %v", err))
+	}
+
+	err = checkCommandVersion(command.Version)
+	if err != nil {
+		return nil, err
+	}
+	return command, nil
+}
+
+func encodeOrder(order *models.Order) []byte {
+	var b []byte
+	b = appendInt64(b, 1, order.Id)
+	b = appendTime(b, 2, order.CreatedAt)
+	b = appendTime(b, 3, order.UpdatedAt)
+	b = appendString(b, 4, order.Hash)
+	b = appendString(b, 5, order.MakerAddress)
+	b = appendString(b, 6, order.TakerAddress)
+	b = appendString(b, 7, order.FeeRecipientAddress)
+	b = appendString(b, 8, order.SenderAddress)
+	b = appendDecimal(b, 9, order.MakerAssetAmount)
+	b = appendDecimal(b, 10, order.TakerAssetAmount)
+	b = appendDecimal(b, 11, order.MakerFee)
+	b = appendDecimal(b, 12, order.TakerFee)
+	b = appendDecimal(b, 13, order.ExpirationTimeSeconds)
+	b = appendDecimal(b, 14, order.Salt)
+	b = appendString(b, 15, string(order.Side))
+	b = appendString(b, 16, string(order.Type))
+	b = appendString(b, 17, order.ProductId)
+	b = appendString(b, 18, order.MakerAssetData)
+	b = appendString(b, 19, order.TakerAssetData)
+	b = appendString(b, 20, order.MakerFeeAssetData)
+	b = appendString(b, 21, order.TakerFeeAssetData)
+	b = appendString(b, 22, order.Signature)
+	b = appendString(b, 23, string(order.Status))
+	b = appendBool(b, 24, order.Settled)
+	b = appendString(b, 25, string(order.TimeInForce))
+	b = appendBool(b, 26, order.PostOnly)
+	b = appendBool(b, 27, order.PostOnlyReprice)
+	b = appendDecimal(b, 28, order.MaxSlippage)
+	b = appendDecimal(b, 29, order.StopPrice)
+	b = appendDecimal(b, 30, order.DisplaySize)
+	b = appendDecimal(b, 31, order.Size)
+	b = appendDecimal(b, 32, order.Funds)
+	b = appendDecimal(b, 33, order.Price)
+	b = appendString(b, 34, string(order.CancelReason))
+	b = appendString(b, 35, order.RequestId)
+	return b
+}
+
+func (d *protoDecoder) order(f protoField) *models.Order {
+	order := &models.Order{}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			order.Id = d.int64(f)
+		case 2:
+			order.CreatedAt = d.time(f)
+		case 3:
+			order.UpdatedAt = d.time(f)
+		case 4:
+			order.Hash = d.string(f)
+		case 5:
+			order.MakerAddress = d.string(f)
+		case 6:
+			order.TakerAddress = d.string(f)
+		case 7:
+			order.FeeRecipientAddress = d.string(f)
+		case 8:
+			order.SenderAddress = d.string(f)
+		case 9:
+			order.MakerAssetAmount = d.decimal(f)
+		case 10:
+			order.TakerAssetAmount = d.decimal(f)
+		case 11:
+			order.MakerFee = d.decimal(f)
+		case 12:
+			order.TakerFee = d.decimal(f)
+		case 13:
+			order.ExpirationTimeSeconds = d.decimal(f)
+		case 14:
+			order.Salt = d.decimal(f)
+		case 15:
+			order.Side = models.Side(d.string(f))
+		case 16:
+			order.Type = models.OrderType(d.string(f))
+		case 17:
+			order.ProductId = d.string(f)
+		case 18:
+			order.MakerAssetData = d.string(f)
+		case 19:
+			order.TakerAssetData = d.string(f)
+		case 20:
+			order.MakerFeeAssetData = d.string(f)
+		case 21:
+			order.TakerFeeAssetData = d.string(f)
+		case 22:
+			order.Signature = d.string(f)
+		case 23:
+			order.Status = models.OrderStatus(d.string(f))
+		case 24:
+			order.Settled = d.bool(f)
+		case 25:
+			order.TimeInForce = models.TimeInForce(d.string(f))
+		case 26:
+			order.PostOnly = d.bool(f)
+		case 27:
+			order.PostOnlyReprice = d.bool(f)
+		case 28:
+			order.MaxSlippage = d.decimal(f)
+		case 29:
+			order.StopPrice = d.decimal(f)
+		case 30:
+			order.DisplaySize = d.decimal(f)
+		case 31:
+			order.Size = d.decimal(f)
+		case 32:
+			order.Funds = d.decimal(f)
+		case 33:
+			order.Price = d.decimal(f)
+		case 34:
+			order.CancelReason = models.DoneReason(d.string(f))
+		case 35:
+			order.RequestId = d.string(f)
+		}
+	})
+	return order
+}
+
+func (protobufCodec) EncodeLog(log Log) ([]byte, error) {
+	var b []byte
+	switch log := log.(type) {
+	case *OpenLog:
+		b = appendMessage(b, logFieldOpen, encodeOpenLog(log))
+	case *MatchLog:
+		b = appendMessage(b, logFieldMatch, encodeMatchLog(log))
+	case *DoneLog:
+		b = appendMessage(b, logFieldDone, encodeDoneLog(log))
+	case *ActivatedLog:
+		b = appendMessage(b, logFieldActivated, encodeActivatedLog(log))
+	default:
+		return nil, errors.New(fmt.Sprintf("log %T can not be encoded", log))
+	}
+	return b, nil
+}
+
+func (protobufCodec) DecodeLog(data []byte) (Log, error) {
+	var d protoDecoder
+	var log Log
+	err := eachField(data, func(num protowire.Number, f protoField) {
+		switch num {
+		case logFieldOpen:
+			log = d.openLog(f)
+		case logFieldMatch:
+			log = d.matchLog(f)
+		case logFieldDone:
+			log = d.doneLog(f)
+		case logFieldActivated:
+			log = d.activatedLog(f)
+		}
+	})
+	if err == nil {
+		err = d.err
+	}
+	if err == nil && log == nil {
+		err = errors.New("no log is set")
+	}
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("invalid protobuf log: %v", err))
+	}
+	return log, nil
+}
+
+func encodeLogBase(base *Base) []byte {
+	var b []byte
+	b = appendInt64(b, 1, base.Sequence)
+	b = appendString(b, 2, base.ProductId)
+	b = appendTime(b, 3, base.Time)
+	return b
+}
+
+func (d *protoDecoder) logBase(f protoField, logType LogType) Base {
+	base := Base{Type: logType}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			base.Sequence = d.int64(f)
+		case 2:
+			base.ProductId = d.string(f)
+		case 3:
+			base.Time = d.time(f)
+		}
+	})
+	return base
+}
+
+func encodeOpenLog(log *OpenLog) []byte {
+	var b []byte
+	b = appendMessage(b, 1, encodeLogBase(&log.Base))
+	b = appendInt64(b, 2, log.OrderId)
+	b = appendDecimal(b, 3, log.RemainingSize)
+	b = appendDecimal(b, 4, log.Price)
+	b = appendString(b, 5, string(log.Side))
+	return b
+}
+
+func (d *protoDecoder) openLog(f protoField) *OpenLog {
+	log := &OpenLog{Base: Base{Type: LogTypeOpen}}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			log.Base = d.logBase(f, LogTypeOpen)
+		case 2:
+			log.OrderId = d.int64(f)
+		case 3:
+			log.RemainingSize = d.decimal(f)
+		case 4:
+			log.Price = d.decimal(f)
+		case 5:
+			log.Side = models.Side(d.string(f))
+		}
+	})
+	return log
+}
+
+func encodeMatchLog(log *MatchLog) []byte {
+	var b []byte
+	b = appendMessage(b, 1, encodeLogBase(&log.Base))
+	b = appendInt64(b, 2, log.TradeId)
+	b = appendInt64(b, 3, log.TakerOrderId)
+	b = appendInt64(b, 4, log.MakerOrderId)
+	b = appendString(b, 5, string(log.Side))
+	b = appendDecimal(b, 6, log.Price)
+	b = appendDecimal(b, 7, log.Size)
+	return b
+}
+
+func (d *protoDecoder) matchLog(f protoField) *MatchLog {
+	log := &MatchLog{Base: Base{Type: LogTypeMatch}}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			log.Base = d.logBase(f, LogTypeMatch)
+		case 2:
+			log.TradeId = d.int64(f)
+		case 3:
+			log.TakerOrderId = d.int64(f)
+		case 4:
+			log.MakerOrderId = d.int64(f)
+		case 5:
+			log.Side = models.Side(d.string(f))
+		case 6:
+			log.Price = d.decimal(f)
+		case 7:
+			log.Size = d.decimal(f)
+		}
+	})
+	return log
+}
+
+func encodeDoneLog(log *DoneLog) []byte {
+	var b []byte
+	b = appendMessage(b, 1, encodeLogBase(&log.Base))
+	b = appendInt64(b, 2, log.OrderId)
+	b = appendString(b, 3, log.OrderHash)
+	b = appendDecimal(b, 4, log.Price)
+	b = appendDecimal(b, 5, log.RemainingSize)
+	b = appendString(b, 6, string(log.Reason))
+	b = appendString(b, 7, string(log.Side))
+	return b
+}
+
+func (d *protoDecoder) doneLog(f protoField) *DoneLog {
+	log := &DoneLog{Base: Base{Type: LogTypeDone}}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			log.Base = d.logBase(f, LogTypeDone)
+		case 2:
+			log.OrderId = d.int64(f)
+		case 3:
+			log.OrderHash = d.string(f)
+		case 4:
+			log.Price = d.decimal(f)
+		case 5:
+			log.RemainingSize = d.decimal(f)
+		case 6:
+			log.Reason = models.DoneReason(d.string(f))
+		case 7:
+			log.Side = models.Side(d.string(f))
+		}
+	})
+	return log
+}
+
+func encodeActivatedLog(log *ActivatedLog) []byte {
+	var b []byte
+	b = appendMessage(b, 1, encodeLogBase(&log.Base))
+	b = appendInt64(b, 2, log.OrderId)
+	b = appendDecimal(b, 3, log.StopPrice)
+	b = appendDecimal(b, 4, log.LastPrice)
+	b = appendString(b, 5, string(log.Side))
+	return b
+}
+
+func (d *protoDecoder) activatedLog(f protoField) *ActivatedLog {
+	log := &ActivatedLog{Base: Base{Type: LogTypeActivated}}
+	d.message(f, func(num protowire.Number, f protoField) {
+		switch num {
+		case 1:
+			log.Base = d.logBase(f, LogTypeActivated)
+		case 2:
+			log.OrderId = d.int64(f)
+		case 3:
+			log.StopPrice = d.decimal(f)
+		case 4:
+			log.LastPrice = d.decimal(f)
+		case 5:
+			log.Side = models.Side(d.string(f))
+		}
+	})
+	return log
+}
+
+func appendInt64(b []byte, num protowire.Number, v int64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if len(v) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendDecimal(b []byte, num protowire.Number, v decimal.Decimal) []byte {
+	if v.IsZero() {
+		return b
+	}
+	return appendString(b, num, v.String())
+}
+
+func appendTime(b []byte, num protowire.Number, v time.Time) []byte {
+	if v.IsZero() {
+		return b
+	}
+	return appendInt64(b, num, v.UnixNano())
+}
+
+// a sub message is always written, even when it is empty
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// protoField is the value of a field on the wire
+type protoField struct {
+	typ    protowire.Type
+	varint uint64
+	bytes  []byte
+}
+
+// call fn for every varint and length delimited field of a message, other fields are skipped
+func eachField(b []byte, fn func(num protowire.Number, f protoField)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		f := protoField{typ: typ}
+		switch typ {
+		case protowire.VarintType:
+			f.varint, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			f.bytes, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			fn(num, f)
+		}
+	}
+	return nil
+}
+
+// protoDecoder converts the fields of a message, it keeps the first error so that the fields can be
+// assigned without checking each of them
+type protoDecoder struct {
+	err error
+}
+
+func (d *protoDecoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+func (d *protoDecoder) int64(f protoField) int64 {
+	if f.typ != protowire.VarintType {
+		d.fail(errors.New(fmt.Sprintf("expected a varint, got wire type %v", f.typ)))
+		return 0
+	}
+	return int64(f.varint)
+}
+
+func (d *protoDecoder) bool(f protoField) bool {
+	return d.int64(f) != 0
+}
+
+func (d *protoDecoder) string(f protoField) string {
+	if f.typ != protowire.BytesType {
+		d.fail(errors.New(fmt.Sprintf("expected a string, got wire type %v", f.typ)))
+		return ""
+	}
+	return string(f.bytes)
+}
+
+func (d *protoDecoder) decimal(f protoField) decimal.Decimal {
+	s := d.string(f)
+	if len(s) == 0 {
+		return decimal.Zero
+	}
+	v, err := decimal.NewFromString(s)
+	if err != nil {
+		d.fail(err)
+	}
+	return v
+}
+
+// times are decoded in UTC, so that the same message always gives the same logs
+func (d *protoDecoder) time(f protoField) time.Time {
+	nanos := d.int64(f)
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos).UTC()
+}
+
+func (d *protoDecoder) message(f protoField, fn func(num protowire.Number, f protoField)) {
+	if f.typ != protowire.BytesType {
+		d.fail(errors.New(fmt.Sprintf("expected a message, got wire type %v", f.typ)))
+		return
+	}
+	err := eachField(f.bytes, fn)
+	if err != nil {
+		d.fail(err)
+	}
+}
@@ -0,0 +1,75 @@
+package match
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// 使用全新的orderBook重新执行order topic中的command，用于重现engine的执行结果
+// 从snapshot之后的order开始执行，snapshot为nil时从offset 0开始；执行完offset为stopOffset的order后停止，
+// stopOffset小于0时执行到reader返回io.EOF为止。每条log按照写入kafka的格式输出为一行JSON，返回最终的快照
+// log的时间来自command的提交时间，相同的输入总是产生完全相同的输出。
+// 和engine一样，无法解码的order记录日志后跳过，返回跳过的offset
+func Replay(product *models.Product, reader OrderReader, snapshot *Snapshot, stopOffset int64,
+	logWriter io.Writer) (*Snapshot, []int64, error) {
+	orderBook := NewOrderBook(product)
+
+	// offset of the last applied order
+	offset := int64(-1)
+	if snapshot != nil {
+		if snapshot.OrderBook.ProductId != product.Id {
+			return nil, nil, errors.New(fmt.Sprintf("snapshot of product %v can not be replayed as %v",
+				snapshot.OrderBook.ProductId, product.Id))
+		}
+		orderBook.Restore(&snapshot.OrderBook)
+		offset = snapshot.OrderOffset
+	}
+
+	err := reader.SetOffset(offset + 1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var skippedOffsets []int64
+
+	for stopOffset < 0 || offset < stopOffset {
+		orderOffset, command, err := reader.FetchOrder()
+		if err == io.EOF {
+			break
+		}
+		if decodeErr, ok := err.(*OrderDecodeError); ok {
+			if stopOffset >= 0 && decodeErr.Offset > stopOffset {
+				break
+			}
+			logger.WithField(logging.FieldProductId, product.Id).Warn(decodeErr)
+			skippedOffsets = append(skippedOffsets, decodeErr.Offset)
+			offset = decodeErr.Offset
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if stopOffset >= 0 && orderOffset > stopOffset {
+			break
+		}
+
+		for _, log := range orderBook.ApplyCommand(command) {
+			bytes, err := json.Marshal(log)
+			if err != nil {
+				return nil, nil, err
+			}
+			_, err = logWriter.Write(append(bytes, '\n'))
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		offset = orderOffset
+	}
+
+	return &Snapshot{OrderOffset: offset, OrderBook: orderBook.Snapshot()}, skippedOffsets, nil
+}
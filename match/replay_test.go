@@ -0,0 +1,101 @@
+package match
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 导出的order文件，offset为1的一行无法解码
+func writeReplayTestOrders(t *testing.T, commands []*Command) string {
+	t.Helper()
+
+	var lines []string
+	for i, command := range commands {
+		if i == 1 {
+			lines = append(lines, `{"type": "place", "order": `)
+		}
+		line, err := EncodeCommand(codecs[EncodingJSON], command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, string(line))
+	}
+
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "orders.json")
+	err = ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func describeReplayLogs(t *testing.T, output []byte) []string {
+	t.Helper()
+
+	var logs []string
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		log, err := DecodeLog([]byte(line))
+		if err != nil {
+			t.Fatal(err)
+		}
+		logs = append(logs, describeLog(log))
+	}
+	return logs
+}
+
+// 和engine一样跳过无法解码的order继续执行，并返回跳过的offset
+func TestReplaySkipsUndecodableOrders(t *testing.T) {
+	commands := newEngineTestCommands()
+	path := writeReplayTestOrders(t, commands)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	tests := []struct {
+		name           string
+		stopOffset     int64
+		commands       int
+		expectedOffset int64
+	}{
+		{"to the end", -1, len(commands), int64(len(commands))},
+		{"stop at the undecodable order", 1, 1, 1},
+		{"stop before the undecodable order", 0, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader, err := NewFileOrderReader(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer reader.Close()
+
+			var output bytes.Buffer
+			snapshot, skippedOffsets, err := Replay(testBookProduct, reader, nil, test.stopOffset, &output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if snapshot.OrderOffset != test.expectedOffset {
+				t.Fatalf("replayed to offset %v, expected %v", snapshot.OrderOffset, test.expectedOffset)
+			}
+			var expectedSkipped []int64
+			if test.expectedOffset >= 1 {
+				expectedSkipped = []int64{1}
+			}
+			if !reflect.DeepEqual(skippedOffsets, expectedSkipped) {
+				t.Fatalf("skipped offsets %v, expected %v", skippedOffsets, expectedSkipped)
+			}
+
+			expected := expectedEngineLogs(commands[:test.commands])
+			if logs := describeReplayLogs(t, output.Bytes()); strings.Join(logs, "\n") != strings.Join(expected, "\n") {
+				t.Fatalf("logs:\n%v\nexpected:\n%v", strings.Join(logs, "\n"), strings.Join(expected, "\n"))
+			}
+		})
+	}
+}
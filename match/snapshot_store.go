@@ -0,0 +1,50 @@
+package match
+
+import (
+	"encoding/json"
+
+	"github.com/go-redis/redis"
+)
+
+// orderBook的快照，以及快照包含的最后一个order的offset，engine和gbe replay都从快照之后的order开始执行
+type Snapshot struct {
+	OrderOffset int64
+	OrderBook   orderBookSnapshot
+}
+
+// gbe:snapshot:{productId}，product最新快照的JSON
+const snapshotKeyPrefix = "gbe:snapshot:"
+
+type RedisSnapshotStore struct {
+	productId string
+	client    *redis.Client
+}
+
+func NewRedisSnapshotStore(productId string, client *redis.Client) *RedisSnapshotStore {
+	return &RedisSnapshotStore{productId: productId, client: client}
+}
+
+func (s *RedisSnapshotStore) Store(snapshot *Snapshot) error {
+	bytes, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(snapshotKeyPrefix+s.productId, bytes, 0).Err()
+}
+
+func (s *RedisSnapshotStore) GetLatest() (*Snapshot, error) {
+	bytes, err := s.client.Get(snapshotKeyPrefix + s.productId).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshot Snapshot
+	err = json.Unmarshal(bytes, &snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
@@ -0,0 +1,138 @@
+package match
+
+import (
+	"github.com/emirpasic/gods/maps/treemap"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// stopBook holds the stop and stop-limit orders of a product until the last trade price reaches their
+// stop price. Buy stops trigger when the price rises to the stop price, sell stops when it falls to it.
+type stopBook struct {
+	// all pending stop orders
+	orders map[int64]*models.Order
+
+	// stopPrice, orderId -> orderId, the order that triggers first is on the top of each queue
+	queues map[models.Side]*treemap.Map
+}
+
+// the key of a stop order in the queue of its side
+type priceSeqKey struct {
+	price decimal.Decimal
+	// time priority, the smaller the earlier
+	seq int64
+}
+
+func newStopBook() *stopBook {
+	return &stopBook{
+		orders: map[int64]*models.Order{},
+		queues: map[models.Side]*treemap.Map{
+			models.SideBuy:  treemap.NewWith(priceSeqKeyAscComparator),
+			models.SideSell: treemap.NewWith(priceSeqKeyDescComparator),
+		},
+	}
+}
+
+func (s *stopBook) add(order *models.Order) {
+	s.orders[order.Id] = order
+	s.queues[order.Side].Put(&priceSeqKey{order.StopPrice, order.Id}, order.Id)
+}
+
+func (s *stopBook) remove(orderId int64) *models.Order {
+	order, found := s.orders[orderId]
+	if !found {
+		return nil
+	}
+	delete(s.orders, orderId)
+	s.queues[order.Side].Remove(&priceSeqKey{order.StopPrice, order.Id})
+	return order
+}
+
+// remove and return the next stop order triggered by the last trade price, nil if there is none.
+// When both sides are triggered, the earlier order goes first, so activation is deterministic.
+func (s *stopBook) popTriggered(lastPrice decimal.Decimal) *models.Order {
+	var triggered *models.Order
+	for side, queue := range s.queues {
+		_, orderId := queue.Min()
+		if orderId == nil {
+			continue
+		}
+
+		order := s.orders[orderId.(int64)]
+		if !stopTriggered(side, order.StopPrice, lastPrice) {
+			continue
+		}
+		if triggered == nil || order.Id < triggered.Id {
+			triggered = order
+		}
+	}
+
+	if triggered == nil {
+		return nil
+	}
+	return s.remove(triggered.Id)
+}
+
+// all pending stop orders, sorted by trigger priority on each side
+func (s *stopBook) snapshot() []models.Order {
+	orders := make([]models.Order, 0, len(s.orders))
+	for _, side := range []models.Side{models.SideBuy, models.SideSell} {
+		for itr := s.queues[side].Iterator(); itr.Next(); {
+			orders = append(orders, *s.orders[itr.Value().(int64)])
+		}
+	}
+	return orders
+}
+
+func stopTriggered(side models.Side, stopPrice, lastPrice decimal.Decimal) bool {
+	if lastPrice.IsZero() {
+		return false
+	}
+	if side == models.SideBuy {
+		return lastPrice.GreaterThanOrEqual(stopPrice)
+	}
+	return lastPrice.LessThanOrEqual(stopPrice)
+}
+
+// a stop order keeps the time in force of the order it becomes, so a GTT stop order expires in the stop book
+func stopOrderExpired(order *models.Order, now int64) bool {
+	return order.TimeInForce == models.TimeInForceGTT && order.ExpirationTimeSeconds.IntPart() <= now
+}
+
+func priceSeqKeyAscComparator(a, b interface{}) int {
+	aAsserted := a.(*priceSeqKey)
+	bAsserted := b.(*priceSeqKey)
+
+	x := aAsserted.price.Cmp(bAsserted.price)
+	if x != 0 {
+		return x
+	}
+
+	y := aAsserted.seq - bAsserted.seq
+	if y == 0 {
+		return 0
+	} else if y > 0 {
+		return 1
+	} else {
+		return -1
+	}
+}
+
+func priceSeqKeyDescComparator(a, b interface{}) int {
+	aAsserted := a.(*priceSeqKey)
+	bAsserted := b.(*priceSeqKey)
+
+	x := aAsserted.price.Cmp(bAsserted.price)
+	if x != 0 {
+		return -x
+	}
+
+	y := aAsserted.seq - bAsserted.seq
+	if y == 0 {
+		return 0
+	} else if y > 0 {
+		return 1
+	} else {
+		return -1
+	}
+}
@@ -1,123 +1,66 @@
-package match
-
-import (
-	"errors"
-	"fmt"
-)
-
-var (
-	tA = [8]byte{1, 2, 4, 8, 16, 32, 64, 128}
-	tB = [8]byte{254, 253, 251, 247, 239, 223, 191, 127}
-)
-
-func dataOrCopy(d []byte, c bool) []byte {
-	if !c {
-		return d
-	}
-	data := make([]byte, len(d))
-	copy(data, d)
-	return data
-}
-
-func NewSlice(l int64) []byte {
-	remainder := l % 8
-	if remainder != 0 {
-		remainder = 1
-	}
-	return make([]byte, l/8+remainder)
-}
-
-func Get(m []byte, i int64) bool {
-	return m[i/8]&tA[i%8] != 0
-}
-
-func Set(m []byte, i int64, v bool) {
-	index := i / 8
-	bit := i % 8
-	if v {
-		m[index] = m[index] | tA[bit]
-	} else {
-		m[index] = m[index] & tB[bit]
-	}
-}
-
-func GetBit(b byte, i int64) bool {
-	return b&tA[i] != 0
-}
-
-func SetBit(b byte, i int64, v bool) byte {
-	if v {
-		return b | tA[i]
-	}
-	return b & tB[i]
-}
-
-func SetBitRef(b *byte, i int64, v bool) {
-	if v {
-		*b = *b | tA[i]
-	} else {
-		*b = *b & tB[i]
-	}
-}
-
-func Len(m []byte) int {
-	return len(m) * 8
-}
-
-type Bitmap []byte
-
-func New(l int64) Bitmap {
-	return NewSlice(l)
-}
-
-func (b Bitmap) Len() int {
-	return Len(b)
-}
-
-func (b Bitmap) Get(i int64) bool {
-	return Get(b, i)
-}
-
-func (b Bitmap) Set(i int64, v bool) {
-	Set(b, i, v)
-}
-
-func (b Bitmap) Data(copy bool) []byte {
-	return dataOrCopy(b, copy)
-}
-
-type Window struct {
-	Min    int64
-	Max    int64
-	Cap    int64
-	Bitmap Bitmap
-}
-
-func newWindow(min, max int64) Window {
-	return Window{
-		Min:    min,
-		Max:    max,
-		Cap:    max - min,
-		Bitmap: New(max - min),
-	}
-}
-
-func (w Window) put(val int64) error {
-	if val <= w.Min {
-		return errors.New(fmt.Sprintf("expired val %v, current Window [%v-%v]", val, w.Min, w.Max))
-	} else if val > w.Max {
-		delta := val - w.Max
-		w.Min += delta
-		w.Max += delta
-		w.Bitmap.Set(val%w.Cap, true)
-	} else if w.Bitmap.Get(val % w.Cap) {
-		return errors.New(fmt.Sprintf("existed val %v", val))
-	} else {
-		w.Bitmap.Set(val%w.Cap, true)
-	}
-	return nil
-}
-
-func (w Window) contains(val int64) bool {
-	return false
-}
+package match
+
+// Window remembers the dedupe keys of the latest orders applied to the order book, so that an order
+// submitted repeatedly is rejected. Only the latest Cap keys are kept, which bounds the memory used.
+// The fields are exported so that the window is saved in and restored from the order book snapshot.
+type Window struct {
+	Cap int
+
+	// ring buffer of the keys in the order they were put
+	Keys []string
+
+	// position in Keys where the next key is put
+	Next int
+
+	keys map[string]struct{}
+}
+
+func newWindow(cap int) Window {
+	return Window{
+		Cap:  cap,
+		Keys: make([]string, 0, cap),
+		keys: map[string]struct{}{},
+	}
+}
+
+// put records the key, false if the key is already in the window
+func (w *Window) put(key string) bool {
+	if w.keys == nil {
+		w.rebuild()
+	}
+	if w.contains(key) {
+		return false
+	}
+
+	if len(w.Keys) < w.Cap {
+		w.Keys = append(w.Keys, key)
+	} else {
+		// the window is full, forget the oldest key
+		delete(w.keys, w.Keys[w.Next])
+		w.Keys[w.Next] = key
+	}
+	w.Next = (w.Next + 1) % w.Cap
+	w.keys[key] = struct{}{}
+	return true
+}
+
+func (w *Window) contains(key string) bool {
+	_, found := w.keys[key]
+	return found
+}
+
+// clone returns a window that shares no memory with w, so that a snapshot is not changed by the keys put
+// after it was taken. The index of the clone is built when a key is put into it.
+func (w *Window) clone() Window {
+	keys := make([]string, len(w.Keys), w.Cap)
+	copy(keys, w.Keys)
+	return Window{Cap: w.Cap, Keys: keys, Next: w.Next}
+}
+
+// rebuild the index of the keys, which is not part of the snapshot
+func (w *Window) rebuild() {
+	w.keys = make(map[string]struct{}, len(w.Keys))
+	for _, key := range w.Keys {
+		w.keys[key] = struct{}{}
+	}
+}
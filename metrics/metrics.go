@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	namespace = "gbe"
+)
+
+var (
+	// engine
+
+	OrdersReceived = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "orders_received_total",
+		Help:      "Orders read from the order topic.",
+	}, []string{"product"})
+
+	OrdersApplied = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "orders_applied_total",
+		Help:      "Orders applied to the order book.",
+	}, []string{"product"})
+
+	OrderQueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "order_queue_depth",
+		Help:      "Orders fetched but not applied yet.",
+	}, []string{"product"})
+
+	ApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "apply_duration_seconds",
+		Help:      "Time to apply an order to the order book.",
+		Buckets:   prometheus.ExponentialBuckets(0.00001, 4, 10),
+	}, []string{"product"})
+
+	LogSeq = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "log_seq",
+		Help:      "Sequence of the last log produced by the order book.",
+	}, []string{"product"})
+
+	CommittedLogSeq = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "committed_log_seq",
+		Help:      "Sequence of the last log written to the log store.",
+	}, []string{"product"})
+
+	LeaderToken = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "leader_token",
+		Help:      "Fencing token of the engine when it is the leader of the product, 0 while it is a standby.",
+	}, []string{"product"})
+
+	OrderOffset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "order_offset",
+		Help:      "Offset of the last order applied to the order book.",
+	}, []string{"product"})
+
+	OrderOffsetLag = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "order_offset_lag",
+		Help:      "Orders in the order topic behind the last fetched one.",
+	}, []string{"product"})
+
+	BookOrders = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "book_orders",
+		Help:      "Orders resting on each side of the order book.",
+	}, []string{"product", "side"})
+
+	LastSnapshotTime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "last_snapshot_timestamp_seconds",
+		Help:      "Unix time of the last order book snapshot stored by the leader, its age is time() minus it.",
+	}, []string{"product"})
+
+	SnapshotOrderOffset = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "engine",
+		Name:      "snapshot_order_offset",
+		Help:      "Offset of the last order in the latest snapshot, a restarted engine replays the orders after it.",
+	}, []string{"product"})
+
+	// rest
+
+	HttpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "rest",
+		Name:      "requests_total",
+		Help:      "REST requests by route and status.",
+	}, []string{"route", "method", "status"})
+
+	HttpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "rest",
+		Name:      "request_duration_seconds",
+		Help:      "REST request latency by route and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// kafka
+
+	KafkaErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "kafka",
+		Name:      "errors_total",
+		Help:      "Kafka read and write errors by topic.",
+	}, []string{"topic", "op"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		OrdersReceived,
+		OrdersApplied,
+		OrderQueueDepth,
+		ApplyDuration,
+		LogSeq,
+		CommittedLogSeq,
+		LeaderToken,
+		OrderOffset,
+		OrderOffsetLag,
+		BookOrders,
+		LastSnapshotTime,
+		SnapshotOrderOffset,
+		HttpRequests,
+		HttpRequestDuration,
+		KafkaErrors,
+	)
+}
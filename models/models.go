@@ -1,127 +1,266 @@
-package models
-
-import (
-	"fmt"
-	"time"
-
-	"github.com/shopspring/decimal"
-)
-
-// 用于表示一笔订单或者交易的方向：买，卖
-type Side string
-
-func NewSideFromString(s string) (*Side, error) {
-	side := Side(s)
-	switch side {
-	case SideBuy:
-	case SideSell:
-	default:
-		return nil, fmt.Errorf("invalid side: %v", s)
-	}
-	return &side, nil
-}
-
-func (s Side) Opposite() Side {
-	if s == SideBuy {
-		return SideSell
-	}
-	return SideBuy
-}
-
-func (s Side) String() string {
-	return string(s)
-}
-
-// 用于表示订单状态
-type OrderStatus string
-
-func NewOrderStatusFromString(s string) (*OrderStatus, error) {
-	status := OrderStatus(s)
-	switch status {
-	case OrderStatusNew:
-	case OrderStatusOpen:
-	case OrderStatusCancelling:
-	case OrderStatusCancelled:
-	case OrderStatusFilled:
-	default:
-		return nil, fmt.Errorf("invalid status: %v", s)
-	}
-	return &status, nil
-}
-
-func (t OrderStatus) String() string {
-	return string(t)
-}
-
-// 用于表示一条fill完成的原因
-type DoneReason string
-
-type TransactionStatus string
-
-const (
-	SideBuy  = Side("buy")
-	SideSell = Side("sell")
-
-	// 初始状态
-	OrderStatusNew = OrderStatus("new")
-	// 已经加入orderBook
-	OrderStatusOpen = OrderStatus("open")
-	// 中间状态，请求取消订单
-	OrderStatusCancelling = OrderStatus("cancelling")
-	// 订单已经被取消，部分成交的订单也是cancelled
-	OrderStatusCancelled = OrderStatus("cancelled")
-	// 订单完全成交
-	OrderStatusFilled = OrderStatus("filled")
-
-	DoneReasonFilled    = DoneReason("filled")
-	DoneReasonCancelled = DoneReason("cancelled")
-
-	TransactionStatusPending   = TransactionStatus("pending")
-	TransactionStatusCompleted = TransactionStatus("completed")
-)
-
-type Asset struct {
-	Currency  string `gorm:"column:currency;primary_key"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	AssetData string
-}
-
-type Product struct {
-	Id            string `gorm:"column:id;primary_key"`
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	BaseCurrency  string
-	QuoteCurrency string
-}
-
-type Order struct {
-	Id                    int64 `gorm:"column:id;primary_key;AUTO_INCREMENT"`
-	CreatedAt             time.Time
-	UpdatedAt             time.Time
-	MakerAddress          string
-	TakerAddress          string
-	FeeRecipientAddress   string
-	SenderAddress         string
-	MakerAssetAmount      decimal.Decimal `sql:"type:decimal(32,16);"`
-	TakerAssetAmount      decimal.Decimal `sql:"type:decimal(32,16);"`
-	MakerFee              decimal.Decimal
-	TakerFee              decimal.Decimal
-	ExpirationTimeSeconds decimal.Decimal `sql:"type:decimal(32,16);"`
-	Salt                  int64
-	Side                  Side
-	ProductId             string
-	MakerFeeAssetData     string
-	TakerFeeAssetData     string
-	Signature             string
-	Status                OrderStatus
-	Settled               bool
-}
-
-type Config struct {
-	Id        int64 `gorm:"column:id;primary_key;AUTO_INCREMENT"`
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Key       string
-	Value     string
-}
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// 用于表示一笔订单或者交易的方向：买，卖
+type Side string
+
+func NewSideFromString(s string) (*Side, error) {
+	side := Side(s)
+	switch side {
+	case SideBuy:
+	case SideSell:
+	default:
+		return nil, fmt.Errorf("invalid side: %v", s)
+	}
+	return &side, nil
+}
+
+func (s Side) Opposite() Side {
+	if s == SideBuy {
+		return SideSell
+	}
+	return SideBuy
+}
+
+func (s Side) String() string {
+	return string(s)
+}
+
+// 用于表示订单类型：限价单，市价单
+type OrderType string
+
+func NewOrderTypeFromString(s string) (*OrderType, error) {
+	orderType := OrderType(s)
+	switch orderType {
+	case OrderTypeLimit:
+	case OrderTypeMarket:
+	case OrderTypeStop:
+	case OrderTypeStopLimit:
+	default:
+		return nil, fmt.Errorf("invalid type: %v", s)
+	}
+	return &orderType, nil
+}
+
+func (t OrderType) String() string {
+	return string(t)
+}
+
+// 用于表示订单状态
+type OrderStatus string
+
+func NewOrderStatusFromString(s string) (*OrderStatus, error) {
+	status := OrderStatus(s)
+	switch status {
+	case OrderStatusNew:
+	case OrderStatusOpen:
+	case OrderStatusCancelling:
+	case OrderStatusCancelled:
+	case OrderStatusFilled:
+	default:
+		return nil, fmt.Errorf("invalid status: %v", s)
+	}
+	return &status, nil
+}
+
+func (t OrderStatus) String() string {
+	return string(t)
+}
+
+// 用于表示订单的有效期策略
+type TimeInForce string
+
+func NewTimeInForceFromString(s string) (*TimeInForce, error) {
+	timeInForce := TimeInForce(s)
+	switch timeInForce {
+	case TimeInForceGTC:
+	case TimeInForceIOC:
+	case TimeInForceFOK:
+	case TimeInForceGTT:
+	default:
+		return nil, fmt.Errorf("invalid time in force: %v", s)
+	}
+	return &timeInForce, nil
+}
+
+func (t TimeInForce) String() string {
+	return string(t)
+}
+
+// 用于表示一条fill完成的原因
+type DoneReason string
+
+type TransactionStatus string
+
+type TransactionType string
+
+const (
+	SideBuy  = Side("buy")
+	SideSell = Side("sell")
+
+	OrderTypeLimit  = OrderType("limit")
+	OrderTypeMarket = OrderType("market")
+	// 最新成交价达到StopPrice后，转为市价单
+	OrderTypeStop = OrderType("stop")
+	// 最新成交价达到StopPrice后，转为限价单
+	OrderTypeStopLimit = OrderType("stop_limit")
+
+	// 初始状态
+	OrderStatusNew = OrderStatus("new")
+	// 已经加入orderBook
+	OrderStatusOpen = OrderStatus("open")
+	// 中间状态，请求取消订单
+	OrderStatusCancelling = OrderStatus("cancelling")
+	// 订单已经被取消，部分成交的订单也是cancelled
+	OrderStatusCancelled = OrderStatus("cancelled")
+	// 订单完全成交
+	OrderStatusFilled = OrderStatus("filled")
+
+	// 一直有效，直到成交或者被取消
+	TimeInForceGTC = TimeInForce("GTC")
+	// 立即成交，未成交的部分立即取消
+	TimeInForceIOC = TimeInForce("IOC")
+	// 全部成交，否则整个订单被拒绝
+	TimeInForceFOK = TimeInForce("FOK")
+	// 有效至ExpirationTimeSeconds，到期后被撤销
+	TimeInForceGTT = TimeInForce("GTT")
+
+	DoneReasonFilled    = DoneReason("filled")
+	DoneReasonCancelled = DoneReason("cancelled")
+	// IOC订单未能立即成交的部分被取消
+	DoneReasonImmediateOrCancel = DoneReason("ioc")
+	// FOK订单无法全部成交，被拒绝
+	DoneReasonFillOrKill = DoneReason("fok")
+	// post-only订单会立即成交，被拒绝
+	DoneReasonPostOnly = DoneReason("post_only")
+	// GTT订单已经到期
+	DoneReasonExpired = DoneReason("expired")
+	// 市价单的剩余部分超出了滑点保护价格
+	DoneReasonSlippage = DoneReason("slippage")
+	// 相同hash的订单已经提交过，本次提交被拒绝，不影响之前提交的订单
+	DoneReasonDuplicated = DoneReason("duplicated")
+	// maker的余额或授权不足，或者订单已经在链上取消，订单无法再成交
+	DoneReasonUnfunded = DoneReason("unfunded")
+	// 限价单的价格不能作为orderBook的价格档位，例如超出了int64能表示的tick数，被拒绝
+	DoneReasonInvalidPrice = DoneReason("invalid_price")
+	// 订单的数量或资金不是size increment的整数倍，或者超出了int64能表示的范围，被拒绝
+	DoneReasonInvalidSize = DoneReason("invalid_size")
+	// 交易暂停期间下的订单，被拒绝
+	DoneReasonHalted = DoneReason("halted")
+
+	// 结算交易已经创建，等待发送或者确认
+	TransactionStatusPending = TransactionStatus("pending")
+	// 结算交易已经在链上成功执行
+	TransactionStatusCompleted = TransactionStatus("completed")
+	// 结算交易在链上执行失败
+	TransactionStatusFailed = TransactionStatus("failed")
+	// 无法构造结算交易，例如成交的订单不存在，成交没有结算，需要人工处理
+	TransactionStatusInvalid = TransactionStatus("invalid")
+
+	// 填充maker和taker订单的batchFillOrders交易，之前版本的结算交易没有类型，也是settlement
+	TransactionTypeSettlement = TransactionType("settlement")
+	// 成交价格好于taker订单的价格时，结算交易完成后退还给taker的quote
+	TransactionTypeRebate = TransactionType("rebate")
+)
+
+type Asset struct {
+	Currency  string `gorm:"column:currency;primary_key"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	AssetData string
+	Decimals  int32
+}
+
+type Product struct {
+	Id             string `gorm:"column:id;primary_key"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	BaseCurrency   string
+	QuoteCurrency  string
+	PriceIncrement decimal.Decimal `sql:"type:decimal(32,16);"`
+	SizeIncrement  decimal.Decimal `sql:"type:decimal(32,16);"`
+	MinSize        decimal.Decimal `sql:"type:decimal(32,16);"`
+	MaxSize        decimal.Decimal `sql:"type:decimal(32,16);"`
+	MinNotional    decimal.Decimal `sql:"type:decimal(32,16);"`
+}
+
+type Order struct {
+	Id                    int64 `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+	Hash                  string
+	MakerAddress          string
+	TakerAddress          string
+	FeeRecipientAddress   string
+	SenderAddress         string
+	MakerAssetAmount      decimal.Decimal `sql:"type:decimal(32,16);"`
+	TakerAssetAmount      decimal.Decimal `sql:"type:decimal(32,16);"`
+	MakerFee              decimal.Decimal
+	TakerFee              decimal.Decimal
+	ExpirationTimeSeconds decimal.Decimal `sql:"type:decimal(32,16);"`
+	Salt                  decimal.Decimal `sql:"type:varchar(78);"`
+	Side                  Side
+	Type                  OrderType
+	ProductId             string
+	MakerAssetData        string
+	TakerAssetData        string
+	MakerFeeAssetData     string
+	TakerFeeAssetData     string
+	Signature             string
+	Status                OrderStatus
+	Settled               bool
+	TimeInForce           TimeInForce
+	PostOnly              bool
+	PostOnlyReprice       bool
+	MaxSlippage           decimal.Decimal
+	StopPrice             decimal.Decimal `sql:"type:decimal(32,16);"`
+	DisplaySize           decimal.Decimal `sql:"type:decimal(32,16);"`
+	Size                  decimal.Decimal `sql:"type:decimal(32,16);"`
+	Funds                 decimal.Decimal `sql:"type:decimal(32,16);"`
+	Price                 decimal.Decimal `sql:"type:decimal(32,16);"`
+	CancelReason          DoneReason
+	// 提交订单的REST请求id，随order写入kafka，用于关联各组件的日志，不需要持久化
+	RequestId string `gorm:"-"`
+}
+
+// 一笔成交在链上的结算交易
+type Transaction struct {
+	Id             int64 `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	ProductId      string
+	TradeId        int64
+	LogSeq         int64
+	LogOffset      int64
+	MakerOrderId   int64
+	TakerOrderId   int64
+	MakerOrderHash string
+	TakerOrderHash string
+	Size           decimal.Decimal `sql:"type:decimal(32,16);"`
+	Price          decimal.Decimal `sql:"type:decimal(32,16);"`
+	Type           TransactionType
+	// 交易的接收地址，结算交易为0x exchange合约，退款交易为quote的ERC20合约
+	To   string
+	Data string
+	// 签名后的交易(rlp编码)和它的nonce，在广播之前保存，重试时广播同一笔交易
+	Nonce uint64
+	RawTx string
+	Hash  string
+	// 结算交易按照taker订单的价格填充，需要退还给taker的quote数量(最小单位)
+	Rebate decimal.Decimal `sql:"type:decimal(78,0);"`
+	Status TransactionStatus
+}
+
+type Config struct {
+	Id        int64 `gorm:"column:id;primary_key;AUTO_INCREMENT"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Key       string
+	Value     string
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+const replayCommand = "replay"
+
+// gbe replay: applies the orders of a product to a fresh order book and writes the logs and the final book
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet(replayCommand, flag.ExitOnError)
+	configPath := flags.String("config", conf.DefaultConfigPath, "path of the config file, only read when the orders come from kafka")
+	productId := flags.String("product", "", "id of the product to replay (required)")
+	input := flags.String("input", "", "JSON lines file of the orders, one order topic message per line; the order topic in kafka when empty")
+	snapshotPath := flags.String("snapshot", "", "book written by a previous replay to start from, the orders after its offset are replayed")
+	stopOffset := flags.Int64("stop-offset", -1, "offset of the last order to replay, -1 for the end of the input")
+	logsPath := flags.String("logs", "-", "file the logs are written to as JSON lines, - for stdout")
+	bookPath := flags.String("book", "", "file the final book and its order offset are written to, can be used as -snapshot")
+	_ = flags.Parse(args)
+
+	if len(*productId) == 0 {
+		return errors.New("-product is required")
+	}
+	product, err := service.GetProductById(*productId)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return errors.New(fmt.Sprintf("product not found: %v", *productId))
+	}
+
+	var snapshot *match.Snapshot
+	if len(*snapshotPath) > 0 {
+		bytes, err := ioutil.ReadFile(*snapshotPath)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(bytes, &snapshot)
+		if err != nil {
+			return errors.New(fmt.Sprintf("invalid snapshot %v: %v", *snapshotPath, err))
+		}
+	}
+
+	var reader match.OrderReader
+	if len(*input) > 0 {
+		fileReader, err := match.NewFileOrderReader(*input)
+		if err != nil {
+			return err
+		}
+		defer fileReader.Close()
+		reader = fileReader
+	} else {
+		conf.SetConfigPath(*configPath)
+		gbeConfig, err := conf.LoadConfig()
+		if err != nil {
+			return err
+		}
+		err = gbeConfig.Validate(conf.SectionKafka)
+		if err != nil {
+			return err
+		}
+
+		// the topic is read up to its end when the replay starts, a replay never waits for new orders
+		kafkaReader := match.NewKafkaOrderReader(product.Id, gbeConfig.Kafka.Brokers)
+		lastOffset, err := kafkaReader.LastOffset()
+		if err != nil {
+			return err
+		}
+		if lastOffset < 0 {
+			return errors.New(fmt.Sprintf("order topic of %v is empty", product.Id))
+		}
+		if *stopOffset < 0 || *stopOffset > lastOffset {
+			*stopOffset = lastOffset
+		}
+		reader = kafkaReader
+	}
+
+	logsFile := os.Stdout
+	if *logsPath != "-" {
+		logsFile, err = os.Create(*logsPath)
+		if err != nil {
+			return err
+		}
+		defer logsFile.Close()
+	}
+	logWriter := bufio.NewWriter(logsFile)
+
+	result, skippedOffsets, err := match.Replay(product, reader, snapshot, *stopOffset, logWriter)
+	if err != nil {
+		return err
+	}
+	err = logWriter.Flush()
+	if err != nil {
+		return err
+	}
+	// the logs may be written to stdout, the skipped orders are reported on stderr
+	if len(skippedOffsets) > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %v orders that could not be decoded, offsets: %v\n",
+			len(skippedOffsets), skippedOffsets)
+	}
+
+	if len(*bookPath) > 0 {
+		bytes, err := json.MarshalIndent(result, "", "    ")
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(*bookPath, append(bytes, '\n'), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package rest
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+// 获取登录消息，maker需要用以太坊私钥personal_sign该消息
+// POST /auth/nonce
+func GetLoginNonce(ctx *gin.Context) {
+	var req loginNonceRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	message, err := service.CreateLoginNonce(req.MakerAddress)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, &loginNonceVo{Message: message})
+}
+
+// 使用登录消息的签名换取accessToken
+// POST /auth/token
+func SignIn(ctx *gin.Context) {
+	var req tokenRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	token, err := service.CreateAccessToken(req.MakerAddress, req.Signature)
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, newMessageVo(err))
+		return
+	}
+
+	ctx.SetCookie("accessToken", token, 7*24*60*60, "/", "", false, true)
+	ctx.JSON(http.StatusOK, &tokenVo{Token: token})
+}
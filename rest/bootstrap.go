@@ -1,15 +1,17 @@
-package rest
-
-import (
-	"github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/conf"
-)
-
-func StartServer() {
-	gbeConfig := conf.GetConfig()
-
-	httpServer := NewHttpServer(gbeConfig.RestServer.Addr)
-	go httpServer.Start()
-
-	log.Info("rest server ok")
-}
+package rest
+
+import (
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+)
+
+var logger = logging.New("rest")
+
+func StartServer() {
+	gbeConfig := conf.GetConfig()
+
+	httpServer := NewHttpServer(gbeConfig.RestServer.Addr)
+	go httpServer.Start()
+
+	logger.Info("rest server ok")
+}
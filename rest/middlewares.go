@@ -0,0 +1,195 @@
+package rest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/metrics"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+const (
+	keyCurrentMaker = "__current_maker"
+	keyRequestId    = "__request_id"
+	keyClientIp     = "__client_ip"
+
+	headerRequestId    = "X-Request-Id"
+	headerForwardedFor = "X-Forwarded-For"
+)
+
+// 校验accessToken，并将token绑定的makerAddress写入context
+func checkToken() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("Authorization")
+		if len(token) == 0 {
+			var err error
+			token, err = c.Cookie("accessToken")
+			if token == "" || err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, newMessageVo(errors.New("token not found")))
+				return
+			}
+		}
+
+		makerAddress, err := service.CheckToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, newMessageVo(err))
+			return
+		}
+
+		c.Set(keyCurrentMaker, makerAddress)
+		c.Next()
+	}
+}
+
+// 获取当前登录的makerAddress，只能在checkToken之后的handler中使用
+func GetCurrentMaker(ctx *gin.Context) string {
+	return ctx.GetString(keyCurrentMaker)
+}
+
+// 为每个请求分配requestId，优先使用调用方传入的X-Request-Id，并在响应中返回
+func requestId() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(headerRequestId)
+		if len(id) == 0 {
+			id = newRequestId()
+		}
+
+		c.Set(keyRequestId, id)
+		c.Header(headerRequestId, id)
+		c.Next()
+	}
+}
+
+func newRequestId() string {
+	bytes := make([]byte, 16)
+	_, err := rand.Read(bytes)
+	if err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(bytes)
+}
+
+// 获取当前请求的requestId，只能在requestId之后的handler中使用
+func GetRequestId(ctx *gin.Context) string {
+	return ctx.GetString(keyRequestId)
+}
+
+// 获取客户端ip并写入context。只有来自可信代理的请求才使用X-Forwarded-For，从右向左取第一个不是可信代理的地址，
+// 否则客户端可以伪造X-Forwarded-For绕过按ip的限流
+func clientIp(trustedProxies []string) gin.HandlerFunc {
+	var proxies []*net.IPNet
+	for _, proxy := range trustedProxies {
+		// 单个ip是只包含它自己的网段
+		if ip := net.ParseIP(proxy); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(err)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	trusted := func(ip net.IP) bool {
+		for _, proxy := range proxies {
+			if proxy.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		host, _, err := net.SplitHostPort(strings.TrimSpace(c.Request.RemoteAddr))
+		if err != nil {
+			host = c.Request.RemoteAddr
+		}
+		ip := net.ParseIP(host)
+
+		if ip != nil && trusted(ip) {
+			forwarded := strings.Split(c.GetHeader(headerForwardedFor), ",")
+			for i := len(forwarded) - 1; i >= 0; i-- {
+				forwardedIp := net.ParseIP(strings.TrimSpace(forwarded[i]))
+				if forwardedIp == nil {
+					break
+				}
+				ip = forwardedIp
+				if !trusted(ip) {
+					break
+				}
+			}
+		}
+
+		if ip != nil {
+			host = ip.String()
+		}
+		c.Set(keyClientIp, host)
+		c.Next()
+	}
+}
+
+// 获取当前请求的客户端ip，只能在clientIp之后的handler中使用
+func GetClientIp(ctx *gin.Context) string {
+	return ctx.GetString(keyClientIp)
+}
+
+// 每个请求结束后输出一条access log
+func accessLog() gin.HandlerFunc {
+	accessLogger := logging.New("access")
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.HandlerName()
+		route = route[strings.LastIndex(route, ".")+1:]
+
+		entry := accessLogger.WithFields(logrus.Fields{
+			logging.FieldRequestId: GetRequestId(c),
+			logging.FieldMaker:     GetCurrentMaker(c),
+			"method":               c.Request.Method,
+			"path":                 c.Request.URL.Path,
+			"route":                route,
+			"status":               c.Writer.Status(),
+			"latency":              time.Since(start).Seconds(),
+			"ip":                   GetClientIp(c),
+		})
+		if len(c.Errors) > 0 {
+			entry = entry.WithField("errors", c.Errors.String())
+		}
+		entry.Info("request")
+	}
+}
+
+// 记录每个请求的数量和耗时，route使用处理请求的handler名称，避免path参数导致过多的label
+func observeRequest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.HandlerName()
+		route = route[strings.LastIndex(route, ".")+1:]
+		status := strconv.Itoa(c.Writer.Status())
+
+		metrics.HttpRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		metrics.HttpRequestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// 没有匹配到route的请求
+func noRoute(c *gin.Context) {
+	c.JSON(http.StatusNotFound, newMessageVo(errors.New("not found")))
+}
@@ -0,0 +1,51 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestClientIp(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(clientIp([]string{"10.0.0.0/8", "192.168.1.1"}))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetClientIp(c))
+	})
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		expected     string
+	}{
+		{"no proxy", "1.2.3.4:5678", "", "1.2.3.4"},
+		{"untrusted proxy is ignored", "1.2.3.4:5678", "5.6.7.8", "1.2.3.4"},
+		{"trusted proxy", "10.0.0.1:5678", "5.6.7.8", "5.6.7.8"},
+		{"trusted proxy ip", "192.168.1.1:5678", "5.6.7.8", "5.6.7.8"},
+		{"trusted proxy without header", "10.0.0.1:5678", "", "10.0.0.1"},
+		// 客户端可以在X-Forwarded-For前面添加任意地址，只使用可信代理追加的地址
+		{"rightmost untrusted address", "10.0.0.1:5678", "9.9.9.9, 5.6.7.8, 10.0.0.2", "5.6.7.8"},
+		{"all trusted", "10.0.0.1:5678", "10.0.0.3, 10.0.0.2", "10.0.0.3"},
+		{"invalid forwarded address", "10.0.0.1:5678", "9.9.9.9, unknown", "10.0.0.1"},
+		{"ipv6", "[::1]:5678", "5.6.7.8", "::1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = test.remoteAddr
+			if len(test.forwardedFor) > 0 {
+				req.Header.Set(headerForwardedFor, test.forwardedFor)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if ip := w.Body.String(); ip != test.expected {
+				t.Fatalf("client ip %v, expected %v", ip, test.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package rest
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+// 返回订单需要填写的fee recipient、sender以及最低fee，与SRA v3 order_config一致
+// POST /order_config
+func GetOrderConfig(ctx *gin.Context) {
+	var req orderConfigRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	exchangeAddress := conf.GetConfig().Ethereum.ExchangeAddress
+	if len(req.ExchangeAddress) > 0 && !strings.EqualFold(req.ExchangeAddress, exchangeAddress) {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(errors.New(fmt.Sprintf("unsupported exchange address: %v",
+			req.ExchangeAddress))))
+		return
+	}
+
+	product, err := service.GetProductByAssetPair(req.MakerAssetData, req.TakerAssetData)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+	if product == nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(errors.New(fmt.Sprintf("product not found: %v - %v",
+			req.MakerAssetData, req.TakerAssetData))))
+		return
+	}
+
+	fees, err := service.GetOrderFees(product, req.MakerAddress, req.MakerAssetData, req.TakerAssetData,
+		req.MakerAssetAmount, req.PostOnly)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newOrderConfigVo(fees))
+}
@@ -1,216 +1,301 @@
-package rest
-
-import (
-	"context"
-	"encoding/json"
-	"fmt"
-	"net/http"
-	"strconv"
-	"sync"
-	"time"
-
-	"github.com/gin-gonic/gin"
-	"github.com/segmentio/kafka-go"
-	"github.com/shopspring/decimal"
-	"github.com/siddontang/go-log/log"
-	"github.com/zimengpan/go-boomflow/conf"
-	"github.com/zimengpan/go-boomflow/match"
-	"github.com/zimengpan/go-boomflow/models"
-	"github.com/zimengpan/go-boomflow/service"
-)
-
-var productId2Writer sync.Map
-
-func getWriter(productId string) *kafka.Writer {
-	writer, found := productId2Writer.Load(productId)
-	if found {
-		return writer.(*kafka.Writer)
-	}
-
-	gbeConfig := conf.GetConfig()
-
-	newWriter := kafka.NewWriter(kafka.WriterConfig{
-		Brokers:      gbeConfig.Kafka.Brokers,
-		Topic:        match.TopicOrderPrefix + productId,
-		Balancer:     &kafka.LeastBytes{},
-		BatchTimeout: 5 * time.Millisecond,
-	})
-	productId2Writer.Store(productId, newWriter)
-	return newWriter
-}
-
-func submitOrder(order *models.Order) {
-	buf, err := json.Marshal(order)
-	if err != nil {
-		log.Error(err)
-		return
-	}
-
-	err = getWriter(order.ProductId).WriteMessages(context.Background(), kafka.Message{Value: buf})
-	if err != nil {
-		log.Error(err)
-	}
-}
-
-// POST /orders
-func PlaceOrder(ctx *gin.Context) {
-	var req placeOrderRequest
-	err := ctx.BindJSON(&req)
-	if err != nil {
-		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
-		return
-	}
-
-	//TODO: Validate order, signature and balances
-	makerAddress := req.MakerAddress
-	takerAddress := req.TakerAddress
-	if takerAddress != "0x0000000000000000000000000000000000000000" {
-		ctx.JSON(http.StatusBadRequest, newMessageVo(fmt.Errorf("Taker Address is not Zero")))
-		return
-	}
-	feeRecipientAddress := req.FeeRecipientAddress
-	senderAddress := req.SenderAddress
-	makerAssetAmount := decimal.NewFromFloat(req.MakerAssetAmount)
-	takerAssetAmount := decimal.NewFromFloat(req.TakerAssetAmount)
-	makerFee := decimal.NewFromFloat(req.MakerFee)
-	takerFee := decimal.NewFromFloat(req.TakerFee)
-	expirationTimeSeconds := decimal.NewFromFloat(req.ExpirationTimeSeconds)
-	salt := req.Salt
-	makerAssetData := req.MakerAssetData
-	takerAssetData := req.TakerAssetData
-	makerFeeAssetData := req.MakerFeeAssetData
-	takerFeeAssetData := req.TakerFeeAssetData
-	signature := req.Signature
-
-	// Place Order to SQL DB
-	order, err := service.PlaceOrder(
-		makerAddress,
-		takerAddress,
-		feeRecipientAddress,
-		senderAddress,
-		makerAssetAmount,
-		takerAssetAmount,
-		makerFee,
-		takerFee,
-		expirationTimeSeconds,
-		salt,
-		makerAssetData,
-		takerAssetData,
-		makerFeeAssetData,
-		takerFeeAssetData,
-		signature)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
-		return
-	}
-
-	submitOrder(order)
-
-	ctx.JSON(http.StatusOK, order)
-}
-
-//TODO: Implementation
-// 撤销指定id的订单
-// DELETE /orders/1
-// DELETE /orders/client:1
-/*func CancelOrder(ctx *gin.Context) {
-	rawOrderId := ctx.Param("orderId")
-
-	var order *models.Order
-	var err error
-	orderId, _ := utils.AToInt64(rawOrderId)
-	order, err = service.GetOrderById(orderId)
-
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
-		return
-	}
-
-	order.Status = models.OrderStatusCancelling
-	submitOrder(order)
-
-	ctx.JSON(http.StatusOK, nil)
-}
-*/
-// 批量撤单
-// DELETE /orders/?productId=BTC-USDT&side=[buy,sell]
-/*func CancelOrders(ctx *gin.Context) {
-	productId := ctx.Query("productId")
-
-	var side *models.Side
-	var err error
-	rawSide := ctx.Query("side")
-	if len(rawSide) > 0 {
-		side, err = models.NewSideFromString(rawSide)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
-			return
-		}
-	}
-
-	orders, err := service.GetOrdersByUserId(GetCurrentUser(ctx).Id,
-		[]models.OrderStatus{models.OrderStatusOpen, models.OrderStatusNew}, side, productId, 0, 0, 10000)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
-		return
-	}
-
-	for _, order := range orders {
-		order.Status = models.OrderStatusCancelling
-		submitOrder(order)
-	}
-
-	ctx.JSON(http.StatusOK, nil)
-}*/
-
-// GET /orders
-func GetOrders(ctx *gin.Context) {
-	productId := ctx.Query("productId")
-	makerAddress := ctx.Query("makerAddress")
-	var side *models.Side
-	var err error
-	rawSide := ctx.GetString("side")
-	if len(rawSide) > 0 {
-		side, err = models.NewSideFromString(rawSide)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
-			return
-		}
-	}
-
-	var statuses []models.OrderStatus
-	statusValues := ctx.QueryArray("status")
-	for _, statusValue := range statusValues {
-		status, err := models.NewOrderStatusFromString(statusValue)
-		if err != nil {
-			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
-			return
-		}
-		statuses = append(statuses, *status)
-	}
-
-	before, _ := strconv.ParseInt(ctx.Query("before"), 10, 64)
-	after, _ := strconv.ParseInt(ctx.Query("after"), 10, 64)
-	limit, _ := strconv.ParseInt(ctx.Query("limit"), 10, 64)
-
-	orders, err := service.GetOrdersByUserId(makerAddress, statuses, side, productId, before, after, int(limit))
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
-		return
-	}
-
-	orderVos := []*orderVo{}
-	for _, order := range orders {
-		orderVos = append(orderVos, newOrderVo(order))
-	}
-
-	var newBefore, newAfter int64 = 0, 0
-	if len(orders) > 0 {
-		newBefore = orders[0].Id
-		newAfter = orders[len(orders)-1].Id
-	}
-	ctx.Header("gbe-before", strconv.FormatInt(newBefore, 10))
-	ctx.Header("gbe-after", strconv.FormatInt(newAfter, 10))
-
-	ctx.JSON(http.StatusOK, orderVos)
-}
+package rest
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/shopspring/decimal"
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+	"github.com/zimengpan/go-boomflow/utils"
+)
+
+// 写入order topic失败的订单不会被撮合，标记为cancelled，不会一直停留在new状态，也不会计入maker的挂单
+func submitOrder(order *models.Order) error {
+	err := match.SubmitOrder(order)
+	if err == nil {
+		return nil
+	}
+
+	log := logger.WithFields(logrus.Fields{
+		logging.FieldRequestId: order.RequestId,
+		logging.FieldOrderId:   order.Id,
+		logging.FieldOrderHash: order.Hash,
+	})
+	log.Error(err)
+	_, updateErr := service.UpdateOrderStatus(order.Id, models.OrderStatusNew, models.OrderStatusCancelled)
+	if updateErr != nil {
+		log.Error(updateErr)
+	}
+	return fmt.Errorf("submit order %v error: %v", order.Id, err)
+}
+
+// POST /orders
+func PlaceOrder(ctx *gin.Context) {
+	var req placeOrderRequest
+	err := ctx.BindJSON(&req)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	// hash, signature, product limits, fees and the maker's balance are validated by service.PlaceOrder
+	makerAddress := req.MakerAddress
+	if !strings.EqualFold(makerAddress, GetCurrentMaker(ctx)) {
+		ctx.JSON(http.StatusForbidden, newMessageVo(fmt.Errorf("Maker Address is not the signed in maker")))
+		return
+	}
+	takerAddress := req.TakerAddress
+	if takerAddress != "0x0000000000000000000000000000000000000000" {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(fmt.Errorf("Taker Address is not Zero")))
+		return
+	}
+	feeRecipientAddress := req.FeeRecipientAddress
+	senderAddress := req.SenderAddress
+	makerAssetAmount := req.MakerAssetAmount
+	takerAssetAmount := req.TakerAssetAmount
+	makerFee := req.MakerFee
+	takerFee := req.TakerFee
+	expirationTimeSeconds := req.ExpirationTimeSeconds
+	salt := req.Salt
+	makerAssetData := req.MakerAssetData
+	takerAssetData := req.TakerAssetData
+	makerFeeAssetData := req.MakerFeeAssetData
+	takerFeeAssetData := req.TakerFeeAssetData
+	signature := req.Signature
+
+	orderType := models.OrderTypeLimit
+	if len(req.Type) > 0 {
+		t, err := models.NewOrderTypeFromString(req.Type)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+		orderType = *t
+	}
+
+	maxSlippage := decimal.NewFromFloat(conf.GetConfig().Match.MaxSlippage)
+	if len(req.MaxSlippage) > 0 {
+		maxSlippage, err = decimal.NewFromString(req.MaxSlippage)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+	}
+
+	stopPrice := decimal.Zero
+	if len(req.StopPrice) > 0 {
+		stopPrice, err = decimal.NewFromString(req.StopPrice)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+	}
+
+	displaySize := decimal.Zero
+	if len(req.DisplaySize) > 0 {
+		displaySize, err = decimal.NewFromString(req.DisplaySize)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+	}
+
+	timeInForce := models.TimeInForceGTC
+	if len(req.TimeInForce) > 0 {
+		t, err := models.NewTimeInForceFromString(req.TimeInForce)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+		timeInForce = *t
+	}
+
+	// Place Order to SQL DB
+	order, err := service.PlaceOrder(
+		makerAddress,
+		takerAddress,
+		feeRecipientAddress,
+		senderAddress,
+		makerAssetAmount,
+		takerAssetAmount,
+		makerFee,
+		takerFee,
+		expirationTimeSeconds,
+		salt,
+		makerAssetData,
+		takerAssetData,
+		makerFeeAssetData,
+		takerFeeAssetData,
+		signature,
+		req.Hash,
+		orderType,
+		maxSlippage,
+		stopPrice,
+		displaySize,
+		timeInForce,
+		req.PostOnly,
+		req.PostOnlyReprice)
+	if err != nil {
+		if service.IsInvalidOrderError(err) {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+
+	order.RequestId = GetRequestId(ctx)
+	err = submitOrder(order)
+	if err != nil {
+		ctx.JSON(http.StatusServiceUnavailable, newMessageVo(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, order)
+}
+
+// 撤销指定id的订单
+// DELETE /orders/1
+func CancelOrder(ctx *gin.Context) {
+	rawOrderId := ctx.Param("orderId")
+
+	orderId, err := utils.AToInt64(rawOrderId)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	order, err := service.GetOrderById(orderId)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+	if order == nil || !strings.EqualFold(order.MakerAddress, GetCurrentMaker(ctx)) {
+		ctx.JSON(http.StatusNotFound, newMessageVo(fmt.Errorf("order not found: %v", rawOrderId)))
+		return
+	}
+
+	err = cancelOrder(order, GetRequestId(ctx))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+		return
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// 批量撤单
+// DELETE /orders/?productId=BTC-USDT&side=[buy,sell]
+func CancelOrders(ctx *gin.Context) {
+	productId := ctx.Query("productId")
+
+	var side *models.Side
+	var err error
+	rawSide := ctx.Query("side")
+	if len(rawSide) > 0 {
+		side, err = models.NewSideFromString(rawSide)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+	}
+
+	orders, err := service.GetOrdersByUserId(GetCurrentMaker(ctx),
+		[]models.OrderStatus{models.OrderStatusOpen, models.OrderStatusNew}, side, productId, 0, 0, 10000)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+
+	for _, order := range orders {
+		err = cancelOrder(order, GetRequestId(ctx))
+		if err != nil {
+			logger.WithField(logging.FieldRequestId, GetRequestId(ctx)).Warn(err)
+		}
+	}
+
+	ctx.JSON(http.StatusOK, nil)
+}
+
+// 先将订单标记为cancelling再提交给engine撤单，engine的done log将订单更新为cancelled或者filled
+func cancelOrder(order *models.Order, requestId string) error {
+	status := order.Status
+	if status != models.OrderStatusNew && status != models.OrderStatusOpen {
+		return fmt.Errorf("order %v can not be cancelled in status %v", order.Id, status)
+	}
+
+	updated, err := service.UpdateOrderStatus(order.Id, status, models.OrderStatusCancelling)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		return fmt.Errorf("order %v status changed, try again", order.Id)
+	}
+
+	err = match.SubmitCancel(order, "", requestId)
+	if err != nil {
+		_, _ = service.UpdateOrderStatus(order.Id, models.OrderStatusCancelling, status)
+		return err
+	}
+	return nil
+}
+
+// GET /orders
+func GetOrders(ctx *gin.Context) {
+	productId := ctx.Query("productId")
+	makerAddress := GetCurrentMaker(ctx)
+	var side *models.Side
+	var err error
+	rawSide := ctx.GetString("side")
+	if len(rawSide) > 0 {
+		side, err = models.NewSideFromString(rawSide)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+	}
+
+	var statuses []models.OrderStatus
+	statusValues := ctx.QueryArray("status")
+	for _, statusValue := range statusValues {
+		status, err := models.NewOrderStatusFromString(statusValue)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, newMessageVo(err))
+			return
+		}
+		statuses = append(statuses, *status)
+	}
+
+	before, _ := strconv.ParseInt(ctx.Query("before"), 10, 64)
+	after, _ := strconv.ParseInt(ctx.Query("after"), 10, 64)
+	limit, _ := strconv.ParseInt(ctx.Query("limit"), 10, 64)
+
+	orders, err := service.GetOrdersByUserId(makerAddress, statuses, side, productId, before, after, int(limit))
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, newMessageVo(err))
+		return
+	}
+
+	orderVos := []*orderVo{}
+	for _, order := range orders {
+		orderVos = append(orderVos, newOrderVo(order))
+	}
+
+	var newBefore, newAfter int64 = 0, 0
+	if len(orders) > 0 {
+		newBefore = orders[0].Id
+		newAfter = orders[len(orders)-1].Id
+	}
+	ctx.Header("gbe-before", strconv.FormatInt(newBefore, 10))
+	ctx.Header("gbe-after", strconv.FormatInt(newAfter, 10))
+
+	ctx.JSON(http.StatusOK, orderVos)
+}
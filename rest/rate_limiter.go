@@ -0,0 +1,125 @@
+package rest
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+const (
+	// interval to drop the idle buckets
+	bucketSweepInterval = time.Minute
+)
+
+// rateLimiter keeps a token bucket for each key, a request takes a token and is rejected when the bucket
+// is empty. Buckets refill at rate tokens per second up to burst.
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// nil if rate is not positive, which means unlimited
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:      rate,
+		burst:     float64(burst),
+		buckets:   map[string]*tokenBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+// take a token of the key, returns how long to wait for the next token when the bucket is empty
+func (l *rateLimiter) take(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucket, found := l.buckets[key]
+	if !found {
+		bucket = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = bucket
+	}
+
+	bucket.tokens = math.Min(l.burst, bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / l.rate * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// drop the buckets that are full again, they are the same as new buckets
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < bucketSweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// rateLimit limits the requests of a kind by client ip and by maker address. The ip limit must be used after
+// clientIp, and before checkToken on private routes so that requests with bad tokens are limited too. The maker
+// limit must be used after checkToken, it only limits signed in makers.
+func rateLimit(limit conf.RateLimit) (ipLimit gin.HandlerFunc, makerLimit gin.HandlerFunc) {
+	ipLimiter := newRateLimiter(limit.PerIpRate, limit.PerIpBurst)
+	makerLimiter := newRateLimiter(limit.PerMakerRate, limit.PerMakerBurst)
+
+	ipLimit = func(c *gin.Context) {
+		if ok, wait := ipLimiter.takeOrUnlimited(GetClientIp(c), time.Now()); !ok {
+			abortTooManyRequests(c, wait)
+			return
+		}
+		c.Next()
+	}
+	makerLimit = func(c *gin.Context) {
+		makerAddress := GetCurrentMaker(c)
+		if len(makerAddress) > 0 {
+			if ok, wait := makerLimiter.takeOrUnlimited(makerAddress, time.Now()); !ok {
+				abortTooManyRequests(c, wait)
+				return
+			}
+		}
+		c.Next()
+	}
+	return ipLimit, makerLimit
+}
+
+// a nil limiter is unlimited
+func (l *rateLimiter) takeOrUnlimited(key string, now time.Time) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	return l.take(key, now)
+}
+
+func abortTooManyRequests(c *gin.Context, wait time.Duration) {
+	c.Header("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, newMessageVo(errors.New("too many requests")))
+}
@@ -0,0 +1,103 @@
+package rest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+func assertTake(t *testing.T, l *rateLimiter, key string, now time.Time, expected bool, expectedWait time.Duration) {
+	t.Helper()
+
+	ok, wait := l.take(key, now)
+	if ok != expected || wait != expectedWait {
+		t.Fatalf("take %v at %v: %v, wait %v, expected %v, wait %v", key, now, ok, wait, expected, expectedWait)
+	}
+}
+
+func TestRateLimiterRefill(t *testing.T) {
+	l := newRateLimiter(2, 3)
+	start := time.Unix(1600000000, 0)
+
+	// a new bucket is full
+	for i := 0; i < 3; i++ {
+		assertTake(t, l, "a", start, true, 0)
+	}
+	assertTake(t, l, "a", start, false, 500*time.Millisecond)
+	assertTake(t, l, "b", start, true, 0)
+
+	// refills at 2 tokens per second
+	assertTake(t, l, "a", start.Add(250*time.Millisecond), false, 250*time.Millisecond)
+	assertTake(t, l, "a", start.Add(500*time.Millisecond), true, 0)
+	assertTake(t, l, "a", start.Add(500*time.Millisecond), false, 500*time.Millisecond)
+
+	// up to the burst
+	later := start.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		assertTake(t, l, "a", later, true, 0)
+	}
+	assertTake(t, l, "a", later, false, 500*time.Millisecond)
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	l := newRateLimiter(1, 10)
+	start := time.Unix(1600000000, 0)
+	l.lastSweep = start
+
+	assertTake(t, l, "a", start, true, 0)
+	for i := 0; i < 10; i++ {
+		assertTake(t, l, "b", start.Add(bucketSweepInterval-time.Second), true, 0)
+	}
+
+	// "a" is full again and dropped, "b" has refilled 1 of 10 tokens
+	assertTake(t, l, "c", start.Add(bucketSweepInterval), true, 0)
+	if _, found := l.buckets["a"]; found {
+		t.Fatal("full bucket is not swept")
+	}
+	if _, found := l.buckets["b"]; !found {
+		t.Fatal("bucket in use is swept")
+	}
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	l := newRateLimiter(0, 1)
+	if l != nil {
+		t.Fatal("rate limiter created for rate 0")
+	}
+	for i := 0; i < 10; i++ {
+		if ok, _ := l.takeOrUnlimited("a", time.Now()); !ok {
+			t.Fatal("unlimited request rejected")
+		}
+	}
+}
+
+// requests with bad tokens are limited by ip before checkToken rejects them
+func TestIpRateLimitBeforeCheckToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ipLimit, makerLimit := rateLimit(conf.RateLimit{PerIpRate: 1, PerIpBurst: 2, PerMakerRate: 1, PerMakerBurst: 1})
+
+	r := gin.New()
+	r.Use(clientIp(nil))
+	r.GET("/api/orders", ipLimit, checkToken(), makerLimit, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	for _, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		req := httptest.NewRequest(http.MethodGet, "/api/orders", nil)
+		req.RemoteAddr = "1.2.3.4:5678"
+		req.Header.Set("Authorization", "Bearer bad")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		if w.Code != expected {
+			t.Fatalf("status %v, expected %v", w.Code, expected)
+		}
+		if expected == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "1" {
+			t.Fatalf("Retry-After %q, expected 1", w.Header().Get("Retry-After"))
+		}
+	}
+}
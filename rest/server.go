@@ -1,44 +1,54 @@
-package rest
-
-import (
-	"io/ioutil"
-
-	"github.com/gin-gonic/gin"
-	"github.com/siddontang/go-log/log"
-)
-
-type HttpServer struct {
-	addr string
-}
-
-func NewHttpServer(addr string) *HttpServer {
-	return &HttpServer{
-		addr: addr,
-	}
-}
-
-func (server *HttpServer) Start() {
-	gin.SetMode(gin.ReleaseMode)
-	gin.DefaultWriter = ioutil.Discard
-
-	r := gin.Default()
-	r.Use(setCROSOptions)
-
-	r.GET("/api/orders", GetOrders)
-	r.POST("/api/orders", PlaceOrder)
-
-	err := r.Run(server.addr)
-	log.Info("here")
-	if err != nil {
-		log.Info("there")
-		panic(err)
-	}
-}
-
-func setCROSOptions(c *gin.Context) {
-	c.Header("Access-Control-Allow-Origin", "*")
-	c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
-	c.Header("Access-Control-Allow-Headers", "*")
-	c.Header("Allow", "HEAD,GET,POST,PUT,PATCH,DELETE,OPTIONS")
-	c.Header("Content-Type", "application/json")
-}
+package rest
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+type HttpServer struct {
+	addr string
+}
+
+func NewHttpServer(addr string) *HttpServer {
+	return &HttpServer{
+		addr: addr,
+	}
+}
+
+func (server *HttpServer) Start() {
+	gin.SetMode(gin.ReleaseMode)
+
+	r := gin.New()
+	r.Use(gin.Recovery(), requestId(), clientIp(conf.GetConfig().RestServer.TrustedProxies), accessLog(),
+		observeRequest(), setCROSOptions)
+	r.NoRoute(noRoute)
+
+	rateLimits := conf.GetConfig().RestServer.RateLimits
+	readIpLimit, readMakerLimit := rateLimit(rateLimits.Read)
+	placementIpLimit, placementMakerLimit := rateLimit(rateLimits.Placement)
+	cancellationIpLimit, cancellationMakerLimit := rateLimit(rateLimits.Cancellation)
+
+	r.POST("/api/auth/nonce", readIpLimit, GetLoginNonce)
+	r.POST("/api/auth/token", readIpLimit, SignIn)
+	r.POST("/api/order_config", readIpLimit, GetOrderConfig)
+
+	// the ip limit runs before checkToken, a client sending bad tokens is limited as well
+	auth := checkToken()
+	r.GET("/api/orders", readIpLimit, auth, readMakerLimit, GetOrders)
+	r.POST("/api/orders", placementIpLimit, auth, placementMakerLimit, PlaceOrder)
+	r.DELETE("/api/orders/:orderId", cancellationIpLimit, auth, cancellationMakerLimit, CancelOrder)
+	r.DELETE("/api/orders", cancellationIpLimit, auth, cancellationMakerLimit, CancelOrders)
+
+	err := r.Run(server.addr)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func setCROSOptions(c *gin.Context) {
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "*")
+	c.Header("Allow", "HEAD,GET,POST,PUT,PATCH,DELETE,OPTIONS")
+	c.Header("Content-Type", "application/json")
+}
@@ -1,109 +1,192 @@
-package rest
-
-import (
-	"strconv"
-	"time"
-
-	"github.com/zimengpan/go-boomflow/models"
-	"github.com/zimengpan/go-boomflow/service"
-)
-
-type messageVo struct {
-	Message string `json:"message"`
-}
-
-func newMessageVo(error error) *messageVo {
-	return &messageVo{
-		Message: error.Error(),
-	}
-}
-
-type placeOrderRequest struct {
-	Hash                  string  `json:"hash"`
-	MakerAddress          string  `json:"makerAddress"`
-	TakerAddress          string  `json:"takerAddress"`
-	FeeRecipientAddress   string  `json:"feeRecipientAddress"`
-	SenderAddress         string  `json:"senderAddress"`
-	MakerAssetAmount      float64 `json:"makerAssetAmount"`
-	TakerAssetAmount      float64 `json:"takerAssetAmount"`
-	MakerFee              float64 `json:"makerFee"`
-	TakerFee              float64 `json:"takerFee"`
-	ExpirationTimeSeconds float64 `json:"expirationTimeSeconds"`
-	Salt                  int64   `json:"salt"`
-	MakerAssetData        string  `json:"makerAssetData"`
-	TakerAssetData        string  `json:"takerAssetData"`
-	MakerFeeAssetData     string  `json:"makerFeeAssetData"`
-	TakerFeeAssetData     string  `json:"takerFeeAssetData"`
-	Signature             string  `json:"signature"`
-}
-
-type orderVo struct {
-	Id                    string `json:"Id"`
-	CreatedAt             string `json:"CreatedAt"`
-	MakerAddress          string `json:"makerAddress"`
-	TakerAddress          string `json:"takerAddress"`
-	FeeRecipientAddress   string `json:"feeRecipientAddress"`
-	SenderAddress         string `json:"senderAddress"`
-	MakerAssetAmount      string `json:"makerAssetAmount"`
-	TakerAssetAmount      string `json:"takerAssetAmount"`
-	MakerFee              string `json:"makerFee"`
-	TakerFee              string `json:"takerFee"`
-	ExpirationTimeSeconds string `json:"expirationTimeSeconds"`
-	Salt                  string `json:"salt"`
-	Side                  string `json:"Side"`
-	ProductId             string `json:"ProductId"`
-	MakerFeeAssetData     string `json:"makerFeeAssetData"`
-	TakerFeeAssetData     string `json:"takerFeeAssetData"`
-	Signature             string `json:"signature"`
-	Status                string `json:"Status"`
-	Settled               bool   `json:"Settled"`
-}
-
-type ProductVo struct {
-	Id             string `json:"id"`
-	BaseCurrency   string `json:"baseCurrency"`
-	QuoteCurrency  string `json:"quoteCurrency"`
-	BaseAssetData  string `json:"BaseAssetData"`
-	QuoteAssetData string `json:"QuoteAssetData"`
-}
-
-type orderBookVo struct {
-	Sequence string           `json:"sequence"`
-	Asks     [][3]interface{} `json:"asks"`
-	Bids     [][3]interface{} `json:"bids"`
-}
-
-func newProductVo(product *models.Product) *ProductVo {
-	base, _ := service.GetAssetByCurrency(product.BaseCurrency)
-	quote, _ := service.GetAssetByCurrency(product.QuoteCurrency)
-	return &ProductVo{
-		Id:             product.Id,
-		BaseCurrency:   product.BaseCurrency,
-		QuoteCurrency:  product.QuoteCurrency,
-		BaseAssetData:  base.AssetData,
-		QuoteAssetData: quote.AssetData,
-	}
-}
-
-func newOrderVo(order *models.Order) *orderVo {
-	return &orderVo{
-		CreatedAt:             order.CreatedAt.Format(time.RFC3339),
-		MakerAddress:          order.MakerAddress,
-		TakerAddress:          order.TakerAddress,
-		FeeRecipientAddress:   order.FeeRecipientAddress,
-		SenderAddress:         order.SenderAddress,
-		MakerAssetAmount:      order.MakerAssetAmount.String(),
-		TakerAssetAmount:      order.TakerAssetAmount.String(),
-		MakerFee:              order.MakerFee.String(),
-		TakerFee:              order.TakerFee.String(),
-		ExpirationTimeSeconds: order.ExpirationTimeSeconds.String(),
-		Salt:                  strconv.FormatInt(order.Salt, 10),
-		Side:                  order.Side.String(),
-		ProductId:             order.ProductId,
-		MakerFeeAssetData:     order.MakerFeeAssetData,
-		TakerFeeAssetData:     order.TakerFeeAssetData,
-		Signature:             order.Signature,
-		Status:                order.Status.String(),
-		Settled:               order.Settled,
-	}
-}
+package rest
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+type messageVo struct {
+	Message string `json:"message"`
+}
+
+func newMessageVo(error error) *messageVo {
+	return &messageVo{
+		Message: error.Error(),
+	}
+}
+
+type placeOrderRequest struct {
+	Hash                  string          `json:"hash"`
+	MakerAddress          string          `json:"makerAddress"`
+	TakerAddress          string          `json:"takerAddress"`
+	FeeRecipientAddress   string          `json:"feeRecipientAddress"`
+	SenderAddress         string          `json:"senderAddress"`
+	MakerAssetAmount      decimal.Decimal `json:"makerAssetAmount"`
+	TakerAssetAmount      decimal.Decimal `json:"takerAssetAmount"`
+	MakerFee              decimal.Decimal `json:"makerFee"`
+	TakerFee              decimal.Decimal `json:"takerFee"`
+	ExpirationTimeSeconds decimal.Decimal `json:"expirationTimeSeconds"`
+	Salt                  decimal.Decimal `json:"salt"`
+	MakerAssetData        string          `json:"makerAssetData"`
+	TakerAssetData        string          `json:"takerAssetData"`
+	MakerFeeAssetData     string          `json:"makerFeeAssetData"`
+	TakerFeeAssetData     string          `json:"takerFeeAssetData"`
+	Signature             string          `json:"signature"`
+	Type                  string          `json:"type"`
+	MaxSlippage           string          `json:"maxSlippage"`
+	StopPrice             string          `json:"stopPrice"`
+	DisplaySize           string          `json:"displaySize"`
+	TimeInForce           string          `json:"timeInForce"`
+	PostOnly              bool            `json:"postOnly"`
+	PostOnlyReprice       bool            `json:"postOnlyReprice"`
+}
+
+type orderConfigRequest struct {
+	MakerAddress          string          `json:"makerAddress"`
+	TakerAddress          string          `json:"takerAddress"`
+	MakerAssetAmount      decimal.Decimal `json:"makerAssetAmount"`
+	TakerAssetAmount      decimal.Decimal `json:"takerAssetAmount"`
+	MakerAssetData        string          `json:"makerAssetData"`
+	TakerAssetData        string          `json:"takerAssetData"`
+	ExchangeAddress       string          `json:"exchangeAddress"`
+	ExpirationTimeSeconds decimal.Decimal `json:"expirationTimeSeconds"`
+	// 不属于SRA，post-only订单适用maker费率
+	PostOnly bool `json:"postOnly"`
+}
+
+type orderConfigVo struct {
+	FeeRecipientAddress string `json:"feeRecipientAddress"`
+	SenderAddress       string `json:"senderAddress"`
+	MakerFee            string `json:"makerFee"`
+	TakerFee            string `json:"takerFee"`
+	MakerFeeAssetData   string `json:"makerFeeAssetData"`
+	TakerFeeAssetData   string `json:"takerFeeAssetData"`
+}
+
+type loginNonceRequest struct {
+	MakerAddress string `json:"makerAddress"`
+}
+
+type loginNonceVo struct {
+	Message string `json:"message"`
+}
+
+type tokenRequest struct {
+	MakerAddress string `json:"makerAddress"`
+	Signature    string `json:"signature"`
+}
+
+type tokenVo struct {
+	Token string `json:"token"`
+}
+
+type orderVo struct {
+	Id                    string `json:"Id"`
+	CreatedAt             string `json:"CreatedAt"`
+	Hash                  string `json:"hash"`
+	MakerAddress          string `json:"makerAddress"`
+	TakerAddress          string `json:"takerAddress"`
+	FeeRecipientAddress   string `json:"feeRecipientAddress"`
+	SenderAddress         string `json:"senderAddress"`
+	MakerAssetAmount      string `json:"makerAssetAmount"`
+	TakerAssetAmount      string `json:"takerAssetAmount"`
+	MakerFee              string `json:"makerFee"`
+	TakerFee              string `json:"takerFee"`
+	ExpirationTimeSeconds string `json:"expirationTimeSeconds"`
+	Salt                  string `json:"salt"`
+	Side                  string `json:"Side"`
+	Type                  string `json:"type"`
+	StopPrice             string `json:"stopPrice"`
+	DisplaySize           string `json:"displaySize"`
+	ProductId             string `json:"ProductId"`
+	MakerAssetData        string `json:"makerAssetData"`
+	TakerAssetData        string `json:"takerAssetData"`
+	MakerFeeAssetData     string `json:"makerFeeAssetData"`
+	TakerFeeAssetData     string `json:"takerFeeAssetData"`
+	Signature             string `json:"signature"`
+	Status                string `json:"Status"`
+	Settled               bool   `json:"Settled"`
+	TimeInForce           string `json:"timeInForce"`
+	PostOnly              bool   `json:"postOnly"`
+}
+
+type ProductVo struct {
+	Id             string `json:"id"`
+	BaseCurrency   string `json:"baseCurrency"`
+	QuoteCurrency  string `json:"quoteCurrency"`
+	BaseAssetData  string `json:"BaseAssetData"`
+	QuoteAssetData string `json:"QuoteAssetData"`
+	PriceIncrement string `json:"priceIncrement"`
+	SizeIncrement  string `json:"sizeIncrement"`
+	MinSize        string `json:"minSize"`
+	MaxSize        string `json:"maxSize"`
+	MinNotional    string `json:"minNotional"`
+}
+
+type orderBookVo struct {
+	Sequence string           `json:"sequence"`
+	Asks     [][3]interface{} `json:"asks"`
+	Bids     [][3]interface{} `json:"bids"`
+}
+
+func newProductVo(product *models.Product) *ProductVo {
+	base, _ := service.GetAssetByCurrency(product.BaseCurrency)
+	quote, _ := service.GetAssetByCurrency(product.QuoteCurrency)
+	return &ProductVo{
+		Id:             product.Id,
+		BaseCurrency:   product.BaseCurrency,
+		QuoteCurrency:  product.QuoteCurrency,
+		BaseAssetData:  base.AssetData,
+		QuoteAssetData: quote.AssetData,
+		PriceIncrement: product.PriceIncrement.String(),
+		SizeIncrement:  product.SizeIncrement.String(),
+		MinSize:        product.MinSize.String(),
+		MaxSize:        product.MaxSize.String(),
+		MinNotional:    product.MinNotional.String(),
+	}
+}
+
+func newOrderVo(order *models.Order) *orderVo {
+	return &orderVo{
+		CreatedAt:             order.CreatedAt.Format(time.RFC3339),
+		Hash:                  order.Hash,
+		MakerAddress:          order.MakerAddress,
+		TakerAddress:          order.TakerAddress,
+		FeeRecipientAddress:   order.FeeRecipientAddress,
+		SenderAddress:         order.SenderAddress,
+		MakerAssetAmount:      order.MakerAssetAmount.String(),
+		TakerAssetAmount:      order.TakerAssetAmount.String(),
+		MakerFee:              order.MakerFee.String(),
+		TakerFee:              order.TakerFee.String(),
+		ExpirationTimeSeconds: order.ExpirationTimeSeconds.String(),
+		Salt:                  order.Salt.String(),
+		Side:                  order.Side.String(),
+		Type:                  order.Type.String(),
+		StopPrice:             order.StopPrice.String(),
+		DisplaySize:           order.DisplaySize.String(),
+		ProductId:             order.ProductId,
+		MakerAssetData:        order.MakerAssetData,
+		TakerAssetData:        order.TakerAssetData,
+		MakerFeeAssetData:     order.MakerFeeAssetData,
+		TakerFeeAssetData:     order.TakerFeeAssetData,
+		Signature:             order.Signature,
+		Status:                order.Status.String(),
+		Settled:               order.Settled,
+		TimeInForce:           order.TimeInForce.String(),
+		PostOnly:              order.PostOnly,
+	}
+}
+
+func newOrderConfigVo(fees *service.OrderFees) *orderConfigVo {
+	return &orderConfigVo{
+		FeeRecipientAddress: fees.FeeRecipientAddress,
+		SenderAddress:       fees.SenderAddress,
+		MakerFee:            fees.MakerFee.String(),
+		TakerFee:            fees.TakerFee.String(),
+		MakerFeeAssetData:   fees.MakerFeeAssetData,
+		TakerFeeAssetData:   fees.TakerFeeAssetData,
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/rest"
+	"github.com/zimengpan/go-boomflow/settlement"
+	"github.com/zimengpan/go-boomflow/watcher"
+)
+
+const defaultRole = "all"
+
+// role is a set of components run by one process, with the config sections they read
+type role struct {
+	description string
+	sections    []string
+	// the process shares the orders, login nonces and settlement transactions with the processes of the other
+	// roles and its replicas, they are kept in redis
+	shared bool
+	start  func() error
+}
+
+var roles = map[string]*role{
+	// only one engine process writes the logs of a product, the others are hot standbys when
+	// match.election is configured. The leader also settles the trades of its logs with the single relayer account,
+	// it reads the orders placed through the api processes from redis
+	"engine": {
+		description: "matching engine and on-chain settlement, one leader per product",
+		sections: []string{conf.SectionRedis, conf.SectionKafka, conf.SectionMatch, conf.SectionEthereum,
+			conf.SectionSettlement, conf.SectionMetrics, conf.SectionLogging},
+		shared: true,
+		start:  startEngine,
+	},
+	// api processes write the order topics and keep the orders and login nonces in redis, so they can be scaled
+	// horizontally. Every process reads the match logs to update the order status, and its order watcher checks
+	// all orders, a status update in redis decides which process cancels an unfunded order
+	"api": {
+		description: "REST server and order watcher, can be scaled horizontally",
+		sections: []string{conf.SectionRedis, conf.SectionKafka, conf.SectionRestServer, conf.SectionMatch,
+			conf.SectionEthereum, conf.SectionFee, conf.SectionOrderWatcher, conf.SectionJwtSecret, conf.SectionMetrics,
+			conf.SectionLogging},
+		shared: true,
+		start:  startApi,
+	},
+	// everything in one process, for development. Without redis.addr the orders, nonces and transactions are
+	// kept in memory and lost on restart
+	"all": {
+		description: "engine and api in one process",
+		start: func() error {
+			err := startEngine()
+			if err != nil {
+				return err
+			}
+			return startApi()
+		},
+	},
+}
+
+func startEngine() error {
+	match.StartEngine()
+	settlement.StartSettlement()
+	return nil
+}
+
+func startApi() error {
+	rest.StartServer()
+	watcher.StartOrderStatusUpdater()
+	watcher.StartOrderWatcher()
+	watcher.StartExpireTicker()
+	return nil
+}
+
+func init() {
+	roles["all"].sections = unionSections(roles["engine"].sections, roles["api"].sections)
+}
+
+func unionSections(sectionLists ...[]string) []string {
+	var sections []string
+	found := map[string]bool{}
+	for _, list := range sectionLists {
+		for _, section := range list {
+			if !found[section] {
+				found[section] = true
+				sections = append(sections, section)
+			}
+		}
+	}
+	return sections
+}
+
+// check the config sections of the role, a role that shares its state with other processes requires redis
+func (r *role) validate(gbeConfig *conf.GbeConfig) error {
+	err := gbeConfig.Validate(r.sections...)
+	if err != nil {
+		return err
+	}
+	if r.shared && len(gbeConfig.Redis.Addr) == 0 {
+		return errors.New("invalid config:\n  redis.addr: is required when engine and api run in separate processes")
+	}
+	return nil
+}
+
+func getRole(name string) (*role, error) {
+	r, found := roles[name]
+	if !found {
+		return nil, errors.New(fmt.Sprintf("unknown role %q, expected one of %v", name, strings.Join(roleNames(), ", ")))
+	}
+	return r, nil
+}
+
+func roleNames() []string {
+	var names []string
+	for name := range roles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+const (
+	// nonce签名的有效期
+	nonceTTL = 5 * time.Minute
+	// accessToken的有效期
+	accessTokenTTL = 7 * 24 * time.Hour
+)
+
+// 为maker生成一条登录消息，maker使用以太坊私钥对其personal_sign后换取accessToken，
+// maker已经有未过期的登录消息时返回该消息
+func CreateLoginNonce(makerAddress string) (string, error) {
+	if !common.IsHexAddress(makerAddress) {
+		return "", errors.New(fmt.Sprintf("invalid address: %v", makerAddress))
+	}
+
+	buf := make([]byte, 16)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+	message := fmt.Sprintf("Sign in to boomflow as %v, nonce: %v", strings.ToLower(makerAddress), hexutil.Encode(buf))
+
+	return getNonceStore().put(makerAddress, message, nonceTTL)
+}
+
+// 校验maker对登录消息的签名，签名正确则签发绑定makerAddress的accessToken，每个nonce只能使用一次
+func CreateAccessToken(makerAddress string, signature string) (string, error) {
+	makerAddress = strings.ToLower(makerAddress)
+
+	message, found, err := getNonceStore().get(makerAddress)
+	if err != nil {
+		return "", err
+	}
+	if !found {
+		return "", errors.New("login nonce not found or expired")
+	}
+
+	signer, err := recoverPersonalSigner(message, signature)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(signer.Hex(), makerAddress) {
+		return "", errors.New(fmt.Sprintf("signature is signed by %v, not %v", signer.Hex(), makerAddress))
+	}
+
+	// 签名校验通过后才删除nonce，错误的签名不会使maker的nonce失效
+	removed, err := getNonceStore().remove(makerAddress, message)
+	if err != nil {
+		return "", err
+	}
+	if !removed {
+		return "", errors.New("login nonce already used or expired")
+	}
+
+	claim := jwt.MapClaims{
+		"makerAddress": makerAddress,
+		"expiredAt":    time.Now().Add(accessTokenTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
+	return token.SignedString([]byte(conf.GetConfig().JwtSecret))
+}
+
+// 校验accessToken，返回其绑定的makerAddress
+func CheckToken(tokenStr string) (string, error) {
+	token, err := jwt.Parse(strings.TrimPrefix(tokenStr, "Bearer "), func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New(fmt.Sprintf("unexpected signing method: %v", token.Header["alg"]))
+		}
+		return []byte(conf.GetConfig().JwtSecret), nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claim, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return "", errors.New("bad token")
+	}
+
+	makerAddress, _ := claim["makerAddress"].(string)
+	expiredAt, _ := claim["expiredAt"].(float64)
+	if len(makerAddress) == 0 {
+		return "", errors.New("bad token")
+	}
+	if int64(expiredAt) < time.Now().Unix() {
+		return "", errors.New("token expired")
+	}
+	return makerAddress, nil
+}
+
+// 恢复personal_sign(EIP-191)签名的账户地址
+func recoverPersonalSigner(message string, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if len(sig) != 65 {
+		return common.Address{}, errors.New(fmt.Sprintf("invalid signature length: %v", len(sig)))
+	}
+
+	// 钱包返回的v为27或28
+	if sig[64] >= 27 {
+		sig[64] -= 27
+	}
+
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	publicKey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}
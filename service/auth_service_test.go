@@ -0,0 +1,65 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// personal_sign，钱包返回的v为27或28
+func personalSign(t *testing.T, message string, key *ecdsa.PrivateKey) string {
+	hash := crypto.Keccak256([]byte(fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)))
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+	return hexutil.Encode(sig)
+}
+
+// 错误的签名不会使nonce失效，正确的签名只能登录一次
+func TestCreateAccessToken(t *testing.T) {
+	makerKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+	makerAddress := crypto.PubkeyToAddress(makerKey.PublicKey).Hex()
+
+	message, err := CreateLoginNonce(makerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 其他人获取nonce时返回未过期的nonce，不会替换maker正在签名的消息
+	again, err := CreateLoginNonce(makerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != message {
+		t.Fatalf("login nonce replaced: %q, expected %q", again, message)
+	}
+
+	_, err = CreateAccessToken(makerAddress, personalSign(t, message, otherKey))
+	if err == nil {
+		t.Fatal("signed in with the signature of another account")
+	}
+
+	token, err := CreateAccessToken(makerAddress, personalSign(t, message, makerKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokenMaker, err := CheckToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.EqualFold(tokenMaker, makerAddress) {
+		t.Fatalf("token of maker %v, expected %v", tokenMaker, makerAddress)
+	}
+
+	_, err = CreateAccessToken(makerAddress, personalSign(t, message, makerKey))
+	if err == nil {
+		t.Fatal("signed in twice with the same nonce")
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/chain"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+var logger = logging.New("service")
+
+var chainStateProvider chain.ChainStateProvider
+var chainStateProviderOnce sync.Once
+
+// 替换默认的ChainStateProvider，需要在处理订单之前调用
+func SetChainStateProvider(provider chain.ChainStateProvider) {
+	chainStateProviderOnce.Do(func() {})
+	chainStateProvider = provider
+}
+
+// 默认根据配置连接Ethereum节点，没有配置rpcUrl时返回nil，不做链上检查
+func GetChainStateProvider() chain.ChainStateProvider {
+	chainStateProviderOnce.Do(func() {
+		ethereumConfig := conf.GetConfig().Ethereum
+		if ethereumConfig.RpcUrl == "" {
+			logger.Warn("ethereum rpcUrl not configured, maker balances and allowances will not be checked")
+			return
+		}
+
+		provider, err := chain.NewEthereumStateProvider(ethereumConfig.RpcUrl, ethereumConfig.ExchangeAddress,
+			ethereumConfig.Erc20ProxyAddress)
+		if err != nil {
+			panic(err)
+		}
+		chainStateProvider = provider
+	})
+	return chainStateProvider
+}
+
+type OrderFundState string
+
+const (
+	// 订单未成交的部分仍然可以在链上全部成交
+	OrderFundStateFunded = OrderFundState("funded")
+	// 订单已经在链上取消，或者maker的余额、授权不足，订单需要从orderBook中撤销
+	OrderFundStateUnfunded = OrderFundState("unfunded")
+	// 订单已经在链上全部成交，由done log更新订单状态，不需要撤销
+	OrderFundStateFilled = OrderFundState("filled")
+)
+
+// 同一个maker的多个订单使用同一份余额，需要检查的是maker所有订单的总额
+var makerOpenOrderStatuses = []models.OrderStatus{models.OrderStatusNew, models.OrderStatusOpen,
+	models.OrderStatusCancelling}
+
+// 一次从链上读取的订单和maker账户的状态，maker可以转出的资产按照订单的先后顺序分配给订单
+type orderFunds struct {
+	states *chain.States
+
+	// 订单需要转出资产的maker账户，assetData无法解析的订单不在其中
+	accounts map[int64][]chain.TokenAccount
+
+	// maker还没有分配给订单的可转出资产，即余额和授权给0x ERC20 proxy的额度中较小的一个，减去已经分配的数量
+	available map[chain.TokenAccount]decimal.Decimal
+}
+
+// 使用一个batch请求读取订单的成交、取消状态，以及maker在订单的makerAsset和makerFee资产上的余额和授权
+func loadOrderFunds(provider chain.ChainStateProvider, orders []*models.Order) (*orderFunds, error) {
+	var orderHashes []common.Hash
+	var accounts []chain.TokenAccount
+	orderAccounts := map[int64][]chain.TokenAccount{}
+	found := map[chain.TokenAccount]bool{}
+	for _, order := range orders {
+		makerAccounts, err := getMakerAccounts(order)
+		if err != nil {
+			logger.WithField(logging.FieldOrderId, order.Id).Warnf("decode order asset data error: %v", err)
+			continue
+		}
+		orderHashes = append(orderHashes, common.HexToHash(order.Hash))
+		orderAccounts[order.Id] = makerAccounts
+		for _, account := range makerAccounts {
+			if !found[account] {
+				found[account] = true
+				accounts = append(accounts, account)
+			}
+		}
+	}
+
+	states, err := provider.GetStates(orderHashes, accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	available := map[chain.TokenAccount]decimal.Decimal{}
+	for _, account := range accounts {
+		transferable := states.Balances[account]
+		if allowance := states.Allowances[account]; allowance.Cmp(transferable) < 0 {
+			transferable = allowance
+		}
+		available[account] = decimal.NewFromBigInt(transferable, 0)
+	}
+	return &orderFunds{states: states, accounts: orderAccounts, available: available}, nil
+}
+
+// 订单需要从maker转出的账户：makerAsset，以及makerFee使用的资产
+func getMakerAccounts(order *models.Order) ([]chain.TokenAccount, error) {
+	owner := common.HexToAddress(order.MakerAddress)
+	makerToken, err := zeroex.DecodeERC20AssetData(order.MakerAssetData)
+	if err != nil {
+		return nil, err
+	}
+	accounts := []chain.TokenAccount{{Token: makerToken, Owner: owner}}
+
+	if order.MakerFee.GreaterThan(decimal.Zero) && order.MakerFeeAssetData != order.MakerAssetData {
+		feeToken, err := zeroex.DecodeERC20AssetData(order.MakerFeeAssetData)
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, chain.TokenAccount{Token: feeToken, Owner: owner})
+	}
+	return accounts, nil
+}
+
+func (f *orderFunds) filled(order *models.Order) decimal.Decimal {
+	return decimal.NewFromBigInt(f.states.Filled[common.HexToHash(order.Hash)], 0)
+}
+
+func (f *orderFunds) cancelled(order *models.Order) bool {
+	return f.states.Cancelled[common.HexToHash(order.Hash)]
+}
+
+// 为订单未成交的部分分配maker的资产，资产足够时从available中扣除，不足时不扣除，留给之后的订单
+func (f *orderFunds) allocate(order *models.Order) OrderFundState {
+	if f.cancelled(order) {
+		return OrderFundStateUnfunded
+	}
+	remaining := order.TakerAssetAmount.Sub(f.filled(order))
+	if remaining.LessThanOrEqual(decimal.Zero) {
+		return OrderFundStateFilled
+	}
+
+	// 剩余部分需要转出的makerAsset和makerFee，makerAsset和makerFee使用同一资产时从同一个账户转出
+	required := map[chain.TokenAccount]decimal.Decimal{}
+	accounts := f.accounts[order.Id]
+	required[accounts[0]] = order.MakerAssetAmount.Mul(remaining).Div(order.TakerAssetAmount).Ceil()
+	if order.MakerFee.GreaterThan(decimal.Zero) {
+		feeAccount := accounts[len(accounts)-1]
+		required[feeAccount] = required[feeAccount].Add(order.MakerFee.Mul(remaining).Div(order.TakerAssetAmount).Ceil())
+	}
+
+	for account, amount := range required {
+		if f.available[account].LessThan(amount) {
+			return OrderFundStateUnfunded
+		}
+	}
+	for account, amount := range required {
+		f.available[account] = f.available[account].Sub(amount)
+	}
+	return OrderFundStateFunded
+}
+
+// 按照orderId的顺序，也就是下单的顺序，为每个maker的订单分配余额，先下的订单先分配
+func sortOrdersById(orders []*models.Order) []*models.Order {
+	sorted := append([]*models.Order(nil), orders...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Id < sorted[j].Id })
+	return sorted
+}
+
+// 根据链上状态检查订单未成交的部分是否仍然可以成交。同一个maker的订单共享maker的余额，
+// 余额只够一部分订单时，先下的订单为funded，之后的订单为unfunded。返回orderId到状态的映射，
+// assetData无法解析的订单不在返回结果中
+func GetOrderFundStates(provider chain.ChainStateProvider, orders []*models.Order) (map[int64]OrderFundState, error) {
+	funds, err := loadOrderFunds(provider, orders)
+	if err != nil {
+		return nil, err
+	}
+
+	states := map[int64]OrderFundState{}
+	for _, order := range sortOrdersById(orders) {
+		if _, found := funds.accounts[order.Id]; found {
+			states[order.Id] = funds.allocate(order)
+		}
+	}
+	return states, nil
+}
+
+// 根据链上状态检查一个订单未成交的部分是否仍然可以成交
+func GetOrderFundState(provider chain.ChainStateProvider, order *models.Order) (OrderFundState, error) {
+	if _, err := getMakerAccounts(order); err != nil {
+		return "", err
+	}
+	states, err := GetOrderFundStates(provider, []*models.Order{order})
+	if err != nil {
+		return "", err
+	}
+	return states[order.Id], nil
+}
+
+// 新订单必须未被取消、未部分成交，且maker的余额和授权在满足之前所有未完成订单之后，还足够完成整个新订单
+func checkOrderFillable(order *models.Order) error {
+	provider := GetChainStateProvider()
+	if provider == nil {
+		return nil
+	}
+
+	if _, err := getMakerAccounts(order); err != nil {
+		return invalidOrder(err.Error())
+	}
+	openOrders, err := getOrderStore().find(order.MakerAddress, makerOpenOrderStatuses)
+	if err != nil {
+		return err
+	}
+	funds, err := loadOrderFunds(provider, append(openOrders, order))
+	if err != nil {
+		return err
+	}
+
+	if funds.cancelled(order) {
+		return invalidOrder(fmt.Sprintf("order %v has been cancelled on chain", order.Hash))
+	}
+	if filled := funds.filled(order); filled.GreaterThan(decimal.Zero) {
+		return invalidOrder(fmt.Sprintf("order %v has been filled %v on chain", order.Hash, filled))
+	}
+
+	for _, openOrder := range sortOrdersById(openOrders) {
+		funds.allocate(openOrder)
+	}
+	if funds.allocate(order) != OrderFundStateFunded {
+		return invalidOrder(fmt.Sprintf("insufficient balance or allowance of maker %v for the order and its %v open orders",
+			order.MakerAddress, len(openOrders)))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/chain"
+	"github.com/zimengpan/go-boomflow/chain/testnode"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const (
+	testToken             = "0xe41d2489571d322189246dafa5ebde1f4699f498"
+	testExchangeAddress   = "0x48bacb9266a570d521063ef5dd96e61686dbe788"
+	testErc20ProxyAddress = "0x1dc4c1cefef38a777b15aa20260a54e584b16c48"
+)
+
+func newTestFundedOrder(provider *chain.MemoryStateProvider) *models.Order {
+	order := &models.Order{
+		Hash:             "0xb01650a8ac36c665b6bee363e83db10787003c89dc2278e05d16de462ba46cd2",
+		MakerAddress:     testMaker1,
+		MakerAssetAmount: decimal.New(100, 0),
+		TakerAssetAmount: decimal.New(200, 0),
+		MakerAssetData:   "0xf47261b0000000000000000000000000" + testToken[2:],
+	}
+	provider.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(100))
+	provider.SetAllowance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(100))
+	return order
+}
+
+// 检查内存中的状态，以及通过JSON-RPC从测试节点读取的状态
+func eachChainStateProvider(t *testing.T,
+	test func(t *testing.T, state *chain.MemoryStateProvider, provider chain.ChainStateProvider)) {
+	t.Run("memory", func(t *testing.T) {
+		state := chain.NewMemoryStateProvider()
+		test(t, state, state)
+	})
+	t.Run("node", func(t *testing.T) {
+		node := testnode.NewNode(1337, testExchangeAddress, testErc20ProxyAddress)
+		url, err := node.Start()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer node.Stop()
+
+		provider, err := chain.NewEthereumStateProvider(url, testExchangeAddress, testErc20ProxyAddress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		test(t, node.State, provider)
+	})
+}
+
+func assertOrderFundState(t *testing.T, provider chain.ChainStateProvider, order *models.Order, expected OrderFundState) {
+	t.Helper()
+
+	state, err := GetOrderFundState(provider, order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != expected {
+		t.Fatalf("order fund state %v, expected %v", state, expected)
+	}
+}
+
+func TestGetOrderFundState(t *testing.T) {
+	eachChainStateProvider(t, func(t *testing.T, state *chain.MemoryStateProvider, provider chain.ChainStateProvider) {
+		order := newTestFundedOrder(state)
+		orderHash := common.HexToHash(order.Hash)
+		assertOrderFundState(t, provider, order, OrderFundStateFunded)
+
+		// 部分成交后只需要剩余部分的资产
+		state.SetFilledAmount(orderHash, big.NewInt(150))
+		state.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(25))
+		assertOrderFundState(t, provider, order, OrderFundStateFunded)
+
+		state.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(24))
+		assertOrderFundState(t, provider, order, OrderFundStateUnfunded)
+
+		// 全部成交的订单不是资金不足，maker的资产已经转出
+		state.SetFilledAmount(orderHash, big.NewInt(200))
+		state.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(0))
+		assertOrderFundState(t, provider, order, OrderFundStateFilled)
+	})
+}
+
+func TestGetOrderFundStateCancelled(t *testing.T) {
+	eachChainStateProvider(t, func(t *testing.T, state *chain.MemoryStateProvider, provider chain.ChainStateProvider) {
+		order := newTestFundedOrder(state)
+		state.SetCancelled(common.HexToHash(order.Hash), true)
+		assertOrderFundState(t, provider, order, OrderFundStateUnfunded)
+	})
+}
+
+// makerFee和makerAsset使用同一资产时，剩余部分的makerAsset和makerFee都从同一余额转出
+func TestGetOrderFundStateMakerFee(t *testing.T) {
+	eachChainStateProvider(t, func(t *testing.T, state *chain.MemoryStateProvider, provider chain.ChainStateProvider) {
+		order := newTestFundedOrder(state)
+		order.MakerFee = decimal.New(10, 0)
+		order.MakerFeeAssetData = order.MakerAssetData
+		state.SetAllowance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(1000))
+		assertOrderFundState(t, provider, order, OrderFundStateUnfunded)
+
+		state.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(110))
+		assertOrderFundState(t, provider, order, OrderFundStateFunded)
+	})
+}
+
+func newTestOpenOrder(orderId int64, hash string) *models.Order {
+	return &models.Order{
+		Id:               orderId,
+		Hash:             hash,
+		MakerAddress:     testMaker1,
+		MakerAssetAmount: decimal.New(100, 0),
+		TakerAssetAmount: decimal.New(200, 0),
+		MakerAssetData:   "0xf47261b0000000000000000000000000" + testToken[2:],
+		Status:           models.OrderStatusOpen,
+	}
+}
+
+// 同一个maker的订单共享余额，余额不够所有订单时先下的订单保留，之后的订单撤销
+func TestGetOrderFundStatesSharedBalance(t *testing.T) {
+	eachChainStateProvider(t, func(t *testing.T, state *chain.MemoryStateProvider, provider chain.ChainStateProvider) {
+		order1 := newTestOpenOrder(1, "0xb01650a8ac36c665b6bee363e83db10787003c89dc2278e05d16de462ba46cd2")
+		order2 := newTestOpenOrder(2, "0x6b6bee363e83db10787003c89dc2278e05d16de462ba46cd2b01650a8ac36c6")
+		state.SetBalance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(150))
+		state.SetAllowance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(1000))
+
+		assertStates := func(expected1, expected2 OrderFundState) {
+			t.Helper()
+			states, err := GetOrderFundStates(provider, []*models.Order{order2, order1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if states[1] != expected1 || states[2] != expected2 {
+				t.Fatalf("order fund states %v, expected %v and %v", states, expected1, expected2)
+			}
+		}
+		assertStates(OrderFundStateFunded, OrderFundStateUnfunded)
+
+		// order1成交一半后只需要50，余额足够两个订单
+		state.SetFilledAmount(common.HexToHash(order1.Hash), big.NewInt(100))
+		assertStates(OrderFundStateFunded, OrderFundStateFunded)
+
+		// 授权不足时按照授权分配
+		state.SetAllowance(common.HexToAddress(testToken), common.HexToAddress(testMaker1), big.NewInt(100))
+		assertStates(OrderFundStateFunded, OrderFundStateUnfunded)
+	})
+}
+
+// 新订单需要的资产加上maker未完成订单需要的资产不能超过maker的余额
+func TestCheckOrderFillableOpenOrders(t *testing.T) {
+	state := chain.NewMemoryStateProvider()
+	SetChainStateProvider(state)
+	defer SetChainStateProvider(nil)
+
+	key, _ := crypto.GenerateKey()
+	maker := crypto.PubkeyToAddress(key.PublicKey)
+	state.SetBalance(common.HexToAddress(testToken), maker, big.NewInt(150))
+	state.SetAllowance(common.HexToAddress(testToken), maker, big.NewInt(1000))
+
+	newOrder := func(hash string, status models.OrderStatus) *models.Order {
+		order := newTestOpenOrder(0, hash)
+		order.MakerAddress = maker.Hex()
+		order.Status = status
+		return order
+	}
+	order := newOrder("0xb01650a8ac36c665b6bee363e83db10787003c89dc2278e05d16de462ba46cd2", models.OrderStatusNew)
+	if err := checkOrderFillable(order); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已经完成的订单不再占用余额
+	err := AddOrder(newOrder("0x6b6bee363e83db10787003c89dc2278e05d16de462ba46cd2b01650a8ac36c6", models.OrderStatusFilled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOrderFillable(order); err != nil {
+		t.Fatal(err)
+	}
+
+	err = AddOrder(newOrder("0x83db10787003c89dc2278e05d16de462ba46cd2b01650a8ac36c66b6bee363e3", models.OrderStatusOpen))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkOrderFillable(order); !IsInvalidOrderError(err) {
+		t.Fatalf("expected invalid order error, got %v", err)
+	}
+
+	state.SetBalance(common.HexToAddress(testToken), maker, big.NewInt(200))
+	if err := checkOrderFillable(order); err != nil {
+		t.Fatal(err)
+	}
+}
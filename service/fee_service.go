@@ -0,0 +1,146 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const (
+	nullAddress = "0x0000000000000000000000000000000000000000"
+)
+
+// 订单需要满足的fee要求，和SRA order_config返回的内容一致
+type OrderFees struct {
+	FeeRecipientAddress string
+	SenderAddress       string
+	MakerFee            decimal.Decimal
+	TakerFee            decimal.Decimal
+	MakerFeeAssetData   string
+	TakerFeeAssetData   string
+}
+
+// maker在该product的累计成交量(quote)，包括作为taker的成交
+func GetMakerVolume(productId string, makerAddress string) (decimal.Decimal, error) {
+	return getVolumeStore().get(productId, makerAddress)
+}
+
+// 结算交易完成后，成交金额(quote)计入maker订单和taker订单的maker的成交量。
+// 两个订单都由用户签名，在0x中都是maker，所以成交量都计入各自地址的maker成交量
+func AddTradeVolume(transaction *models.Transaction) error {
+	if transaction.Type == models.TransactionTypeRebate {
+		return nil
+	}
+
+	volume := transaction.Size.Mul(transaction.Price)
+	for _, orderId := range []int64{transaction.MakerOrderId, transaction.TakerOrderId} {
+		order, err := GetOrderById(orderId)
+		if err != nil {
+			return err
+		}
+		if order == nil {
+			return errors.New(fmt.Sprintf("order not found: %v", orderId))
+		}
+		err = getVolumeStore().add(transaction.ProductId, order.MakerAddress, volume)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 根据maker的成交量，找到适用的费率
+func GetFeeTier(productId string, makerAddress string) (*conf.FeeTier, error) {
+	feeConfig := conf.GetConfig().Fee
+
+	tiers, found := feeConfig.Schedules[productId]
+	if !found {
+		tiers = feeConfig.DefaultSchedule
+	}
+	if len(tiers) == 0 {
+		return &conf.FeeTier{}, nil
+	}
+
+	volume, err := GetMakerVolume(productId, makerAddress)
+	if err != nil {
+		return nil, err
+	}
+	return selectFeeTier(tiers, volume), nil
+}
+
+// 费率表按MinVolume升序排列，取成交量能达到的最高一档
+func selectFeeTier(tiers []conf.FeeTier, volume decimal.Decimal) *conf.FeeTier {
+	tier := tiers[0]
+	for _, t := range tiers {
+		if volume.LessThan(decimal.NewFromFloat(t.MinVolume)) {
+			break
+		}
+		tier = t
+	}
+	return &tier
+}
+
+// 计算订单至少需要支付的fee。结算时relayer作为taker调用batchFillOrders，订单的takerFee由relayer支付，
+// 所以订单的fee都由签名者以makerAsset作为makerFee支付，takerFee为0。
+// post-only订单只会作为maker成交，适用maker费率；其他订单可能作为taker成交，适用taker费率
+func GetOrderFees(product *models.Product, makerAddress string, makerAssetData, takerAssetData string,
+	makerAssetAmount decimal.Decimal, postOnly bool) (*OrderFees, error) {
+	feeConfig := conf.GetConfig().Fee
+	if len(feeConfig.RecipientAddresses) == 0 {
+		return nil, errors.New("no fee recipient address configured")
+	}
+
+	tier, err := GetFeeTier(product.Id, makerAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := tier.TakerFeeRate
+	if postOnly {
+		rate = tier.MakerFeeRate
+	}
+	return &OrderFees{
+		FeeRecipientAddress: feeConfig.RecipientAddresses[0],
+		SenderAddress:       nullAddress,
+		MakerFee:            makerAssetAmount.Mul(decimal.NewFromFloat(rate)).Ceil(),
+		TakerFee:            decimal.Zero,
+		MakerFeeAssetData:   makerAssetData,
+		TakerFeeAssetData:   takerAssetData,
+	}, nil
+}
+
+// 检查订单的fee recipient是否是我们的地址，以及fee是否满足费率表的要求
+func checkOrderFees(product *models.Product, order *models.Order) error {
+	isOurRecipient := false
+	for _, address := range conf.GetConfig().Fee.RecipientAddresses {
+		if strings.EqualFold(address, order.FeeRecipientAddress) {
+			isOurRecipient = true
+			break
+		}
+	}
+	if !isOurRecipient {
+		return invalidOrder(fmt.Sprintf("invalid fee recipient address: %v", order.FeeRecipientAddress))
+	}
+
+	required, err := GetOrderFees(product, order.MakerAddress, order.MakerAssetData, order.TakerAssetData,
+		order.MakerAssetAmount, order.PostOnly)
+	if err != nil {
+		return err
+	}
+
+	if order.MakerFee.LessThan(required.MakerFee) {
+		return invalidOrder(fmt.Sprintf("maker fee %v less than required %v", order.MakerFee, required.MakerFee))
+	}
+	if order.MakerFee.GreaterThan(decimal.Zero) && !strings.EqualFold(order.MakerFeeAssetData, required.MakerFeeAssetData) {
+		return invalidOrder(fmt.Sprintf("maker fee must be paid in %v", required.MakerFeeAssetData))
+	}
+	// takerFee由发送结算交易的relayer支付
+	if !order.TakerFee.IsZero() {
+		return invalidOrder(fmt.Sprintf("taker fee must be 0, the fee is paid as maker fee: %v", order.TakerFee))
+	}
+	return nil
+}
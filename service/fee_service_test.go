@@ -0,0 +1,86 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const testFeeRecipient = "0x173a2467cece1f752eb8416e337d0f0b58cad795"
+
+// 测试使用的配置只有费率表，没有配置redis
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "service")
+	if err != nil {
+		panic(err)
+	}
+	configPath := filepath.Join(dir, "conf.json")
+	err = ioutil.WriteFile(configPath, []byte(`{"fee": {
+		"recipientAddresses": ["`+testFeeRecipient+`"],
+		"defaultSchedule": [{"minVolume": 0, "makerFeeRate": 0.001, "takerFeeRate": 0.003}]
+	}}`), 0644)
+	if err != nil {
+		panic(err)
+	}
+	conf.SetConfigPath(configPath)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newFeeTestOrder(postOnly bool, makerFee, takerFee int64) *models.Order {
+	return &models.Order{
+		MakerAddress:        "0x1d297954f3a6c293ddde068bd462c1d5761de089",
+		FeeRecipientAddress: testFeeRecipient,
+		MakerAssetAmount:    decimal.New(10000, 0),
+		TakerAssetAmount:    decimal.New(20000, 0),
+		MakerAssetData:      "0xa",
+		TakerAssetData:      "0xb",
+		MakerFee:            decimal.New(makerFee, 0),
+		TakerFee:            decimal.New(takerFee, 0),
+		MakerFeeAssetData:   "0xa",
+		TakerFeeAssetData:   "0xb",
+		PostOnly:            postOnly,
+	}
+}
+
+// relayer作为taker调用batchFillOrders，订单的fee都以makerFee支付：post-only订单按maker费率，其他订单按taker费率
+func TestCheckOrderFees(t *testing.T) {
+	product := &models.Product{Id: "1"}
+	tests := []struct {
+		name  string
+		order *models.Order
+		valid bool
+	}{
+		{"post-only pays the maker rate", newFeeTestOrder(true, 10, 0), true},
+		{"post-only below the maker rate", newFeeTestOrder(true, 9, 0), false},
+		{"taking order pays the taker rate", newFeeTestOrder(false, 30, 0), true},
+		{"taking order at the maker rate", newFeeTestOrder(false, 10, 0), false},
+		{"taker fee would be paid by the relayer", newFeeTestOrder(false, 30, 60), false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := checkOrderFees(product, test.order)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && err == nil {
+				t.Fatal("invalid fees accepted")
+			}
+		})
+	}
+
+	fees, err := GetOrderFees(product, testFeeRecipient, "0xa", "0xb", decimal.New(10000, 0), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fees.MakerFee.Equal(decimal.New(30, 0)) || !fees.TakerFee.IsZero() {
+		t.Fatalf("order config fees %v %v, expected 30 0", fees.MakerFee, fees.TakerFee)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis"
+)
+
+// 撮合日志reader处理到的位置，重启后从这个位置之后继续读取。
+// 配置了redis时保存在redis中，没有配置redis时保存在进程的内存中
+type logOffsetStorage interface {
+	// 没有保存过时found为false
+	get(readerId, productId string) (seq, offset int64, found bool, err error)
+
+	save(readerId, productId string, seq, offset int64) error
+}
+
+var sharedLogOffsetStore = struct {
+	sync.Once
+	store logOffsetStorage
+}{}
+
+func getLogOffsetStore() logOffsetStorage {
+	sharedLogOffsetStore.Do(func() {
+		if client := getRedisClient(); client != nil {
+			sharedLogOffsetStore.store = newRedisLogOffsetStore(client)
+			return
+		}
+		sharedLogOffsetStore.store = newMemoryLogOffsetStore()
+	})
+	return sharedLogOffsetStore.store
+}
+
+// 获取reader最后处理的撮合日志的seq和offset
+func GetLogOffset(readerId, productId string) (seq, offset int64, found bool, err error) {
+	return getLogOffsetStore().get(readerId, productId)
+}
+
+func SaveLogOffset(readerId, productId string, seq, offset int64) error {
+	return getLogOffsetStore().save(readerId, productId, seq, offset)
+}
+
+type logOffset struct {
+	seq    int64
+	offset int64
+}
+
+type memoryLogOffsetStore struct {
+	sync.Mutex
+	offsets map[string]logOffset
+}
+
+func newMemoryLogOffsetStore() *memoryLogOffsetStore {
+	return &memoryLogOffsetStore{offsets: map[string]logOffset{}}
+}
+
+func (s *memoryLogOffsetStore) get(readerId, productId string) (int64, int64, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	position, found := s.offsets[readerId+":"+productId]
+	return position.seq, position.offset, found, nil
+}
+
+func (s *memoryLogOffsetStore) save(readerId, productId string, seq, offset int64) error {
+	s.Lock()
+	defer s.Unlock()
+	s.offsets[readerId+":"+productId] = logOffset{seq: seq, offset: offset}
+	return nil
+}
+
+// gbe:log_offset:{readerId}:{productId}，hash，seq和offset为最后处理的撮合日志
+type redisLogOffsetStore struct {
+	client *redis.Client
+}
+
+func newRedisLogOffsetStore(client *redis.Client) *redisLogOffsetStore {
+	return &redisLogOffsetStore{client: client}
+}
+
+func logOffsetKey(readerId, productId string) string {
+	return redisKeyPrefix + "log_offset:" + readerId + ":" + productId
+}
+
+func (s *redisLogOffsetStore) get(readerId, productId string) (int64, int64, bool, error) {
+	values, err := s.client.HMGet(logOffsetKey(readerId, productId), "seq", "offset").Result()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	rawSeq, ok := values[0].(string)
+	if !ok {
+		return 0, 0, false, nil
+	}
+	rawOffset, ok := values[1].(string)
+	if !ok {
+		return 0, 0, false, nil
+	}
+
+	seq, err := strconv.ParseInt(rawSeq, 10, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	offset, err := strconv.ParseInt(rawOffset, 10, 64)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return seq, offset, true, nil
+}
+
+func (s *redisLogOffsetStore) save(readerId, productId string, seq, offset int64) error {
+	return s.client.HMSet(logOffsetKey(readerId, productId), map[string]interface{}{
+		"seq":    seq,
+		"offset": offset,
+	}).Err()
+}
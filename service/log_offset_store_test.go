@@ -0,0 +1,51 @@
+package service
+
+import "testing"
+
+func eachLogOffsetStore(t *testing.T, test func(t *testing.T, store logOffsetStorage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryLogOffsetStore())
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newTestRedisClient(t)
+		test(t, newRedisLogOffsetStore(client))
+	})
+}
+
+func assertLogOffset(t *testing.T, store logOffsetStorage, readerId, productId string, expectedFound bool,
+	expectedSeq, expectedOffset int64) {
+	t.Helper()
+
+	seq, offset, found, err := store.get(readerId, productId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != expectedFound || seq != expectedSeq || offset != expectedOffset {
+		t.Fatalf("log offset %v %v (found %v), expected %v %v (found %v)", seq, offset, found,
+			expectedSeq, expectedOffset, expectedFound)
+	}
+}
+
+// 每个reader在每个product中的位置分别保存
+func TestLogOffsetStore(t *testing.T) {
+	eachLogOffsetStore(t, func(t *testing.T, store logOffsetStorage) {
+		assertLogOffset(t, store, "order_status", "1", false, 0, 0)
+
+		err := store.save("order_status", "1", 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.save("order_status", "2", 3, 7)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.save("order_status", "1", 12, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertLogOffset(t, store, "order_status", "1", true, 12, 2)
+		assertLogOffset(t, store, "order_status", "2", true, 3, 7)
+		assertLogOffset(t, store, "settlement", "1", false, 0, 0)
+	})
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+// 登录nonce的存储，maker在一个api进程获取nonce，可能在另一个api进程登录。
+// 配置了redis时保存在redis中并设置过期时间，没有配置redis时保存在进程的内存中
+type nonceStorage interface {
+	// 保存maker的登录消息并返回，maker已经有未过期的消息时不替换，返回已有的消息。
+	// 获取nonce不需要登录，否则任何人都可以不断替换maker的nonce，使maker签名的消息失效
+	put(makerAddress string, message string, ttl time.Duration) (string, error)
+
+	// 读取maker的登录消息，不存在或者已经过期时返回false
+	get(makerAddress string) (string, bool, error)
+
+	// 签名校验通过后删除maker的登录消息，每条消息只能使用一次，消息已经被删除或者替换时返回false
+	remove(makerAddress string, message string) (bool, error)
+}
+
+var sharedNonceStore = struct {
+	sync.Once
+	store nonceStorage
+}{}
+
+func getNonceStore() nonceStorage {
+	sharedNonceStore.Do(func() {
+		if client := getRedisClient(); client != nil {
+			sharedNonceStore.store = newRedisNonceStore(client)
+			return
+		}
+		sharedNonceStore.store = newMemoryNonceStore()
+	})
+	return sharedNonceStore.store
+}
+
+// makerAddress -> 等待签名的登录nonce
+type memoryNonceStore struct {
+	sync.Mutex
+	nonces map[string]*loginNonce
+}
+
+type loginNonce struct {
+	message   string
+	expiredAt time.Time
+}
+
+func newMemoryNonceStore() *memoryNonceStore {
+	return &memoryNonceStore{nonces: map[string]*loginNonce{}}
+}
+
+func (s *memoryNonceStore) put(makerAddress string, message string, ttl time.Duration) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	now := time.Now()
+	// 顺便清理过期的nonce，否则只获取nonce不登录的maker会一直占用内存
+	for maker, nonce := range s.nonces {
+		if now.After(nonce.expiredAt) {
+			delete(s.nonces, maker)
+		}
+	}
+
+	makerAddress = strings.ToLower(makerAddress)
+	if nonce, found := s.nonces[makerAddress]; found {
+		return nonce.message, nil
+	}
+	s.nonces[makerAddress] = &loginNonce{
+		message:   message,
+		expiredAt: now.Add(ttl),
+	}
+	return message, nil
+}
+
+func (s *memoryNonceStore) get(makerAddress string) (string, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	nonce, found := s.nonces[strings.ToLower(makerAddress)]
+	if !found || time.Now().After(nonce.expiredAt) {
+		return "", false, nil
+	}
+	return nonce.message, true, nil
+}
+
+func (s *memoryNonceStore) remove(makerAddress string, message string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	makerAddress = strings.ToLower(makerAddress)
+	nonce, found := s.nonces[makerAddress]
+	if !found || nonce.message != message {
+		return false, nil
+	}
+	delete(s.nonces, makerAddress)
+	return !time.Now().After(nonce.expiredAt), nil
+}
+
+// gbe:nonce:{maker}，登录消息，过期后由redis删除
+type redisNonceStore struct {
+	client *redis.Client
+}
+
+func newRedisNonceStore(client *redis.Client) *redisNonceStore {
+	return &redisNonceStore{client: client}
+}
+
+func nonceKey(makerAddress string) string {
+	return redisKeyPrefix + "nonce:" + strings.ToLower(makerAddress)
+}
+
+// 只有消息没有被替换时才删除，同一个nonce在多个api进程同时登录时只有一个能删除成功
+var removeNonceScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+return redis.call('DEL', KEYS[1])
+`)
+
+func (s *redisNonceStore) put(makerAddress string, message string, ttl time.Duration) (string, error) {
+	// SET NX和GET在一个事务中执行，返回新保存的或者已有的消息
+	var get *redis.StringCmd
+	_, err := s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SetNX(nonceKey(makerAddress), message, ttl)
+		get = pipe.Get(nonceKey(makerAddress))
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
+
+func (s *redisNonceStore) get(makerAddress string) (string, bool, error) {
+	message, err := s.client.Get(nonceKey(makerAddress)).Result()
+	if err == redis.Nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return message, true, nil
+}
+
+func (s *redisNonceStore) remove(makerAddress string, message string) (bool, error) {
+	removed, err := removeNonceScript.Run(s.client, []string{nonceKey(makerAddress)}, message).Int64()
+	if err != nil {
+		return false, err
+	}
+	return removed == 1, nil
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func eachNonceStore(t *testing.T, test func(t *testing.T, store nonceStorage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryNonceStore())
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newTestRedisClient(t)
+		test(t, newRedisNonceStore(client))
+	})
+}
+
+func putNonce(t *testing.T, store nonceStorage, makerAddress string, message string, ttl time.Duration) string {
+	t.Helper()
+
+	current, err := store.put(makerAddress, message, ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return current
+}
+
+func assertNonce(t *testing.T, store nonceStorage, makerAddress string, expected string) {
+	t.Helper()
+
+	message, found, err := store.get(makerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if found != (len(expected) > 0) || message != expected {
+		t.Fatalf("got nonce %q (found %v), expected %q", message, found, expected)
+	}
+}
+
+func assertNonceRemoved(t *testing.T, store nonceStorage, makerAddress string, message string, expected bool) {
+	t.Helper()
+
+	removed, err := store.remove(makerAddress, message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed != expected {
+		t.Fatalf("removed nonce %q: %v, expected %v", message, removed, expected)
+	}
+}
+
+// 每个nonce只能删除一次，maker地址不区分大小写
+func TestNonceStoreRemove(t *testing.T) {
+	eachNonceStore(t, func(t *testing.T, store nonceStorage) {
+		assertNonce(t, store, testMaker1, "")
+		assertNonceRemoved(t, store, testMaker1, "nonce 1", false)
+
+		putNonce(t, store, testMaker1, "nonce 1", time.Minute)
+		putNonce(t, store, testMaker2, "nonce 2", time.Minute)
+
+		// 读取不删除nonce
+		assertNonce(t, store, strings.ToLower(testMaker1), "nonce 1")
+		assertNonce(t, store, testMaker1, "nonce 1")
+
+		assertNonceRemoved(t, store, testMaker1, "nonce 2", false)
+		assertNonceRemoved(t, store, strings.ToLower(testMaker1), "nonce 1", true)
+		assertNonceRemoved(t, store, testMaker1, "nonce 1", false)
+		assertNonce(t, store, testMaker1, "")
+		assertNonce(t, store, testMaker2, "nonce 2")
+	})
+}
+
+// 未过期的nonce不会被替换，删除后才能生成新的nonce
+func TestNonceStoreKeepsUnexpired(t *testing.T) {
+	eachNonceStore(t, func(t *testing.T, store nonceStorage) {
+		if message := putNonce(t, store, testMaker1, "nonce 1", time.Minute); message != "nonce 1" {
+			t.Fatalf("put nonce %q, expected %q", message, "nonce 1")
+		}
+		if message := putNonce(t, store, testMaker1, "nonce 2", time.Minute); message != "nonce 1" {
+			t.Fatalf("put nonce %q, expected %q", message, "nonce 1")
+		}
+		assertNonce(t, store, testMaker1, "nonce 1")
+
+		assertNonceRemoved(t, store, testMaker1, "nonce 1", true)
+		if message := putNonce(t, store, testMaker1, "nonce 3", time.Minute); message != "nonce 3" {
+			t.Fatalf("put nonce %q, expected %q", message, "nonce 3")
+		}
+	})
+}
+
+func TestMemoryNonceStoreExpire(t *testing.T) {
+	store := newMemoryNonceStore()
+	putNonce(t, store, testMaker1, "nonce 1", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	assertNonce(t, store, testMaker1, "")
+	assertNonceRemoved(t, store, testMaker1, "nonce 1", false)
+
+	putNonce(t, store, testMaker1, "nonce 2", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	// 保存其他maker的nonce时清理过期的nonce
+	putNonce(t, store, testMaker2, "nonce 3", time.Minute)
+	if len(store.nonces) != 1 {
+		t.Fatalf("%v nonces left, expected 1", len(store.nonces))
+	}
+
+	// 过期的nonce可以被替换
+	if message := putNonce(t, store, testMaker1, "nonce 4", time.Minute); message != "nonce 4" {
+		t.Fatalf("put nonce %q, expected %q", message, "nonce 4")
+	}
+}
+
+func TestRedisNonceStoreExpire(t *testing.T) {
+	client, server := newTestRedisClient(t)
+	store := newRedisNonceStore(client)
+
+	putNonce(t, store, testMaker1, "nonce 1", time.Minute)
+	if ttl := server.TTL(nonceKey(testMaker1)); ttl != time.Minute {
+		t.Fatalf("nonce ttl %v, expected %v", ttl, time.Minute)
+	}
+
+	server.FastForward(time.Minute)
+	assertNonce(t, store, testMaker1, "")
+	assertNonceRemoved(t, store, testMaker1, "nonce 1", false)
+	if message := putNonce(t, store, testMaker1, "nonce 2", time.Minute); message != "nonce 2" {
+		t.Fatalf("put nonce %q, expected %q", message, "nonce 2")
+	}
+}
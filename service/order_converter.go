@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	// 价格的计算精度，与decimal(32,16)保持一致
+	priceScale = 16
+)
+
+// 根据maker卖出的资产判断订单方向：maker卖出base为卖单，maker卖出quote为买单
+func getOrderSide(makerAssetData string, baseAsset, quoteAsset *models.Asset) (models.Side, error) {
+	switch makerAssetData {
+	case baseAsset.AssetData:
+		return models.SideSell, nil
+	case quoteAsset.AssetData:
+		return models.SideBuy, nil
+	default:
+		return "", invalidOrder(fmt.Sprintf("maker asset %v is neither %v nor %v",
+			makerAssetData, baseAsset.Currency, quoteAsset.Currency))
+	}
+}
+
+// 将0x订单中以最小单位表示的资产数量，换算为orderBook使用的base数量(Size)、quote数量(Funds)和quote/base价格(Price)
+func normalizeOrder(order *models.Order, baseAsset, quoteAsset *models.Asset) error {
+	for _, amount := range []decimal.Decimal{order.MakerAssetAmount, order.TakerAssetAmount} {
+		if amount.LessThanOrEqual(decimal.Zero) || !amount.Equal(amount.Truncate(0)) {
+			return invalidOrder(fmt.Sprintf("asset amount %v must be a positive integer", amount))
+		}
+	}
+
+	baseAmount, quoteAmount := order.TakerAssetAmount, order.MakerAssetAmount
+	if order.Side == models.SideSell {
+		baseAmount, quoteAmount = order.MakerAssetAmount, order.TakerAssetAmount
+	}
+
+	order.Size = baseAmount.Shift(-baseAsset.Decimals)
+	order.Funds = quoteAmount.Shift(-quoteAsset.Decimals)
+	order.Price = order.Funds.DivRound(order.Size, priceScale)
+	return nil
+}
+
+// 计算订单的0x hash，如果客户端提供了hash，必须与计算结果一致
+func hashOrder(order *models.Order, expectedHash string) error {
+	zeroExOrder, err := zeroex.NewOrder(order)
+	if err != nil {
+		return invalidOrder(err.Error())
+	}
+
+	ethereumConfig := conf.GetConfig().Ethereum
+	order.Hash = zeroExOrder.Hash(ethereumConfig.ChainId, common.HexToAddress(ethereumConfig.ExchangeAddress)).Hex()
+	if len(expectedHash) > 0 && !strings.EqualFold(expectedHash, order.Hash) {
+		return invalidOrder(fmt.Sprintf("order hash mismatch: expected %v, got %v", order.Hash, expectedHash))
+	}
+	return nil
+}
+
+// 订单必须由maker签名，结算时交易所合约会再次校验签名，这里提前拒绝无法结算的订单
+func verifyOrderSignature(order *models.Order) error {
+	signer, err := zeroex.RecoverOrderSigner(common.HexToHash(order.Hash), order.Signature)
+	if err != nil {
+		return invalidOrder(fmt.Sprintf("invalid signature of order %v: %v", order.Hash, err))
+	}
+	if !strings.EqualFold(signer.Hex(), order.MakerAddress) {
+		return invalidOrder(fmt.Sprintf("order %v is signed by %v, not by maker %v",
+			order.Hash, signer.Hex(), order.MakerAddress))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+func newSignatureTestOrder(t *testing.T, key *ecdsa.PrivateKey) *models.Order {
+	order := &models.Order{
+		MakerAddress:          crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		TakerAddress:          nullAddress,
+		FeeRecipientAddress:   nullAddress,
+		SenderAddress:         nullAddress,
+		MakerAssetAmount:      decimal.New(100, 0),
+		TakerAssetAmount:      decimal.New(200, 0),
+		MakerFee:              decimal.Zero,
+		TakerFee:              decimal.Zero,
+		ExpirationTimeSeconds: decimal.New(1600000000, 0),
+		Salt:                  decimal.New(1, 0),
+		MakerAssetData:        "0xf47261b0000000000000000000000000" + testToken[2:],
+		TakerAssetData:        "0xf47261b0000000000000000000000000" + testExchangeAddress[2:],
+	}
+	if err := hashOrder(order, ""); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// 按照钱包的格式签名：v, r, s，最后是签名类型
+func signTestOrder(t *testing.T, order *models.Order, key *ecdsa.PrivateKey, signatureType byte) {
+	hash := common.HexToHash(order.Hash).Bytes()
+	if signatureType == zeroex.SignatureTypeEthSign {
+		hash = crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n32"), hash)
+	}
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := append([]byte{sig[64] + 27}, sig[:64]...)
+	order.Signature = hexutil.Encode(append(signature, signatureType))
+}
+
+func TestVerifyOrderSignature(t *testing.T) {
+	makerKey, _ := crypto.GenerateKey()
+	otherKey, _ := crypto.GenerateKey()
+
+	tests := []struct {
+		name          string
+		key           *ecdsa.PrivateKey
+		signatureType byte
+		valid         bool
+	}{
+		{"eip712", makerKey, zeroex.SignatureTypeEIP712, true},
+		{"eth sign", makerKey, zeroex.SignatureTypeEthSign, true},
+		{"not signed by maker", otherKey, zeroex.SignatureTypeEIP712, false},
+		// wallet签名需要调用合约校验，不支持
+		{"wallet signature", makerKey, 0x04, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order := newSignatureTestOrder(t, makerKey)
+			signTestOrder(t, order, test.key, test.signatureType)
+
+			err := verifyOrderSignature(order)
+			if test.valid && err != nil {
+				t.Fatal(err)
+			}
+			if !test.valid && !IsInvalidOrderError(err) {
+				t.Fatalf("expected invalid order error, got %v", err)
+			}
+		})
+	}
+
+	t.Run("signed order changed", func(t *testing.T) {
+		order := newSignatureTestOrder(t, makerKey)
+		signTestOrder(t, order, makerKey, zeroex.SignatureTypeEIP712)
+		order.TakerAssetAmount = decimal.New(100, 0)
+		if err := hashOrder(order, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := verifyOrderSignature(order); !IsInvalidOrderError(err) {
+			t.Fatalf("expected invalid order error, got %v", err)
+		}
+	})
+
+	t.Run("malformed signature", func(t *testing.T) {
+		order := newSignatureTestOrder(t, makerKey)
+		order.Signature = "0x1234"
+		if err := verifyOrderSignature(order); !IsInvalidOrderError(err) {
+			t.Fatalf("expected invalid order error, got %v", err)
+		}
+	})
+}
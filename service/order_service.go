@@ -1,299 +1,442 @@
-package service
-
-import (
-	"errors"
-	"fmt"
-	"time"
-
-	"github.com/shopspring/decimal"
-	"github.com/zimengpan/go-boomflow/models"
-)
-
-var n, _ = decimal.NewFromString("10000000000000000")
-
-var mockOrderDB1 = map[string]*models.Order{
-	"1": &models.Order{
-		1,
-		time.Date(2019, time.November, 10, 23, 0, 0, 0, time.UTC),
-		time.Date(2019, time.November, 10, 23, 0, 0, 0, time.UTC),
-		"0x9e56625509c2f60af937f23b7b532600390e8c8b",
-		"TakerAddress          string",
-		"FeeRecipientAddress   string",
-		"SenderAddress         string",
-		n,
-		n,
-		n,
-		n,
-		n,
-		1,
-		models.SideSell,
-		"1",
-		"0x02571792000000000000000000000000371b13d97f4bf77d724e78c16b7dc74099f40e840000000000000000000000000000000000000000000000000000000000000063",
-		"0xf47261b0000000000000000000000000e41d2489571d322189246dafa5ebde1f4699f498",
-		"0x012761a3ed31b43c8780e905a260a35faefcc527be7516aa11c0256729b5b351bc33",
-		models.OrderStatusNew,
-		false,
-	},
-}
-
-var mockOrderDB2 = map[string][]*models.Order{
-	"0x9e56625509c2f60af937f23b7b532600390e8c8b": []*models.Order{
-		&models.Order{
-			1,
-			time.Date(2019, time.November, 10, 23, 0, 0, 0, time.UTC),
-			time.Date(2019, time.November, 10, 23, 0, 0, 0, time.UTC),
-			"0x9e56625509c2f60af937f23b7b532600390e8c8b",
-			"TakerAddress          string",
-			"FeeRecipientAddress   string",
-			"SenderAddress         string",
-			n,
-			n,
-			n,
-			n,
-			n,
-			1,
-			models.SideSell,
-			"1",
-			"0x02571792000000000000000000000000371b13d97f4bf77d724e78c16b7dc74099f40e840000000000000000000000000000000000000000000000000000000000000063",
-			"0xf47261b0000000000000000000000000e41d2489571d322189246dafa5ebde1f4699f498",
-			"0x012761a3ed31b43c8780e905a260a35faefcc527be7516aa11c0256729b5b351bc33",
-			models.OrderStatusNew,
-			false,
-		},
-	},
-}
-
-func PlaceOrder(
-	makerAddress string,
-	takerAddress string,
-	feeRecipientAddress string,
-	senderAddress string,
-	makerAssetAmount decimal.Decimal,
-	takerAssetAmount decimal.Decimal,
-	makerFee decimal.Decimal,
-	takerFee decimal.Decimal,
-	expirationTimeSeconds decimal.Decimal,
-	salt int64,
-	makerAssetData string,
-	takerAssetData string,
-	makerFeeAssetData string,
-	takerFeeAssetData string,
-	signature string,
-) (*models.Order, error) {
-	product, err := GetProductByAssetPair(makerAssetData, takerAssetData)
-	if err != nil {
-		return nil, err
-	}
-	if product == nil {
-		return nil, errors.New(fmt.Sprintf("product not found: %v - %v", makerAssetData, takerAssetData))
-	}
-
-	baseAsset, err := GetAssetByCurrency(product.BaseCurrency)
-	if err != nil {
-		return nil, err
-	}
-	if baseAsset == nil {
-		return nil, errors.New(fmt.Sprintf("asset not found: %v - %v", makerAssetData, takerAssetData))
-	}
-
-	side := models.SideBuy
-	if baseAsset.AssetData == takerAssetData {
-		side = models.SideSell
-	}
-
-	order := &models.Order{
-		MakerAddress:          makerAddress,
-		TakerAddress:          takerAddress,
-		FeeRecipientAddress:   feeRecipientAddress,
-		SenderAddress:         senderAddress,
-		MakerAssetAmount:      makerAssetAmount,
-		TakerAssetAmount:      takerAssetAmount,
-		MakerFee:              makerFee,
-		TakerFee:              takerFee,
-		ExpirationTimeSeconds: expirationTimeSeconds,
-		Salt:                  salt,
-		Side:                  side,
-		ProductId:             product.Id,
-		MakerFeeAssetData:     makerFeeAssetData,
-		TakerFeeAssetData:     takerFeeAssetData,
-		Signature:             signature,
-		Status:                models.OrderStatusNew,
-	}
-	return order, nil
-	// tx
-	/*
-		var holdCurrency string
-		var holdSize decimal.Decimal
-
-		db, err := mysql.SharedStore().BeginTx()
-		if err != nil {
-			return nil, err
-		}
-		defer func() { _ = db.Rollback() }()
-
-		err = HoldBalance(db, userId, holdCurrency, holdSize, models.BillTypeTrade)
-		if err != nil {
-			return nil, err
-		}
-
-		err = db.AddOrder(order)
-		if err != nil {
-			return nil, err
-		}
-
-		return order, db.CommitTx()*/
-}
-
-/*func UpdateOrderStatus(orderId int64, oldStatus, newStatus models.OrderStatus) (bool, error) {
-	return mysql.SharedStore().UpdateOrderStatus(orderId, oldStatus, newStatus)
-}
-
-func ExecuteFill(orderId int64) error {
-	// tx
-	db, err := mysql.SharedStore().BeginTx()
-	if err != nil {
-		return err
-	}
-	defer func() { _ = db.Rollback() }()
-
-	order, err := db.GetOrderByIdForUpdate(orderId)
-	if err != nil {
-		return err
-	}
-	if order == nil {
-		return fmt.Errorf("order not found: %v", orderId)
-	}
-	if order.Status == models.OrderStatusFilled || order.Status == models.OrderStatusCancelled {
-		return fmt.Errorf("order status invalid: %v %v", orderId, order.Status)
-	}
-
-	product, err := GetProductById(order.ProductId)
-	if err != nil {
-		return err
-	}
-	if product == nil {
-		return fmt.Errorf("product not found: %v", order.ProductId)
-	}
-
-	fills, err := mysql.SharedStore().GetUnsettledFillsByOrderId(orderId)
-	if err != nil {
-		return err
-	}
-	if len(fills) == 0 {
-		return nil
-	}
-
-	var bills []*models.Bill
-	for _, fill := range fills {
-		fill.Settled = true
-
-		notes := fmt.Sprintf("%v-%v", fill.OrderId, fill.Id)
-
-		if !fill.Done {
-			executedValue := fill.Size.Mul(fill.Price)
-			order.ExecutedValue = order.ExecutedValue.Add(executedValue)
-			order.FilledSize = order.FilledSize.Add(fill.Size)
-
-			if order.Side == models.SideBuy {
-				// 买单，incr base
-				bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, fill.Size, decimal.Zero,
-					models.BillTypeTrade, notes)
-				if err != nil {
-					return err
-				}
-				bills = append(bills, bill)
-
-				// 买单，decr quote
-				bill, err = AddDelayBill(db, order.UserId, product.QuoteCurrency, decimal.Zero, executedValue.Neg(),
-					models.BillTypeTrade, notes)
-				if err != nil {
-					return err
-				}
-				bills = append(bills, bill)
-
-			} else {
-				// 卖单，decr base
-				bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, decimal.Zero, fill.Size.Neg(),
-					models.BillTypeTrade, notes)
-				if err != nil {
-					return err
-				}
-				bills = append(bills, bill)
-
-				// 卖单，incr quote
-				bill, err = AddDelayBill(db, order.UserId, product.QuoteCurrency, executedValue, decimal.Zero,
-					models.BillTypeTrade, notes)
-				if err != nil {
-					return err
-				}
-				bills = append(bills, bill)
-			}
-
-		} else {
-			if fill.DoneReason == models.DoneReasonCancelled {
-				order.Status = models.OrderStatusCancelled
-			} else if fill.DoneReason == models.DoneReasonFilled {
-				order.Status = models.OrderStatusFilled
-			} else {
-				log.Fatalf("unknown done reason: %v", fill.DoneReason)
-			}
-
-			if order.Side == models.SideBuy {
-				// 如果是是买单，需要解冻剩余的funds
-				remainingFunds := order.Funds.Sub(order.ExecutedValue)
-				if remainingFunds.GreaterThan(decimal.Zero) {
-					bill, err := AddDelayBill(db, order.UserId, product.QuoteCurrency, remainingFunds, remainingFunds.Neg(),
-						models.BillTypeTrade, notes)
-					if err != nil {
-						return err
-					}
-					bills = append(bills, bill)
-				}
-
-			} else {
-				// 如果是卖单，解冻剩余的size
-				remainingSize := order.Size.Sub(order.FilledSize)
-				if remainingSize.GreaterThan(decimal.Zero) {
-					bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, remainingSize, remainingSize.Neg(),
-						models.BillTypeTrade, notes)
-					if err != nil {
-						return err
-					}
-					bills = append(bills, bill)
-				}
-			}
-
-			break
-		}
-	}
-
-	err = db.UpdateOrder(order)
-	if err != nil {
-		return err
-	}
-
-	for _, fill := range fills {
-		err = db.UpdateFill(fill)
-		if err != nil {
-			return err
-		}
-	}
-
-	return db.CommitTx()
-}
-*/
-/*func GetOrderById(orderId int64) (*models.Order, error) {
-	return mysql.SharedStore().GetOrderById(orderId)
-}
-*/
-/*
-func GetOrderByClientOid(userId int64, clientOid string) (*models.Order, error) {
-	return mysql.SharedStore().GetOrderByClientOid(userId, clientOid)
-}
-*/
-func GetOrdersByUserId(makerAddress string, statuses []models.OrderStatus, side *models.Side, productId string,
-	beforeId, afterId int64, limit int) ([]*models.Order, error) {
-	//TODO: Implementation
-	return mockOrderDB2[makerAddress], nil
-	//return mysql.SharedStore().GetOrdersByUserId(userId, statuses, side, productId, beforeId, afterId, limit)
-}
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/utils"
+)
+
+// 订单本身不合法的错误，与读取存储或者链上状态失败等内部错误区分开，REST对前者返回400
+type InvalidOrderError struct {
+	message string
+}
+
+func (e *InvalidOrderError) Error() string {
+	return e.message
+}
+
+func invalidOrder(message string) error {
+	return &InvalidOrderError{message: message}
+}
+
+func IsInvalidOrderError(err error) bool {
+	_, ok := err.(*InvalidOrderError)
+	return ok
+}
+
+// 校验订单的参数、hash、maker签名、product的价格数量限制、fee以及maker在链上的余额和授权，
+// 全部通过后保存为new状态的订单
+func PlaceOrder(
+	makerAddress string,
+	takerAddress string,
+	feeRecipientAddress string,
+	senderAddress string,
+	makerAssetAmount decimal.Decimal,
+	takerAssetAmount decimal.Decimal,
+	makerFee decimal.Decimal,
+	takerFee decimal.Decimal,
+	expirationTimeSeconds decimal.Decimal,
+	salt decimal.Decimal,
+	makerAssetData string,
+	takerAssetData string,
+	makerFeeAssetData string,
+	takerFeeAssetData string,
+	signature string,
+	hash string,
+	orderType models.OrderType,
+	maxSlippage decimal.Decimal,
+	stopPrice decimal.Decimal,
+	displaySize decimal.Decimal,
+	timeInForce models.TimeInForce,
+	postOnly bool,
+	postOnlyReprice bool,
+) (*models.Order, error) {
+	isStop := orderType == models.OrderTypeStop || orderType == models.OrderTypeStopLimit
+	if isStop && stopPrice.LessThanOrEqual(decimal.Zero) {
+		return nil, invalidOrder(fmt.Sprintf("invalid stop price: %v", stopPrice))
+	}
+	if !isStop && !stopPrice.IsZero() {
+		return nil, invalidOrder(fmt.Sprintf("stop price is only allowed for %v and %v orders",
+			models.OrderTypeStop, models.OrderTypeStopLimit))
+	}
+
+	if displaySize.LessThan(decimal.Zero) {
+		return nil, invalidOrder(fmt.Sprintf("invalid display size: %v", displaySize))
+	}
+	if displaySize.GreaterThan(decimal.Zero) && orderType != models.OrderTypeLimit && orderType != models.OrderTypeStopLimit {
+		return nil, invalidOrder(fmt.Sprintf("display size is only allowed for %v and %v orders",
+			models.OrderTypeLimit, models.OrderTypeStopLimit))
+	}
+
+	if orderType == models.OrderTypeMarket || orderType == models.OrderTypeStop {
+		if postOnly {
+			return nil, invalidOrder(fmt.Sprintf("%v order can not be post-only", orderType))
+		}
+		if maxSlippage.LessThan(decimal.Zero) || maxSlippage.GreaterThanOrEqual(decimal.New(1, 0)) {
+			return nil, invalidOrder(fmt.Sprintf("invalid max slippage: %v", maxSlippage))
+		}
+		// market orders never rest on the book
+		timeInForce = models.TimeInForceIOC
+	}
+	if postOnly && timeInForce != models.TimeInForceGTC && timeInForce != models.TimeInForceGTT {
+		return nil, invalidOrder(fmt.Sprintf("post-only order must be %v or %v, got %v",
+			models.TimeInForceGTC, models.TimeInForceGTT, timeInForce))
+	}
+	if timeInForce == models.TimeInForceGTT && expirationTimeSeconds.IntPart() <= time.Now().Unix() {
+		return nil, invalidOrder(fmt.Sprintf("GTT order already expired at %v", expirationTimeSeconds))
+	}
+
+	product, err := GetProductByAssetPair(makerAssetData, takerAssetData)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, invalidOrder(fmt.Sprintf("product not found: %v - %v", makerAssetData, takerAssetData))
+	}
+
+	baseAsset, err := GetAssetByCurrency(product.BaseCurrency)
+	if err != nil {
+		return nil, err
+	}
+	quoteAsset, err := GetAssetByCurrency(product.QuoteCurrency)
+	if err != nil {
+		return nil, err
+	}
+	if baseAsset == nil || quoteAsset == nil {
+		return nil, errors.New(fmt.Sprintf("asset not found: %v - %v", makerAssetData, takerAssetData))
+	}
+
+	side, err := getOrderSide(makerAssetData, baseAsset, quoteAsset)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		CreatedAt:             time.Now(),
+		MakerAddress:          makerAddress,
+		TakerAddress:          takerAddress,
+		FeeRecipientAddress:   feeRecipientAddress,
+		SenderAddress:         senderAddress,
+		MakerAssetAmount:      makerAssetAmount,
+		TakerAssetAmount:      takerAssetAmount,
+		MakerFee:              makerFee,
+		TakerFee:              takerFee,
+		ExpirationTimeSeconds: expirationTimeSeconds,
+		Salt:                  salt,
+		Side:                  side,
+		Type:                  orderType,
+		ProductId:             product.Id,
+		MakerAssetData:        makerAssetData,
+		TakerAssetData:        takerAssetData,
+		MakerFeeAssetData:     makerFeeAssetData,
+		TakerFeeAssetData:     takerFeeAssetData,
+		Signature:             signature,
+		Status:                models.OrderStatusNew,
+		TimeInForce:           timeInForce,
+		PostOnly:              postOnly,
+		PostOnlyReprice:       postOnlyReprice,
+		MaxSlippage:           maxSlippage,
+		StopPrice:             stopPrice,
+		DisplaySize:           displaySize,
+	}
+
+	err = hashOrder(order, hash)
+	if err != nil {
+		return nil, err
+	}
+	err = verifyOrderSignature(order)
+	if err != nil {
+		return nil, err
+	}
+	err = normalizeOrder(order, baseAsset, quoteAsset)
+	if err != nil {
+		return nil, err
+	}
+	err = checkProductLimits(product, order)
+	if err != nil {
+		return nil, err
+	}
+	err = checkOrderFees(product, order)
+	if err != nil {
+		return nil, err
+	}
+	err = checkOrderFillable(order)
+	if err != nil {
+		return nil, err
+	}
+
+	err = AddOrder(order)
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+	// tx
+	/*
+		var holdCurrency string
+		var holdSize decimal.Decimal
+
+		db, err := mysql.SharedStore().BeginTx()
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = db.Rollback() }()
+
+		err = HoldBalance(db, userId, holdCurrency, holdSize, models.BillTypeTrade)
+		if err != nil {
+			return nil, err
+		}
+
+		err = db.AddOrder(order)
+		if err != nil {
+			return nil, err
+		}
+
+		return order, db.CommitTx()*/
+}
+
+// 检查订单的价格和数量是否符合product的限制
+func checkProductLimits(product *models.Product, order *models.Order) error {
+	if !product.PriceIncrement.IsZero() {
+		if order.Type != models.OrderTypeMarket && order.Type != models.OrderTypeStop &&
+			!utils.DecimalIsMultipleOf(order.Price, product.PriceIncrement) {
+			return invalidOrder(fmt.Sprintf("price %v is not a multiple of price increment %v",
+				order.Price, product.PriceIncrement))
+		}
+		if !utils.DecimalIsMultipleOf(order.StopPrice, product.PriceIncrement) {
+			return invalidOrder(fmt.Sprintf("stop price %v is not a multiple of price increment %v",
+				order.StopPrice, product.PriceIncrement))
+		}
+	}
+
+	// 市价买单按照资金下单，只检查最小成交额
+	if (order.Type == models.OrderTypeMarket || order.Type == models.OrderTypeStop) && order.Side == models.SideBuy {
+		if order.Funds.LessThan(product.MinNotional) {
+			return invalidOrder(fmt.Sprintf("funds %v less than min notional %v", order.Funds, product.MinNotional))
+		}
+		return nil
+	}
+
+	for _, size := range []decimal.Decimal{order.Size, order.DisplaySize} {
+		if !product.SizeIncrement.IsZero() && !utils.DecimalIsMultipleOf(size, product.SizeIncrement) {
+			return invalidOrder(fmt.Sprintf("size %v is not a multiple of size increment %v", size, product.SizeIncrement))
+		}
+	}
+	if order.Size.LessThan(product.MinSize) {
+		return invalidOrder(fmt.Sprintf("size %v less than min size %v", order.Size, product.MinSize))
+	}
+	if !product.MaxSize.IsZero() && order.Size.GreaterThan(product.MaxSize) {
+		return invalidOrder(fmt.Sprintf("size %v greater than max size %v", order.Size, product.MaxSize))
+	}
+	if order.DisplaySize.GreaterThan(decimal.Zero) && order.DisplaySize.LessThan(product.MinSize) {
+		return invalidOrder(fmt.Sprintf("display size %v less than min size %v", order.DisplaySize, product.MinSize))
+	}
+	if order.Type == models.OrderTypeLimit || order.Type == models.OrderTypeStopLimit {
+		notional := order.Size.Mul(order.Price)
+		if notional.LessThan(product.MinNotional) {
+			return invalidOrder(fmt.Sprintf("notional %v less than min notional %v", notional, product.MinNotional))
+		}
+	}
+	return nil
+}
+
+func AddOrder(order *models.Order) error {
+	orderId, err := getOrderStore().nextId()
+	if err != nil {
+		return err
+	}
+
+	order.Id = orderId
+	order.UpdatedAt = order.CreatedAt
+	return getOrderStore().add(order)
+}
+
+// 只有订单当前状态为oldStatus时才更新为newStatus，返回是否更新成功
+func UpdateOrderStatus(orderId int64, oldStatus, newStatus models.OrderStatus) (bool, error) {
+	return getOrderStore().updateStatus(orderId, oldStatus, newStatus)
+}
+
+/*func ExecuteFill(orderId int64) error {
+	// tx
+	db, err := mysql.SharedStore().BeginTx()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = db.Rollback() }()
+
+	order, err := db.GetOrderByIdForUpdate(orderId)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return fmt.Errorf("order not found: %v", orderId)
+	}
+	if order.Status == models.OrderStatusFilled || order.Status == models.OrderStatusCancelled {
+		return fmt.Errorf("order status invalid: %v %v", orderId, order.Status)
+	}
+
+	product, err := GetProductById(order.ProductId)
+	if err != nil {
+		return err
+	}
+	if product == nil {
+		return fmt.Errorf("product not found: %v", order.ProductId)
+	}
+
+	fills, err := mysql.SharedStore().GetUnsettledFillsByOrderId(orderId)
+	if err != nil {
+		return err
+	}
+	if len(fills) == 0 {
+		return nil
+	}
+
+	var bills []*models.Bill
+	for _, fill := range fills {
+		fill.Settled = true
+
+		notes := fmt.Sprintf("%v-%v", fill.OrderId, fill.Id)
+
+		if !fill.Done {
+			executedValue := fill.Size.Mul(fill.Price)
+			order.ExecutedValue = order.ExecutedValue.Add(executedValue)
+			order.FilledSize = order.FilledSize.Add(fill.Size)
+
+			if order.Side == models.SideBuy {
+				// 买单，incr base
+				bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, fill.Size, decimal.Zero,
+					models.BillTypeTrade, notes)
+				if err != nil {
+					return err
+				}
+				bills = append(bills, bill)
+
+				// 买单，decr quote
+				bill, err = AddDelayBill(db, order.UserId, product.QuoteCurrency, decimal.Zero, executedValue.Neg(),
+					models.BillTypeTrade, notes)
+				if err != nil {
+					return err
+				}
+				bills = append(bills, bill)
+
+			} else {
+				// 卖单，decr base
+				bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, decimal.Zero, fill.Size.Neg(),
+					models.BillTypeTrade, notes)
+				if err != nil {
+					return err
+				}
+				bills = append(bills, bill)
+
+				// 卖单，incr quote
+				bill, err = AddDelayBill(db, order.UserId, product.QuoteCurrency, executedValue, decimal.Zero,
+					models.BillTypeTrade, notes)
+				if err != nil {
+					return err
+				}
+				bills = append(bills, bill)
+			}
+
+		} else {
+			if fill.DoneReason == models.DoneReasonCancelled {
+				order.Status = models.OrderStatusCancelled
+			} else if fill.DoneReason == models.DoneReasonFilled {
+				order.Status = models.OrderStatusFilled
+			} else {
+				log.Fatalf("unknown done reason: %v", fill.DoneReason)
+			}
+
+			if order.Side == models.SideBuy {
+				// 如果是是买单，需要解冻剩余的funds
+				remainingFunds := order.Funds.Sub(order.ExecutedValue)
+				if remainingFunds.GreaterThan(decimal.Zero) {
+					bill, err := AddDelayBill(db, order.UserId, product.QuoteCurrency, remainingFunds, remainingFunds.Neg(),
+						models.BillTypeTrade, notes)
+					if err != nil {
+						return err
+					}
+					bills = append(bills, bill)
+				}
+
+			} else {
+				// 如果是卖单，解冻剩余的size
+				remainingSize := order.Size.Sub(order.FilledSize)
+				if remainingSize.GreaterThan(decimal.Zero) {
+					bill, err := AddDelayBill(db, order.UserId, product.BaseCurrency, remainingSize, remainingSize.Neg(),
+						models.BillTypeTrade, notes)
+					if err != nil {
+						return err
+					}
+					bills = append(bills, bill)
+				}
+			}
+
+			break
+		}
+	}
+
+	err = db.UpdateOrder(order)
+	if err != nil {
+		return err
+	}
+
+	for _, fill := range fills {
+		err = db.UpdateFill(fill)
+		if err != nil {
+			return err
+		}
+	}
+
+	return db.CommitTx()
+}
+*/
+
+func GetOrderById(orderId int64) (*models.Order, error) {
+	return getOrderStore().get(orderId)
+}
+
+/*
+func GetOrderByClientOid(userId int64, clientOid string) (*models.Order, error) {
+	return mysql.SharedStore().GetOrderByClientOid(userId, clientOid)
+}
+*/
+
+func GetOrdersByUserId(makerAddress string, statuses []models.OrderStatus, side *models.Side, productId string,
+	beforeId, afterId int64, limit int) ([]*models.Order, error) {
+	found, err := getOrderStore().find(makerAddress, statuses)
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*models.Order
+	for _, order := range found {
+		if (side != nil && order.Side != *side) ||
+			(len(productId) > 0 && order.ProductId != productId) ||
+			(beforeId > 0 && order.Id <= beforeId) ||
+			(afterId > 0 && order.Id >= afterId) {
+			continue
+		}
+		orders = append(orders, order)
+	}
+
+	// 与数据库查询一致，按照orderId倒序
+	sort.Slice(orders, func(i, j int) bool { return orders[i].Id > orders[j].Id })
+	if limit > 0 && len(orders) > limit {
+		orders = orders[:limit]
+	}
+	return orders, nil
+	//return mysql.SharedStore().GetOrdersByUserId(userId, statuses, side, productId, beforeId, afterId, limit)
+}
+
+func containsOrderStatus(statuses []models.OrderStatus, status models.OrderStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
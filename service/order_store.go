@@ -0,0 +1,319 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// 订单的存储。配置了redis时订单保存在redis中，engine，api和watcher在不同的进程中看到相同的订单；
+// 没有配置redis时保存在进程的内存中
+type orderStorage interface {
+	// 分配一个新的orderId，orderBook按照orderId识别订单，orderId在所有进程中和重启前后都不能重复
+	nextId() (int64, error)
+
+	add(order *models.Order) error
+
+	// 订单不存在时返回nil
+	get(orderId int64) (*models.Order, error)
+
+	// 只有订单当前状态为oldStatus时才更新为newStatus，返回是否更新成功
+	updateStatus(orderId int64, oldStatus, newStatus models.OrderStatus) (bool, error)
+
+	// 按照maker或者状态查找订单，maker为空时不限制maker，statuses为空时不限制状态，返回的订单没有排序
+	find(makerAddress string, statuses []models.OrderStatus) ([]*models.Order, error)
+}
+
+var sharedOrderStore = struct {
+	sync.Once
+	store orderStorage
+}{}
+
+func getOrderStore() orderStorage {
+	sharedOrderStore.Do(func() {
+		if client := getRedisClient(); client != nil {
+			sharedOrderStore.store = newRedisOrderStore(client)
+			return
+		}
+		sharedOrderStore.store = newMemoryOrderStore()
+	})
+	return sharedOrderStore.store
+}
+
+// 当前时间的微秒数，每秒分配的orderId少于一百万个时，新分配的orderId总是大于之前分配的
+func orderIdSeed() int64 {
+	return time.Now().UnixNano() / int64(time.Microsecond)
+}
+
+// 保存在进程内存中的订单，只能用于单进程的开发环境。
+// 保存和返回的都是订单的副本，与redis实现一样，调用方修改订单不会影响保存的订单
+type memoryOrderStore struct {
+	sync.RWMutex
+	seq    int64
+	orders map[int64]*models.Order
+}
+
+func newMemoryOrderStore() *memoryOrderStore {
+	// orderId从当前时间开始自增，进程重启后不会与orderBook中已有的订单重复
+	return &memoryOrderStore{
+		seq:    orderIdSeed(),
+		orders: map[int64]*models.Order{},
+	}
+}
+
+func copyOrder(order *models.Order) *models.Order {
+	orderCopy := *order
+	return &orderCopy
+}
+
+func (s *memoryOrderStore) nextId() (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.seq++
+	return s.seq, nil
+}
+
+func (s *memoryOrderStore) add(order *models.Order) error {
+	s.Lock()
+	defer s.Unlock()
+	s.orders[order.Id] = copyOrder(order)
+	return nil
+}
+
+func (s *memoryOrderStore) get(orderId int64) (*models.Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+	order, found := s.orders[orderId]
+	if !found {
+		return nil, nil
+	}
+	return copyOrder(order), nil
+}
+
+func (s *memoryOrderStore) updateStatus(orderId int64, oldStatus, newStatus models.OrderStatus) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	order, found := s.orders[orderId]
+	if !found || order.Status != oldStatus {
+		return false, nil
+	}
+	order.Status = newStatus
+	order.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (s *memoryOrderStore) find(makerAddress string, statuses []models.OrderStatus) ([]*models.Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var orders []*models.Order
+	for _, order := range s.orders {
+		if (len(makerAddress) > 0 && !strings.EqualFold(order.MakerAddress, makerAddress)) ||
+			(len(statuses) > 0 && !containsOrderStatus(statuses, order.Status)) {
+			continue
+		}
+		orders = append(orders, copyOrder(order))
+	}
+	return orders, nil
+}
+
+// 保存在redis中的订单：
+//
+//	gbe:order:id                  orderId计数器
+//	gbe:order:{orderId}           hash，order为订单的JSON，status和updatedAt为订单当前的状态
+//	gbe:orders:maker:{maker}      maker的所有orderId，sorted set，score为orderId
+//	gbe:orders:status:{status}    该状态的所有orderId，sorted set，score为orderId
+type redisOrderStore struct {
+	client *redis.Client
+
+	// 是否已经检查过redis中的计数器
+	idSeeded int32
+}
+
+const (
+	orderFieldOrder     = "order"
+	orderFieldStatus    = "status"
+	orderFieldUpdatedAt = "updatedAt"
+)
+
+var orderIdKey = redisKeyPrefix + "order:id"
+
+// 每个订单都在其中一个状态的索引中
+var orderStatuses = []models.OrderStatus{models.OrderStatusNew, models.OrderStatusOpen, models.OrderStatusCancelling,
+	models.OrderStatusCancelled, models.OrderStatusFilled}
+
+// 状态和状态索引在一个script中更新，多个进程同时更新一个订单的状态时只有一个成功
+var updateOrderStatusScript = redis.NewScript(`
+if redis.call('HGET', KEYS[1], 'status') ~= ARGV[1] then
+	return 0
+end
+redis.call('HMSET', KEYS[1], 'status', ARGV[2], 'updatedAt', ARGV[3])
+redis.call('ZREM', KEYS[2], ARGV[4])
+redis.call('ZADD', KEYS[3], ARGV[4], ARGV[4])
+return 1
+`)
+
+func newRedisOrderStore(client *redis.Client) *redisOrderStore {
+	return &redisOrderStore{client: client}
+}
+
+func orderKey(orderId int64) string {
+	return redisKeyPrefix + "order:" + strconv.FormatInt(orderId, 10)
+}
+
+func makerOrdersKey(makerAddress string) string {
+	return redisKeyPrefix + "orders:maker:" + strings.ToLower(makerAddress)
+}
+
+func statusOrdersKey(status models.OrderStatus) string {
+	return redisKeyPrefix + "orders:status:" + string(status)
+}
+
+func (s *redisOrderStore) nextId() (int64, error) {
+	// 计数器不存在时从当前时间开始，redis中的数据丢失后也不会重复
+	if atomic.LoadInt32(&s.idSeeded) == 0 {
+		err := s.client.SetNX(orderIdKey, orderIdSeed(), 0).Err()
+		if err != nil {
+			return 0, err
+		}
+		atomic.StoreInt32(&s.idSeeded, 1)
+	}
+	return s.client.Incr(orderIdKey).Result()
+}
+
+func (s *redisOrderStore) add(order *models.Order) error {
+	data, err := json.Marshal(order)
+	if err != nil {
+		return err
+	}
+
+	member := redis.Z{Score: float64(order.Id), Member: order.Id}
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(orderKey(order.Id), map[string]interface{}{
+			orderFieldOrder:     data,
+			orderFieldStatus:    string(order.Status),
+			orderFieldUpdatedAt: order.UpdatedAt.Format(time.RFC3339Nano),
+		})
+		pipe.ZAdd(makerOrdersKey(order.MakerAddress), member)
+		pipe.ZAdd(statusOrdersKey(order.Status), member)
+		return nil
+	})
+	return err
+}
+
+func (s *redisOrderStore) get(orderId int64) (*models.Order, error) {
+	orders, err := s.load([]int64{orderId})
+	if err != nil {
+		return nil, err
+	}
+	if len(orders) == 0 {
+		return nil, nil
+	}
+	return orders[0], nil
+}
+
+func (s *redisOrderStore) updateStatus(orderId int64, oldStatus, newStatus models.OrderStatus) (bool, error) {
+	updated, err := updateOrderStatusScript.Run(s.client,
+		[]string{orderKey(orderId), statusOrdersKey(oldStatus), statusOrdersKey(newStatus)},
+		string(oldStatus), string(newStatus), time.Now().Format(time.RFC3339Nano), orderId).Int64()
+	if err != nil {
+		return false, err
+	}
+	return updated == 1, nil
+}
+
+func (s *redisOrderStore) find(makerAddress string, statuses []models.OrderStatus) ([]*models.Order, error) {
+	var keys []string
+	if len(makerAddress) > 0 {
+		keys = append(keys, makerOrdersKey(makerAddress))
+	} else if len(statuses) > 0 {
+		for _, status := range statuses {
+			keys = append(keys, statusOrdersKey(status))
+		}
+	} else {
+		for _, status := range orderStatuses {
+			keys = append(keys, statusOrdersKey(status))
+		}
+	}
+
+	var orderIds []int64
+	for _, key := range keys {
+		members, err := s.client.ZRange(key, 0, -1).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, member := range members {
+			orderId, err := strconv.ParseInt(member, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+			orderIds = append(orderIds, orderId)
+		}
+	}
+
+	orders, err := s.load(orderIds)
+	if err != nil {
+		return nil, err
+	}
+
+	// 按照maker查找时，状态在这里过滤
+	var found []*models.Order
+	for _, order := range orders {
+		if len(statuses) == 0 || containsOrderStatus(statuses, order.Status) {
+			found = append(found, order)
+		}
+	}
+	return found, nil
+}
+
+// 读取订单，跳过不存在的订单
+func (s *redisOrderStore) load(orderIds []int64) ([]*models.Order, error) {
+	if len(orderIds) == 0 {
+		return nil, nil
+	}
+
+	pipe := s.client.Pipeline()
+	defer func() { _ = pipe.Close() }()
+
+	cmds := make([]*redis.SliceCmd, len(orderIds))
+	for i, orderId := range orderIds {
+		cmds[i] = pipe.HMGet(orderKey(orderId), orderFieldOrder, orderFieldStatus, orderFieldUpdatedAt)
+	}
+	_, err := pipe.Exec()
+	if err != nil {
+		return nil, err
+	}
+
+	var orders []*models.Order
+	for _, cmd := range cmds {
+		values := cmd.Val()
+		data, ok := values[0].(string)
+		if !ok {
+			continue
+		}
+
+		var order models.Order
+		err = json.Unmarshal([]byte(data), &order)
+		if err != nil {
+			return nil, err
+		}
+		if status, ok := values[1].(string); ok {
+			order.Status = models.OrderStatus(status)
+		}
+		if updatedAt, ok := values[2].(string); ok {
+			order.UpdatedAt, err = time.Parse(time.RFC3339Nano, updatedAt)
+			if err != nil {
+				return nil, err
+			}
+		}
+		orders = append(orders, &order)
+	}
+	return orders, nil
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const (
+	testMaker1 = "0x1D297954F3a6C293DDDe068BD462c1d5761de089"
+	testMaker2 = "0x9e56625509c2f60af937f23b7b532600390e8c8b"
+)
+
+// 连接测试结束后关闭的miniredis
+func newTestRedisClient(t *testing.T) (*redis.Client, *miniredis.Miniredis) {
+	t.Helper()
+
+	server, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() {
+		_ = client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func newTestRedisOrderStore(t *testing.T) (*redisOrderStore, *miniredis.Miniredis) {
+	t.Helper()
+
+	client, server := newTestRedisClient(t)
+	return newRedisOrderStore(client), server
+}
+
+// 两种实现的行为相同
+func eachOrderStore(t *testing.T, test func(t *testing.T, store orderStorage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryOrderStore())
+	})
+	t.Run("redis", func(t *testing.T) {
+		store, _ := newTestRedisOrderStore(t)
+		test(t, store)
+	})
+}
+
+func addTestOrder(t *testing.T, store orderStorage, makerAddress string, status models.OrderStatus) *models.Order {
+	t.Helper()
+
+	orderId, err := store.nextId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	order := &models.Order{
+		Id:           orderId,
+		CreatedAt:    time.Now().UTC().Truncate(time.Microsecond),
+		MakerAddress: makerAddress,
+		Side:         models.SideBuy,
+		ProductId:    "1",
+		Status:       status,
+	}
+	order.UpdatedAt = order.CreatedAt
+	err = store.add(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func orderIds(orders []*models.Order) []int64 {
+	var ids []int64
+	for _, order := range orders {
+		ids = append(ids, order.Id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func assertOrderIds(t *testing.T, orders []*models.Order, expected ...int64) {
+	t.Helper()
+
+	ids := orderIds(orders)
+	if len(ids) != len(expected) {
+		t.Fatalf("orders are %v, expected %v", ids, expected)
+	}
+	for i := range ids {
+		if ids[i] != expected[i] {
+			t.Fatalf("orders are %v, expected %v", ids, expected)
+		}
+	}
+}
+
+func TestOrderStoreNextId(t *testing.T) {
+	eachOrderStore(t, func(t *testing.T, store orderStorage) {
+		seed := orderIdSeed()
+		first, err := store.nextId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := store.nextId()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first < seed-int64(time.Minute/time.Microsecond) {
+			t.Fatalf("order id %v does not start from the clock %v", first, seed)
+		}
+		if second != first+1 {
+			t.Fatalf("order ids are %v and %v, expected consecutive ids", first, second)
+		}
+	})
+}
+
+func TestRedisOrderStoreSharesIds(t *testing.T) {
+	store, server := newTestRedisOrderStore(t)
+	first, err := store.nextId()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// another api process allocates from the same counter
+	other := newRedisOrderStore(store.client)
+	second, err := other.nextId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second != first+1 {
+		t.Fatalf("order id of the other process is %v, expected %v", second, first+1)
+	}
+
+	// the counter is lost, a process started after that seeds it from the clock again
+	server.FlushAll()
+	third, err := newRedisOrderStore(store.client).nextId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third <= second {
+		t.Fatalf("order id %v after the counter is lost is not greater than %v", third, second)
+	}
+}
+
+func TestOrderStoreGet(t *testing.T) {
+	eachOrderStore(t, func(t *testing.T, store orderStorage) {
+		order := addTestOrder(t, store, testMaker1, models.OrderStatusNew)
+
+		found, err := store.get(order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found == nil || found.Id != order.Id || found.MakerAddress != order.MakerAddress ||
+			found.Status != order.Status || !found.UpdatedAt.Equal(order.UpdatedAt) {
+			t.Fatalf("found %+v, expected %+v", found, order)
+		}
+
+		found, err = store.get(order.Id + 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found != nil {
+			t.Fatalf("found %+v for a missing order", found)
+		}
+	})
+}
+
+// 修改保存时传入的或者查询返回的订单，不会影响保存的订单
+func TestOrderStoreReturnsCopies(t *testing.T) {
+	eachOrderStore(t, func(t *testing.T, store orderStorage) {
+		orders, err := store.find("", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders)
+
+		order := addTestOrder(t, store, testMaker1, models.OrderStatusNew)
+		order.Status = models.OrderStatusFilled
+
+		found, err := store.get(order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found.Status = models.OrderStatusCancelled
+		orders, err = store.find(testMaker1, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		orders[0].Status = models.OrderStatusCancelled
+
+		found, err = store.get(order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Status != models.OrderStatusNew {
+			t.Fatalf("order status %v, expected %v", found.Status, models.OrderStatusNew)
+		}
+	})
+}
+
+func TestOrderStoreUpdateStatus(t *testing.T) {
+	eachOrderStore(t, func(t *testing.T, store orderStorage) {
+		order := addTestOrder(t, store, testMaker1, models.OrderStatusNew)
+
+		updated, err := store.updateStatus(order.Id, models.OrderStatusNew, models.OrderStatusCancelling)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !updated {
+			t.Fatal("status not updated")
+		}
+
+		// another process updates the order from the status it read before
+		updated, err = store.updateStatus(order.Id, models.OrderStatusNew, models.OrderStatusOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated {
+			t.Fatal("status updated from a stale status")
+		}
+
+		found, err := store.get(order.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found.Status != models.OrderStatusCancelling || found.UpdatedAt.Before(order.UpdatedAt) {
+			t.Fatalf("order is %v updated at %v", found.Status, found.UpdatedAt)
+		}
+
+		updated, err = store.updateStatus(order.Id+1000, models.OrderStatusNew, models.OrderStatusOpen)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated {
+			t.Fatal("status of a missing order updated")
+		}
+	})
+}
+
+func TestOrderStoreFind(t *testing.T) {
+	eachOrderStore(t, func(t *testing.T, store orderStorage) {
+		order1 := addTestOrder(t, store, testMaker1, models.OrderStatusNew)
+		order2 := addTestOrder(t, store, testMaker1, models.OrderStatusNew)
+		order3 := addTestOrder(t, store, testMaker2, models.OrderStatusNew)
+		_, err := store.updateStatus(order2.Id, models.OrderStatusNew, models.OrderStatusFilled)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		orders, err := store.find("", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders, order1.Id, order2.Id, order3.Id)
+
+		// the maker address is case insensitive
+		orders, err = store.find("0x1d297954f3a6c293ddde068bd462c1d5761de089", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders, order1.Id, order2.Id)
+
+		orders, err = store.find(testMaker1, []models.OrderStatus{models.OrderStatusNew, models.OrderStatusOpen})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders, order1.Id)
+
+		orders, err = store.find("", []models.OrderStatus{models.OrderStatusNew})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders, order1.Id, order3.Id)
+
+		orders, err = store.find("", []models.OrderStatus{models.OrderStatusFilled})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertOrderIds(t, orders, order2.Id)
+	})
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+// redis中所有key的前缀
+const redisKeyPrefix = "gbe:"
+
+// 配置了redis.addr时，需要在多个进程之间共享的数据保存在redis中；没有配置时保存在进程的内存中，只能用于单进程的开发环境
+var sharedRedis = struct {
+	sync.Once
+	client *redis.Client
+}{}
+
+// 获取共享的redis client，没有配置redis时返回nil
+func getRedisClient() *redis.Client {
+	sharedRedis.Do(func() {
+		redisConfig := conf.GetConfig().Redis
+		if len(redisConfig.Addr) == 0 {
+			return
+		}
+		sharedRedis.client = redis.NewClient(&redis.Options{
+			Addr:     redisConfig.Addr,
+			Password: redisConfig.Password,
+		})
+	})
+	return sharedRedis.client
+}
@@ -0,0 +1,33 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+func AddTransaction(transaction *models.Transaction) error {
+	transaction.CreatedAt = time.Now()
+	transaction.UpdatedAt = transaction.CreatedAt
+	return getTransactionStore().add(transaction)
+}
+
+func UpdateTransaction(transaction *models.Transaction) error {
+	transaction.UpdatedAt = time.Now()
+	return getTransactionStore().update(transaction)
+}
+
+// 获取product最后一笔成交的结算交易，用于从上次的位置继续读取撮合日志
+func GetLastTransactionByProductId(productId string) (*models.Transaction, error) {
+	return getTransactionStore().getLast(productId)
+}
+
+func GetTransactionsByStatus(status models.TransactionStatus) ([]*models.Transaction, error) {
+	return getTransactionStore().findByStatus(status)
+}
+
+// 按照创建顺序返回，保证交易按照成交顺序发送
+func sortTransactions(transactions []*models.Transaction) {
+	sort.Slice(transactions, func(i, j int) bool { return transactions[i].Id < transactions[j].Id })
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+// 结算交易的存储。配置了redis时保存在redis中，settlement重启后从最后一笔结算交易继续，不会重复发送；
+// 没有配置redis时保存在进程的内存中
+type transactionStorage interface {
+	// 分配transactionId并保存
+	add(transaction *models.Transaction) error
+
+	update(transaction *models.Transaction) error
+
+	// product中tradeId最大的结算交易，没有时返回nil
+	getLast(productId string) (*models.Transaction, error)
+
+	// 该状态的所有结算交易，按照transactionId排序
+	findByStatus(status models.TransactionStatus) ([]*models.Transaction, error)
+}
+
+var sharedTransactionStore = struct {
+	sync.Once
+	store transactionStorage
+}{}
+
+func getTransactionStore() transactionStorage {
+	sharedTransactionStore.Do(func() {
+		if client := getRedisClient(); client != nil {
+			sharedTransactionStore.store = newRedisTransactionStore(client)
+			return
+		}
+		sharedTransactionStore.store = newMemoryTransactionStore()
+	})
+	return sharedTransactionStore.store
+}
+
+// 保存在进程内存中的结算交易，transactionId自增，重启后丢失
+type memoryTransactionStore struct {
+	sync.RWMutex
+	seq          int64
+	transactions map[int64]*models.Transaction
+}
+
+func newMemoryTransactionStore() *memoryTransactionStore {
+	return &memoryTransactionStore{transactions: map[int64]*models.Transaction{}}
+}
+
+func (s *memoryTransactionStore) add(transaction *models.Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.seq++
+	transaction.Id = s.seq
+	s.transactions[transaction.Id] = transaction
+	return nil
+}
+
+func (s *memoryTransactionStore) update(transaction *models.Transaction) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.transactions[transaction.Id] = transaction
+	return nil
+}
+
+func (s *memoryTransactionStore) getLast(productId string) (*models.Transaction, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var last *models.Transaction
+	for _, transaction := range s.transactions {
+		if transaction.ProductId == productId && (last == nil || transaction.TradeId > last.TradeId) {
+			last = transaction
+		}
+	}
+	return last, nil
+}
+
+func (s *memoryTransactionStore) findByStatus(status models.TransactionStatus) ([]*models.Transaction, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var transactions []*models.Transaction
+	for _, transaction := range s.transactions {
+		if transaction.Status == status {
+			transactions = append(transactions, transaction)
+		}
+	}
+	sortTransactions(transactions)
+	return transactions, nil
+}
+
+// 保存在redis中的结算交易：
+//
+//	gbe:transaction:id                        transactionId计数器
+//	gbe:transaction:{transactionId}           结算交易的JSON
+//	gbe:transactions:product:{productId}      product的所有transactionId，sorted set，score为tradeId
+//	gbe:transactions:status:{status}          该状态的所有transactionId，sorted set，score为transactionId
+type redisTransactionStore struct {
+	client *redis.Client
+}
+
+var transactionIdKey = redisKeyPrefix + "transaction:id"
+
+// 每笔结算交易都在其中一个状态的索引中
+var transactionStatuses = []models.TransactionStatus{models.TransactionStatusPending,
+	models.TransactionStatusCompleted, models.TransactionStatusFailed, models.TransactionStatusInvalid}
+
+func newRedisTransactionStore(client *redis.Client) *redisTransactionStore {
+	return &redisTransactionStore{client: client}
+}
+
+func transactionKey(transactionId int64) string {
+	return redisKeyPrefix + "transaction:" + strconv.FormatInt(transactionId, 10)
+}
+
+func productTransactionsKey(productId string) string {
+	return redisKeyPrefix + "transactions:product:" + productId
+}
+
+func statusTransactionsKey(status models.TransactionStatus) string {
+	return redisKeyPrefix + "transactions:status:" + string(status)
+}
+
+func (s *redisTransactionStore) add(transaction *models.Transaction) error {
+	transactionId, err := s.client.Incr(transactionIdKey).Result()
+	if err != nil {
+		return err
+	}
+	transaction.Id = transactionId
+
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(transactionKey(transaction.Id), data, 0)
+		pipe.ZAdd(productTransactionsKey(transaction.ProductId),
+			redis.Z{Score: float64(transaction.TradeId), Member: transaction.Id})
+		pipe.ZAdd(statusTransactionsKey(transaction.Status),
+			redis.Z{Score: float64(transaction.Id), Member: transaction.Id})
+		return nil
+	})
+	return err
+}
+
+func (s *redisTransactionStore) update(transaction *models.Transaction) error {
+	data, err := json.Marshal(transaction)
+	if err != nil {
+		return err
+	}
+
+	// 只有settlement的leader更新结算交易，不需要检查之前的状态
+	_, err = s.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.Set(transactionKey(transaction.Id), data, 0)
+		for _, status := range transactionStatuses {
+			if status != transaction.Status {
+				pipe.ZRem(statusTransactionsKey(status), transaction.Id)
+			}
+		}
+		pipe.ZAdd(statusTransactionsKey(transaction.Status),
+			redis.Z{Score: float64(transaction.Id), Member: transaction.Id})
+		return nil
+	})
+	return err
+}
+
+func (s *redisTransactionStore) getLast(productId string) (*models.Transaction, error) {
+	members, err := s.client.ZRevRange(productTransactionsKey(productId), 0, 0).Result()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.load(members)
+	if err != nil {
+		return nil, err
+	}
+	if len(transactions) == 0 {
+		return nil, nil
+	}
+	return transactions[0], nil
+}
+
+func (s *redisTransactionStore) findByStatus(status models.TransactionStatus) ([]*models.Transaction, error) {
+	members, err := s.client.ZRange(statusTransactionsKey(status), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	transactions, err := s.load(members)
+	if err != nil {
+		return nil, err
+	}
+	sortTransactions(transactions)
+	return transactions, nil
+}
+
+// 读取结算交易，跳过不存在的结算交易
+func (s *redisTransactionStore) load(members []string) ([]*models.Transaction, error) {
+	if len(members) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(members))
+	for i, member := range members {
+		transactionId, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = transactionKey(transactionId)
+	}
+	values, err := s.client.MGet(keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var transactions []*models.Transaction
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue
+		}
+		var transaction models.Transaction
+		err = json.Unmarshal([]byte(data), &transaction)
+		if err != nil {
+			return nil, err
+		}
+		transactions = append(transactions, &transaction)
+	}
+	return transactions, nil
+}
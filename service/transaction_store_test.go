@@ -0,0 +1,111 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+func eachTransactionStore(t *testing.T, test func(t *testing.T, store transactionStorage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryTransactionStore())
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newTestRedisClient(t)
+		test(t, newRedisTransactionStore(client))
+	})
+}
+
+func addTestTransaction(t *testing.T, store transactionStorage, productId string, tradeId int64,
+	status models.TransactionStatus) *models.Transaction {
+	t.Helper()
+
+	transaction := &models.Transaction{
+		ProductId: productId,
+		TradeId:   tradeId,
+		LogSeq:    tradeId * 3,
+		LogOffset: tradeId * 3,
+		Size:      decimal.New(tradeId, 0),
+		Price:     decimal.RequireFromString("0.0014"),
+		Status:    status,
+	}
+	err := store.add(transaction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return transaction
+}
+
+func assertTransactionIds(t *testing.T, transactions []*models.Transaction, expected ...int64) {
+	t.Helper()
+
+	var transactionIds []int64
+	for _, transaction := range transactions {
+		transactionIds = append(transactionIds, transaction.Id)
+	}
+	if len(transactionIds) != len(expected) {
+		t.Fatalf("transactions %v, expected %v", transactionIds, expected)
+	}
+	for i := range expected {
+		if transactionIds[i] != expected[i] {
+			t.Fatalf("transactions %v, expected %v", transactionIds, expected)
+		}
+	}
+}
+
+// settlement重启后从product最后一笔成交之后继续读取撮合日志
+func TestTransactionStoreGetLast(t *testing.T) {
+	eachTransactionStore(t, func(t *testing.T, store transactionStorage) {
+		last, err := store.getLast("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last != nil {
+			t.Fatalf("last transaction %+v of an empty store", last)
+		}
+
+		addTestTransaction(t, store, "1", 1, models.TransactionStatusCompleted)
+		addTestTransaction(t, store, "2", 5, models.TransactionStatusPending)
+		expected := addTestTransaction(t, store, "1", 2, models.TransactionStatusInvalid)
+
+		last, err = store.getLast("1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last == nil || last.Id != expected.Id || last.LogSeq != expected.LogSeq ||
+			last.LogOffset != expected.LogOffset || !last.Size.Equal(expected.Size) {
+			t.Fatalf("last transaction %+v, expected %+v", last, expected)
+		}
+	})
+}
+
+func TestTransactionStoreFindByStatus(t *testing.T) {
+	eachTransactionStore(t, func(t *testing.T, store transactionStorage) {
+		first := addTestTransaction(t, store, "1", 1, models.TransactionStatusPending)
+		second := addTestTransaction(t, store, "1", 2, models.TransactionStatusPending)
+		third := addTestTransaction(t, store, "1", 3, models.TransactionStatusPending)
+
+		second.Hash = "0x01"
+		second.Status = models.TransactionStatusCompleted
+		err := store.update(second)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pending, err := store.findByStatus(models.TransactionStatusPending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTransactionIds(t, pending, first.Id, third.Id)
+
+		completed, err := store.findByStatus(models.TransactionStatusCompleted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertTransactionIds(t, completed, second.Id)
+		if completed[0].Hash != "0x01" {
+			t.Fatalf("updated transaction hash %q", completed[0].Hash)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/go-redis/redis"
+	"github.com/shopspring/decimal"
+)
+
+// maker在每个product的累计成交量(quote)，用于选择费率档位。
+// 配置了redis时保存在redis中，没有配置redis时保存在进程的内存中
+type volumeStorage interface {
+	// 没有成交过时返回0
+	get(productId, makerAddress string) (decimal.Decimal, error)
+
+	add(productId, makerAddress string, volume decimal.Decimal) error
+}
+
+var sharedVolumeStore = struct {
+	sync.Once
+	store volumeStorage
+}{}
+
+func getVolumeStore() volumeStorage {
+	sharedVolumeStore.Do(func() {
+		if client := getRedisClient(); client != nil {
+			sharedVolumeStore.store = newRedisVolumeStore(client)
+			return
+		}
+		sharedVolumeStore.store = newMemoryVolumeStore()
+	})
+	return sharedVolumeStore.store
+}
+
+// productId:makerAddress -> 成交量
+type memoryVolumeStore struct {
+	sync.Mutex
+	volumes map[string]decimal.Decimal
+}
+
+func newMemoryVolumeStore() *memoryVolumeStore {
+	return &memoryVolumeStore{volumes: map[string]decimal.Decimal{}}
+}
+
+func (s *memoryVolumeStore) get(productId, makerAddress string) (decimal.Decimal, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.volumes[productId+":"+strings.ToLower(makerAddress)], nil
+}
+
+func (s *memoryVolumeStore) add(productId, makerAddress string, volume decimal.Decimal) error {
+	s.Lock()
+	defer s.Unlock()
+	key := productId + ":" + strings.ToLower(makerAddress)
+	s.volumes[key] = s.volumes[key].Add(volume)
+	return nil
+}
+
+// gbe:volume:{productId}，hash，field为maker地址，value为成交量。
+// 用HINCRBYFLOAT累加，多个settlement进程同时累加不会丢失，精度对于选择费率档位足够
+type redisVolumeStore struct {
+	client *redis.Client
+}
+
+func newRedisVolumeStore(client *redis.Client) *redisVolumeStore {
+	return &redisVolumeStore{client: client}
+}
+
+func volumeKey(productId string) string {
+	return redisKeyPrefix + "volume:" + productId
+}
+
+func (s *redisVolumeStore) get(productId, makerAddress string) (decimal.Decimal, error) {
+	raw, err := s.client.HGet(volumeKey(productId), strings.ToLower(makerAddress)).Result()
+	if err == redis.Nil {
+		return decimal.Zero, nil
+	}
+	if err != nil {
+		return decimal.Zero, err
+	}
+	return decimal.NewFromString(raw)
+}
+
+func (s *redisVolumeStore) add(productId, makerAddress string, volume decimal.Decimal) error {
+	increment, _ := volume.Float64()
+	return s.client.HIncrByFloat(volumeKey(productId), strings.ToLower(makerAddress), increment).Err()
+}
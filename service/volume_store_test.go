@@ -0,0 +1,96 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/conf"
+)
+
+func eachVolumeStore(t *testing.T, test func(t *testing.T, store volumeStorage)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newMemoryVolumeStore())
+	})
+	t.Run("redis", func(t *testing.T) {
+		client, _ := newTestRedisClient(t)
+		test(t, newRedisVolumeStore(client))
+	})
+}
+
+func assertVolume(t *testing.T, store volumeStorage, productId, makerAddress string, expected string) {
+	t.Helper()
+
+	volume, err := store.get(productId, makerAddress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !volume.Equal(decimal.RequireFromString(expected)) {
+		t.Fatalf("volume of %v in product %v is %v, expected %v", makerAddress, productId, volume, expected)
+	}
+}
+
+// 成交量按product和maker地址分别累加，地址不区分大小写
+func TestVolumeStore(t *testing.T) {
+	eachVolumeStore(t, func(t *testing.T, store volumeStorage) {
+		assertVolume(t, store, "1", "0xAbC", "0")
+
+		err := store.add("1", "0xAbC", decimal.RequireFromString("1.5"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.add("1", "0xabc", decimal.RequireFromString("2.25"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.add("2", "0xabc", decimal.RequireFromString("10"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertVolume(t, store, "1", "0xABC", "3.75")
+		assertVolume(t, store, "2", "0xabc", "10")
+		assertVolume(t, store, "1", "0xdef", "0")
+	})
+}
+
+// 成交量达到下一档的MinVolume之后适用下一档的费率
+func TestFeeTierChangesWithVolume(t *testing.T) {
+	tiers := []conf.FeeTier{
+		{MinVolume: 0, MakerFeeRate: 0.002, TakerFeeRate: 0.003},
+		{MinVolume: 1000, MakerFeeRate: 0.001, TakerFeeRate: 0.002},
+		{MinVolume: 5000, MakerFeeRate: 0, TakerFeeRate: 0.001},
+	}
+
+	eachVolumeStore(t, func(t *testing.T, store volumeStorage) {
+		expectTier := func(expectedRate float64) {
+			t.Helper()
+
+			volume, err := store.get("1", "0xabc")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tier := selectFeeTier(tiers, volume); tier.MakerFeeRate != expectedRate {
+				t.Fatalf("maker fee rate %v at volume %v, expected %v", tier.MakerFeeRate, volume, expectedRate)
+			}
+		}
+
+		expectTier(0.002)
+		for _, volume := range []string{"600", "399.5"} {
+			err := store.add("1", "0xabc", decimal.RequireFromString(volume))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		expectTier(0.002)
+		err := store.add("1", "0xabc", decimal.RequireFromString("0.5"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectTier(0.001)
+		err = store.add("1", "0xabc", decimal.RequireFromString("4000"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectTier(0)
+	})
+}
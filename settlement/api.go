@@ -0,0 +1,32 @@
+package settlement
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// 用于对结算交易签名，签名的账户就是交易的发送者
+type TransactionSigner interface {
+	// 获取签名账户的地址
+	GetAddress() common.Address
+
+	// 对交易签名，返回签名后的交易
+	SignTransaction(tx *types.Transaction) (*types.Transaction, error)
+}
+
+// 用于发送结算交易，并查询交易的执行结果
+type TransactionSender interface {
+	// 获取账户下一笔交易的nonce
+	GetNonce(account common.Address) (uint64, error)
+
+	// 获取建议的gas price
+	GetGasPrice() (*big.Int, error)
+
+	// 发送签名后的交易
+	SendTransaction(tx *types.Transaction) error
+
+	// 获取交易回执，交易还没有被打包时返回nil
+	GetTransactionReceipt(txHash common.Hash) (*types.Receipt, error)
+}
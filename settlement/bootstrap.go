@@ -0,0 +1,70 @@
+package settlement
+
+import (
+	"time"
+
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+var logger = logging.New("settlement")
+
+// settlement campaigns for leader like an engine of this pseudo product
+const electionKey = "settlement"
+
+func StartSettlement() {
+	gbeConfig := conf.GetConfig()
+
+	if len(gbeConfig.Settlement.PrivateKey) == 0 || len(gbeConfig.Ethereum.RpcUrl) == 0 {
+		logger.Warn("settlement privateKey or ethereum rpcUrl not configured, settlement not started")
+		return
+	}
+
+	signer, err := NewKeySigner(gbeConfig.Settlement.PrivateKey, gbeConfig.Ethereum.ChainId)
+	if err != nil {
+		panic(err)
+	}
+	sender, err := NewEthereumSender(gbeConfig.Ethereum.RpcUrl)
+	if err != nil {
+		panic(err)
+	}
+
+	confirmInterval := time.Duration(gbeConfig.Settlement.ConfirmInterval) * time.Second
+	if confirmInterval <= 0 {
+		confirmInterval = 5 * time.Second
+	}
+
+	products, err := service.GetProducts()
+	if err != nil {
+		panic(err)
+	}
+	var logReaders []match.LogReader
+	for _, product := range products {
+		logReaders = append(logReaders, match.NewKafkaLogReader("settlement", product.Id, gbeConfig.Kafka.Brokers))
+	}
+
+	settler := NewSettler(logReaders, gbeConfig.Ethereum.ExchangeAddress, gbeConfig.Settlement.GasLimit,
+		confirmInterval, signer, sender)
+
+	// the relayer account is shared by all products, only one engine process sends the settlements
+	elector, err := match.NewElector(gbeConfig.Match.Election)
+	if err != nil {
+		panic(err)
+	}
+	if elector == nil {
+		settler.Start()
+		logger.Info("settlement ok")
+		return
+	}
+
+	go func() {
+		lease, err := elector.Campaign(electionKey)
+		if err != nil {
+			logger.Fatalf("campaign for settlement leader error: %v", err)
+		}
+		settler.Start()
+		logger.WithField("token", lease.Token()).Info("settlement ok, became leader")
+	}()
+}
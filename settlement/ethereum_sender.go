@@ -0,0 +1,58 @@
+package settlement
+
+import (
+	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	rpcTimeout = 10 * time.Second
+)
+
+// EthereumSender sends the transactions to an Ethereum node through JSON-RPC
+type EthereumSender struct {
+	client *ethclient.Client
+}
+
+func NewEthereumSender(rpcUrl string) (*EthereumSender, error) {
+	client, err := ethclient.Dial(rpcUrl)
+	if err != nil {
+		return nil, err
+	}
+	return &EthereumSender{client: client}, nil
+}
+
+func (s *EthereumSender) GetNonce(account common.Address) (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return s.client.PendingNonceAt(ctx, account)
+}
+
+func (s *EthereumSender) GetGasPrice() (*big.Int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return s.client.SuggestGasPrice(ctx)
+}
+
+func (s *EthereumSender) SendTransaction(tx *types.Transaction) error {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+	return s.client.SendTransaction(ctx, tx)
+}
+
+func (s *EthereumSender) GetTransactionReceipt(txHash common.Hash) (*types.Receipt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), rpcTimeout)
+	defer cancel()
+
+	receipt, err := s.client.TransactionReceipt(ctx, txHash)
+	if err == ethereum.NotFound {
+		return nil, nil
+	}
+	return receipt, err
+}
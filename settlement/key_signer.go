@@ -0,0 +1,39 @@
+package settlement
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// KeySigner signs the transactions with a private key held in memory
+type KeySigner struct {
+	key     *ecdsa.PrivateKey
+	address common.Address
+	signer  types.Signer
+}
+
+func NewKeySigner(hexKey string, chainId int64) (*KeySigner, error) {
+	key, err := crypto.HexToECDSA(strings.TrimPrefix(hexKey, "0x"))
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeySigner{
+		key:     key,
+		address: crypto.PubkeyToAddress(key.PublicKey),
+		signer:  types.NewEIP155Signer(big.NewInt(chainId)),
+	}, nil
+}
+
+func (s *KeySigner) GetAddress() common.Address {
+	return s.address
+}
+
+func (s *KeySigner) SignTransaction(tx *types.Transaction) (*types.Transaction, error) {
+	return types.SignTx(tx, s.signer, s.key)
+}
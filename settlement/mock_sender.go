@@ -0,0 +1,86 @@
+package settlement
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// MockSender keeps the sent transactions in memory instead of sending them to a node, it is used in tests
+// and local environments. Sent transactions stay pending until Mine is called.
+type MockSender struct {
+	mu           sync.Mutex
+	signer       types.Signer
+	gasPrice     *big.Int
+	nonces       map[common.Address]uint64
+	transactions []*types.Transaction
+	pending      []*types.Transaction
+	receipts     map[common.Hash]*types.Receipt
+	blockNumber  int64
+}
+
+func NewMockSender(chainId int64) *MockSender {
+	return &MockSender{
+		signer:   types.NewEIP155Signer(big.NewInt(chainId)),
+		gasPrice: big.NewInt(1),
+		nonces:   map[common.Address]uint64{},
+		receipts: map[common.Hash]*types.Receipt{},
+	}
+}
+
+func (s *MockSender) GetNonce(account common.Address) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.nonces[account], nil
+}
+
+func (s *MockSender) GetGasPrice() (*big.Int, error) {
+	return new(big.Int).Set(s.gasPrice), nil
+}
+
+func (s *MockSender) SendTransaction(tx *types.Transaction) error {
+	from, err := types.Sender(s.signer, tx)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nonces[from] = tx.Nonce() + 1
+	s.transactions = append(s.transactions, tx)
+	s.pending = append(s.pending, tx)
+	return nil
+}
+
+func (s *MockSender) GetTransactionReceipt(txHash common.Hash) (*types.Receipt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.receipts[txHash], nil
+}
+
+// Mine packs all pending transactions into a new block with the given receipt status
+func (s *MockSender) Mine(status uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blockNumber++
+	for i, tx := range s.pending {
+		s.receipts[tx.Hash()] = &types.Receipt{
+			Status:           status,
+			TxHash:           tx.Hash(),
+			GasUsed:          tx.Gas(),
+			BlockNumber:      big.NewInt(s.blockNumber),
+			TransactionIndex: uint(i),
+		}
+	}
+	s.pending = nil
+}
+
+// GetTransactions returns all the transactions sent so far
+func (s *MockSender) GetTransactions() []*types.Transaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*types.Transaction{}, s.transactions...)
+}
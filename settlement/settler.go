@@ -0,0 +1,512 @@
+package settlement
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	// 0x v3每个被成交的订单需要支付 gasPrice * protocolFeeMultiplier 的protocol fee
+	protocolFeeMultiplier = 150000
+)
+
+// 读取撮合日志，为每一笔成交构造0x batchFillOrders交易，签名并发送到链上，然后跟踪交易的执行结果
+type Settler struct {
+	// 每个product对应一个logReader，所有product共用一个发送账户
+	logReaders []match.LogReader
+
+	exchangeAddress common.Address
+	gasLimit        uint64
+
+	signer TransactionSigner
+	sender TransactionSender
+
+	// 新创建的结算交易写入chan，等待发送
+	transactionCh chan *models.Transaction
+
+	// 检查pending交易的间隔
+	confirmInterval time.Duration
+
+	// 发送账户下一笔交易的nonce，已经签名但是广播失败的交易不会计入节点的pending nonce
+	nextNonce uint64
+}
+
+func NewSettler(logReaders []match.LogReader, exchangeAddress string, gasLimit uint64, confirmInterval time.Duration,
+	signer TransactionSigner, sender TransactionSender) *Settler {
+	s := &Settler{
+		logReaders:      logReaders,
+		exchangeAddress: common.HexToAddress(exchangeAddress),
+		gasLimit:        gasLimit,
+		signer:          signer,
+		sender:          sender,
+		transactionCh:   make(chan *models.Transaction, 1000),
+		confirmInterval: confirmInterval,
+	}
+	for _, logReader := range logReaders {
+		logReader.RegisterObserver(s)
+	}
+	return s
+}
+
+// 从最后一笔结算交易对应的撮合日志之后继续读取
+func (s *Settler) Start() {
+	for _, logReader := range s.logReaders {
+		lastTransaction, err := service.GetLastTransactionByProductId(logReader.GetProductId())
+		if err != nil {
+			panic(err)
+		}
+		if lastTransaction != nil {
+			go logReader.Run(lastTransaction.LogSeq, lastTransaction.LogOffset+1)
+		} else {
+			go logReader.Run(0, 0)
+		}
+	}
+
+	err := s.restoreNonce()
+	if err != nil {
+		panic(err)
+	}
+	go s.runSender()
+}
+
+// 跳过所有已经签名的pending交易使用的nonce
+func (s *Settler) restoreNonce() error {
+	transactions, err := service.GetTransactionsByStatus(models.TransactionStatusPending)
+	if err != nil {
+		return err
+	}
+	for _, transaction := range transactions {
+		if len(transaction.RawTx) > 0 && transaction.Nonce >= s.nextNonce {
+			s.nextNonce = transaction.Nonce + 1
+		}
+	}
+	return nil
+}
+
+func (s *Settler) OnOpenLog(log *match.OpenLog, offset int64) {
+	// do nothing
+}
+
+func (s *Settler) OnDoneLog(log *match.DoneLog, offset int64) {
+	// do nothing
+}
+
+func (s *Settler) OnActivatedLog(log *match.ActivatedLog, offset int64) {
+	// do nothing
+}
+
+func (s *Settler) OnMatchLog(matchLog *match.MatchLog, offset int64) {
+	transaction, err := s.newTransaction(matchLog, offset)
+	if err != nil {
+		// 不能跳过这笔成交，重启后从最后一笔结算交易之后重新读取
+		panic(err)
+	}
+
+	err = service.AddTransaction(transaction)
+	if err != nil {
+		panic(err)
+	}
+	if transaction.Status == models.TransactionStatusPending {
+		s.transactionCh <- transaction
+	}
+}
+
+// 根据MatchLog构造结算交易，maker和taker都按照成交价格成交。
+// 无法构造结算交易时也记录这笔成交，状态为invalid，读取订单失败时返回error
+func (s *Settler) newTransaction(matchLog *match.MatchLog, offset int64) (*models.Transaction, error) {
+	makerOrder, err := service.GetOrderById(matchLog.MakerOrderId)
+	if err != nil {
+		return nil, err
+	}
+	takerOrder, err := service.GetOrderById(matchLog.TakerOrderId)
+	if err != nil {
+		return nil, err
+	}
+
+	transaction := &models.Transaction{
+		ProductId:    matchLog.ProductId,
+		TradeId:      matchLog.TradeId,
+		LogSeq:       matchLog.Sequence,
+		LogOffset:    offset,
+		MakerOrderId: matchLog.MakerOrderId,
+		TakerOrderId: matchLog.TakerOrderId,
+		Size:         matchLog.Size,
+		Price:        matchLog.Price,
+		Type:         models.TransactionTypeSettlement,
+		To:           s.exchangeAddress.Hex(),
+		Status:       models.TransactionStatusPending,
+	}
+	if makerOrder == nil || takerOrder == nil {
+		logger.Errorf("build settlement of trade %v error: order not found: maker=%v taker=%v",
+			matchLog.TradeId, matchLog.MakerOrderId, matchLog.TakerOrderId)
+		transaction.Status = models.TransactionStatusInvalid
+		return transaction, nil
+	}
+	transaction.MakerOrderHash = makerOrder.Hash
+	transaction.TakerOrderHash = takerOrder.Hash
+
+	data, rebate, err := fillOrdersCalldata(matchLog, makerOrder, takerOrder)
+	if err != nil {
+		logger.Errorf("build settlement of trade %v error: %v", matchLog.TradeId, err)
+		transaction.Status = models.TransactionStatusInvalid
+		return transaction, nil
+	}
+	transaction.Data = hexutil.Encode(data)
+	transaction.Rebate = decimal.NewFromBigInt(rebate, 0)
+	return transaction, nil
+}
+
+// 一笔成交的结算数量，均为资产的最小单位
+type settlementAmounts struct {
+	// maker订单的takerAssetFillAmount，发送账户按照成交价格支付给maker
+	makerFill *big.Int
+	// taker订单的takerAssetFillAmount，发送账户把成交的base交给taker，或者向taker买入成交的base
+	takerFill *big.Int
+	// exchange合约按照taker订单自己的价格填充，taker多支付或者少收到的quote，结算完成后由发送账户退还
+	rebate *big.Int
+}
+
+// 根据成交的数量和价格计算两个订单的填充数量。maker订单按照成交价格填充，
+// taker订单按照成交数量填充，价格差由rebate退还，taker最终也按照成交价格成交
+func getSettlementAmounts(matchLog *match.MatchLog, makerSide models.Side, takerOrder *zeroex.Order,
+	baseAsset, quoteAsset *models.Asset) (*settlementAmounts, error) {
+	base, err := zeroex.DecimalToUint256(matchLog.Size.Shift(baseAsset.Decimals).Truncate(0))
+	if err != nil {
+		return nil, err
+	}
+	quote, err := zeroex.DecimalToUint256(matchLog.Size.Mul(matchLog.Price).Shift(quoteAsset.Decimals).Truncate(0))
+	if err != nil {
+		return nil, err
+	}
+	if base.Sign() == 0 || quote.Sign() == 0 {
+		return nil, errors.New(fmt.Sprintf("trade of %v at %v is less than one unit of the assets",
+			matchLog.Size, matchLog.Price))
+	}
+
+	amounts := &settlementAmounts{}
+	if makerSide == models.SideSell {
+		// 发送账户向maker支付quote得到base，把base交给taker，taker按照自己的价格支付quote，向下取整
+		amounts.makerFill = quote
+		amounts.takerFill = base
+		paid := new(big.Int).Mul(base, takerOrder.MakerAssetAmount)
+		paid.Div(paid, takerOrder.TakerAssetAmount)
+		amounts.rebate = new(big.Int).Sub(paid, quote)
+	} else {
+		// 发送账户向maker支付base得到quote，再向taker支付quote买入base，支付的quote向上取整保证得到全部base
+		amounts.makerFill = base
+		received := new(big.Int).Mul(base, takerOrder.TakerAssetAmount)
+		received.Add(received, new(big.Int).Sub(takerOrder.MakerAssetAmount, big.NewInt(1)))
+		received.Div(received, takerOrder.MakerAssetAmount)
+		amounts.takerFill = received
+		amounts.rebate = new(big.Int).Sub(quote, received)
+	}
+	if amounts.rebate.Sign() < 0 {
+		amounts.rebate.SetInt64(0)
+	}
+	return amounts, nil
+}
+
+// 发送账户先作为taker填充maker订单，再填充taker订单，两次填充在同一笔batchFillOrders交易中。
+// 发送账户需要持有少量base和quote资产并授权给ERC20Proxy，返回需要退还给taker的quote
+func fillOrdersCalldata(matchLog *match.MatchLog, makerOrder, takerOrder *models.Order) ([]byte, *big.Int, error) {
+	baseAsset, quoteAsset, err := getProductAssets(matchLog.ProductId)
+	if err != nil {
+		return nil, nil, err
+	}
+	return settlementCalldata(matchLog, makerOrder, takerOrder, baseAsset, quoteAsset)
+}
+
+func settlementCalldata(matchLog *match.MatchLog, makerOrder, takerOrder *models.Order,
+	baseAsset, quoteAsset *models.Asset) ([]byte, *big.Int, error) {
+	leftOrder, err := zeroex.NewOrder(makerOrder)
+	if err != nil {
+		return nil, nil, err
+	}
+	rightOrder, err := zeroex.NewOrder(takerOrder)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	amounts, err := getSettlementAmounts(matchLog, makerOrder.Side, rightOrder, baseAsset, quoteAsset)
+	if err != nil {
+		return nil, nil, err
+	}
+	if amounts.rebate.Sign() > 0 {
+		_, err = zeroex.DecodeERC20AssetData(quoteAsset.AssetData)
+		if err != nil {
+			return nil, nil, errors.New(fmt.Sprintf("can not refund the price improvement of the taker: %v", err))
+		}
+	}
+
+	data, err := zeroex.BatchFillOrdersCalldata([]*zeroex.Order{leftOrder, rightOrder},
+		[]*big.Int{amounts.makerFill, amounts.takerFill}, []string{makerOrder.Signature, takerOrder.Signature})
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, amounts.rebate, nil
+}
+
+// 结算交易完成后，把taker按照自己的价格多支付或者少收到的quote转给taker
+func newRebateTransaction(settlement *models.Transaction) (*models.Transaction, error) {
+	takerOrder, err := service.GetOrderById(settlement.TakerOrderId)
+	if err != nil {
+		return nil, err
+	}
+	if takerOrder == nil {
+		return nil, errors.New(fmt.Sprintf("order not found: %v", settlement.TakerOrderId))
+	}
+	_, quoteAsset, err := getProductAssets(settlement.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	token, err := zeroex.DecodeERC20AssetData(quoteAsset.AssetData)
+	if err != nil {
+		return nil, err
+	}
+	amount, err := zeroex.DecimalToUint256(settlement.Rebate)
+	if err != nil {
+		return nil, err
+	}
+	data, err := zeroex.TransferCalldata(common.HexToAddress(takerOrder.MakerAddress), amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.Transaction{
+		ProductId:      settlement.ProductId,
+		TradeId:        settlement.TradeId,
+		LogSeq:         settlement.LogSeq,
+		LogOffset:      settlement.LogOffset,
+		MakerOrderId:   settlement.MakerOrderId,
+		TakerOrderId:   settlement.TakerOrderId,
+		MakerOrderHash: settlement.MakerOrderHash,
+		TakerOrderHash: settlement.TakerOrderHash,
+		Size:           settlement.Size,
+		Price:          settlement.Price,
+		Type:           models.TransactionTypeRebate,
+		To:             token.Hex(),
+		Data:           hexutil.Encode(data),
+		Rebate:         settlement.Rebate,
+		Status:         models.TransactionStatusPending,
+	}, nil
+}
+
+func getProductAssets(productId string) (*models.Asset, *models.Asset, error) {
+	product, err := service.GetProductById(productId)
+	if err != nil {
+		return nil, nil, err
+	}
+	if product == nil {
+		return nil, nil, errors.New(fmt.Sprintf("product not found: %v", productId))
+	}
+	baseAsset, err := service.GetAssetByCurrency(product.BaseCurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	quoteAsset, err := service.GetAssetByCurrency(product.QuoteCurrency)
+	if err != nil {
+		return nil, nil, err
+	}
+	if baseAsset == nil || quoteAsset == nil {
+		return nil, nil, errors.New(fmt.Sprintf("asset not found: %v %v", product.BaseCurrency, product.QuoteCurrency))
+	}
+	return baseAsset, quoteAsset, nil
+}
+
+// 交易的发送和确认在同一个goroutine中进行，保证发送账户的nonce不会冲突
+func (s *Settler) runSender() {
+	ticker := time.NewTicker(s.confirmInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case transaction := <-s.transactionCh:
+			err := s.sendTransaction(transaction)
+			if err != nil {
+				logger.Errorf("send settlement transaction %v error: %v", transaction.Id, err)
+			}
+
+		case <-ticker.C:
+			err := s.confirmTransactions()
+			if err != nil {
+				logger.Error(err)
+			}
+		}
+	}
+}
+
+// 签名后先保存交易的hash、nonce和rlp编码再广播，保存失败时不会广播，广播失败时由confirmTransactions重新广播同一笔交易，
+// 一笔结算交易不会被签名两次
+func (s *Settler) sendTransaction(transaction *models.Transaction) error {
+	if len(transaction.RawTx) == 0 {
+		signedTx, err := s.signTransaction(transaction)
+		if err != nil {
+			return err
+		}
+		rawTx, err := rlp.EncodeToBytes(signedTx)
+		if err != nil {
+			return err
+		}
+
+		transaction.Nonce = signedTx.Nonce()
+		transaction.RawTx = hexutil.Encode(rawTx)
+		transaction.Hash = signedTx.Hash().Hex()
+		err = service.UpdateTransaction(transaction)
+		if err != nil {
+			return err
+		}
+		s.nextNonce = signedTx.Nonce() + 1
+	}
+	return s.broadcastTransaction(transaction)
+}
+
+func (s *Settler) broadcastTransaction(transaction *models.Transaction) error {
+	rawTx, err := hexutil.Decode(transaction.RawTx)
+	if err != nil {
+		return err
+	}
+	signedTx := new(types.Transaction)
+	err = rlp.DecodeBytes(rawTx, signedTx)
+	if err != nil {
+		return err
+	}
+
+	err = s.sender.SendTransaction(signedTx)
+	if err != nil && isKnownTransactionError(err) {
+		return nil
+	}
+	return err
+}
+
+// 节点已经收到过这笔交易
+func isKnownTransactionError(err error) bool {
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "already known") || strings.Contains(message, "known transaction")
+}
+
+// 使用发送账户的下一个nonce和当前的gas price签名结算交易
+func (s *Settler) signTransaction(transaction *models.Transaction) (*types.Transaction, error) {
+	nonce, err := s.sender.GetNonce(s.signer.GetAddress())
+	if err != nil {
+		return nil, err
+	}
+	if nonce < s.nextNonce {
+		nonce = s.nextNonce
+	}
+	gasPrice, err := s.sender.GetGasPrice()
+	if err != nil {
+		return nil, err
+	}
+	data, err := hexutil.Decode(transaction.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// 之前版本的结算交易没有记录接收地址
+	to := s.exchangeAddress
+	if len(transaction.To) > 0 {
+		to = common.HexToAddress(transaction.To)
+	}
+	// batchFillOrders填充两个订单，需要支付两份protocol fee
+	value := new(big.Int)
+	if transaction.Type != models.TransactionTypeRebate {
+		value.Mul(gasPrice, big.NewInt(2*protocolFeeMultiplier))
+	}
+	tx := types.NewTransaction(nonce, to, value, s.gasLimit, gasPrice, data)
+	return s.signer.SignTransaction(tx)
+}
+
+// 检查所有pending交易的回执，没有签名的交易签名后发送，还没有被打包的交易重新广播
+func (s *Settler) confirmTransactions() error {
+	transactions, err := service.GetTransactionsByStatus(models.TransactionStatusPending)
+	if err != nil {
+		return err
+	}
+
+	for _, transaction := range transactions {
+		if len(transaction.Hash) == 0 {
+			err = s.sendTransaction(transaction)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		receipt, err := s.sender.GetTransactionReceipt(common.HexToHash(transaction.Hash))
+		if err != nil {
+			return err
+		}
+		if receipt == nil {
+			// 之前版本广播成功后才保存hash，没有保存签名后的交易
+			if len(transaction.RawTx) > 0 {
+				err = s.broadcastTransaction(transaction)
+				if err != nil {
+					logger.Warnf("rebroadcast transaction %v error: %v", transaction.Id, err)
+				}
+			}
+			continue
+		}
+
+		if receipt.Status == types.ReceiptStatusSuccessful {
+			transaction.Status = models.TransactionStatusCompleted
+			err = s.addRebate(transaction)
+			if err != nil {
+				return err
+			}
+		} else {
+			transaction.Status = models.TransactionStatusFailed
+			logger.Warnf("settlement transaction %v of trade %v failed: %v",
+				transaction.Id, transaction.TradeId, transaction.Hash)
+		}
+		err = service.UpdateTransaction(transaction)
+		if err != nil {
+			return err
+		}
+
+		// 交易状态保存之后再累加成交量，保存失败重新确认时不会重复累加
+		if transaction.Status == models.TransactionStatusCompleted {
+			err = service.AddTradeVolume(transaction)
+			if err != nil {
+				logger.Errorf("add volume of trade %v error: %v", transaction.TradeId, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 结算交易完成后创建退款交易，由下一次检查发送。无法构造的退款交易记录为invalid，需要人工处理
+func (s *Settler) addRebate(settlement *models.Transaction) error {
+	if settlement.Type == models.TransactionTypeRebate || !settlement.Rebate.IsPositive() {
+		return nil
+	}
+
+	rebate, err := newRebateTransaction(settlement)
+	if err != nil {
+		logger.Errorf("build rebate of trade %v error: %v", settlement.TradeId, err)
+		rebate = &models.Transaction{
+			ProductId:    settlement.ProductId,
+			TradeId:      settlement.TradeId,
+			LogSeq:       settlement.LogSeq,
+			LogOffset:    settlement.LogOffset,
+			MakerOrderId: settlement.MakerOrderId,
+			TakerOrderId: settlement.TakerOrderId,
+			Type:         models.TransactionTypeRebate,
+			Rebate:       settlement.Rebate,
+			Status:       models.TransactionStatusInvalid,
+		}
+	}
+	return service.AddTransaction(rebate)
+}
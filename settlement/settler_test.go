@@ -0,0 +1,389 @@
+package settlement
+
+import (
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/chain/testnode"
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+	"github.com/zimengpan/go-boomflow/zeroex"
+)
+
+const (
+	testChainId           = 1337
+	testExchangeAddress   = "0x48bacb9266a570d521063ef5dd96e61686dbe788"
+	testErc20ProxyAddress = "0x1dc4c1cefef38a777b15aa20260a54e584b16c48"
+	testPrivateKey        = "0x4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d"
+	testMakerAddress      = "0x1D297954F3a6C293DDDe068BD462c1d5761de089"
+	testTakerAddress      = "0x7fD7F7b5dD5EA1C3E1e5D4C2FE8dAD8a2e8F8e6B"
+	zeroAddress           = "0x0000000000000000000000000000000000000000"
+	testBaseToken         = "0xe41d2489571d322189246dafa5ebde1f4699f498"
+	testQuoteToken        = "0x6b175474e89094c44da98b954eedeac495271d0f"
+)
+
+// 结算测试使用的base(18位小数)和quote(6位小数)，都是ERC20
+var (
+	testBaseAsset  = &models.Asset{Currency: "A", AssetData: "0xf47261b0000000000000000000000000" + testBaseToken[2:], Decimals: 18}
+	testQuoteAsset = &models.Asset{Currency: "C", AssetData: "0xf47261b0000000000000000000000000" + testQuoteToken[2:], Decimals: 6}
+)
+
+// 结算交易保存在进程内存中，不连接redis
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "settlement")
+	if err != nil {
+		panic(err)
+	}
+	configPath := filepath.Join(dir, "conf.json")
+	err = ioutil.WriteFile(configPath, []byte("{}"), 0644)
+	if err != nil {
+		panic(err)
+	}
+	conf.SetConfigPath(configPath)
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newTestOrder(maker string, side models.Side, size, price int64, salt int64) *models.Order {
+	baseAmount := decimal.New(size, testBaseAsset.Decimals)
+	quoteAmount := decimal.New(size*price, testQuoteAsset.Decimals)
+	order := &models.Order{
+		MakerAddress:          maker,
+		TakerAddress:          zeroAddress,
+		FeeRecipientAddress:   zeroAddress,
+		SenderAddress:         zeroAddress,
+		MakerFee:              decimal.Zero,
+		TakerFee:              decimal.Zero,
+		ExpirationTimeSeconds: decimal.New(1792499797, 0),
+		Salt:                  decimal.New(salt, 0),
+		Side:                  side,
+		ProductId:             "1",
+		Signature:             "0x01",
+	}
+	if side == models.SideSell {
+		order.MakerAssetAmount, order.TakerAssetAmount = baseAmount, quoteAmount
+		order.MakerAssetData, order.TakerAssetData = testBaseAsset.AssetData, testQuoteAsset.AssetData
+	} else {
+		order.MakerAssetAmount, order.TakerAssetAmount = quoteAmount, baseAmount
+		order.MakerAssetData, order.TakerAssetData = testQuoteAsset.AssetData, testBaseAsset.AssetData
+	}
+	return order
+}
+
+func newTestMatchLog(size, price int64) *match.MatchLog {
+	return &match.MatchLog{
+		Base:  match.Base{Type: match.LogTypeMatch, Sequence: 1, ProductId: "1", Time: time.Now()},
+		Size:  decimal.New(size, 0),
+		Price: decimal.New(price, 0),
+	}
+}
+
+func getFilledAmount(t *testing.T, node *testnode.Node, order *models.Order) *big.Int {
+	t.Helper()
+
+	o, err := zeroex.NewOrder(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filled, err := node.State.GetFilledAmount(o.Hash(testChainId, common.HexToAddress(testExchangeAddress)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filled
+}
+
+func units(amount int64, decimals int32) *big.Int {
+	return new(big.Int).Mul(big.NewInt(amount), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+}
+
+// 解析batchFillOrders的calldata，返回两个订单的填充数量
+func decodeFillAmounts(t *testing.T, data []byte) []*big.Int {
+	t.Helper()
+
+	method, err := zeroex.ExchangeABI.MethodById(data[:4])
+	if err != nil {
+		t.Fatal(err)
+	}
+	args, err := method.Inputs.Unpack(data[4:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return args[1].([]*big.Int)
+}
+
+func TestGetSettlementAmounts(t *testing.T) {
+	tests := []struct {
+		name      string
+		makerSide models.Side
+		// taker订单的makerAssetAmount和takerAssetAmount
+		takerMaker, takerTaker *big.Int
+		size, price            int64
+		makerFill, takerFill   *big.Int
+		rebate                 *big.Int
+	}{
+		{
+			// taker以4的价格买入3个A，按照3成交1个A，多支付的1个C退还
+			name: "taker buys above the price", makerSide: models.SideSell,
+			takerMaker: units(12, 6), takerTaker: units(3, 18), size: 1, price: 3,
+			makerFill: units(3, 6), takerFill: units(1, 18), rebate: units(1, 6),
+		},
+		{
+			// taker以3的价格卖出3个A，按照4成交1个A，发送账户只需要支付3个C买入1个A，少收到的1个C退还
+			name: "taker sells below the price", makerSide: models.SideBuy,
+			takerMaker: units(3, 18), takerTaker: units(9, 6), size: 1, price: 4,
+			makerFill: units(1, 18), takerFill: units(3, 6), rebate: units(1, 6),
+		},
+		{
+			name: "same price", makerSide: models.SideSell,
+			takerMaker: units(9, 6), takerTaker: units(3, 18), size: 1, price: 3,
+			makerFill: units(3, 6), takerFill: units(1, 18), rebate: new(big.Int),
+		},
+		{
+			// taker支付的quote向下取整，少于成交金额时不退还
+			name: "taker pays rounded down", makerSide: models.SideSell,
+			takerMaker: big.NewInt(10000001), takerTaker: units(3, 18), size: 1, price: 3,
+			makerFill: units(3, 6), takerFill: units(1, 18), rebate: big.NewInt(333333),
+		},
+		{
+			// 向taker支付的quote向上取整
+			name: "taker receives rounded up", makerSide: models.SideBuy,
+			takerMaker: units(3, 18), takerTaker: big.NewInt(10000001), size: 1, price: 4,
+			makerFill: units(1, 18), takerFill: big.NewInt(3333334), rebate: big.NewInt(666666),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			takerOrder := &zeroex.Order{MakerAssetAmount: test.takerMaker, TakerAssetAmount: test.takerTaker}
+			amounts, err := getSettlementAmounts(newTestMatchLog(test.size, test.price), test.makerSide, takerOrder,
+				testBaseAsset, testQuoteAsset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if amounts.makerFill.Cmp(test.makerFill) != 0 || amounts.takerFill.Cmp(test.takerFill) != 0 ||
+				amounts.rebate.Cmp(test.rebate) != 0 {
+				t.Fatalf("got fills %v %v rebate %v, expected %v %v rebate %v", amounts.makerFill, amounts.takerFill,
+					amounts.rebate, test.makerFill, test.takerFill, test.rebate)
+			}
+		})
+	}
+
+	// 不足一个最小单位的成交无法结算
+	_, err := getSettlementAmounts(&match.MatchLog{Size: decimal.New(1, -19), Price: decimal.New(3, 0)},
+		models.SideSell, &zeroex.Order{MakerAssetAmount: units(3, 6), TakerAssetAmount: units(1, 18)},
+		testBaseAsset, testQuoteAsset)
+	if err == nil {
+		t.Fatal("settled a trade of less than one unit")
+	}
+}
+
+// maker以3的价格卖出，taker以4的价格买入，两个订单都按照成交价格3结算，taker多支付的quote通过退款交易退还
+func TestSettleTradeOnNode(t *testing.T) {
+	node := testnode.NewNode(testChainId, testExchangeAddress, testErc20ProxyAddress)
+	url, err := node.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Stop()
+
+	signer, err := NewKeySigner(testPrivateKey, testChainId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender, err := NewEthereumSender(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settler := NewSettler(nil, testExchangeAddress, 1000000, time.Second, signer, sender)
+
+	// maker以3的价格卖出2个A，taker以4的价格买入3个A
+	makerOrder := newTestOrder(testMakerAddress, models.SideSell, 2, 3, 1)
+	takerOrder := newTestOrder(testTakerAddress, models.SideBuy, 3, 4, 2)
+
+	send := func(transaction *models.Transaction) *types.Receipt {
+		t.Helper()
+
+		tx, err := settler.signTransaction(transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = sender.SendTransaction(tx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt, err := sender.GetTransactionReceipt(tx.Hash())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt == nil {
+			t.Fatal("transaction is not mined")
+		}
+		return receipt
+	}
+	settle := func(matchLog *match.MatchLog) (*types.Receipt, []*big.Int, *big.Int) {
+		t.Helper()
+
+		data, rebate, err := settlementCalldata(matchLog, makerOrder, takerOrder, testBaseAsset, testQuoteAsset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		receipt := send(&models.Transaction{Type: models.TransactionTypeSettlement, Data: hexutil.Encode(data)})
+		return receipt, decodeFillAmounts(t, data), rebate
+	}
+
+	// 成交1个A，maker收到3个C，taker收到1个A并支付4个C
+	receipt, fills, rebate := settle(newTestMatchLog(1, 3))
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("settlement failed")
+	}
+	if !decimal.NewFromBigInt(fills[0], 0).Equal(decimal.New(3, 6)) ||
+		!decimal.NewFromBigInt(fills[1], 0).Equal(decimal.New(1, 18)) {
+		t.Fatalf("encoded fills %v, expected [3e6 1e18]", fills)
+	}
+	if !decimal.NewFromBigInt(rebate, 0).Equal(decimal.New(1, 6)) {
+		t.Fatalf("rebate %v, expected 1e6", rebate)
+	}
+	if filled := getFilledAmount(t, node, makerOrder); !decimal.NewFromBigInt(filled, 0).Equal(decimal.New(3, 6)) {
+		t.Fatalf("maker order filled %v, expected 3e6", filled)
+	}
+	if filled := getFilledAmount(t, node, takerOrder); !decimal.NewFromBigInt(filled, 0).Equal(decimal.New(1, 18)) {
+		t.Fatalf("taker order filled %v, expected 1e18", filled)
+	}
+
+	// 发送账户把多收的1个C转给taker
+	quoteToken := common.HexToAddress(testQuoteToken)
+	node.State.SetBalance(quoteToken, signer.GetAddress(), units(5, 6))
+	data, err := zeroex.TransferCalldata(common.HexToAddress(takerOrder.MakerAddress), rebate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receipt = send(&models.Transaction{Type: models.TransactionTypeRebate, To: testQuoteToken, Data: hexutil.Encode(data)})
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Fatal("rebate failed")
+	}
+	balance, err := node.State.GetBalance(quoteToken, common.HexToAddress(testTakerAddress))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Cmp(rebate) != 0 {
+		t.Fatalf("taker received %v, expected %v", balance, rebate)
+	}
+
+	// maker订单只剩1个A
+	receipt, _, _ = settle(newTestMatchLog(2, 3))
+	if receipt.Status != types.ReceiptStatusFailed {
+		t.Fatal("settled more than the maker order has left")
+	}
+	if filled := getFilledAmount(t, node, makerOrder); !decimal.NewFromBigInt(filled, 0).Equal(decimal.New(3, 6)) {
+		t.Fatalf("maker order filled %v after a failed settlement, expected 3e6", filled)
+	}
+}
+
+// 前failures次广播失败
+type failingSender struct {
+	TransactionSender
+	failures int
+}
+
+func (s *failingSender) SendTransaction(tx *types.Transaction) error {
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("connection refused")
+	}
+	return s.TransactionSender.SendTransaction(tx)
+}
+
+// 广播失败的交易在确认时重新广播同一笔签名交易，不会重新签名，后面的交易也不会复用它的nonce
+func TestRebroadcastSignedTransaction(t *testing.T) {
+	node := testnode.NewNode(testChainId, testExchangeAddress, testErc20ProxyAddress)
+	url, err := node.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer node.Stop()
+
+	signer, err := NewKeySigner(testPrivateKey, testChainId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ethereumSender, err := NewEthereumSender(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender := &failingSender{TransactionSender: ethereumSender, failures: 1}
+	settler := NewSettler(nil, testExchangeAddress, 1000000, time.Second, signer, sender)
+
+	makerOrder := newTestOrder(testMakerAddress, models.SideSell, 2, 3, 11)
+	takerOrder := newTestOrder(testTakerAddress, models.SideBuy, 2, 3, 12)
+	var transactions []*models.Transaction
+	for i := 0; i < 2; i++ {
+		data, _, err := settlementCalldata(newTestMatchLog(1, 3), makerOrder, takerOrder, testBaseAsset, testQuoteAsset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transaction := &models.Transaction{
+			ProductId: "1",
+			TradeId:   int64(i + 1),
+			Type:      models.TransactionTypeSettlement,
+			To:        testExchangeAddress,
+			Data:      hexutil.Encode(data),
+			Status:    models.TransactionStatusPending,
+		}
+		err = service.AddTransaction(transaction)
+		if err != nil {
+			t.Fatal(err)
+		}
+		transactions = append(transactions, transaction)
+	}
+
+	// 第一笔广播失败，第二笔的nonce在第一笔之后，节点要求按照nonce的顺序接收
+	if err := settler.sendTransaction(transactions[0]); err == nil {
+		t.Fatal("broadcast did not fail")
+	}
+	if err := settler.sendTransaction(transactions[1]); err == nil {
+		t.Fatal("node accepted a nonce gap")
+	}
+	pending, err := service.GetTransactionsByStatus(models.TransactionStatusPending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || len(pending[0].RawTx) == 0 || pending[0].Nonce != 0 || pending[1].Nonce != 1 {
+		t.Fatalf("signed transactions were not saved before the broadcast: %+v", pending)
+	}
+	hashes := []string{pending[0].Hash, pending[1].Hash}
+
+	// 第一次确认重新广播，第二次确认得到回执
+	for i := 0; i < 2; i++ {
+		err = settler.confirmTransactions()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(node.GetTransactions()) != 2 {
+		t.Fatalf("node received %v transactions, expected 2", len(node.GetTransactions()))
+	}
+	for i, tx := range node.GetTransactions() {
+		if tx.Hash().Hex() != hashes[i] {
+			t.Fatalf("transaction %v was signed again", i)
+		}
+	}
+	completed, err := service.GetTransactionsByStatus(models.TransactionStatusCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(completed) != 2 {
+		t.Fatalf("%v transactions completed, expected 2", len(completed))
+	}
+}
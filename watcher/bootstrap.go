@@ -0,0 +1,80 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/zimengpan/go-boomflow/conf"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+var logger = logging.New("watcher")
+
+func StartOrderWatcher() {
+	gbeConfig := conf.GetConfig()
+
+	provider := service.GetChainStateProvider()
+	if provider == nil {
+		logger.Warn("no chain state provider, order watcher not started")
+		return
+	}
+
+	interval := time.Duration(gbeConfig.OrderWatcher.Interval) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+
+	orderWatcher := NewOrderWatcher(provider, interval, match.SubmitCancel)
+	orderWatcher.Start()
+
+	logger.Info("order watcher ok")
+}
+
+// 每个api进程都读取所有product的撮合日志，根据open log和done log更新订单状态
+func StartOrderStatusUpdater() {
+	gbeConfig := conf.GetConfig()
+
+	products, err := service.GetProducts()
+	if err != nil {
+		panic(err)
+	}
+	var logReaders []match.LogReader
+	for _, product := range products {
+		logReaders = append(logReaders, match.NewKafkaLogReader(orderStatusReaderId, product.Id, gbeConfig.Kafka.Brokers))
+	}
+
+	NewOrderStatusUpdater(logReaders).Start()
+
+	logger.Info("order status updater ok")
+}
+
+// 定期向每个product的order topic提交expire command，engine会移除orderBook中所有已经过期的GTT订单。
+// 多个api进程都会提交，重复的expire command不会产生log
+func StartExpireTicker() {
+	interval := time.Duration(conf.GetConfig().OrderWatcher.ExpireInterval) * time.Second
+	if interval <= 0 {
+		logger.Info("expire ticker disabled")
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			products, err := service.GetProducts()
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			for _, product := range products {
+				err = match.SubmitCommand(product.Id, match.NewCommand(match.CommandTypeExpire, ""))
+				if err != nil {
+					logger.WithField(logging.FieldProductId, product.Id).Error(err)
+				}
+			}
+		}
+	}()
+
+	logger.Info("expire ticker ok")
+}
@@ -0,0 +1,104 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/match"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+const (
+	orderStatusReaderId = "order_status"
+
+	// 更新订单状态失败时重试的间隔，不能跳过撮合日志
+	orderStatusRetryInterval = time.Second
+)
+
+// 读取撮合日志更新订单状态：open log将新订单更新为open，done log将订单更新为filled或者cancelled。
+// 每个api进程都会读取，订单处于预期的状态时才会更新，重复处理同一条log没有影响
+type OrderStatusUpdater struct {
+	logReaders []match.LogReader
+}
+
+func NewOrderStatusUpdater(logReaders []match.LogReader) *OrderStatusUpdater {
+	u := &OrderStatusUpdater{logReaders: logReaders}
+	for _, logReader := range logReaders {
+		logReader.RegisterObserver(u)
+	}
+	return u
+}
+
+// 从上次处理的撮合日志之后继续读取
+func (u *OrderStatusUpdater) Start() {
+	for _, logReader := range u.logReaders {
+		seq, offset, found, err := service.GetLogOffset(orderStatusReaderId, logReader.GetProductId())
+		if err != nil {
+			panic(err)
+		}
+		if found {
+			go logReader.Run(seq, offset+1)
+		} else {
+			go logReader.Run(0, 0)
+		}
+	}
+}
+
+func (u *OrderStatusUpdater) OnOpenLog(log *match.OpenLog, offset int64) {
+	u.updateStatus(log.OrderId, []models.OrderStatus{models.OrderStatusNew}, models.OrderStatusOpen)
+	u.saveOffset(log.ProductId, log.Sequence, offset)
+}
+
+func (u *OrderStatusUpdater) OnMatchLog(log *match.MatchLog, offset int64) {
+	// do nothing
+}
+
+func (u *OrderStatusUpdater) OnDoneLog(log *match.DoneLog, offset int64) {
+	// 重复提交的订单被拒绝，不影响之前提交的同一个订单
+	if log.Reason != models.DoneReasonDuplicated {
+		status := models.OrderStatusCancelled
+		if log.Reason == models.DoneReasonFilled {
+			status = models.OrderStatusFilled
+		}
+		// 订单可能没有open log直接done，也可能在撤单的过程中成交
+		u.updateStatus(log.OrderId, []models.OrderStatus{models.OrderStatusNew, models.OrderStatusOpen,
+			models.OrderStatusCancelling}, status)
+	}
+	u.saveOffset(log.ProductId, log.Sequence, offset)
+}
+
+func (u *OrderStatusUpdater) OnActivatedLog(log *match.ActivatedLog, offset int64) {
+	// do nothing
+}
+
+// 订单处于oldStatuses中的一个状态时更新为newStatus，已经是其他状态时忽略
+func (u *OrderStatusUpdater) updateStatus(orderId int64, oldStatuses []models.OrderStatus, newStatus models.OrderStatus) {
+	for _, oldStatus := range oldStatuses {
+		for {
+			updated, err := service.UpdateOrderStatus(orderId, oldStatus, newStatus)
+			if err != nil {
+				logger.WithField(logging.FieldOrderId, orderId).Errorf("update order status error: %v", err)
+				time.Sleep(orderStatusRetryInterval)
+				continue
+			}
+			if updated {
+				logger.WithFields(logrus.Fields{
+					logging.FieldOrderId: orderId,
+					"status":             newStatus,
+				}).Debug("order status updated")
+				return
+			}
+			break
+		}
+	}
+}
+
+// 位置保存失败时只记录日志，重启后重新处理的log不会改变订单状态
+func (u *OrderStatusUpdater) saveOffset(productId string, seq, offset int64) {
+	err := service.SaveLogOffset(orderStatusReaderId, productId, seq, offset)
+	if err != nil {
+		logger.WithField(logging.FieldProductId, productId).Errorf("save log offset error: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/zimengpan/go-boomflow/chain"
+	"github.com/zimengpan/go-boomflow/logging"
+	"github.com/zimengpan/go-boomflow/models"
+	"github.com/zimengpan/go-boomflow/service"
+)
+
+// 定期检查所有未完成订单在链上是否仍然可以成交，
+// maker转走资产、撤销授权或者在链上取消的订单会被从orderBook中撤销
+type OrderWatcher struct {
+	provider chain.ChainStateProvider
+
+	// 检查的间隔
+	interval time.Duration
+
+	// 将撤单请求提交给engine
+	submitter func(order *models.Order, reason models.DoneReason, requestId string) error
+
+	// 上一次检查时的区块高度，区块高度不变时不需要重新检查
+	blockNumber uint64
+}
+
+func NewOrderWatcher(provider chain.ChainStateProvider, interval time.Duration,
+	submitter func(order *models.Order, reason models.DoneReason, requestId string) error) *OrderWatcher {
+	return &OrderWatcher{
+		provider:  provider,
+		interval:  interval,
+		submitter: submitter,
+	}
+}
+
+func (w *OrderWatcher) Start() {
+	go w.runChecker()
+}
+
+// 每个interval检查一次，只有产生了新的区块才检查订单
+func (w *OrderWatcher) runChecker() {
+	for {
+		time.Sleep(w.interval)
+
+		blockNumber, err := w.provider.GetBlockNumber()
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if blockNumber == w.blockNumber {
+			continue
+		}
+
+		err = w.CheckOrders()
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		w.blockNumber = blockNumber
+	}
+}
+
+// 检查所有未完成的订单，撤销无法再成交的订单
+func (w *OrderWatcher) CheckOrders() error {
+	orders, err := service.GetOrdersByUserId("", []models.OrderStatus{models.OrderStatusNew, models.OrderStatusOpen},
+		nil, "", 0, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	// 所有订单的链上状态在一个batch请求中读取，同一个maker的订单一起检查余额
+	states, err := service.GetOrderFundStates(w.provider, orders)
+	if err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		// 已经在链上全部成交的订单，等待done log更新状态
+		if states[order.Id] != service.OrderFundStateUnfunded {
+			continue
+		}
+
+		err = w.cancelOrder(order)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 先将订单标记为cancelling，再提交给engine撤单，engine的done log将订单更新为cancelled，
+// 撤单到达之前已经成交的订单更新为filled
+func (w *OrderWatcher) cancelOrder(order *models.Order) error {
+	status := order.Status
+	updated, err := service.UpdateOrderStatus(order.Id, status, models.OrderStatusCancelling)
+	if err != nil {
+		return err
+	}
+	if !updated {
+		// 订单状态已经发生了变化，由下一次检查处理
+		return nil
+	}
+
+	err = w.submitter(order, models.DoneReasonUnfunded, "")
+	if err != nil {
+		_, _ = service.UpdateOrderStatus(order.Id, models.OrderStatusCancelling, status)
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
+		logging.FieldOrderId:   order.Id,
+		logging.FieldOrderHash: order.Hash,
+		logging.FieldMaker:     order.MakerAddress,
+	}).Info("unfunded order cancelling")
+	return nil
+}
@@ -0,0 +1,67 @@
+package zeroex
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const (
+	erc20ABIJSON = `[
+		{"constant":true,"inputs":[{"name":"_owner","type":"address"}],"name":"balanceOf","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+		{"constant":true,"inputs":[{"name":"_owner","type":"address"},{"name":"_spender","type":"address"}],"name":"allowance","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+		{"constant":false,"inputs":[{"name":"_to","type":"address"},{"name":"_value","type":"uint256"}],"name":"transfer","outputs":[{"name":"","type":"bool"}],"type":"function"}
+	]`
+
+	orderTupleArrayJSON = `{"name":"%v","type":"tuple[]","components":[
+		{"name":"makerAddress","type":"address"},
+		{"name":"takerAddress","type":"address"},
+		{"name":"feeRecipientAddress","type":"address"},
+		{"name":"senderAddress","type":"address"},
+		{"name":"makerAssetAmount","type":"uint256"},
+		{"name":"takerAssetAmount","type":"uint256"},
+		{"name":"makerFee","type":"uint256"},
+		{"name":"takerFee","type":"uint256"},
+		{"name":"expirationTimeSeconds","type":"uint256"},
+		{"name":"salt","type":"uint256"},
+		{"name":"makerAssetData","type":"bytes"},
+		{"name":"takerAssetData","type":"bytes"},
+		{"name":"makerFeeAssetData","type":"bytes"},
+		{"name":"takerFeeAssetData","type":"bytes"}
+	]}`
+
+	fillResultsArrayJSON = `{"name":"%v","type":"tuple[]","components":[
+		{"name":"makerAssetFilledAmount","type":"uint256"},
+		{"name":"takerAssetFilledAmount","type":"uint256"},
+		{"name":"makerFeePaid","type":"uint256"},
+		{"name":"takerFeePaid","type":"uint256"},
+		{"name":"protocolFeePaid","type":"uint256"}
+	]}`
+)
+
+var (
+	exchangeABIJSON = `[
+		{"constant":true,"inputs":[{"name":"","type":"bytes32"}],"name":"filled","outputs":[{"name":"","type":"uint256"}],"type":"function"},
+		{"constant":true,"inputs":[{"name":"","type":"bytes32"}],"name":"cancelled","outputs":[{"name":"","type":"bool"}],"type":"function"},
+		{"constant":false,"inputs":[` + fmt.Sprintf(orderTupleArrayJSON, "orders") + `,
+			{"name":"takerAssetFillAmounts","type":"uint256[]"},{"name":"signatures","type":"bytes[]"}],
+			"name":"batchFillOrders","outputs":[` + fmt.Sprintf(fillResultsArrayJSON, "fillResults") + `],"payable":true,"type":"function"}
+	]`
+)
+
+var (
+	// ERC20ABI is the part of the ERC20 token interface used to check the funds of makers and to refund takers
+	ERC20ABI = mustParseABI(erc20ABIJSON)
+
+	// ExchangeABI is the part of the 0x v3 exchange contract used by the relayer
+	ExchangeABI = mustParseABI(exchangeABIJSON)
+)
+
+func mustParseABI(json string) abi.ABI {
+	parsed, err := abi.JSON(strings.NewReader(json))
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
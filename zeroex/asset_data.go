@@ -0,0 +1,27 @@
+package zeroex
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var (
+	// bytes4(keccak256("ERC20Token(address)"))
+	ERC20AssetProxyId = []byte{0xf4, 0x72, 0x61, 0xb0}
+)
+
+// DecodeERC20AssetData returns the token address of ERC20 asset data, an error for other asset proxies
+func DecodeERC20AssetData(assetData string) (common.Address, error) {
+	data, err := hexutil.Decode(assetData)
+	if err != nil {
+		return common.Address{}, errors.New(fmt.Sprintf("invalid asset data %v: %v", assetData, err))
+	}
+	if len(data) != 36 || !bytes.Equal(data[:4], ERC20AssetProxyId) {
+		return common.Address{}, errors.New(fmt.Sprintf("unsupported asset data: %v", assetData))
+	}
+	return common.BytesToAddress(data[4:]), nil
+}
@@ -0,0 +1,37 @@
+package zeroex
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// BatchFillOrdersCalldata encodes the exchange call that fills each order with its takerAssetFillAmount of the
+// taker asset, in the given order and in one transaction. The sender of the transaction is the taker of every fill,
+// a fill fails when the order has less than the amount left
+func BatchFillOrdersCalldata(orders []*Order, takerAssetFillAmounts []*big.Int, signatures []string) ([]byte, error) {
+	if len(orders) != len(takerAssetFillAmounts) || len(orders) != len(signatures) {
+		return nil, errors.New(fmt.Sprintf("%v orders with %v fill amounts and %v signatures",
+			len(orders), len(takerAssetFillAmounts), len(signatures)))
+	}
+
+	values := make([]Order, len(orders))
+	sigs := make([][]byte, len(signatures))
+	for i, order := range orders {
+		values[i] = *order
+		sig, err := hexutil.Decode(signatures[i])
+		if err != nil {
+			return nil, err
+		}
+		sigs[i] = sig
+	}
+	return ExchangeABI.Pack("batchFillOrders", values, takerAssetFillAmounts, sigs)
+}
+
+// TransferCalldata encodes the ERC20 call that transfers amount of the token from the sender of the transaction
+func TransferCalldata(to common.Address, amount *big.Int) ([]byte, error) {
+	return ERC20ABI.Pack("transfer", to, amount)
+}
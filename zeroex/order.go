@@ -0,0 +1,168 @@
+package zeroex
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/shopspring/decimal"
+	"github.com/zimengpan/go-boomflow/models"
+)
+
+const (
+	eip712DomainSchema  = "EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"
+	eip712DomainName    = "0x Protocol"
+	eip712DomainVersion = "3.0.0"
+
+	orderSchema = "Order(" +
+		"address makerAddress," +
+		"address takerAddress," +
+		"address feeRecipientAddress," +
+		"address senderAddress," +
+		"uint256 makerAssetAmount," +
+		"uint256 takerAssetAmount," +
+		"uint256 makerFee," +
+		"uint256 takerFee," +
+		"uint256 expirationTimeSeconds," +
+		"uint256 salt," +
+		"bytes makerAssetData," +
+		"bytes takerAssetData," +
+		"bytes makerFeeAssetData," +
+		"bytes takerFeeAssetData" +
+		")"
+)
+
+var (
+	eip712DomainSchemaHash = crypto.Keccak256([]byte(eip712DomainSchema))
+	orderSchemaHash        = crypto.Keccak256([]byte(orderSchema))
+)
+
+// Order is a 0x v3 order exactly as it is signed by the maker and filled by the exchange contract
+type Order struct {
+	MakerAddress          common.Address
+	TakerAddress          common.Address
+	FeeRecipientAddress   common.Address
+	SenderAddress         common.Address
+	MakerAssetAmount      *big.Int
+	TakerAssetAmount      *big.Int
+	MakerFee              *big.Int
+	TakerFee              *big.Int
+	ExpirationTimeSeconds *big.Int
+	Salt                  *big.Int
+	MakerAssetData        []byte
+	TakerAssetData        []byte
+	MakerFeeAssetData     []byte
+	TakerFeeAssetData     []byte
+}
+
+func NewOrder(order *models.Order) (*Order, error) {
+	o := &Order{}
+
+	addresses := []struct {
+		dst *common.Address
+		src string
+	}{
+		{&o.MakerAddress, order.MakerAddress},
+		{&o.TakerAddress, order.TakerAddress},
+		{&o.FeeRecipientAddress, order.FeeRecipientAddress},
+		{&o.SenderAddress, order.SenderAddress},
+	}
+	for _, address := range addresses {
+		if !common.IsHexAddress(address.src) {
+			return nil, errors.New(fmt.Sprintf("invalid address: %v", address.src))
+		}
+		*address.dst = common.HexToAddress(address.src)
+	}
+
+	amounts := []struct {
+		dst **big.Int
+		src decimal.Decimal
+	}{
+		{&o.MakerAssetAmount, order.MakerAssetAmount},
+		{&o.TakerAssetAmount, order.TakerAssetAmount},
+		{&o.MakerFee, order.MakerFee},
+		{&o.TakerFee, order.TakerFee},
+		{&o.ExpirationTimeSeconds, order.ExpirationTimeSeconds},
+		{&o.Salt, order.Salt},
+	}
+	for _, amount := range amounts {
+		value, err := DecimalToUint256(amount.src)
+		if err != nil {
+			return nil, err
+		}
+		*amount.dst = value
+	}
+
+	assetData := []struct {
+		dst *[]byte
+		src string
+	}{
+		{&o.MakerAssetData, order.MakerAssetData},
+		{&o.TakerAssetData, order.TakerAssetData},
+		{&o.MakerFeeAssetData, order.MakerFeeAssetData},
+		{&o.TakerFeeAssetData, order.TakerFeeAssetData},
+	}
+	for _, data := range assetData {
+		// fee asset data is empty when the order has no fee
+		if len(data.src) == 0 || data.src == "0x" {
+			*data.dst = []byte{}
+			continue
+		}
+		value, err := hexutil.Decode(data.src)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("invalid asset data %v: %v", data.src, err))
+		}
+		*data.dst = value
+	}
+
+	return o, nil
+}
+
+// Hash returns the EIP-712 hash of the order, which identifies the order on the exchange contract
+func (o *Order) Hash(chainId int64, exchangeAddress common.Address) common.Hash {
+	structHash := crypto.Keccak256(
+		orderSchemaHash,
+		common.LeftPadBytes(o.MakerAddress.Bytes(), 32),
+		common.LeftPadBytes(o.TakerAddress.Bytes(), 32),
+		common.LeftPadBytes(o.FeeRecipientAddress.Bytes(), 32),
+		common.LeftPadBytes(o.SenderAddress.Bytes(), 32),
+		common.LeftPadBytes(o.MakerAssetAmount.Bytes(), 32),
+		common.LeftPadBytes(o.TakerAssetAmount.Bytes(), 32),
+		common.LeftPadBytes(o.MakerFee.Bytes(), 32),
+		common.LeftPadBytes(o.TakerFee.Bytes(), 32),
+		common.LeftPadBytes(o.ExpirationTimeSeconds.Bytes(), 32),
+		common.LeftPadBytes(o.Salt.Bytes(), 32),
+		crypto.Keccak256(o.MakerAssetData),
+		crypto.Keccak256(o.TakerAssetData),
+		crypto.Keccak256(o.MakerFeeAssetData),
+		crypto.Keccak256(o.TakerFeeAssetData),
+	)
+
+	return common.BytesToHash(crypto.Keccak256(
+		[]byte("\x19\x01"),
+		domainHash(chainId, exchangeAddress),
+		structHash,
+	))
+}
+
+func domainHash(chainId int64, exchangeAddress common.Address) []byte {
+	return crypto.Keccak256(
+		eip712DomainSchemaHash,
+		crypto.Keccak256([]byte(eip712DomainName)),
+		crypto.Keccak256([]byte(eip712DomainVersion)),
+		common.LeftPadBytes(big.NewInt(chainId).Bytes(), 32),
+		common.LeftPadBytes(exchangeAddress.Bytes(), 32),
+	)
+}
+
+// DecimalToUint256 converts an integer amount to the uint256 used by the contracts
+func DecimalToUint256(d decimal.Decimal) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(d.String(), 10)
+	if !ok || value.Sign() < 0 || value.BitLen() > 256 {
+		return nil, errors.New(fmt.Sprintf("invalid uint256: %v", d))
+	}
+	return value, nil
+}
@@ -0,0 +1,55 @@
+package zeroex
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	// signature of the EIP-712 order hash
+	SignatureTypeEIP712 = 0x02
+
+	// signature of the order hash prefixed by "\x19Ethereum Signed Message:\n32", as signed by eth_sign
+	SignatureTypeEthSign = 0x03
+
+	// v, r, s followed by the signature type
+	ecSignatureLength = 66
+)
+
+// RecoverOrderSigner returns the address that signed the order hash. Only EIP712 and EthSign signatures are
+// supported, the other 0x signature types are validated by a contract or a wallet and can't be checked offline
+func RecoverOrderSigner(orderHash common.Hash, signature string) (common.Address, error) {
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		return common.Address{}, errors.New(fmt.Sprintf("invalid signature %v: %v", signature, err))
+	}
+	if len(sig) != ecSignatureLength {
+		return common.Address{}, errors.New(fmt.Sprintf("invalid signature length: %v", len(sig)))
+	}
+
+	var hash []byte
+	switch sig[65] {
+	case SignatureTypeEIP712:
+		hash = orderHash.Bytes()
+	case SignatureTypeEthSign:
+		hash = crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n32"), orderHash.Bytes())
+	default:
+		return common.Address{}, errors.New(fmt.Sprintf("unsupported signature type: %v", sig[65]))
+	}
+
+	v := sig[0]
+	if v != 27 && v != 28 {
+		return common.Address{}, errors.New(fmt.Sprintf("invalid signature v: %v", v))
+	}
+	// crypto expects r, s, v with v being 0 or 1
+	rsv := append(append([]byte{}, sig[1:65]...), v-27)
+	publicKey, err := crypto.SigToPub(hash, rsv)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return crypto.PubkeyToAddress(*publicKey), nil
+}